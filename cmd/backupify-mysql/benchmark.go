@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// benchmarkCompression prints how well and how fast each codec compresses
+// the start of the dump at path.
+func benchmarkCompression(path string) {
+	sample, err := backupify.ReadBenchmarkSample(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	results, err := backupify.BenchmarkCompression(sample)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Sample: %d bytes of %s\n", len(sample), path)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "codec\tlevel\tsize\tratio\ttime\tMB/s\t")
+	for _, result := range results {
+		ratio := float64(len(sample)) / float64(max(result.Size, 1))
+		speed := float64(len(sample)) / (1 << 20) / max(result.Duration.Seconds(), 1e-9)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%s\t%.1f\t\n", result.Codec, result.Level, result.Size, ratio, result.Duration.Round(time.Millisecond), speed)
+	}
+	w.Flush()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// cdcCommand streams the binary log to the destinations until interrupted.
+func cdcCommand(args []string) {
+	fs := flag.NewFlagSet("cdc", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := backupify.RunCDC(ctx, cf.load())
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("cdc failed: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// checkCommand checks every destination for uploads and prints a table of
+// the results, exiting non-zero when one fails.
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	fs.Parse(args)
+
+	results, err := backupify.CheckDestinations(context.Background(), cf.load())
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DESTINATION\tTYPE\tSTATUS")
+	for _, result := range results {
+		status := "ok"
+		if result.Error != "" {
+			status = "FAILED: " + result.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Destination, result.Type, status)
+	}
+	w.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
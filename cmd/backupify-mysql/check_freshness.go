@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// checkFreshnessCommand exits non-zero when the newest backup is older
+// than max_backup_age_hours, for monitors that notice a backup job that
+// stopped running.
+func checkFreshnessCommand(args []string) {
+	fs := flag.NewFlagSet("check-freshness", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	maxAge := fs.Int("max-age-hours", 0, "override max_backup_age_hours")
+	fs.Parse(args)
+	config := cf.load()
+	if *maxAge > 0 {
+		config.MaxBackupAgeHours = *maxAge
+	}
+
+	results, err := backupify.CheckFreshness(context.Background(), config)
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			fmt.Printf("%s: %s\n", result.Location, result.Error)
+		case result.Newest == "":
+			fmt.Printf("%s: no backups\n", result.Location)
+		default:
+			fmt.Printf("%s: %s (%s old)\n", result.Location, result.Newest, time.Since(result.Created).Round(time.Minute))
+		}
+	}
+	if err != nil {
+		log.Fatalf("ALERT: %v", err)
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// contentsCommand lists the entries of an archive.
+func contentsCommand(args []string) {
+	fs := flag.NewFlagSet("contents", flag.ExitOnError)
+	dictionary := fs.String("dict", "", "zstd dictionary the archive was compressed with")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: contents [-dict file] <archive>")
+	}
+
+	files, err := backupify.ArchiveContents(fs.Arg(0), *dictionary)
+	for _, file := range files {
+		fmt.Printf("%s %12d %s %s\n", file.Mode, file.Size, file.ModTime.Format(time.DateTime), file.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// drainSpoolCommand uploads the files a -spool run left in spool_dir.
+func drainSpoolCommand(args []string) {
+	fs := flag.NewFlagSet("drain-spool", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	fs.Parse(args)
+
+	results, err := backupify.DrainSpool(context.Background(), cf.load())
+	if err != nil {
+		log.Fatalf("failed to drain spool: %v", err)
+	}
+	fmt.Printf("Uploaded %d files\n", len(results))
+}
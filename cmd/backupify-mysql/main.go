@@ -1,173 +1,204 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/jlaffaye/ftp"
+	"backupify-mysql/pkg/backupify"
 )
 
-type Config struct {
-	MySQLHost       string   `json:"mysql_host"`
-	MySQLUser       string   `json:"mysql_user"`
-	MySQLPassword   string   `json:"mysql_password"`
-	Databases       []string `json:"databases"`
-	BackupDirectory string   `json:"backup_directory"`
-	FTPHost         string   `json:"ftp_host"`
-	FTPUser         string   `json:"ftp_user"`
-	FTPPassword     string   `json:"ftp_password"`
-	FTPDirectory    string   `json:"ftp_directory"`
-}
+// pathList is a flag that can be repeated or given a comma-separated list.
+type pathList []string
 
-func loadConfig(filename string) (Config, error) {
-	var config Config
-	file, err := os.Open(filename)
-	if err != nil {
-		return config, err
-	}
-	defer file.Close()
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
-	return config, err
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
 }
 
-func backupDatabase(config Config, database string, outputFile string) error {
-	cmd := exec.Command(
-		"mysqldump",
-		"-h", config.MySQLHost,
-		"-u", config.MySQLUser,
-		"-p"+config.MySQLPassword,
-		database,
-	)
-	outfile, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create database copy file: %w", err)
-	}
-	defer outfile.Close()
-
-	cmd.Stdout = outfile
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to execute mysqldump: %w", err)
+func (p *pathList) Set(value string) error {
+	for _, path := range strings.Split(value, ",") {
+		if path != "" {
+			*p = append(*p, path)
+		}
 	}
 	return nil
 }
 
-func archiveFiles(files []string, archivePath string) error {
-	tarFile, err := os.Create(archivePath)
-	if err != nil {
-		return fmt.Errorf("failed to create archive: %w", err)
-	}
-	defer tarFile.Close()
-
-	gzWriter := gzip.NewWriter(tarFile)
-	defer gzWriter.Close()
+// configFlags registers the flags that control config loading on fs.
+type configFlags struct {
+	paths        pathList
+	appendSlices bool
+	allowUnknown bool
+	appVersion   string
+	profile      string
+	// logOutput is where the log wrote before load redacted it.
+	logOutput io.Writer
+}
 
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.paths, "config", "config file or directory, or env:[NAME] for JSON in an environment variable; repeat or comma-separate to merge several (default config.json)")
+	fs.BoolVar(&f.appendSlices, "config-append-slices", false, "append arrays from later config files instead of replacing them")
+	fs.BoolVar(&f.allowUnknown, "allow-unknown-config", false, "ignore unknown config keys instead of failing, e.g. for keys of newer versions")
+	fs.StringVar(&f.profile, "profile", "", "merge this profile of the config's profiles over the rest of the config")
+	fs.StringVar(&f.appVersion, "app-version", os.Getenv("BACKUPIFY_APP_VERSION"), "application version to record in archives (overrides app_version)")
+}
 
-	for _, file := range files {
-		info, err := os.Stat(file)
-		if err != nil {
-			return fmt.Errorf("failed to get file information %s: %w", file, err)
+func (f *configFlags) read() (backupify.Config, error) {
+	paths := f.paths
+	if len(paths) == 0 {
+		paths = pathList{"config.json"}
+		// Containers may inject the whole config instead of mounting it.
+		if _, err := os.Stat("config.json"); os.IsNotExist(err) && os.Getenv(backupify.EnvConfigVariable) != "" {
+			paths = pathList{"env:"}
 		}
+	}
+	config, err := backupify.LoadConfigProfile(paths, f.profile, f.appendSlices, f.allowUnknown)
+	if err == nil && f.appVersion != "" {
+		config.AppVersion = f.appVersion
+	}
+	return config, err
+}
 
-		header, err := tar.FileInfoHeader(info, info.Name())
-		if err != nil {
-			return fmt.Errorf("failed to create file header %s: %w", file, err)
-		}
+func (f *configFlags) load() backupify.Config {
+	config, err := f.read()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	f.logOutput = log.Writer()
+	f.redactLog(config)
+	return config
+}
 
-		header.Name = filepath.Base(file)
-		err = tarWriter.WriteHeader(header)
-		if err != nil {
-			return fmt.Errorf("failed to write file header into archive: %w", err)
-		}
+// redactLog makes the log redact the secrets of config, and no longer
+// those of a config loaded earlier.
+func (f *configFlags) redactLog(config backupify.Config) {
+	log.SetOutput(backupify.RedactingWriter(config, f.logOutput))
+}
 
-		fileContent, err := os.Open(file)
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %w", file, err)
-		}
-		defer fileContent.Close()
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-		_, err = io.Copy(tarWriter, fileContent)
-		if err != nil {
-			return fmt.Errorf("failed to write file %s into archive: %w", file, err)
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "serve":
+			serveCommand(os.Args[2:])
+		case "schedule":
+			scheduleCommand(os.Args[2:])
+		case "unchunk":
+			unchunkCommand(os.Args[2:])
+		case "verify":
+			verifyCommand(os.Args[2:])
+		case "restore":
+			restoreCommand(os.Args[2:])
+		case "train-dict", "train-dictionary":
+			trainDictCommand(os.Args[2:])
+		case "drain-spool":
+			drainSpoolCommand(os.Args[2:])
+		case "contents":
+			contentsCommand(os.Args[2:])
+		case "rekey":
+			rekeyCommand(os.Args[2:])
+		case "cdc":
+			cdcCommand(os.Args[2:])
+		case "check":
+			checkCommand(os.Args[2:])
+		case "check-freshness":
+			checkFreshnessCommand(os.Args[2:])
+		case "prune":
+			pruneCommand(os.Args[2:])
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
 		}
+		return
 	}
 
-	return nil
-}
-
-func uploadToFTP(config Config, localFile string) error {
-	conn, err := ftp.Dial(config.FTPHost)
-	if err != nil {
-		return fmt.Errorf("failed to connect to ftp server: %w", err)
+	var cf configFlags
+	cf.register(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	progress := flag.Bool("progress", false, "show dump progress on stderr when it is a terminal")
+	resume := flag.Bool("resume", false, "continue an interrupted run, reusing the dumps it finished")
+	events := flag.Bool("events", false, "write run events to stdout as JSON lines")
+	onlyUpload := flag.String("only-upload", "", "upload this existing archive to all destinations without dumping")
+	toStdout := flag.Bool("stdout", false, "write the archive to stdout instead of uploading it")
+	spool := flag.Bool("spool", false, "move the archive to spool_dir instead of uploading it, for drain-spool")
+	acceptSizeDrop := flag.Bool("accept-size-drop", false, "ship archives that shrank beyond size_drop_threshold_percent and compare later runs with them")
+	benchmark := flag.String("benchmark-compression", "", "compress a sample of this dump with every codec, print the results and exit")
+	flag.Parse()
+	if *benchmark != "" {
+		benchmarkCompression(*benchmark)
+		return
 	}
-	defer conn.Quit()
+	config := cf.load()
 
-	err = conn.Login(config.FTPUser, config.FTPPassword)
-	if err != nil {
-		return fmt.Errorf("failed to auth on ftp server: %w", err)
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(config.Redacted())
+		if err != nil {
+			log.Fatalf("failed to print config: %v", err)
+		}
+		return
 	}
 
-	file, err := os.Open(localFile)
-	if err != nil {
-		return fmt.Errorf("failed to open local file: %w", err)
+	config.Resume = *resume
+	config.Spool = *spool
+	config.AcceptSizeDrop = *acceptSizeDrop
+	// stdout may carry -events or -stdout.
+	if *progress && isTerminal(os.Stderr) {
+		config.Progress = os.Stderr
 	}
-	defer file.Close()
 
-	remotePath := filepath.Join(config.FTPDirectory, filepath.Base(localFile))
-	err = conn.Stor(remotePath, file)
-	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
+	if *toStdout && *events {
+		log.Fatal("-stdout and -events can't be used together")
 	}
-
-	return nil
-}
-
-func main() {
-	config, err := loadConfig("config.json")
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+	if *toStdout {
+		config.ArchiveWriter = os.Stdout
 	}
 
-	err = os.MkdirAll(config.BackupDirectory, os.ModePerm)
-	if err != nil {
-		log.Fatalf("failed to create directory for backups: %v", err)
+	if *events {
+		var mu sync.Mutex
+		encoder := json.NewEncoder(os.Stdout)
+		config.OnEvent = func(event backupify.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			encoder.Encode(event)
+		}
 	}
 
-	var backupFiles []string
-	for _, db := range config.Databases {
-		backupFile := filepath.Join(config.BackupDirectory, db+".sql")
-		fmt.Printf("creating database backup %s -> %s\n", db, backupFile)
-		err = backupDatabase(config, db, backupFile)
+	if *onlyUpload != "" {
+		_, err := backupify.UploadArchive(context.Background(), config, *onlyUpload)
 		if err != nil {
-			log.Printf("failed to backup database %s: %v", db, err)
-			continue
+			log.Fatalf("failed to upload: %v", err)
 		}
-		backupFiles = append(backupFiles, backupFile)
+		fmt.Println("Upload completed")
+		return
 	}
 
-	archivePath := filepath.Join(config.BackupDirectory, fmt.Sprintf("backup_%s.tar.gz", time.Now().Format("20060102_150405")))
-	fmt.Printf("creating archive -> %s\n", archivePath)
-	err = archiveFiles(backupFiles, archivePath)
-	if err != nil {
-		log.Fatalf("failed to archive: %v", err)
+	// A cancelled run still cleans up, e.g. its pid and status files.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	started := time.Now()
+	summary, err := backupify.Run(ctx, config)
+	if config.PrintReport && !*events && !*toStdout {
+		printReport(os.Stdout, summary, time.Since(started), err)
 	}
-
-	fmt.Printf("uploading -> %s\n", archivePath)
-	err = uploadToFTP(config, archivePath)
 	if err != nil {
-		log.Fatalf("failed to upload: %v", err)
+		log.Fatal(err)
 	}
 
-	fmt.Println("Backup completed")
+	if !*events && !*toStdout {
+		fmt.Println("Backup completed")
+	}
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// pruneCommand applies remote_keep_last without running a backup.
+func pruneCommand(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	dryRun := fs.Bool("dry-run", false, "only print what would be deleted")
+	fs.Parse(args)
+
+	results, err := backupify.Prune(context.Background(), cf.load(), *dryRun)
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	for _, result := range results {
+		for _, file := range result.Deleted {
+			fmt.Printf("%s: %s %s\n", result.Destination, verb, file)
+		}
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Destination, result.Error)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
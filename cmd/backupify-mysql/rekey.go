@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// rekeyCommand re-encrypts archives with a new key.
+func rekeyCommand(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	var opts backupify.RekeyOptions
+	fs.StringVar(&opts.DecryptCommand, "decrypt-command", "", "command that decrypts stdin with the old key")
+	fs.StringVar(&opts.EncryptCommand, "encrypt-command", "", "command that encrypts stdin with the new key")
+	fs.StringVar(&opts.VerifyCommand, "verify-command", "", "command that decrypts stdin with the new key, to check the result")
+	fs.StringVar(&opts.OutputDir, "output-dir", "", "directory to write the re-encrypted archives to (defaults to replacing them in place)")
+	fs.StringVar(&opts.SigningKeyPath, "signing-key", "", "Ed25519 private key (PEM) to sign archives that have a .sig file again")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatal("usage: rekey -decrypt-command cmd -encrypt-command cmd -verify-command cmd [-output-dir dir] [-signing-key file] <archive>...")
+	}
+
+	failed := 0
+	for _, archive := range fs.Args() {
+		target, err := backupify.RekeyArchive(archive, opts)
+		if err != nil {
+			log.Printf("failed to rekey %s: %v", archive, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Re-encrypted %s\n", target)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
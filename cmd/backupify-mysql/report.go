@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// printReport writes the print_report tables of summary to out.
+func printReport(out io.Writer, summary backupify.Summary, elapsed time.Duration, runErr error) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tSIZE\tSTATUS")
+	for _, db := range summary.Databases {
+		status := "ok"
+		switch {
+		case db.Error != "":
+			status = "FAILED: " + db.Error
+		case db.Skipped:
+			status = "skipped, unchanged"
+		case db.VerifyFailed:
+			status = "FAILED: restore check"
+		case len(db.SchemaOnlyTables) > 0:
+			status = "ok, schema only: " + strings.Join(db.SchemaOnlyTables, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", db.Name, reportSize(db.Size), status)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	archives := summary.Archives
+	if summary.Archive != "" {
+		archives = []string{summary.Archive}
+	}
+	for _, archive := range archives {
+		fmt.Fprintf(out, "Archive:  %s (%s)\n", filepath.Base(archive), reportSize(uploadedSize(summary.Uploads, archive, len(archives) == 1)))
+	}
+	if summary.SHA256 != "" {
+		fmt.Fprintf(out, "SHA256:   %s\n", summary.SHA256)
+	}
+	fmt.Fprintf(out, "Time:     %s (dump %s, archive %s, upload %s)\n", elapsed.Round(time.Second),
+		reportMS(summary.DumpMS), reportMS(summary.ArchiveMS), reportMS(summary.UploadMS))
+	if runErr != nil {
+		fmt.Fprintf(out, "Result:   FAILED: %v\n", runErr)
+	}
+
+	if len(summary.Uploads) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DESTINATION\tREMOTE PATH\tSIZE\tSTATUS")
+	for _, upload := range summary.Uploads {
+		status := "ok"
+		if upload.Error != "" {
+			status = "FAILED: " + upload.Error
+		} else if upload.Failover {
+			status = "ok, failover"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", upload.Destination, upload.RemotePath, reportSize(upload.Size), status)
+	}
+	w.Flush()
+}
+
+// uploadedSize is the size of archive as uploaded, or 0 when no upload of
+// it succeeded. A single archive may have been renamed by remote_path.
+func uploadedSize(uploads []backupify.UploadResult, archive string, single bool) int64 {
+	for _, upload := range uploads {
+		if upload.Error == "" && (single || filepath.Base(upload.RemotePath) == filepath.Base(archive)) {
+			return upload.Size
+		}
+	}
+	return 0
+}
+
+func reportSize(size int64) string {
+	switch {
+	case size <= 0:
+		return "-"
+	case size < 1<<10:
+		return fmt.Sprintf("%d B", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	case size < 1<<30:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	}
+	return fmt.Sprintf("%.2f GiB", float64(size)/(1<<30))
+}
+
+func reportMS(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// restoreCommand restores an archive into MySQL. The archive is either
+// given by path or picked from the backup directory or a destination with
+// -latest or -before.
+func restoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	latest := fs.Bool("latest", false, "restore the newest archive")
+	before := fs.String("before", "", "restore the newest archive created before this RFC3339 time")
+	from := fs.String("from", "", "pick the archive from this FTP destination instead of the backup directory")
+	onlyDatabase := fs.String("only-database", "", "restore only this database")
+	allowVersionMismatch := fs.Bool("allow-version-mismatch", false, "restore a dump made on a newer or different server with a warning")
+	fs.Parse(args)
+
+	selecting := *latest || *before != ""
+	if fs.NArg() > 1 || (fs.NArg() == 1) == selecting || (*latest && *before != "") {
+		log.Fatal("usage: restore [flags] <archive> | restore [flags] -latest | restore [flags] -before <time>")
+	}
+
+	config := cf.load()
+	ctx := context.Background()
+
+	archivePath := fs.Arg(0)
+	if selecting {
+		var cutoff time.Time
+		if *before != "" {
+			var err error
+			cutoff, err = time.Parse(time.RFC3339, *before)
+			if err != nil {
+				log.Fatalf("invalid -before time: %v", err)
+			}
+		}
+
+		var archives []backupify.BackupArchive
+		var err error
+		if *from != "" {
+			archives, err = backupify.ListRemoteArchives(ctx, config, *from)
+		} else {
+			archives, err = backupify.ListLocalArchives(config.BackupDirectory)
+		}
+		if err != nil {
+			log.Fatalf("failed to list archives: %v", err)
+		}
+		archive, err := backupify.SelectArchive(archives, cutoff)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Selected %s (created %s)", archive.Name, archive.Created.Format(time.RFC3339))
+
+		if *from != "" {
+			archivePath, err = backupify.DownloadArchive(ctx, config, *from, archive.Name, config.BackupDirectory)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			archivePath = filepath.Join(config.BackupDirectory, archive.Name)
+		}
+	}
+
+	err := backupify.RestoreArchive(ctx, config, archivePath, backupify.RestoreOptions{OnlyDatabase: *onlyDatabase, AllowVersionMismatch: *allowVersionMismatch})
+	if err != nil {
+		log.Fatalf("restore failed: %v", err)
+	}
+	fmt.Println("Restore completed")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/robfig/cron/v3"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// scheduleCommand runs backups at the times given by the schedule cron
+// expression until interrupted. A run that is due while the previous one is
+// still going is skipped. SIGHUP reloads the config.
+func scheduleCommand(args []string) {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	fs.Parse(args)
+	config := cf.load()
+
+	var running sync.Mutex
+	start := func(config backupify.Config) (*cron.Cron, error) {
+		return startScheduler(config, &running, backupify.Run)
+	}
+
+	if config.Schedule == "" {
+		log.Fatal("schedule must be set to use schedule mode")
+	}
+	scheduler, err := start(config)
+	if err != nil {
+		log.Fatalf("invalid schedule %q: %v", config.Schedule, err)
+	}
+	log.Printf("waiting for schedule %q", config.Schedule)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		newConfig, err := cf.read()
+		if err == nil && newConfig.Schedule == "" {
+			err = errors.New("schedule is not set")
+		}
+		var newScheduler *cron.Cron
+		if err == nil {
+			newScheduler, err = start(newConfig)
+		}
+		if err != nil {
+			log.Printf("failed to reload config, keeping the old one: %v", err)
+			continue
+		}
+		scheduler.Stop()
+		scheduler = newScheduler
+		cf.redactLog(newConfig)
+		log.Printf("reloaded config, waiting for schedule %q", newConfig.Schedule)
+	}
+
+	log.Print("stopping, waiting for a running backup to finish")
+	<-scheduler.Stop().Done()
+	running.Lock()
+}
+
+// backupFunc runs a backup, as backupify.Run does.
+type backupFunc func(ctx context.Context, config backupify.Config) (backupify.Summary, error)
+
+// startScheduler starts running backup at the times of config.Schedule.
+// A run holds running, so runs of schedulers sharing it don't overlap.
+func startScheduler(config backupify.Config, running *sync.Mutex, backup backupFunc) (*cron.Cron, error) {
+	scheduler := cron.New()
+	_, err := scheduler.AddFunc(config.Schedule, scheduledBackup(config, running, backup))
+	if err != nil {
+		return nil, err
+	}
+	scheduler.Start()
+	return scheduler, nil
+}
+
+// scheduledBackup returns the job of a scheduler, which skips a run while
+// the previous one holds running.
+func scheduledBackup(config backupify.Config, running *sync.Mutex, backup backupFunc) func() {
+	return func() {
+		if !running.TryLock() {
+			log.Print("skipping scheduled backup, the previous one is still running")
+			return
+		}
+		defer running.Unlock()
+
+		summary, err := backup(context.Background(), config)
+		data, _ := json.Marshal(summary)
+		if err != nil {
+			log.Printf("scheduled backup failed: %v: %s", err, data)
+			return
+		}
+		log.Printf("scheduled backup completed: %s", data)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+func TestStartScheduler(t *testing.T) {
+	tests := []struct {
+		schedule string
+		ok       bool
+	}{
+		{"30 2 * * *", true},
+		{"*/15 * * * *", true},
+		{"0 3 * * mon-fri", true},
+		{"@daily", true},
+		{"@every 6h", true},
+		{"", false},
+		{"30 2 * *", false},
+		{"61 * * * *", false},
+		{"@fortnightly", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			var running sync.Mutex
+			scheduler, err := startScheduler(backupify.Config{Schedule: tt.schedule}, &running, nil)
+			if (err == nil) != tt.ok {
+				t.Fatalf("startScheduler(%q) = %v, want ok %v", tt.schedule, err, tt.ok)
+			}
+			if scheduler != nil {
+				scheduler.Stop()
+			}
+		})
+	}
+}
+
+func TestScheduledBackupSkipsOverlappingRuns(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	backup := func(ctx context.Context, config backupify.Config) (backupify.Summary, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return backupify.Summary{}, errors.New("failed")
+	}
+
+	var running sync.Mutex
+	job := scheduledBackup(backupify.Config{}, &running, backup)
+	done := make(chan struct{})
+	go func() {
+		job()
+		close(done)
+	}()
+	<-started
+	job()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("a run while the previous one is going called backup, %d calls", n)
+	}
+	close(release)
+	<-done
+
+	job()
+	if n := calls.Load(); n != 2 {
+		t.Errorf("a run after the previous one finished made %d calls, want 2", n)
+	}
+}
+
+func TestRedactLogAfterReload(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	var out bytes.Buffer
+	cf := configFlags{logOutput: &out}
+
+	cf.redactLog(backupify.Config{MySQLPassword: "old-password"})
+	log.Print("connecting with old-password")
+	cf.redactLog(backupify.Config{MySQLPassword: "new-password"})
+	log.Print("connecting with new-password")
+
+	for _, secret := range []string{"old-password", "new-password"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("log contains %q: %q", secret, out.String())
+		}
+	}
+	if n := strings.Count(out.String(), "with ***"); n != 2 {
+		t.Errorf("log has %d redacted messages, want 2: %q", n, out.String())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// Timeouts of the serve HTTP server. Requests have no body worth waiting
+// for; there is no write timeout, as the response is only written once the
+// backup is done.
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Second
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+type backupResponse struct {
+	backupify.Summary
+	Error string `json:"error,omitempty"`
+}
+
+// serveCommand starts an HTTP server whose POST /backup endpoint runs a
+// backup and responds with the Summary. Only one backup runs at a time.
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	listen := fs.String("listen", "", "address to listen on (overrides serve_address)")
+	fs.Parse(args)
+	config := cf.load()
+
+	if config.ServeToken == "" {
+		log.Fatal("serve_token must be set to use serve mode")
+	}
+	addr := config.ServeAddress
+	if *listen != "" {
+		addr = *listen
+	}
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	var running sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.ServeToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !running.TryLock() {
+			http.Error(w, "backup already running", http.StatusConflict)
+			return
+		}
+		defer running.Unlock()
+
+		summary, err := backupify.Run(context.Background(), config)
+		response := backupResponse{Summary: summary}
+		status := http.StatusOK
+		if err != nil {
+			log.Printf("backup failed: %v", err)
+			response.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	log.Printf("listening on %s", addr)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// trainDictCommand builds a zstd dictionary for zstd_dictionary_path from
+// sample dumps, or with -recent from the dumps in the newest archives.
+func trainDictCommand(args []string) {
+	fs := flag.NewFlagSet("train-dict", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	output := fs.String("o", "", "dictionary file to write (default backupify.dict, or zstd_dictionary_path with -recent)")
+	size := fs.Int("size", 112640, "maximum dictionary size in bytes")
+	recent := fs.Int("recent", 0, "sample the dumps in this many of the newest archives in backup_directory")
+	fs.Parse(args)
+	if (fs.NArg() == 0) == (*recent <= 0) {
+		log.Fatal("usage: train-dict [-o file] [-size bytes] <sample.sql>... | train-dict -recent <n> [-config file] [-o file]")
+	}
+
+	var dictionary []byte
+	var err error
+	if *recent > 0 {
+		config := cf.load()
+		if *output == "" {
+			*output = config.ZstdDictionaryPath
+		}
+		if *output == "" {
+			log.Fatal("set zstd_dictionary_path or -o")
+		}
+		dictionary, err = backupify.TrainZstdDictionaryFromArchives(config, *recent, *size)
+	} else {
+		if *output == "" {
+			*output = "backupify.dict"
+		}
+		dictionary, err = backupify.TrainZstdDictionary(fs.Args(), *size)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Older archives can only be decompressed with the dictionary they
+	// were written with, so it is kept next to the new one.
+	if info, err := os.Stat(*output); err == nil {
+		previous := *output + "." + info.ModTime().Format("20060102_150405")
+		if err := os.Rename(*output, previous); err != nil {
+			log.Fatalf("failed to keep previous dictionary: %v", err)
+		}
+		fmt.Printf("Kept previous dictionary as %s\n", previous)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("failed to read previous dictionary: %v", err)
+	}
+	err = os.WriteFile(*output, dictionary, 0644)
+	if err != nil {
+		log.Fatalf("failed to write dictionary: %v", err)
+	}
+	fmt.Printf("Wrote %d byte dictionary to %s\n", len(dictionary), *output)
+}
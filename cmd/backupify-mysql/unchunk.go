@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// unchunkCommand rebuilds the tar stream of a chunked archive from the
+// chunk store.
+func unchunkCommand(args []string) {
+	fs := flag.NewFlagSet("unchunk", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	store := fs.String("store", "", "chunk store directory (defaults to chunk_store from the config)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		log.Fatal("usage: unchunk [flags] <manifest.chunks.json> <output.tar|->")
+	}
+
+	if *store == "" {
+		*store = cf.load().ChunkStore
+	}
+
+	var out io.Writer = os.Stdout
+	if fs.Arg(1) != "-" {
+		file, err := os.Create(fs.Arg(1))
+		if err != nil {
+			log.Fatalf("failed to create output: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	err := backupify.ReassembleChunks(*store, fs.Arg(0), out)
+	if err != nil {
+		log.Fatalf("failed to reassemble archive: %v", err)
+	}
+}
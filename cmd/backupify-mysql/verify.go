@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"backupify-mysql/pkg/backupify"
+)
+
+// verifyCommand checks an archive against its .sha256 sidecar, its
+// MANIFEST.json and, with -pubkey, its .sig signature.
+func verifyCommand(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var opts backupify.VerifyOptions
+	fs.StringVar(&opts.DictionaryPath, "dict", "", "zstd dictionary the archive was compressed with")
+	fs.StringVar(&opts.PublicKeyPath, "pubkey", "", "Ed25519 public key (PEM) to check the .sig file against")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: verify [-dict file] [-pubkey file] <archive>")
+	}
+
+	err := backupify.VerifyArchiveFile(fs.Arg(0), opts)
+	if err != nil {
+		log.Fatalf("verification failed:\n%v", err)
+	}
+	fmt.Println("OK")
+}
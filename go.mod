@@ -3,7 +3,16 @@ module backupify-mysql
 go 1.22
 
 require (
+	github.com/andybalholm/brotli v1.2.5
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/jlaffaye/ftp v0.2.0
+	github.com/klauspost/compress v1.17.11
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/net v0.33.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/jlaffaye/ftp v0.2.0 // indirect
 )
@@ -0,0 +1,157 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// dumpFailures returns the errors of the databases that could not be
+// dumped, or nil when all of them were.
+func dumpFailures(results []DatabaseResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Error == "" {
+			continue
+		}
+		err := result.err
+		if err == nil {
+			err = errors.New(result.Error)
+		}
+		errs = append(errs, &DatabaseError{Database: result.Name, Err: err})
+	}
+	return errors.Join(errs...)
+}
+
+// abort undoes an AllOrNothing run that failed: the files already uploaded
+// are deleted from their destinations, and the local files and copies this
+// run produced are removed. It returns err wrapped for the caller.
+func (r *run) abort(ctx context.Context, summary *Summary, localFiles []string, err error) error {
+	r.logger.Printf("all_or_nothing: rolling back: %v", err)
+	r.removeUploads(ctx, summary.Uploads)
+	for _, file := range localFiles {
+		removeLocalArchive(r.cfg, file)
+	}
+	for _, local := range summary.LocalCopies {
+		if local.Path != "" {
+			removeLocalArchive(r.cfg, local.Path)
+		}
+	}
+	return fmt.Errorf("all_or_nothing: run rolled back: %w", err)
+}
+
+// removeUploads deletes the successful uploads, and their sidecars, from
+// the FTP destinations. Files sent to ssh destinations can't be removed
+// and are only logged.
+func (r *run) removeUploads(ctx context.Context, uploads []UploadResult) {
+	byDest := make(map[string][]string)
+	for _, upload := range uploads {
+		if upload.Error == "" && upload.RemotePath != "" {
+			byDest[upload.Destination] = append(byDest[upload.Destination], upload.RemotePath)
+		}
+	}
+
+	for _, dest := range expandFailover(r.dests) {
+		files := byDest[dest.Name]
+		if len(files) == 0 {
+			continue
+		}
+		if !dest.isFTP() {
+			for _, file := range files {
+				r.logger.Printf("can't roll back %s on %s destination %s, remove it by hand", file, dest.Type, dest.Name)
+			}
+			continue
+		}
+
+		conn, err := dialFTP(ctx, r.cfg, dest)
+		if err != nil {
+			r.logger.Printf("failed to roll back uploads to %s: %v", dest.Name, err)
+			continue
+		}
+		for _, file := range files {
+			err = conn.Delete(file)
+			if err != nil {
+				r.logger.Printf("failed to remove %s from %s: %v", file, dest.Name, err)
+				continue
+			}
+			for _, suffix := range sidecarSuffixes {
+				conn.Delete(file + suffix)
+			}
+			r.logger.Printf("removed %s from %s", file, dest.Name)
+		}
+		conn.Quit()
+	}
+}
+
+// commitStaged uploads the archives perDatabase staged with AllOrNothing,
+// but only when every database was dumped and archived. A failure on the
+// way rolls back everything.
+func (r *run) commitStaged(ctx context.Context, summary *Summary, outcomes []databaseOutcome) error {
+	var local []string
+	var errs []error
+	for _, o := range outcomes {
+		if o.archive != "" {
+			local = append(local, o.archive)
+		}
+		local = append(local, entryPaths(o.entries)...)
+		if o.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.result.Name, o.err))
+		}
+	}
+	if err := dumpFailures(summary.Databases); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return r.abort(ctx, summary, local, errors.Join(errs...))
+	}
+
+	defer r.stage("upload", &summary.UploadMS)()
+	for _, o := range outcomes {
+		if o.result.Skipped {
+			continue
+		}
+		db := o.result.Name
+		database, _ := r.cfg.tableGroup(db)
+		dests := r.cfg.destinationsFor(r.dests, database)
+		if len(dests) == 0 {
+			return r.abort(ctx, summary, local, fmt.Errorf("%s: %w", db, errNoDestination))
+		}
+		var err error
+		if o.archive == "" {
+			var uploaded Summary
+			err = uploadDumps(ctx, r.cfg, &uploaded, dests, o.entries)
+			summary.Uploads = append(summary.Uploads, uploaded.Uploads...)
+		} else {
+			var uploads []UploadResult
+			r.logger.Printf("uploading -> %s", o.archive)
+			uploads, err = uploadArchive(ctx, r.cfg, dests, o.archive)
+			summary.Uploads = append(summary.Uploads, uploads...)
+			if err != nil {
+				err = fmt.Errorf("failed to upload: %w", err)
+			}
+		}
+		if err != nil {
+			return r.abort(ctx, summary, local, fmt.Errorf("%s: %w", db, err))
+		}
+	}
+
+	for _, o := range outcomes {
+		if o.result.Skipped {
+			continue
+		}
+		r.commitState(o.result.Name)
+		if o.archive != "" && r.cfg.DeleteLocalAfterUpload {
+			removeLocalArchive(r.cfg, o.archive)
+		}
+	}
+	return nil
+}
+
+// entryPaths returns the local files of entries.
+func entryPaths(entries []archiveEntry) []string {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.path
+	}
+	return paths
+}
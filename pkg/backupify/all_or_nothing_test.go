@@ -0,0 +1,93 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitStaged(t *testing.T) {
+	const archive = "backup_shop.big_20240102_030405.tar.gz"
+	tests := []struct {
+		name         string
+		destinations []string
+		routes       map[string]string
+		shipped      string
+		err          error
+	}{
+		{
+			name:         "table group goes to the destination of its database",
+			destinations: []string{"routed", "other"},
+			routes:       map[string]string{"shop": "routed"},
+			shipped:      "routed",
+		},
+		{
+			name:         "unrouted database",
+			destinations: []string{"routed", "other"},
+			routes:       map[string]string{"crm": "routed"},
+			shipped:      "other",
+		},
+		{
+			name:         "no destination left",
+			destinations: []string{"routed"},
+			routes:       map[string]string{"crm": "routed"},
+			err:          errNoDestination,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var dests []Destination
+			for _, name := range tt.destinations {
+				remote := filepath.Join(dir, name)
+				if err := os.Mkdir(remote, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				dests = append(dests, Destination{Name: name, Type: DestinationCommand, Directory: remote, Command: "tee {path}"})
+			}
+			config := Config{
+				BackupDirectory:      dir,
+				StateDirectory:       dir,
+				Destinations:         dests,
+				DatabaseDestinations: tt.routes,
+				TableGroups:          map[string]map[string][]string{"shop": {"big": {"orders"}}},
+				AllOrNothing:         true,
+				Logger:               log.New(io.Discard, "", 0),
+			}
+			r, err := newRun(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			local := filepath.Join(dir, archive)
+			if err := os.WriteFile(local, []byte("archive"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			summary := &Summary{}
+			outcomes := []databaseOutcome{{result: DatabaseResult{Name: "shop" + groupSeparator + "big"}, archive: local}}
+			err = r.commitStaged(context.Background(), summary, outcomes)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("commitStaged() = %v, want %v", err, tt.err)
+				}
+				if _, statErr := os.Stat(local); !os.IsNotExist(statErr) {
+					t.Errorf("staged archive kept after the rollback")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("commitStaged() = %v", err)
+			}
+			for _, name := range tt.destinations {
+				_, statErr := os.Stat(filepath.Join(dir, name, archive))
+				if uploaded := statErr == nil; uploaded != (name == tt.shipped) {
+					t.Errorf("archive on %s: %v, want %v", name, uploaded, name == tt.shipped)
+				}
+			}
+		})
+	}
+}
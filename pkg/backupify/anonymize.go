@@ -0,0 +1,308 @@
+package backupify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Strategies of Config.Anonymize.
+const (
+	AnonymizeNull   = "null"
+	AnonymizeEmpty  = "empty"
+	AnonymizeRedact = "redact"
+	AnonymizeHash   = "hash"
+	AnonymizeEmail  = "email"
+)
+
+// insertPattern matches the start of a data statement of mysqldump.
+var insertPattern = regexp.MustCompile("^(?:INSERT|REPLACE)(?: IGNORE)? INTO ")
+
+// validateAnonymize checks the rules and that the dump is plain SQL written
+// by mysqldump, which is what the rewriter understands.
+func (c Config) validateAnonymize() error {
+	for key, strategy := range c.Anonymize {
+		if parts := strings.Split(key, "."); len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("anonymize: %q must be database.table.column", key)
+		}
+		switch strategy {
+		case AnonymizeNull, AnonymizeEmpty, AnonymizeRedact, AnonymizeHash, AnonymizeEmail:
+		default:
+			return fmt.Errorf("anonymize: strategy of %s must be one of null, empty, redact, hash or email, got %q", key, strategy)
+		}
+	}
+	if tool := c.dumpTool(); tool != DumpToolMysqldump && tool != DumpToolMariadbDump {
+		return fmt.Errorf("anonymize is not supported with %s", tool)
+	}
+	if c.TabExport {
+		return fmt.Errorf("anonymize can't be used with tab_export")
+	}
+	return nil
+}
+
+// anonymizer rewrites the INSERT statements of a mysqldump stream, replacing
+// the values of the columns in Config.Anonymize. Column positions come from
+// the CREATE TABLE statement written before the data, or from the column
+// list of --complete-insert.
+type anonymizer struct {
+	w        io.Writer
+	rules    map[string]map[string]string
+	salt     []byte
+	database string
+	table    string
+	creating bool
+	columns  map[string][]string
+	line     []byte
+	err      error
+}
+
+// newAnonymizer writes the anonymized dump to w. database is the one
+// mysqldump was given; USE statements in the dump change it.
+func newAnonymizer(config Config, database string, w io.Writer) *anonymizer {
+	a := &anonymizer{
+		w:        w,
+		rules:    map[string]map[string]string{},
+		salt:     []byte(config.AnonymizeSalt),
+		database: database,
+		columns:  map[string][]string{},
+	}
+	for key, strategy := range config.Anonymize {
+		i := strings.LastIndex(key, ".")
+		table, column := key[:i], key[i+1:]
+		if a.rules[table] == nil {
+			a.rules[table] = map[string]string{}
+		}
+		a.rules[table][column] = strategy
+	}
+	return a
+}
+
+func (a *anonymizer) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			a.line = append(a.line, p...)
+			break
+		}
+		a.line = append(a.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := a.flushLine(); err != nil {
+			a.err = err
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Close writes what is left after the last newline.
+func (a *anonymizer) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	if len(a.line) == 0 {
+		return nil
+	}
+	return a.flushLine()
+}
+
+func (a *anonymizer) flushLine() error {
+	line := string(a.line)
+	a.line = a.line[:0]
+	line, err := a.rewrite(line)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(a.w, line)
+	return err
+}
+
+// rewrite returns line with the configured values replaced, keeping track
+// of the database and table columns it passes.
+func (a *anonymizer) rewrite(line string) (string, error) {
+	if a.creating {
+		if strings.HasPrefix(line, "  `") {
+			if column, _, ok := cutIdentifier(line[2:]); ok {
+				key := a.database + "." + a.table
+				a.columns[key] = append(a.columns[key], column)
+			}
+		} else if strings.HasPrefix(line, ")") {
+			a.creating = false
+		}
+		return line, nil
+	}
+
+	switch {
+	case strings.HasPrefix(line, "USE "):
+		if database, _, ok := cutIdentifier(line[len("USE "):]); ok {
+			a.database = database
+		}
+	case strings.HasPrefix(line, "CREATE TABLE "):
+		rest := strings.TrimPrefix(line[len("CREATE TABLE "):], "IF NOT EXISTS ")
+		if table, _, ok := cutIdentifier(rest); ok {
+			a.table, a.creating = table, true
+			a.columns[a.database+"."+table] = nil
+		}
+	default:
+		if m := insertPattern.FindString(line); m != "" {
+			return a.rewriteInsert(line, len(m))
+		}
+	}
+	return line, nil
+}
+
+// rewriteInsert replaces the values of an INSERT statement whose table name
+// starts at offset.
+func (a *anonymizer) rewriteInsert(line string, offset int) (string, error) {
+	table, rest, ok := cutIdentifier(line[offset:])
+	if !ok {
+		return line, nil
+	}
+	key := a.database + "." + table
+	rules := a.rules[key]
+	if len(rules) == 0 {
+		return line, nil
+	}
+
+	columns := a.columns[key]
+	if strings.HasPrefix(rest, " (") {
+		columns = nil
+		rest = rest[len(" ("):]
+		for {
+			column, after, ok := cutIdentifier(strings.TrimLeft(rest, ", "))
+			if !ok {
+				break
+			}
+			columns = append(columns, column)
+			rest = after
+		}
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("can't anonymize %s: its columns are not known", key)
+	}
+	strategies := make([]string, len(columns))
+	for i, column := range columns {
+		strategies[i] = rules[column]
+	}
+
+	start := strings.Index(line, " VALUES ")
+	if start < 0 {
+		return line, nil
+	}
+	start += len(" VALUES ")
+	var out strings.Builder
+	out.Grow(len(line))
+	out.WriteString(line[:start])
+
+	// Fields are separated at the top level of each tuple; quoted strings
+	// are skipped with their backslash escapes.
+	field, fieldStart, depth := 0, 0, 0
+	for i := start; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '\'':
+			for i++; i < len(line) && line[i] != '\''; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			if depth == 0 {
+				out.WriteByte(c)
+				field, fieldStart = 0, i+1
+			}
+			depth++
+		case ',', ')':
+			if depth != 1 {
+				if depth == 0 {
+					out.WriteByte(c)
+				}
+				continue
+			}
+			value := line[fieldStart:i]
+			if field < len(strategies) && strategies[field] != "" {
+				value = a.replace(strategies[field], value)
+			}
+			out.WriteString(value)
+			out.WriteByte(c)
+			field, fieldStart = field+1, i+1
+			if c == ')' {
+				depth = 0
+			}
+		default:
+			if depth == 0 {
+				out.WriteByte(c)
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// replace returns the SQL literal that stands in for value. NULL stays NULL
+// so the nullability of the data is kept.
+func (a *anonymizer) replace(strategy, value string) string {
+	if strategy == AnonymizeNull {
+		return "NULL"
+	}
+	if value == "NULL" {
+		return value
+	}
+	switch strategy {
+	case AnonymizeEmpty:
+		return "''"
+	case AnonymizeRedact:
+		return "'REDACTED'"
+	case AnonymizeEmail:
+		return "'" + a.hash(value)[:12] + "@example.invalid'"
+	default:
+		return "'" + a.hash(value)[:16] + "'"
+	}
+}
+
+// hash is a keyed digest of value, the same for equal values so joins on
+// hashed columns still match.
+func (a *anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cutIdentifier reads a backquoted identifier from the start of s and
+// returns it unquoted with the rest of s.
+func cutIdentifier(s string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(s, "`") {
+		return "", s, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '`' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '`' {
+			b.WriteByte('`')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], true
+	}
+	return "", s, false
+}
+
+// dumpedDatabase returns the database named in mysqldump arguments, the
+// first one that is not an option.
+func dumpedDatabase(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package backupify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const anonymizeTable = "CREATE TABLE `users` (\n" +
+	"  `id` int NOT NULL,\n" +
+	"  `name` varchar(64) DEFAULT NULL,\n" +
+	"  `email` varchar(255) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB;\n"
+
+func testHash(salt, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestAnonymizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]string
+		dump  string
+		want  string
+	}{
+		{
+			name:  "redact by create table columns",
+			rules: map[string]string{"shop.users.name": AnonymizeRedact},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com'),(2,'Bob','b@example.com');\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,'REDACTED','a@example.com'),(2,'REDACTED','b@example.com');\n",
+		},
+		{
+			name:  "null and empty",
+			rules: map[string]string{"shop.users.name": AnonymizeNull, "shop.users.email": AnonymizeEmpty},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,NULL,'');\n",
+		},
+		{
+			name:  "hash keeps NULL",
+			rules: map[string]string{"shop.users.name": AnonymizeHash},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,NULL,'a@example.com'),(2,'Bob',NULL);\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,NULL,'a@example.com'),(2,'" + testHash("salt", "'Bob'")[:16] + "',NULL);\n",
+		},
+		{
+			name:  "email",
+			rules: map[string]string{"shop.users.email": AnonymizeEmail},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','" + testHash("salt", "'a@example.com'")[:12] + "@example.invalid');\n",
+		},
+		{
+			name:  "quoted separators",
+			rules: map[string]string{"shop.users.email": AnonymizeRedact},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'O\\'Brien, (Jr.)','a@example.com');\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,'O\\'Brien, (Jr.)','REDACTED');\n",
+		},
+		{
+			name:  "complete insert column list",
+			rules: map[string]string{"shop.users.email": AnonymizeRedact},
+			dump:  "INSERT INTO `users` (`email`, `id`) VALUES ('a@example.com',1);\n",
+			want:  "INSERT INTO `users` (`email`, `id`) VALUES ('REDACTED',1);\n",
+		},
+		{
+			name:  "replace and insert ignore",
+			rules: map[string]string{"shop.users.name": AnonymizeRedact},
+			dump:  anonymizeTable + "REPLACE INTO `users` VALUES (1,'Alice',NULL);\nINSERT IGNORE INTO `users` VALUES (2,'Bob',NULL);\n",
+			want:  anonymizeTable + "REPLACE INTO `users` VALUES (1,'REDACTED',NULL);\nINSERT IGNORE INTO `users` VALUES (2,'REDACTED',NULL);\n",
+		},
+		{
+			name:  "other table untouched",
+			rules: map[string]string{"shop.customers.name": AnonymizeRedact},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+		},
+		{
+			name:  "use switches database",
+			rules: map[string]string{"shop.users.name": AnonymizeRedact},
+			dump:  "USE `crm`;\n" + anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+			want:  "USE `crm`;\n" + anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice','a@example.com');\n",
+		},
+		{
+			name:  "no trailing newline",
+			rules: map[string]string{"shop.users.name": AnonymizeRedact},
+			dump:  anonymizeTable + "INSERT INTO `users` VALUES (1,'Alice',NULL);",
+			want:  anonymizeTable + "INSERT INTO `users` VALUES (1,'REDACTED',NULL);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, chunk := range []int{len(tt.dump), 7, 1} {
+				var out strings.Builder
+				a := newAnonymizer(Config{Anonymize: tt.rules, AnonymizeSalt: "salt"}, "shop", &out)
+				for dump := tt.dump; dump != ""; {
+					n := min(chunk, len(dump))
+					if _, err := a.Write([]byte(dump[:n])); err != nil {
+						t.Fatalf("Write: %v", err)
+					}
+					dump = dump[n:]
+				}
+				if err := a.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if got := out.String(); got != tt.want {
+					t.Errorf("writes of %d bytes:\ngot  %q\nwant %q", chunk, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnonymizerUnknownColumns(t *testing.T) {
+	var out strings.Builder
+	a := newAnonymizer(Config{Anonymize: map[string]string{"shop.users.name": AnonymizeRedact}}, "shop", &out)
+	_, err := a.Write([]byte("INSERT INTO `users` VALUES (1,'Alice');\n"))
+	if err == nil {
+		t.Fatal("Write succeeded for a table without known columns")
+	}
+}
+
+func TestCutIdentifier(t *testing.T) {
+	tests := []struct {
+		in   string
+		name string
+		rest string
+		ok   bool
+	}{
+		{"`users` VALUES", "users", " VALUES", true},
+		{"`we``ird` (", "we`ird", " (", true},
+		{"users", "", "users", false},
+		{"`unterminated", "", "`unterminated", false},
+	}
+	for _, tt := range tests {
+		name, rest, ok := cutIdentifier(tt.in)
+		if name != tt.name || rest != tt.rest || ok != tt.ok {
+			t.Errorf("cutIdentifier(%q) = %q, %q, %v, want %q, %q, %v", tt.in, name, rest, ok, tt.name, tt.rest, tt.ok)
+		}
+	}
+}
+
+func TestValidateAnonymize(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"valid", Config{Anonymize: map[string]string{"shop.users.email": AnonymizeEmail}}, true},
+		{"two parts", Config{Anonymize: map[string]string{"users.email": AnonymizeEmail}}, false},
+		{"empty part", Config{Anonymize: map[string]string{"shop..email": AnonymizeEmail}}, false},
+		{"unknown strategy", Config{Anonymize: map[string]string{"shop.users.email": "shuffle"}}, false},
+		{"mydumper", Config{Anonymize: map[string]string{"shop.users.email": AnonymizeEmail}, DumpTool: DumpToolMydumper}, false},
+		{"tab export", Config{Anonymize: map[string]string{"shop.users.email": AnonymizeEmail}, TabExport: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateAnonymize()
+			if (err == nil) != tt.ok {
+				t.Errorf("validateAnonymize() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
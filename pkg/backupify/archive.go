@@ -0,0 +1,325 @@
+package backupify
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const manifestName = "MANIFEST.json"
+
+// ManifestEntry records the size and SHA-256 of a file inside the archive.
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveEntry is a file to put into the archive under name. Entries
+// without a path are generated files whose content is data, with the
+// permission bits mode (0644 when zero). Entries with a segment stand for
+// the already compressed dump of a database.
+type archiveEntry struct {
+	path    string
+	name    string
+	data    []byte
+	mode    int64
+	segment *archiveSegment
+}
+
+func archiveFiles(config Config, entries []archiveEntry, archivePath string) error {
+	tarFile, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer tarFile.Close()
+
+	err = writeArchive(config, entries, tarFile)
+	if err != nil {
+		return err
+	}
+	return tarFile.Close()
+}
+
+// writeArchive writes the compressed (and, if configured, encrypted) tar
+// stream of entries to w.
+func writeArchive(config Config, entries []archiveEntry, w io.Writer) error {
+	if hasSegments(entries) {
+		return writeSegmentedArchive(config, entries, w)
+	}
+	config = config.autoCompressionLevel(entriesSize(entries))
+	pipeline, err := newPipeline(config, w)
+	if err != nil {
+		return err
+	}
+
+	err = writeTar(config, pipeline, entries)
+	if err != nil {
+		pipeline.Close()
+		return err
+	}
+	return pipeline.Close()
+}
+
+// archiveSuffix is the file name suffix of archives, which reflects the
+// order of the compress and encrypt stages. With EncryptOnUploadOnly only
+// the uploaded copy has the .enc suffix.
+func (c Config) archiveSuffix() string {
+	compressed := c.compressionSuffix()
+	switch {
+	case c.EncryptCommand == "" || c.EncryptOnUploadOnly:
+		return ".tar" + compressed
+	case c.PipelineOrder == PipelineEncryptThenCompress:
+		return ".tar.enc" + compressed
+	default:
+		return ".tar" + compressed + ".enc"
+	}
+}
+
+// writeTar writes the uncompressed tar stream of entries to w.
+func writeTar(config Config, w io.Writer, entries []archiveEntry) error {
+	tarWriter := tar.NewWriter(w)
+	var manifest []ManifestEntry
+	for _, entry := range entries {
+		manifestEntry, err := addFileToArchive(config, tarWriter, entry)
+		if err != nil {
+			return err
+		}
+		manifest = append(manifest, manifestEntry)
+	}
+
+	if config.Manifest {
+		err := addManifest(tarWriter, manifest)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// addFileToArchive writes entry into the archive and returns its manifest
+// entry. With VerifyEntryChecksums the source file is read again afterwards
+// and must hash to what was streamed into the archive.
+func addFileToArchive(config Config, tarWriter *tar.Writer, entry archiveEntry) (ManifestEntry, error) {
+	if entry.path == "" {
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		err := addBytesToArchive(tarWriter, entry.name, entry.data, mode)
+		sum := sha256.Sum256(entry.data)
+		return ManifestEntry{Name: entry.name, Size: int64(len(entry.data)), SHA256: hex.EncodeToString(sum[:])}, err
+	}
+
+	file := entry.path
+	info, err := os.Stat(file)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to get file information %s: %w", file, err)
+	}
+
+	header, err := tar.FileInfoHeader(info, info.Name())
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to create file header %s: %w", file, err)
+	}
+
+	header.Name = entry.name
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to write file header into archive: %w", err)
+	}
+
+	fileContent, err := os.Open(file)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to open file %s: %w", file, err)
+	}
+	defer fileContent.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tarWriter, hash), fileContent)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to write file %s into archive: %w", file, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if config.VerifyEntryChecksums {
+		reread, err := fileSHA256(file)
+		if err != nil {
+			return ManifestEntry{}, fmt.Errorf("failed to verify file %s: %w", file, err)
+		}
+		if reread != sum {
+			return ManifestEntry{}, fmt.Errorf("file %s was corrupted while archiving: SHA-256 %s went into the archive, the file has %s", file, sum, reread)
+		}
+	}
+	return ManifestEntry{Name: entry.name, Size: size, SHA256: sum}, nil
+}
+
+// addManifest writes MANIFEST.json as the last entry of the archive, since
+// the checksums are only known once every other entry has been written.
+func addManifest(tarWriter *tar.Writer, manifest []ManifestEntry) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return addBytesToArchive(tarWriter, manifestName, data, 0644)
+}
+
+func addBytesToArchive(tarWriter *tar.Writer, name string, data []byte, mode int64) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	err := tarWriter.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write %s header into archive: %w", name, err)
+	}
+	_, err = tarWriter.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write %s into archive: %w", name, err)
+	}
+	return nil
+}
+
+// Pipeline orders for Config.PipelineOrder.
+const (
+	PipelineCompressThenEncrypt = "compress-then-encrypt"
+	PipelineEncryptThenCompress = "encrypt-then-compress"
+)
+
+// newPipeline returns a writer that compresses and, if configured,
+// encrypts the tar stream into out in the configured order.
+func newPipeline(config Config, out io.Writer) (io.WriteCloser, error) {
+	if config.EncryptCommand == "" {
+		return newCompressor(config, out)
+	}
+
+	if config.PipelineOrder == PipelineEncryptThenCompress {
+		compressor, err := newCompressor(config, out)
+		if err != nil {
+			return nil, err
+		}
+		encryptor, err := startCompressCommand(config.EncryptCommand, compressor)
+		if err != nil {
+			compressor.Close()
+			return nil, err
+		}
+		return &stageWriter{first: encryptor, second: compressor}, nil
+	}
+
+	encryptor, err := startCompressCommand(config.EncryptCommand, out)
+	if err != nil {
+		return nil, err
+	}
+	compressor, err := newCompressor(config, encryptor)
+	if err != nil {
+		encryptor.Close()
+		return nil, err
+	}
+	return &stageWriter{first: compressor, second: encryptor}, nil
+}
+
+// stageWriter writes into first, which feeds second. Close flushes first
+// before closing second.
+type stageWriter struct {
+	first  io.WriteCloser
+	second io.WriteCloser
+}
+
+func (w *stageWriter) Write(p []byte) (int, error) {
+	return w.first.Write(p)
+}
+
+func (w *stageWriter) Close() error {
+	err := w.first.Close()
+	secondErr := w.second.Close()
+	if err != nil {
+		return err
+	}
+	return secondErr
+}
+
+// newCompressor returns a writer that compresses into out, either with the
+// built-in gzip or zstd writer or by piping through config.CompressCommand.
+func newCompressor(config Config, out io.Writer) (io.WriteCloser, error) {
+	if config.CompressCommand != "" {
+		return startCompressCommand(config.CompressCommand, out)
+	}
+	switch config.compression() {
+	case CompressionZstd:
+		return newZstdWriter(config, out)
+	case CompressionBrotli:
+		return newBrotliWriter(config, out), nil
+	case compressionNone:
+		return nopWriteCloser{out}, nil
+	}
+	return newGzipWriter(config, out), nil
+}
+
+type commandWriter struct {
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (c Config) validateCompressCommand() error {
+	if c.CompressCommand == "" {
+		if c.CompressSuffix != "" {
+			return fmt.Errorf("compress_suffix needs compress_command")
+		}
+	} else if len(strings.Fields(c.CompressCommand)) == 0 {
+		return fmt.Errorf("compress_command must name a command")
+	}
+	switch c.CompressSuffix {
+	case "", ".gz", ".zst", ".br":
+	default:
+		return fmt.Errorf("compress_suffix must be .gz, .zst or .br, got %q", c.CompressSuffix)
+	}
+	if c.EncryptCommand != "" && len(strings.Fields(c.EncryptCommand)) == 0 {
+		return fmt.Errorf("encrypt_command must name a command")
+	}
+	return nil
+}
+
+func startCompressCommand(command string, out io.Writer) (*commandWriter, error) {
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = out
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compressor stdin: %w", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start compressor %s: %w", args[0], err)
+	}
+	return &commandWriter{stdin: stdin, cmd: cmd, stderr: stderr}, nil
+}
+
+func (w *commandWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+func (w *commandWriter) Close() error {
+	w.stdin.Close()
+	err := w.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("compressor %s failed: %w: %s", w.cmd.Path, err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package backupify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// ArchiveDelta is how much of an archive changed since the previous
+// archive of the same series, see ReportArchiveDelta.
+type ArchiveDelta struct {
+	Archive string `json:"archive"`
+	// Size is the size of the uncompressed tar stream and ChangedBytes the
+	// part of it that isn't in the previous one.
+	Size         int64 `json:"size"`
+	ChangedBytes int64 `json:"changed_bytes"`
+}
+
+// archiveSignature lists the content-defined chunks of an archive's tar
+// stream by the first 8 bytes of their SHA-256, which is all that's needed
+// to tell whether a later archive contains them.
+type archiveSignature struct {
+	Archive string           `json:"archive"`
+	Chunks  map[string]int64 `json:"chunks"`
+}
+
+// signatureKey is the StateStore key of the signature of the last archive
+// of series.
+func signatureKey(series string) string {
+	if series == combinedSeries {
+		series = "all"
+	}
+	return "signature-" + series
+}
+
+// reportDelta splits the tar stream of archivePath, or of archiveData when
+// it was built in memory, into the same
+// content-defined chunks as ChunkStore, logs how many of its bytes are in
+// chunks the previous archive of series didn't have and saves its
+// signature for the next run. The uncompressed stream is compared because
+// a change early in a compressed archive changes everything after it.
+// Failures are only logged.
+func (r *run) reportDelta(summary *Summary, series, archivePath string, archiveData []byte) {
+	if !r.cfg.ReportArchiveDelta {
+		return
+	}
+	signature, size, err := signArchiveChunks(r.cfg, archivePath, archiveData)
+	if err != nil {
+		r.logger.Printf("failed to compute delta of %s: %v", archivePath, err)
+		return
+	}
+
+	store, key := r.cfg.stateStore(), signatureKey(series)
+	var previous archiveSignature
+	data, err := store.Get(key)
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, &previous)
+	}
+	if err != nil {
+		r.logger.Printf("failed to read archive signature %s: %v", key, err)
+	}
+	if previous.Chunks != nil {
+		delta := ArchiveDelta{Archive: archivePath, Size: size}
+		for hash, n := range signature.Chunks {
+			if _, ok := previous.Chunks[hash]; !ok {
+				delta.ChangedBytes += n
+			}
+		}
+		percent := 0.0
+		if size > 0 {
+			percent = float64(delta.ChangedBytes) * 100 / float64(size)
+		}
+		r.logger.Printf("%d of %d bytes (%.1f%%) of %s changed since %s", delta.ChangedBytes, size, percent, filepath.Base(archivePath), previous.Archive)
+		r.mu.Lock()
+		summary.Deltas = append(summary.Deltas, delta)
+		r.mu.Unlock()
+	}
+
+	data, err = json.Marshal(signature)
+	if err == nil {
+		err = store.Set(key, data)
+	}
+	if err != nil {
+		r.logger.Printf("failed to write archive signature %s: %v", key, err)
+	}
+}
+
+// signArchiveChunks returns the chunk signature of the tar stream of
+// archivePath and the stream's size. A chunk that occurs more than once is
+// counted once per occurrence.
+func signArchiveChunks(config Config, archivePath string, archiveData []byte) (archiveSignature, int64, error) {
+	signature := archiveSignature{Archive: filepath.Base(archivePath), Chunks: map[string]int64{}}
+	file, err := openArchive(archivePath, archiveData)
+	if err != nil {
+		return signature, 0, err
+	}
+	defer file.Close()
+	stream, err := decompressArchive(file, archivePath, config.ZstdDictionaryPath)
+	if err != nil {
+		return signature, 0, err
+	}
+	defer stream.Close()
+
+	var size int64
+	c := &chunker{emit: func(data []byte) error {
+		sum := sha256.Sum256(data)
+		signature.Chunks[hex.EncodeToString(sum[:8])] += int64(len(data))
+		size += int64(len(data))
+		return nil
+	}}
+	_, err = io.Copy(c, stream)
+	if err == nil {
+		err = c.flush()
+	}
+	if err != nil {
+		return signature, 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return signature, size, nil
+}
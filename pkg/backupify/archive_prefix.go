@@ -0,0 +1,55 @@
+package backupify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders of ArchivePathPrefix.
+const (
+	prefixDatabase  = "{database}"
+	prefixTimestamp = "{timestamp}"
+)
+
+// validateArchivePathPrefix checks that ArchivePathPrefix is a relative
+// directory.
+func (c Config) validateArchivePathPrefix() error {
+	prefix := c.ArchivePathPrefix
+	if !strings.HasSuffix(prefix, "/") || strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "..") {
+		return fmt.Errorf("archive_path_prefix must be a relative directory ending in /, e.g. {database}/, got %q", prefix)
+	}
+	return nil
+}
+
+// entryName prefixes name, the archive entry of a file of database db, with
+// ArchivePathPrefix.
+func (r *run) entryName(db, name string) string {
+	if r.cfg.ArchivePathPrefix == "" {
+		return name
+	}
+	return strings.NewReplacer(prefixDatabase, db, prefixTimestamp, r.timestamp).Replace(r.cfg.ArchivePathPrefix) + name
+}
+
+// archivePrefixPattern matches ArchivePathPrefix at the start of an entry
+// name, whichever database and timestamp it was rendered with.
+func (c Config) archivePrefixPattern() *regexp.Regexp {
+	if c.ArchivePathPrefix == "" {
+		return nil
+	}
+	pattern := regexp.QuoteMeta(c.ArchivePathPrefix)
+	pattern = strings.ReplaceAll(pattern, regexp.QuoteMeta(prefixDatabase), `[^/]+`)
+	pattern = strings.ReplaceAll(pattern, regexp.QuoteMeta(prefixTimestamp), `\d{8}_\d{6}`)
+	return regexp.MustCompile("^" + pattern)
+}
+
+// trimArchivePrefix removes the part of name that matches prefix.
+func trimArchivePrefix(prefix *regexp.Regexp, name string) string {
+	if prefix == nil {
+		return name
+	}
+	if loc := prefix.FindStringIndex(name); loc != nil {
+		return name[loc[1]:]
+	}
+	return name
+}
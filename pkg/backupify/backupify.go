@@ -0,0 +1,856 @@
+// Package backupify dumps MySQL databases, archives the dumps and ships the
+// archive to an FTP server.
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DatabaseResult is the outcome of dumping a single database.
+type DatabaseResult struct {
+	Name  string `json:"name"`
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Size is the size of the dump files before archiving.
+	Size int64 `json:"size,omitempty"`
+	// Skipped is set when the database was left out because it hadn't
+	// changed since its last backup.
+	Skipped bool `json:"skipped,omitempty"`
+	// VerifyFailed is set when the dump succeeded but could not be restored
+	// by the VerifyRestore check.
+	VerifyFailed bool `json:"verify_failed,omitempty"`
+	// SkippedViews are the views left out by SkipInvalidDefinerViews.
+	SkippedViews []string `json:"skipped_views,omitempty"`
+	// SchemaOnlyTables are the tables dumped without their rows because of
+	// SchemaOnlyAboveMB.
+	SchemaOnlyTables []string `json:"schema_only_tables,omitempty"`
+
+	err error
+}
+
+// Summary describes a finished run.
+type Summary struct {
+	RunID       string           `json:"run_id"`
+	Environment string           `json:"environment,omitempty"`
+	Databases   []DatabaseResult `json:"databases"`
+	// Archive is the tar archive that was uploaded. It is empty when the
+	// dumps are uploaded on their own (Archive disabled or GzipDumps).
+	Archive string `json:"archive,omitempty"`
+	// SHA256 is the checksum of Archive when Checksum is set.
+	SHA256 string `json:"sha256,omitempty"`
+	// Archives lists the per-database archives when PerDatabaseArchives is
+	// set.
+	Archives []string       `json:"archives,omitempty"`
+	Uploads  []UploadResult `json:"uploads,omitempty"`
+	// Prunes lists what RemoteKeepLast deleted from each destination. A
+	// failed prune doesn't fail the run.
+	Prunes []PruneResult `json:"prunes,omitempty"`
+	// LocalCopies lists the copies made to AdditionalBackupDirs.
+	LocalCopies []LocalCopy `json:"local_copies,omitempty"`
+	// NewChunks and ReusedChunks count the chunks of a ChunkStore archive
+	// that had to be stored and that were already present.
+	NewChunks    int `json:"new_chunks,omitempty"`
+	ReusedChunks int `json:"reused_chunks,omitempty"`
+	// Deltas is how much each archive changed since the previous one, when
+	// ReportArchiveDelta is set.
+	Deltas []ArchiveDelta `json:"deltas,omitempty"`
+	// DumpMS, ArchiveMS and UploadMS are the time spent in each stage. With
+	// PerDatabaseArchives they are summed over all databases.
+	DumpMS    int64 `json:"dump_ms"`
+	ArchiveMS int64 `json:"archive_ms"`
+	UploadMS  int64 `json:"upload_ms"`
+	// EstimatedMonthlyCost sums the storage cost of the uploads when
+	// StorageCostPerGB is set.
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost,omitempty"`
+	// SchemaCommit is the commit SchemaGitRepo got for this run's schema
+	// changes, if there were any.
+	SchemaCommit string `json:"schema_commit,omitempty"`
+}
+
+// Run dumps every configured database, archives the dumps and uploads the
+// archive. A database that fails to dump is recorded in the summary and
+// skipped; archive and upload failures abort the run.
+func Run(ctx context.Context, cfg Config) (Summary, error) {
+	cfg = cfg.withRunID()
+	started := time.Now()
+	sup := startSupervision(cfg)
+	defer sup.finish()
+	tr := startTrace(cfg)
+	if sup != nil || tr != nil {
+		onEvent := cfg.OnEvent
+		cfg.OnEvent = func(event Event) {
+			sup.event(event)
+			tr.event(event)
+			if onEvent != nil {
+				onEvent(event)
+			}
+		}
+	}
+	summary, err := runBackup(ctx, cfg, sup, tr)
+	summary.RunID, summary.Environment = cfg.RunID, cfg.Environment
+	if cfg.MetricsTextfilePath != "" {
+		if metricsErr := writeMetricsTextfile(cfg, summary, started, time.Now(), err); metricsErr != nil {
+			cfg.logger().Printf("failed to write metrics textfile: %v", metricsErr)
+		}
+	}
+	tr.export(summary, err)
+	cfg.emit(Event{Type: EventDone, EstimatedMonthlyCost: summary.EstimatedMonthlyCost, Error: errorString(err)})
+	return summary, err
+}
+
+func runBackup(ctx context.Context, cfg Config, sup *supervisor, tr *tracer) (Summary, error) {
+	var summary Summary
+
+	err := cfg.Validate()
+	if err != nil {
+		return summary, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+
+	err = os.MkdirAll(cfg.BackupDirectory, os.ModePerm)
+	if err != nil {
+		return summary, fmt.Errorf("failed to create directory for backups: %w", err)
+	}
+	err = checkFreeDisk(cfg)
+	if err != nil {
+		return summary, err
+	}
+
+	r, err := newRun(cfg)
+	if err != nil {
+		return summary, err
+	}
+	r.supervisor = sup
+	r.tracer = tr
+	if cfg.SkipMissingDatabases {
+		err = r.withoutMissingDatabases(ctx)
+		if err != nil {
+			return summary, err
+		}
+	}
+	if len(r.databases) == 0 {
+		if !cfg.AllowEmptyBackup {
+			return summary, fmt.Errorf("%w: databases is empty", ErrNoDatabases)
+		}
+		r.logger.Printf("warning: databases is empty, the backup won't contain any dumps")
+	}
+	if cfg.SplitThresholdMB > 0 {
+		r.cfg.PerDatabaseArchives, err = r.splitArchives(ctx)
+		if err != nil {
+			return summary, err
+		}
+	}
+	if r.cfg.PerDatabaseArchives {
+		sup.setTotal(len(r.perDatabaseUnits()))
+	} else {
+		sup.setTotal(len(r.databases))
+	}
+	if cfg.CheckPrivileges {
+		err = checkPrivileges(ctx, cfg, r.databases)
+		if err != nil {
+			return summary, err
+		}
+	}
+	if cfg.PreflightUploadCheck && !cfg.Spool && cfg.ArchiveWriter == nil {
+		err = r.preflightUploads(ctx)
+		if err != nil {
+			return summary, err
+		}
+	}
+	err = flushBinaryLogs(ctx, cfg)
+	if err != nil {
+		return summary, err
+	}
+	if r.cfg.PerDatabaseArchives {
+		err = r.perDatabase(ctx, &summary)
+	} else {
+		err = r.combined(ctx, &summary)
+	}
+	if len(cfg.StorageCostPerGB) > 0 {
+		summary.EstimatedMonthlyCost = cfg.estimateStorageCost(summary.Uploads)
+		r.logger.Printf("estimated storage cost of this run: %.2f per month", summary.EstimatedMonthlyCost)
+	}
+
+	if saveErr := r.state.save(); saveErr != nil {
+		r.logger.Printf("failed to save state: %v", saveErr)
+	}
+	if err != nil {
+		return summary, err
+	}
+	if removeErr := r.journal.remove(); removeErr != nil {
+		r.logger.Printf("failed to remove run journal: %v", removeErr)
+	}
+	err = checkSuccessThreshold(cfg, summary)
+	if err != nil {
+		return summary, err
+	}
+	if cfg.CatalogPath != "" || cfg.UploadCatalog {
+		r.appendCatalog(ctx, summary)
+	}
+	if cfg.SchemaGitRepo != "" {
+		r.commitSchema(ctx, &summary)
+	}
+	return summary, nil
+}
+
+// run holds the state shared by the stages of a single backup run.
+type run struct {
+	cfg       Config
+	logger    *log.Logger
+	started   time.Time
+	timestamp string
+	dests     []Destination
+	state     *state
+	journal   *journal
+	// databases are the databases this run backs up.
+	databases []string
+	// supervisor keeps the PidFile and StatusFile, if configured.
+	supervisor *supervisor
+	// tracer collects the spans for OTelEndpoint, if configured.
+	tracer *tracer
+
+	mu      sync.Mutex
+	pending map[string]DatabaseState
+	// pendingCursors are the IncrementalColumns cursors to record per
+	// database once it has been shipped.
+	pendingCursors map[string]map[string]incrementalPosition
+	// pendingSizes are the archive sizes to record for SizeDropThresholdPercent
+	// once the archives have been shipped, keyed like ArchiveSizes.
+	pendingSizes map[string]int64
+}
+
+func newRun(cfg Config) (*run, error) {
+	st, err := loadState(cfg.stateStore())
+	if err != nil {
+		return nil, err
+	}
+	jr, started, err := openJournal(cfg, time.Now(), cfg.Resume)
+	if err != nil {
+		return nil, err
+	}
+	r := &run{
+		cfg:       cfg,
+		logger:    cfg.logger(),
+		started:   started,
+		timestamp: started.Format("20060102_150405"),
+		dests:     renderDestinations(cfg.destinations(), started),
+		state:     st,
+		journal:   jr,
+		databases: cfg.Databases,
+		pending:   map[string]DatabaseState{},
+
+		pendingCursors: map[string]map[string]incrementalPosition{},
+		pendingSizes:   map[string]int64{},
+	}
+	if cfg.DatabaseBatchSize > 0 {
+		r.databases = r.nextBatch()
+	}
+	r.databases = cfg.orderDatabases(r.databases)
+	return r, nil
+}
+
+// stage starts timing a stage of the run. Calling the returned function
+// logs the duration and adds it to *total in milliseconds; it is safe to use
+// from concurrent goroutines.
+func (r *run) stage(name string, total *int64) func() {
+	r.supervisor.setStage(name)
+	endSpan := r.tracer.stage(name)
+	started := time.Now()
+	return func() {
+		endSpan()
+		elapsed := time.Since(started)
+		atomic.AddInt64(total, elapsed.Milliseconds())
+		r.logger.Printf("%s stage took %s", name, elapsed.Round(time.Millisecond))
+	}
+}
+
+// combined dumps the databases one after another into a single archive.
+func (r *run) combined(ctx context.Context, summary *Summary) error {
+	if r.cfg.StreamUploads {
+		return r.streamDumps(ctx, summary)
+	}
+
+	var backupFiles []archiveEntry
+	var compressor *segmentCompressor
+	if r.cfg.ParallelCompression {
+		compressor = r.newSegmentCompressor()
+		defer compressor.remove()
+	}
+	done := r.stage("dump", &summary.DumpMS)
+	if r.cfg.ConsistentSnapshot {
+		results, dumped, err := r.consistentDumps(ctx)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			summary.Databases = append(summary.Databases, result)
+			if compressor != nil {
+				dumped[i] = compressor.add(dumped[i])
+			}
+			backupFiles = append(backupFiles, dumped[i]...)
+		}
+	} else {
+		for i, db := range r.databases {
+			if err := r.pauseBeforeDatabase(ctx, i); err != nil {
+				if compressor != nil {
+					compressor.wait()
+				}
+				return err
+			}
+			result, entries := r.dumpDatabase(ctx, db)
+			summary.Databases = append(summary.Databases, result)
+			if compressor != nil {
+				entries = compressor.add(entries)
+			}
+			backupFiles = append(backupFiles, entries...)
+		}
+	}
+	done()
+	if compressor != nil {
+		done = r.stage("compress", &summary.ArchiveMS)
+		err := compressor.wait()
+		done()
+		if err != nil {
+			return fmt.Errorf("failed to compress: %w", err)
+		}
+	}
+	sortViewsLast(backupFiles)
+	if r.cfg.AllOrNothing {
+		if err := dumpFailures(summary.Databases); err != nil {
+			var staged []string
+			if r.cfg.rawDumps() {
+				staged = entryPaths(backupFiles)
+			}
+			return r.abort(ctx, summary, staged, err)
+		}
+	}
+
+	if r.cfg.rawDumps() {
+		defer r.stage("upload", &summary.UploadMS)()
+		err := uploadDumps(ctx, r.cfg, summary, r.dests, backupFiles)
+		if err != nil && r.cfg.AllOrNothing {
+			return r.abort(ctx, summary, entryPaths(backupFiles), err)
+		}
+		if err != nil {
+			return err
+		}
+		r.commitState(r.databases...)
+		r.pruneRemote(ctx, summary)
+		return nil
+	}
+
+	extra, err := extraFileEntries(r.cfg)
+	if err != nil {
+		return err
+	}
+	backupFiles = append(backupFiles, extra...)
+	if r.cfg.DumpGrants {
+		r.logger.Printf("dumping users and grants -> %s", grantsName)
+		grants, err := r.grantsEntry(ctx)
+		if err != nil {
+			return err
+		}
+		backupFiles = append(backupFiles, grants)
+	}
+	if r.cfg.CaptureServerVariables {
+		if info, ok := r.serverInfoEntry(ctx); ok {
+			backupFiles = append(backupFiles, info)
+		}
+	}
+	backupFiles, err = r.withMetadata(ctx, summary.Databases, backupFiles)
+	if err != nil {
+		return err
+	}
+	backupFiles = r.withRestoreScript(backupFiles)
+	if r.cfg.ArchiveWriter != nil {
+		r.logger.Printf("writing archive to the output stream")
+		done = r.stage("archive", &summary.ArchiveMS)
+		err = writeArchive(r.cfg, backupFiles, r.cfg.ArchiveWriter)
+		done()
+		if err != nil {
+			return fmt.Errorf("failed to archive: %w", err)
+		}
+		r.commitState(r.databases...)
+		return nil
+	}
+	if r.cfg.ChunkStore != "" {
+		err := r.chunked(ctx, summary, backupFiles)
+		if err == nil {
+			r.commitState(r.databases...)
+		}
+		return err
+	}
+
+	archiveCfg := r.archiveConfig("", backupFiles)
+	archivePath := filepath.Join(r.cfg.BackupDirectory, fmt.Sprintf("backup_%s%s", r.archiveStamp(), archiveCfg.archiveSuffix()))
+	done = r.stage("archive", &summary.ArchiveMS)
+	data, inMemory, err := r.archiveInMemory(archiveCfg, backupFiles, archivePath)
+	if err == nil && !inMemory {
+		r.logger.Printf("creating archive -> %s", archivePath)
+		err = archiveFiles(archiveCfg, backupFiles, archivePath)
+	}
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to archive: %w", err)
+	}
+	summary.Archive = archivePath
+	if inMemory {
+		summary.Archive = filepath.Base(archivePath)
+	}
+	summary.SHA256, err = r.finishArchive(summary, combinedSeries, "", archivePath, data)
+	if err != nil {
+		return err
+	}
+
+	r.logger.Printf("uploading -> %s", archivePath)
+	done = r.stage("upload", &summary.UploadMS)
+	if inMemory {
+		summary.Uploads, err = uploadFromMemory(ctx, r.cfg, r.dests, summary.Archive, data)
+	} else {
+		summary.Uploads, err = uploadArchive(ctx, r.cfg, r.dests, archivePath)
+	}
+	done()
+	if r.cfg.StreamChecksum {
+		summary.SHA256, _ = readChecksum(archivePath + checksumSuffix)
+	}
+	if err != nil && r.cfg.AllOrNothing {
+		return r.abort(ctx, summary, []string{archivePath}, fmt.Errorf("failed to upload: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+	r.commitState(r.databases...)
+	r.pruneRemote(ctx, summary)
+
+	if r.cfg.DeleteLocalAfterUpload && !inMemory {
+		removeLocalArchive(r.cfg, archivePath)
+	}
+	if r.cfg.LatestSymlink {
+		err = updateLatest(r.cfg, archivePath)
+		if err != nil {
+			r.logger.Printf("failed to update latest archive link: %v", err)
+		}
+	}
+	return nil
+}
+
+// finishArchive runs what every archive goes through between being created
+// and being uploaded: it reports the archive, checks its size and delta,
+// verifies it, writes its checksum and signature and copies it to
+// AdditionalBackupDirs. data is the archive when it was built in memory,
+// which rules out the steps that need the file. It returns the checksum
+// written, if any.
+func (r *run) finishArchive(summary *Summary, series, db, archivePath string, data []byte) (string, error) {
+	size := int64(len(data))
+	if data == nil {
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to check archive size: %w", err)
+		}
+		size = info.Size()
+	}
+	r.cfg.emit(Event{Type: EventArchiveCreated, Database: db, File: archivePath, Size: size})
+	err := r.checkSizeDrop(series, archivePath, size)
+	if err != nil {
+		return "", err
+	}
+	r.reportDelta(summary, series, archivePath, data)
+	if r.cfg.VerifyArchive {
+		err = testArchive(r.cfg, archivePath, data)
+		if err != nil {
+			return "", err
+		}
+	}
+	var sum string
+	if r.cfg.Checksum && !r.cfg.StreamChecksum {
+		sum, err = writeChecksum(archivePath)
+		if err != nil {
+			return "", err
+		}
+	}
+	if r.cfg.SigningKeyPath != "" {
+		err = signArchive(archivePath, r.cfg.SigningKeyPath)
+		if err != nil {
+			return "", err
+		}
+	}
+	r.copyToLocalDirs(summary, archivePath)
+	return sum, nil
+}
+
+// chunked stores the archive as deduplicated chunks and uploads the new
+// chunks together with the manifest.
+func (r *run) chunked(ctx context.Context, summary *Summary, backupFiles []archiveEntry) error {
+	err := os.MkdirAll(r.cfg.ChunkStore, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk store: %w", err)
+	}
+	manifestPath := filepath.Join(r.cfg.ChunkStore, fmt.Sprintf("backup_%s.chunks.json", r.timestamp))
+	r.logger.Printf("creating chunked archive -> %s", manifestPath)
+	done := r.stage("archive", &summary.ArchiveMS)
+	newChunks, manifest, err := chunkArchive(r.cfg, backupFiles, manifestPath)
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to archive: %w", err)
+	}
+	r.cfg.emit(Event{Type: EventArchiveCreated, File: manifestPath})
+	summary.Archive = manifestPath
+	summary.NewChunks = len(newChunks)
+	summary.ReusedChunks = len(manifest.Chunks) - len(newChunks)
+	r.logger.Printf("archive has %d chunks, %d of them new", len(manifest.Chunks), len(newChunks))
+
+	r.logger.Printf("uploading -> %s", manifestPath)
+	done = r.stage("upload", &summary.UploadMS)
+	summary.Uploads, err = forEachDestination(ctx, r.cfg, r.dests, manifestPath, func(ctx context.Context, dest Destination) (string, error) {
+		return uploadChunks(ctx, r.cfg, dest, r.cfg.ChunkStore, manifest, manifestPath)
+	})
+	done()
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+	return nil
+}
+
+// checkSuccessThreshold fails the run when more databases failed than
+// MaxFailedDatabases allows or fewer succeeded than MinSuccessRatio requires.
+// The successful dumps have been shipped regardless.
+func checkSuccessThreshold(cfg Config, summary Summary) error {
+	total := len(summary.Databases)
+	failed := 0
+	var unrestorable []string
+	var errs, verifyErrs []error
+	for _, db := range summary.Databases {
+		if db.Error == "" {
+			continue
+		}
+		failed++
+		err := db.err
+		if err == nil {
+			err = errors.New(db.Error)
+		}
+		errs = append(errs, &DatabaseError{Database: db.Name, Err: err})
+		if db.VerifyFailed {
+			unrestorable = append(unrestorable, db.Name)
+			verifyErrs = append(verifyErrs, errs[len(errs)-1])
+		}
+	}
+	if len(unrestorable) > 0 {
+		return fmt.Errorf("restore verification failed for %s: %w", strings.Join(unrestorable, ", "), errors.Join(verifyErrs...))
+	}
+	if cfg.MaxFailedDatabases > 0 && failed > cfg.MaxFailedDatabases {
+		return fmt.Errorf("%d of %d databases failed, more than the allowed %d: %w", failed, total, cfg.MaxFailedDatabases, errors.Join(errs...))
+	}
+	if cfg.MinSuccessRatio > 0 && total > 0 {
+		ratio := float64(total-failed) / float64(total)
+		if ratio < cfg.MinSuccessRatio {
+			return fmt.Errorf("only %d of %d databases backed up, below the required ratio %.2f: %w", total-failed, total, cfg.MinSuccessRatio, errors.Join(errs...))
+		}
+	}
+	return nil
+}
+
+// dumpDatabase dumps a single database and returns its result together with
+// the files to archive. Failures are logged and reported in the result.
+func (r *run) dumpDatabase(ctx context.Context, unit string) (result DatabaseResult, entries []archiveEntry) {
+	cfg, logger := r.cfg, r.logger
+	db, tables := cfg.tableGroup(unit)
+	cfg.emit(Event{Type: EventDatabaseStarted, Database: unit})
+	defer func() {
+		if result.Error == "" && len(entries) > 0 {
+			if err := r.journal.record(unit, entries); err != nil {
+				logger.Printf("failed to record dump of %s in the run journal: %v", unit, err)
+			}
+			result.Size = entriesSize(entries)
+		}
+		cfg.emit(Event{Type: EventDatabaseFinished, Database: unit, File: result.File, Size: result.Size, Skipped: result.Skipped, Error: result.Error})
+	}()
+
+	if cfg.SkipUnchangedDatabases {
+		unchanged, updated := r.unchanged(ctx, db)
+		if unchanged {
+			logger.Printf("skipping database %s, unchanged since %s", db, updated)
+			return DatabaseResult{Name: unit, Skipped: true}, nil
+		}
+		r.setPending(db, DatabaseState{LastBackup: r.started, LastUpdateTime: updated})
+	}
+	if done, ok := r.journal.completed(unit); ok {
+		logger.Printf("reusing dump of %s from the interrupted run", unit)
+		return DatabaseResult{Name: unit, File: done[0].path}, done
+	}
+	if tables == nil {
+		r.maintainDatabase(ctx, db)
+	}
+
+	dumpCtx, cancel := dumpContext(ctx, cfg)
+	defer cancel()
+
+	excluded, err := excludedTables(ctx, cfg, db)
+	if err != nil {
+		logger.Printf("failed to backup database %s: %v", db, err)
+		return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+	}
+	if tables != nil && len(withoutExcluded(tables, excluded)) == 0 {
+		// Dumping the group without tables would dump the whole database.
+		logger.Printf("skipping table group %s, all of its tables are excluded", unit)
+		return DatabaseResult{Name: unit, Skipped: true}, nil
+	}
+
+	if cfg.TabExport {
+		dir := filepath.Join(cfg.TabDirectory, db)
+		logger.Printf("creating tab-separated database backup %s -> %s", db, dir)
+		files, err := backupDatabaseTab(dumpCtx, cfg, db, ignoreTableArgs(db, excluded)...)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		var entries []archiveEntry
+		for _, file := range files {
+			entries = append(entries, archiveEntry{path: file, name: r.entryName(db, db+"/"+filepath.Base(file))})
+		}
+		return DatabaseResult{Name: unit, File: dir}, entries
+	}
+	if cfg.dumpTool() == DumpToolMydumper {
+		logger.Printf("creating mydumper backup %s -> %s", db, filepath.Join(cfg.BackupDirectory, db+".mydumper"))
+		dir, files, err := backupDatabaseMydumper(dumpCtx, cfg, db)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		var entries []archiveEntry
+		for _, file := range files {
+			entries = append(entries, archiveEntry{path: file, name: r.entryName(db, mydumperPrefix+db+"/"+filepath.Base(file))})
+		}
+		return DatabaseResult{Name: unit, File: dir}, entries
+	}
+
+	backupFile := filepath.Join(cfg.BackupDirectory, unit+".sql")
+	if cfg.GzipDumps {
+		backupFile = filepath.Join(cfg.BackupDirectory, fmt.Sprintf("%s_%s.sql.gz", unit, r.timestamp))
+	} else if cfg.rawDumps() {
+		backupFile = filepath.Join(cfg.BackupDirectory, fmt.Sprintf("%s_%s.sql", unit, r.timestamp))
+	}
+	var views, skippedViews []string
+	parallel := cfg.ParallelTables > 1 && tables == nil
+	if (cfg.DumpViewsLast || parallel) && tables == nil {
+		views, err = listViews(ctx, cfg, db)
+		if err != nil {
+			logger.Printf("failed to list views of %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		views = withoutExcluded(views, excluded)
+	}
+
+	// A group dumps just its tables; the rest of the database leaves out
+	// every grouped table.
+	var incremental, exported, schemaOnly []string
+	if tables == nil {
+		incremental = withoutExcluded(tablesOf(cfg.IncrementalColumns, db), excluded)
+		exported = withoutExcluded(tablesOf(cfg.ExportFormats, db), excluded)
+		schemaOnly, err = schemaOnlyTables(ctx, cfg, db, slices.Concat(excluded, cfg.groupedTables(db), incremental, exported))
+		if err != nil {
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+	}
+	// Everything the main dump leaves out, as it is dumped on its own.
+	ignored := slices.Concat(views, excluded, cfg.groupedTables(db), incremental, exported, schemaOnly)
+	args := append(ignoreTableArgs(db, ignored), db)
+	if tables != nil {
+		args = append([]string{db}, withoutExcluded(tables, excluded)...)
+	}
+	output := &dumpOutput{file: backupFile}
+	if r.dumpsInMemory() && !parallel && len(schemaOnly) == 0 && len(exported) == 0 {
+		output.memoryLimit = int64(cfg.InMemoryArchiveMaxMB) << 20
+	}
+	logger.Printf("creating database backup %s -> %s", unit, backupFile)
+	stopProgress := watchProgress(ctx, cfg, unit, backupFile)
+	stopCheckpoints := r.watchCheckpoints(ctx, unit, backupFile)
+	if parallel {
+		// Views can't be dumped in the parts, they go into the views dump.
+		err = dumpTablesParallel(dumpCtx, cfg, db, backupFile, ignored)
+	} else {
+		skippedViews, err = dumpSkippingInvalidViews(dumpCtx, cfg, db, output, func(skipped []string) []string {
+			return append(ignoreTableArgs(db, skipped), args...)
+		})
+	}
+	stopProgress()
+	stopCheckpoints()
+	if err != nil {
+		err = timeoutError(cfg, dumpCtx, err, backupFile)
+		logger.Printf("failed to backup database %s: %v", db, err)
+		return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+	}
+	if len(schemaOnly) > 0 {
+		logger.Printf("dumping only the schema of %s, bigger than %d MB: %s", db, cfg.SchemaOnlyAboveMB, strings.Join(schemaOnly, ", "))
+		err = appendSchemaOnly(dumpCtx, cfg, db, backupFile, schemaOnly)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err, backupFile)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+	}
+	if len(exported) > 0 {
+		// The rows are exported, but restore still needs the tables.
+		err = appendSchemaOnly(dumpCtx, cfg, db, backupFile, exported)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err, backupFile)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+	}
+	files := []string{backupFile}
+	inMemory := map[string][]byte{}
+	if output.inMemory {
+		inMemory[backupFile] = output.data
+	}
+
+	if views = withoutExcluded(views, skippedViews); len(views) > 0 {
+		file := viewsFile(backupFile)
+		viewsOutput := &dumpOutput{file: file, memoryLimit: output.memoryLimit}
+		logger.Printf("creating views backup %s -> %s", db, file)
+		skipped, err := dumpSkippingInvalidViews(dumpCtx, cfg, db, viewsOutput, func(skipped []string) []string {
+			if kept := withoutExcluded(views, skipped); len(kept) > 0 {
+				return append([]string{"--skip-triggers", db}, kept...)
+			}
+			return nil
+		})
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err, file)
+			logger.Printf("failed to backup views of %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		skippedViews = append(skippedViews, skipped...)
+		if len(withoutExcluded(views, skipped)) > 0 {
+			files = append(files, file)
+			if viewsOutput.inMemory {
+				inMemory[file] = viewsOutput.data
+			}
+		} else {
+			os.Remove(file)
+		}
+	}
+
+	if cfg.VerifyRestore {
+		logger.Printf("verifying backup of %s by restoring it", db)
+		err = verifyRestore(ctx, cfg, db, r.timestamp, files...)
+		if err != nil {
+			logger.Printf("restore verification of %s failed: %v", db, err)
+			err = fmt.Errorf("restore verification failed: %w", err)
+			return DatabaseResult{Name: unit, Error: err.Error(), VerifyFailed: true, err: err}, nil
+		}
+	}
+	for _, file := range files {
+		// The dump of a group is named after its database, so restoring
+		// the archive loads it there.
+		name := strings.Replace(filepath.Base(file), unit, db, 1)
+		if data, ok := inMemory[file]; ok {
+			entries = append(entries, archiveEntry{name: r.entryName(db, name), data: data})
+			continue
+		}
+		entries = append(entries, archiveEntry{path: file, name: r.entryName(db, name)})
+	}
+	if len(incremental) > 0 {
+		incrementalEntries, err := r.dumpIncremental(dumpCtx, db, incremental)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		entries = append(entries, incrementalEntries...)
+	}
+	if len(exported) > 0 {
+		exportEntries, err := r.exportTables(dumpCtx, db, exported)
+		if err != nil {
+			err = timeoutError(cfg, dumpCtx, err)
+			logger.Printf("failed to backup database %s: %v", db, err)
+			return DatabaseResult{Name: unit, Error: err.Error(), err: err}, nil
+		}
+		entries = append(entries, exportEntries...)
+	}
+	return DatabaseResult{Name: unit, File: backupFile, SkippedViews: skippedViews, SchemaOnlyTables: schemaOnly}, entries
+}
+
+// setPending remembers the state to record for db once its backup has been
+// shipped.
+func (r *run) setPending(db string, dbState DatabaseState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[db] = dbState
+}
+
+// commitState records the pending state of the given databases, which have
+// been shipped successfully.
+func (r *run) commitState(dbs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, db := range dbs {
+		if r.cfg.DatabaseBatchSize > 0 {
+			r.state.markBatched(db)
+		}
+		if dbState, ok := r.pending[db]; ok {
+			r.state.setDatabase(db, dbState)
+		}
+		for table, position := range r.pendingCursors[db] {
+			r.state.setIncrementalPosition(table, position)
+		}
+		if size, ok := r.pendingSizes[db]; ok {
+			r.state.setArchiveSize(db, size)
+		}
+	}
+	// The combined archive holds every database, and is shipped with them.
+	if size, ok := r.pendingSizes[combinedSeries]; ok {
+		r.state.setArchiveSize(combinedSeries, size)
+	}
+}
+
+// uploadDumps uploads every dump file on its own to all destinations.
+func uploadDumps(ctx context.Context, cfg Config, summary *Summary, dests []Destination, files []archiveEntry) error {
+	var errs []error
+	for _, file := range files {
+		cfg.logger().Printf("uploading -> %s", file.path)
+		results, err := uploadToAll(ctx, cfg, dests, file.path)
+		summary.Uploads = append(summary.Uploads, results...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.name, err))
+			if cfg.UploadFailureMode == UploadFailFast {
+				break
+			}
+			continue
+		}
+		if cfg.DeleteLocalAfterUpload {
+			removeLocalArchive(cfg, file.path)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to upload: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// removeLocalArchive deletes an uploaded archive and its .sha256 sidecar.
+func removeLocalArchive(cfg Config, archivePath string) {
+	for _, file := range append([]string{archivePath}, existingSidecars(archivePath)...) {
+		err := os.Remove(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			cfg.logger().Printf("failed to remove local archive %s: %v", file, err)
+		}
+	}
+}
+
+func (c Config) logger() *log.Logger {
+	if c.Logger != nil {
+		return c.redactingLogger(c.Logger)
+	}
+	return c.redactingLogger(log.Default())
+}
@@ -0,0 +1,40 @@
+package backupify
+
+// nextBatch picks the next DatabaseBatchSize databases, in the order of
+// Databases, among those not yet shipped in the current cycle, and starts a
+// new cycle once every database has been. Databases are marked as shipped
+// by commitState, so a batch that fails is tried again by the next run, and
+// adding or removing databases doesn't shift the others.
+func (r *run) nextBatch() []string {
+	total := len(r.cfg.Databases)
+	size := r.cfg.DatabaseBatchSize
+	if total == 0 || size >= total {
+		return r.cfg.Databases
+	}
+
+	batch, done := batchFrom(r.cfg.Databases, r.state.batchDone(), size)
+	if done == 0 {
+		r.state.setBatchDone(nil)
+	}
+	r.logger.Printf("backing up %d of %d databases in this batch, %d already done in this cycle", len(batch), total, done)
+	return batch
+}
+
+// batchFrom returns up to size databases that aren't in done, and how many
+// of databases are in done. When all of them are, it starts over with the
+// first size and reports none done.
+func batchFrom(databases []string, done map[string]bool, size int) ([]string, int) {
+	var batch []string
+	count := 0
+	for _, db := range databases {
+		if done[db] {
+			count++
+		} else if len(batch) < size {
+			batch = append(batch, db)
+		}
+	}
+	if len(batch) == 0 {
+		return databases[:size], 0
+	}
+	return batch, count
+}
@@ -0,0 +1,107 @@
+package backupify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// benchmarkSampleSize is how much of a dump BenchmarkCompression reads.
+const benchmarkSampleSize = 64 << 20
+
+// CompressionBenchmark is the result of compressing a sample with one codec
+// and level.
+type CompressionBenchmark struct {
+	Codec    string
+	Level    string
+	Size     int64
+	Duration time.Duration
+}
+
+// ReadBenchmarkSample reads the first 64 MiB of a dump file.
+func ReadBenchmarkSample(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sample: %w", err)
+	}
+	defer file.Close()
+	sample, err := io.ReadAll(io.LimitReader(file, benchmarkSampleSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sample: %w", err)
+	}
+	return sample, nil
+}
+
+// BenchmarkCompression compresses sample with gzip, zstd and brotli at
+// their fast, default and best levels, and with xz when it is installed,
+// which can be used through CompressCommand.
+func BenchmarkCompression(sample []byte) ([]CompressionBenchmark, error) {
+	type codec struct {
+		name, level string
+		writer      func(io.Writer) (io.WriteCloser, error)
+	}
+	gzipLevel := func(level int) func(io.Writer) (io.WriteCloser, error) {
+		return func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) }
+	}
+	zstdLevel := func(level zstd.EncoderLevel) func(io.Writer) (io.WriteCloser, error) {
+		return func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w, zstd.WithEncoderLevel(level)) }
+	}
+	codecs := []codec{
+		{CompressionGzip, "1", gzipLevel(gzip.BestSpeed)},
+		{CompressionGzip, "6", gzipLevel(gzip.DefaultCompression)},
+		{CompressionGzip, "9", gzipLevel(gzip.BestCompression)},
+		{CompressionZstd, "1", zstdLevel(zstd.SpeedFastest)},
+		{CompressionZstd, "3", zstdLevel(zstd.SpeedDefault)},
+		{CompressionZstd, "19", zstdLevel(zstd.SpeedBestCompression)},
+	}
+	for _, level := range []int{1, 5, 9} {
+		codecs = append(codecs, codec{CompressionBrotli, strconv.Itoa(level), func(w io.Writer) (io.WriteCloser, error) {
+			return brotli.NewWriterLevel(w, level), nil
+		}})
+	}
+	if _, err := exec.LookPath("xz"); err == nil {
+		for _, level := range []string{"1", "6"} {
+			level := level
+			codecs = append(codecs, codec{"xz", level, func(w io.Writer) (io.WriteCloser, error) {
+				return startCompressCommand("xz -T0 -"+level, w)
+			}})
+		}
+	}
+
+	var results []CompressionBenchmark
+	for _, c := range codecs {
+		var out countingWriter
+		started := time.Now()
+		w, err := c.writer(&out)
+		if err != nil {
+			return results, fmt.Errorf("failed to start %s: %w", c.name, err)
+		}
+		_, err = io.Copy(w, bytes.NewReader(sample))
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to compress with %s: %w", c.name, err)
+		}
+		results = append(results, CompressionBenchmark{Codec: c.name, Level: c.level, Size: out.n, Duration: time.Since(started)})
+	}
+	return results, nil
+}
+
+// countingWriter discards what is written and counts the bytes.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
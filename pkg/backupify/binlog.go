@@ -0,0 +1,78 @@
+package backupify
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// binlogScanSize bounds how much of the head of a dump is searched for the
+// CHANGE MASTER TO statement --master-data writes.
+const binlogScanSize = 1 << 20
+
+// changeMasterPattern matches the binlog coordinates mysqldump writes with
+// --master-data (CHANGE REPLICATION SOURCE TO on newer servers).
+var changeMasterPattern = regexp.MustCompile(`CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+
+// BinlogPosition is the binary log position a dump made with MasterData
+// is consistent with, the starting point for replaying binlogs.
+type BinlogPosition struct {
+	File     string `json:"file"`
+	Position int64  `json:"position"`
+}
+
+// dumpBinlogPosition reads the binlog position from the head of the dump
+// at path. It reports false when the dump has none.
+func dumpBinlogPosition(path string) (BinlogPosition, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return BinlogPosition{}, false
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return BinlogPosition{}, false
+		}
+		defer gzReader.Close()
+		r = gzReader
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(r, binlogScanSize))
+	scanner.Buffer(make([]byte, 64<<10), binlogScanSize)
+	for scanner.Scan() {
+		m := changeMasterPattern.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		position, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return BinlogPosition{}, false
+		}
+		return BinlogPosition{File: m[1], Position: position}, true
+	}
+	return BinlogPosition{}, false
+}
+
+// flushBinaryLogs starts a new binlog file before the first dump when
+// FlushLogs is set. It runs once per run, where mysqldump's --flush-logs
+// would rotate the binlog for every database.
+func flushBinaryLogs(ctx context.Context, config Config) error {
+	if !config.FlushLogs {
+		return nil
+	}
+	config.logger().Printf("flushing binary logs before the first dump")
+	_, err := queryMySQL(ctx, config, "FLUSH BINARY LOGS")
+	if err != nil {
+		return fmt.Errorf("failed to flush binary logs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package backupify
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressionBrotli writes .tar.br archives with andybalholm/brotli.
+const CompressionBrotli = "brotli"
+
+// newBrotliWriter compresses into out with brotli at the configured
+// quality, or brotli's own default.
+func newBrotliWriter(config Config, out io.Writer) io.WriteCloser {
+	if level := config.compressionLevel(); level > 0 {
+		return brotli.NewWriterLevel(out, level)
+	}
+	return brotli.NewWriter(out)
+}
+
+// newBrotliReader decompresses a brotli stream.
+func newBrotliReader(r io.Reader) io.ReadCloser {
+	return io.NopCloser(brotli.NewReader(r))
+}
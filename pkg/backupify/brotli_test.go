@@ -0,0 +1,40 @@
+package backupify
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBrotliRoundTrip(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO `orders` VALUES (1,'pending'),(2,'shipped');\n", 1000)
+	for _, level := range []CompressionLevel{"", "1", "11"} {
+		t.Run("level "+string(level), func(t *testing.T) {
+			var archive bytes.Buffer
+			w, err := newCompressor(Config{Compression: CompressionBrotli, CompressionLevel: level}, &archive)
+			if err != nil {
+				t.Fatalf("newCompressor() = %v", err)
+			}
+			if _, err := io.WriteString(w, dump); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if archive.Len() >= len(dump) {
+				t.Errorf("compressed %d bytes into %d", len(dump), archive.Len())
+			}
+
+			r, err := decompressArchive(&archive, "backup_20240102_030405.tar.br", "")
+			if err != nil {
+				t.Fatalf("decompressArchive() = %v", err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil || string(got) != dump {
+				t.Errorf("read back %d bytes, %v, want the %d bytes written", len(got), err, len(dump))
+			}
+		})
+	}
+}
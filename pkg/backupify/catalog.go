@@ -0,0 +1,133 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const catalogName = "catalog.jsonl"
+
+// CatalogEntry is the line a successful run appends to the catalog.
+type CatalogEntry struct {
+	RunID     string        `json:"run_id,omitempty"`
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Databases []string      `json:"databases"`
+	Files     []CatalogFile `json:"files"`
+	// AppVersion is Config.AppVersion, if set.
+	AppVersion string `json:"app_version,omitempty"`
+	// EstimatedMonthlyCost is Summary.EstimatedMonthlyCost, with
+	// StorageCostPerGB.
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost,omitempty"`
+}
+
+// CatalogFile is a file a run shipped, with where it was uploaded to.
+type CatalogFile struct {
+	Name         string   `json:"name"`
+	Size         int64    `json:"size,omitempty"`
+	SHA256       string   `json:"sha256,omitempty"`
+	Destinations []string `json:"destinations"`
+}
+
+// newCatalogEntry collects the backed up databases and uploaded files of
+// summary.
+func (r *run) newCatalogEntry(summary Summary) CatalogEntry {
+	entry := CatalogEntry{RunID: r.cfg.RunID, Started: r.started, Finished: time.Now(), AppVersion: r.cfg.AppVersion, EstimatedMonthlyCost: summary.EstimatedMonthlyCost}
+	for _, db := range summary.Databases {
+		if db.Error == "" && !db.Skipped {
+			entry.Databases = append(entry.Databases, db.Name)
+		}
+	}
+
+	files := map[string]int{}
+	for _, upload := range summary.Uploads {
+		if upload.Error != "" {
+			continue
+		}
+		name := path.Base(upload.RemotePath)
+		i, ok := files[name]
+		if !ok {
+			i = len(entry.Files)
+			files[name] = i
+			entry.Files = append(entry.Files, CatalogFile{Name: name, Size: upload.Size, SHA256: upload.SHA256})
+		}
+		entry.Files[i].Destinations = append(entry.Files[i].Destinations, upload.Destination)
+	}
+	return entry
+}
+
+// appendCatalog appends the record of a successful run to CatalogPath, and
+// with UploadCatalog to catalog.jsonl on every FTP destination. They are a
+// record of what was backed up, so failures are logged rather than failing
+// a backup that has been shipped.
+func (r *run) appendCatalog(ctx context.Context, summary Summary) {
+	line, err := json.Marshal(r.newCatalogEntry(summary))
+	if err != nil {
+		r.logger.Printf("failed to encode catalog entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if r.cfg.CatalogPath != "" {
+		err = appendLocalCatalog(r.cfg.CatalogPath, line)
+		if err != nil {
+			r.logger.Printf("failed to append to catalog: %v", err)
+		}
+	}
+	if !r.cfg.UploadCatalog {
+		return
+	}
+	for _, dest := range expandFailover(r.dests) {
+		if !dest.isFTP() {
+			r.logger.Printf("skipping catalog for %s destination %s", dest.Type, dest.Name)
+			continue
+		}
+		err = appendRemoteCatalog(ctx, r.cfg, dest, line)
+		if err != nil {
+			r.logger.Printf("failed to append to catalog on %s: %v", dest.Name, err)
+		}
+	}
+}
+
+func appendLocalCatalog(catalogPath string, line []byte) error {
+	err := os.MkdirAll(filepath.Dir(catalogPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(catalogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(line)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// appendRemoteCatalog appends line to catalog.jsonl in the directory of
+// dest with APPE, which creates the file if needed.
+func appendRemoteCatalog(ctx context.Context, config Config, dest Destination, line []byte) error {
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		return err
+	}
+	err = conn.Append(path.Join(dest.Directory, catalogName), bytes.NewReader(line))
+	if err != nil {
+		return fmt.Errorf("failed to append: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCDCFlushSeconds = 300
+
+// cdcKey is the key RunCDC keeps its position under, apart from the state
+// that backup runs rewrite while it is running.
+const cdcKey = "cdc"
+
+// cdcPosition is what RunCDC keeps under cdcKey.
+type cdcPosition struct {
+	// Binlog is the last binlog file shipped.
+	Binlog string `json:"binlog"`
+}
+
+// loadCDCBinlog returns the last binlog file RunCDC shipped. Positions
+// kept in the state by older versions are still read.
+func loadCDCBinlog(store StateStore) (string, error) {
+	data, err := store.Get(cdcKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cdc position: %w", err)
+	}
+	if data == nil {
+		st, err := loadState(store)
+		if err != nil {
+			return "", err
+		}
+		return st.cdcBinlog(), nil
+	}
+	var position cdcPosition
+	err = json.Unmarshal(data, &position)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse cdc position: %w", err)
+	}
+	return position.Binlog, nil
+}
+
+func saveCDCBinlog(store StateStore, name string) error {
+	data, err := json.Marshal(cdcPosition{Binlog: name})
+	if err != nil {
+		return err
+	}
+	err = store.Set(cdcKey, data)
+	if err != nil {
+		return fmt.Errorf("failed to write cdc position: %w", err)
+	}
+	return nil
+}
+
+func (c Config) cdcFlushInterval() time.Duration {
+	if c.CDCFlushSeconds <= 0 {
+		return defaultCDCFlushSeconds * time.Second
+	}
+	return time.Duration(c.CDCFlushSeconds) * time.Second
+}
+
+// RunCDC copies the binary log of the server continuously until ctx is
+// cancelled or mysqlbinlog fails. mysqlbinlog streams binlog files into
+// CDCDirectory; every CDCFlushSeconds the finished ones are gzipped and
+// uploaded to all destinations, and with CDCRotateBinlog FLUSH BINARY LOGS
+// rotates the current one so that it is shipped the next time. The last
+// shipped file is kept under cdcKey and the next run continues after it.
+func RunCDC(ctx context.Context, config Config) error {
+	if config.CDCDirectory == "" {
+		return fmt.Errorf("%w: cdc_directory is not set", ErrConfigInvalid)
+	}
+	err := config.Validate()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	err = os.MkdirAll(config.CDCDirectory, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create cdc directory: %w", err)
+	}
+	err = checkBinlogSettings(ctx, config)
+	if err != nil {
+		return err
+	}
+	shipped, err := loadCDCBinlog(config.stateStore())
+	if err != nil {
+		return err
+	}
+	start, err := cdcStartFile(ctx, config, shipped)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	args := append(dumpArgs(config), "--read-from-remote-server", "--raw", "--stop-never",
+		"--result-file="+config.CDCDirectory+string(filepath.Separator), start)
+	cmd := exec.CommandContext(ctx, "mysqlbinlog", args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	config.logger().Printf("streaming binary log from %s -> %s", start, config.CDCDirectory)
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start mysqlbinlog: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ticker := time.NewTicker(config.cdcFlushInterval())
+	defer ticker.Stop()
+	for {
+		err = shipBinlogs(ctx, config)
+		if err != nil {
+			config.logger().Printf("failed to ship binary logs, retrying later: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			<-exited
+			return ctx.Err()
+		case err := <-exited:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("mysqlbinlog exited: %w: %s", err, strings.TrimSpace(stderr.String()))
+		case <-ticker.C:
+		}
+		if !config.CDCRotateBinlog {
+			continue
+		}
+		_, err = queryMySQL(ctx, config, "FLUSH BINARY LOGS")
+		if err != nil {
+			config.logger().Printf("failed to rotate binary log: %v", err)
+		}
+	}
+}
+
+// checkBinlogSettings fails when the server has no binary log and warns
+// when it isn't row-based, because statement-based events may not replay
+// to the same data.
+func checkBinlogSettings(ctx context.Context, config Config) error {
+	rows, err := queryMySQL(ctx, config, "SELECT @@log_bin, @@binlog_format")
+	if err != nil {
+		return fmt.Errorf("failed to check binary log settings: %w", err)
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return fmt.Errorf("failed to check binary log settings: no result")
+	}
+	if rows[0][0] != "1" {
+		return fmt.Errorf("binary logging is disabled on the server, enable log_bin for cdc")
+	}
+	if !strings.EqualFold(rows[0][1], "ROW") {
+		config.logger().Printf("binlog_format is %s, ROW is recommended for cdc", rows[0][1])
+	}
+	return nil
+}
+
+// cdcStartFile returns the binlog file to stream from: the newest one in
+// CDCDirectory, which may be incomplete, else the one after shipped, else
+// the server's current file, so nothing from before the first run is
+// copied.
+func cdcStartFile(ctx context.Context, config Config, shipped string) (string, error) {
+	files, err := localBinlogs(config.CDCDirectory)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		return files[len(files)-1], nil
+	}
+	if shipped != "" {
+		return nextBinlog(shipped), nil
+	}
+	rows, err := queryMySQL(ctx, config, "SHOW MASTER STATUS")
+	if err != nil {
+		// MySQL 8.4 only has the new name.
+		rows, err = queryMySQL(ctx, config, "SHOW BINARY LOG STATUS")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read binary log position: %w", err)
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return "", fmt.Errorf("failed to read binary log position: no result")
+	}
+	return rows[0][0], nil
+}
+
+// nextBinlog returns the file that follows name, e.g. mysql-bin.000124
+// after mysql-bin.000123.
+func nextBinlog(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	n, err := strconv.Atoi(name[i+1:])
+	if i < 0 || err != nil {
+		return name
+	}
+	return fmt.Sprintf("%s.%0*d", name[:i], len(name)-i-1, n+1)
+}
+
+// localBinlogs returns the binlog files mysqlbinlog wrote to dir, oldest
+// first.
+func localBinlogs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cdc directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		i := strings.LastIndexByte(name, '.')
+		if _, err := strconv.Atoi(name[i+1:]); i > 0 && err == nil && entry.Type().IsRegular() {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// shipBinlogs gzips and uploads every finished binlog file in
+// CDCDirectory, oldest first, and removes it once all destinations have
+// it. The newest file is still being written and stays.
+func shipBinlogs(ctx context.Context, config Config) error {
+	files, err := localBinlogs(config.CDCDirectory)
+	if err != nil || len(files) < 2 {
+		return err
+	}
+	for _, name := range files[:len(files)-1] {
+		file := filepath.Join(config.CDCDirectory, name)
+		gzPath, err := gzipFile(config, file)
+		if err != nil {
+			return err
+		}
+		config.logger().Printf("uploading -> %s", gzPath)
+		_, err = uploadToAll(ctx, config, renderDestinations(config.destinations(), time.Now()), gzPath)
+		if err != nil {
+			return err
+		}
+		os.Remove(gzPath)
+		os.Remove(file)
+		err = saveCDCBinlog(config.stateStore(), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gzipFile writes a gzipped copy of file next to it and returns its path.
+func gzipFile(config Config, file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer in.Close()
+	gzPath := file + ".gz"
+	out, err := os.Create(gzPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", gzPath, err)
+	}
+	defer out.Close()
+	gzWriter := newGzipWriter(config, out)
+	_, err = io.Copy(gzWriter, in)
+	if err == nil {
+		err = gzWriter.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		os.Remove(gzPath)
+		return "", fmt.Errorf("failed to compress %s: %w", file, err)
+	}
+	return gzPath, nil
+}
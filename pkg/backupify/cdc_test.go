@@ -0,0 +1,105 @@
+package backupify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCDCBinlog(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		cdc   string
+		want  string
+	}{
+		{name: "first run"},
+		{name: "own key", cdc: `{"binlog":"binlog.000012"}`, want: "binlog.000012"},
+		{name: "kept in the state by older versions", state: `{"cdc_binlog":"binlog.000007"}`, want: "binlog.000007"},
+		{name: "own key wins over the state", state: `{"cdc_binlog":"binlog.000007"}`, cdc: `{"binlog":"binlog.000012"}`, want: "binlog.000012"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{".backupify-state.json": tt.state, ".backupify-cdc.json": tt.cdc}
+			for name, data := range files {
+				if data == "" {
+					continue
+				}
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := loadCDCBinlog(Config{StateDirectory: dir}.stateStore())
+			if err != nil {
+				t.Fatalf("loadCDCBinlog() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("loadCDCBinlog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveCDCBinlogKeepsState(t *testing.T) {
+	store := Config{StateDirectory: t.TempDir()}.stateStore()
+	st, err := loadState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCDCBinlog(store, "binlog.000003"); err != nil {
+		t.Fatalf("saveCDCBinlog() = %v", err)
+	}
+	st.dirty = true
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCDCBinlog(store)
+	if err != nil {
+		t.Fatalf("loadCDCBinlog() = %v", err)
+	}
+	if got != "binlog.000003" {
+		t.Errorf("loadCDCBinlog() after a state save = %q, want %q", got, "binlog.000003")
+	}
+}
+
+func TestNextBinlog(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"binlog.000001", "binlog.000002"},
+		{"mysql-bin.000999", "mysql-bin.001000"},
+		{"binlog.999", "binlog.1000"},
+		{"binlog", "binlog"},
+		{"binlog.index", "binlog.index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextBinlog(tt.name); got != tt.want {
+				t.Errorf("nextBinlog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalBinlogs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"binlog.000002", "binlog.000001", "binlog.index", "binlog.000001.gz", ".000003"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "binlog.000004"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := localBinlogs(dir)
+	if err != nil {
+		t.Fatalf("localBinlogs() = %v", err)
+	}
+	want := []string{"binlog.000001", "binlog.000002"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("localBinlogs() = %v, want %v", got, want)
+	}
+}
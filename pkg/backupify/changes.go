@@ -0,0 +1,34 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+)
+
+// lastUpdateTime returns the newest UPDATE_TIME of the tables in database,
+// or "" when the server doesn't track it for any of them.
+func lastUpdateTime(ctx context.Context, config Config, database string) (string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT MAX(UPDATE_TIME) FROM information_schema.tables WHERE table_schema = "+quoteString(database))
+	if err != nil {
+		return "", fmt.Errorf("failed to query update time: %w", err)
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 || rows[0][0] == "NULL" {
+		return "", nil
+	}
+	return rows[0][0], nil
+}
+
+// unchanged reports whether database has not been modified since its last
+// successful backup, and returns the update time to record after this one.
+// A database whose update time is unknown is always considered changed.
+func (r *run) unchanged(ctx context.Context, database string) (bool, string) {
+	updated, err := lastUpdateTime(ctx, r.cfg, database)
+	if err != nil {
+		r.logger.Printf("failed to check %s for changes, backing it up: %v", database, err)
+		return false, ""
+	}
+	if updated == "" {
+		return false, ""
+	}
+	return updated == r.state.database(database).LastUpdateTime, updated
+}
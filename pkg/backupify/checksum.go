@@ -0,0 +1,200 @@
+package backupify
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const checksumSuffix = ".sha256"
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeChecksum writes the <archive>.sha256 sidecar in sha256sum format.
+func writeChecksum(archivePath string) (string, error) {
+	sum, err := fileSHA256(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum archive: %w", err)
+	}
+	return sum, writeChecksumFile(archivePath, sum)
+}
+
+// writeChecksumFile writes the .sha256 sidecar of archivePath for sum. With
+// StreamChecksum every destination writes it once its upload is done, so
+// the file is replaced atomically and never seen half written.
+func writeChecksumFile(archivePath, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(archivePath))
+	tmp, err := os.CreateTemp(filepath.Dir(archivePath), filepath.Base(archivePath)+checksumSuffix+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write checksum file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(line)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), archivePath+checksumSuffix)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write checksum file: %w", err)
+	}
+	return nil
+}
+
+// readChecksum returns the hash stored in a .sha256 sidecar.
+func readChecksum(sidecarPath string) (string, error) {
+	data, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file %s is empty", sidecarPath)
+	}
+	return fields[0], nil
+}
+
+// VerifyOptions configures VerifyArchiveFile.
+type VerifyOptions struct {
+	// DictionaryPath is the zstd dictionary the archive was compressed
+	// with, if any.
+	DictionaryPath string
+	// PublicKeyPath, when set, requires a valid .sig sidecar made with the
+	// matching SigningKeyPath.
+	PublicKeyPath string
+}
+
+// VerifyArchiveFile checks a downloaded archive: its SHA-256 against the
+// .sha256 sidecar next to it, and every entry against MANIFEST.json when the
+// archive contains one. It returns nil when everything that could be checked
+// matches; checks are skipped when the sidecar or manifest is missing.
+func VerifyArchiveFile(archivePath string, opts VerifyOptions) error {
+	var errs []error
+
+	if opts.PublicKeyPath != "" {
+		err := verifySignature(archivePath, opts.PublicKeyPath)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	want, err := readChecksum(archivePath + checksumSuffix)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		errs = append(errs, fmt.Errorf("failed to read checksum file: %w", err))
+	default:
+		got, err := fileSHA256(archivePath)
+		if err != nil {
+			return fmt.Errorf("failed to checksum archive: %w", err)
+		}
+		if got != want {
+			errs = append(errs, fmt.Errorf("archive checksum mismatch: expected %s, got %s", want, got))
+		}
+	}
+
+	err = verifyManifest(archivePath, nil, opts.DictionaryPath)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// testArchive reads the freshly written archive back to the end, checking
+// it against its manifest when it has one, so a corrupt archive is caught
+// before it is shipped. archiveData is the archive when it was built in
+// memory.
+func testArchive(config Config, archivePath string, archiveData []byte) error {
+	err := verifyManifest(archivePath, archiveData, config.ZstdDictionaryPath)
+	if err != nil {
+		return fmt.Errorf("archive verification failed: %w", err)
+	}
+	return nil
+}
+
+// verifyManifest hashes every entry of an archive and compares the results
+// with its MANIFEST.json.
+func verifyManifest(archivePath string, archiveData []byte, dictionaryPath string) error {
+	file, err := openArchive(archivePath, archiveData)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tarStream, err := decompressArchive(file, archivePath, dictionaryPath)
+	if err != nil {
+		return err
+	}
+	defer tarStream.Close()
+
+	got := map[string]ManifestEntry{}
+	var manifest []ManifestEntry
+	hasManifest := false
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Name == manifestName {
+			hasManifest = true
+			err = json.NewDecoder(tarReader).Decode(&manifest)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", manifestName, err)
+			}
+			continue
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, tarReader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from archive: %w", header.Name, err)
+		}
+		got[header.Name] = ManifestEntry{Name: header.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+	if !hasManifest {
+		return nil
+	}
+
+	var errs []error
+	for _, want := range manifest {
+		entry, ok := got[want.Name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: missing from archive", want.Name))
+		case entry.Size != want.Size:
+			errs = append(errs, fmt.Errorf("%s: size mismatch: expected %d, got %d", want.Name, want.Size, entry.Size))
+		case entry.SHA256 != want.SHA256:
+			errs = append(errs, fmt.Errorf("%s: checksum mismatch: expected %s, got %s", want.Name, want.SHA256, entry.SHA256))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,288 @@
+package backupify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Content-defined chunking parameters: a chunk boundary is placed where the
+// rolling gear hash has chunkAvgBits low zero bits, giving ~256 KiB chunks
+// bounded by chunkMinSize and chunkMaxSize. Changing them invalidates
+// deduplication against previously stored chunks.
+const (
+	chunkMinSize = 64 << 10
+	chunkAvgBits = 18
+	chunkMaxSize = 1 << 20
+)
+
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		sum := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return table
+}()
+
+// ChunkRef is a chunk of a chunked archive.
+type ChunkRef struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// ChunkManifest lists, in order, the chunks that make up the uncompressed
+// tar stream of a chunked archive.
+type ChunkManifest struct {
+	Created time.Time  `json:"created"`
+	Size    int64      `json:"size"`
+	Chunks  []ChunkRef `json:"chunks"`
+}
+
+// chunkStore keeps gzipped chunks in <dir>/chunks/<first two hex>/<sha256>.gz.
+type chunkStore struct {
+	dir string
+}
+
+func (s chunkStore) chunkPath(hash string) string {
+	return filepath.Join(s.dir, chunkRelPath(hash))
+}
+
+func chunkRelPath(hash string) string {
+	return path.Join("chunks", hash[:2], hash+".gz")
+}
+
+// put stores data unless a chunk with the same hash exists and reports
+// whether it was new.
+func (s chunkStore) put(hash string, data []byte) (bool, error) {
+	chunkPath := s.chunkPath(hash)
+	if _, err := os.Stat(chunkPath); err == nil {
+		return false, nil
+	}
+	err := os.MkdirAll(filepath.Dir(chunkPath), os.ModePerm)
+	if err != nil {
+		return false, fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	gzWriter.Write(data)
+	err = gzWriter.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to compress chunk: %w", err)
+	}
+
+	tmpPath := chunkPath + ".tmp"
+	err = os.WriteFile(tmpPath, buf.Bytes(), 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	err = os.Rename(tmpPath, chunkPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	return true, nil
+}
+
+func (s chunkStore) get(ref ChunkRef) ([]byte, error) {
+	file, err := os.Open(s.chunkPath(ref.SHA256))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chunk %s: %w", ref.SHA256, err)
+	}
+	defer file.Close()
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", ref.SHA256, err)
+	}
+	data, err := io.ReadAll(gzReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", ref.SHA256, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != ref.SHA256 {
+		return nil, fmt.Errorf("chunk %s is corrupt", ref.SHA256)
+	}
+	return data, nil
+}
+
+// chunker is a writer that splits everything written to it into
+// content-defined chunks and hands them to emit.
+type chunker struct {
+	buf  []byte
+	hash uint64
+	emit func([]byte) error
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+	const mask = 1<<chunkAvgBits - 1
+	for i, b := range p {
+		c.buf = append(c.buf, b)
+		c.hash = c.hash<<1 + gearTable[b]
+		if (len(c.buf) >= chunkMinSize && c.hash&mask == 0) || len(c.buf) >= chunkMaxSize {
+			if err := c.flush(); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (c *chunker) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := c.emit(c.buf)
+	c.buf = c.buf[:0]
+	c.hash = 0
+	return err
+}
+
+// chunkArchive writes the tar stream of entries into the chunk store and a
+// manifest referencing the chunks to manifestPath. It returns the relative
+// paths of the chunks that weren't in the store yet.
+func chunkArchive(config Config, entries []archiveEntry, manifestPath string) ([]string, ChunkManifest, error) {
+	store := chunkStore{dir: config.ChunkStore}
+	manifest := ChunkManifest{Created: time.Now()}
+	var newChunks []string
+
+	c := &chunker{emit: func(data []byte) error {
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		isNew, err := store.put(hash, data)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			newChunks = append(newChunks, chunkRelPath(hash))
+		}
+		manifest.Chunks = append(manifest.Chunks, ChunkRef{SHA256: hash, Size: int64(len(data))})
+		manifest.Size += int64(len(data))
+		return nil
+	}}
+
+	err := writeTar(config, c, entries)
+	if err == nil {
+		err = c.flush()
+	}
+	if err != nil {
+		return nil, manifest, fmt.Errorf("failed to write chunks: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, manifest, fmt.Errorf("failed to encode chunk manifest: %w", err)
+	}
+	err = os.WriteFile(manifestPath, data, 0644)
+	if err != nil {
+		return nil, manifest, fmt.Errorf("failed to write chunk manifest: %w", err)
+	}
+	return newChunks, manifest, nil
+}
+
+// uploadChunks uploads the chunks of manifest that dest doesn't have yet,
+// then the manifest, mirroring the local chunk store layout under the
+// destination directory. What dest has is listed rather than assumed, so a
+// failed earlier upload or a new destination gets every missing chunk; a
+// chunk of the wrong size, cut off by an interrupted upload, is replaced.
+func uploadChunks(ctx context.Context, config Config, dest Destination, store string, manifest ChunkManifest, manifestPath string) (string, error) {
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	listed := map[string]map[string]int64{}
+	for _, chunk := range manifestChunks(manifest) {
+		dir := path.Join(dest.Directory, path.Dir(chunk))
+		present, ok := listed[dir]
+		if !ok {
+			present = remoteSizes(conn, dir)
+			listed[dir] = present
+		}
+		local := filepath.Join(store, chunk)
+		info, err := os.Stat(local)
+		if err != nil {
+			return "", fmt.Errorf("failed to read chunk %s: %w", path.Base(chunk), err)
+		}
+		if size, ok := present[path.Base(chunk)]; ok && size == info.Size() {
+			continue
+		}
+		_, err = storFile(config, conn, dir, local)
+		if err != nil {
+			return "", fmt.Errorf("failed to upload chunk %s: %w", path.Base(chunk), err)
+		}
+		present[path.Base(chunk)] = info.Size()
+	}
+	return storFile(config, conn, dest.Directory, manifestPath)
+}
+
+// manifestChunks returns the relative paths of the distinct chunks of
+// manifest, in order.
+func manifestChunks(manifest ChunkManifest) []string {
+	seen := map[string]bool{}
+	var chunks []string
+	for _, ref := range manifest.Chunks {
+		if !seen[ref.SHA256] {
+			seen[ref.SHA256] = true
+			chunks = append(chunks, chunkRelPath(ref.SHA256))
+		}
+	}
+	return chunks
+}
+
+// remoteSizes returns the sizes of the files in dir by base name. A
+// directory that can't be listed, usually because it doesn't exist yet,
+// has none.
+func remoteSizes(conn *ftpConn, dir string) map[string]int64 {
+	sizes := map[string]int64{}
+	entries, err := conn.List(dir)
+	if err != nil {
+		return sizes
+	}
+	for _, entry := range entries {
+		if entry.Type == ftp.EntryTypeFile {
+			sizes[path.Base(entry.Name)] = int64(entry.Size)
+		}
+	}
+	return sizes
+}
+
+// ReassembleChunks writes the tar stream described by the chunk manifest at
+// manifestPath, reading chunks from the chunk store directory store.
+func ReassembleChunks(store, manifestPath string, w io.Writer) error {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	var manifest ChunkManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("failed to parse chunk manifest: %w", err)
+	}
+
+	s := chunkStore{dir: store}
+	for _, ref := range manifest.Chunks {
+		chunk, err := s.get(ref)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package backupify
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// compressionNone stores the tar stream uncompressed. It is only chosen by
+// archiveConfig, not configured.
+const compressionNone = "none"
+
+// Sizes of the sample compressed to estimate the compression gain: up to
+// gainSampleEntrySize bytes from the start of each entry, gainSampleSize
+// in total.
+const (
+	gainSampleEntrySize = 1 << 20
+	gainSampleSize      = 8 << 20
+)
+
+// nopWriteCloser is the compressor of compressionNone.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// archiveConfig returns the config to archive entries of database (empty
+// for the combined archive) with, using its DatabaseCompression. With
+// MinCompressionGainPercent, a sample of the entries is compressed first
+// and if it doesn't shrink by at least that much the archive is stored as
+// an uncompressed .tar, which saves the CPU for data that doesn't compress.
+// With EncryptOnUploadOnly the archive isn't encrypted.
+func (r *run) archiveConfig(database string, entries []archiveEntry) Config {
+	cfg := r.cfg
+	if compression, ok := cfg.DatabaseCompression[database]; ok {
+		cfg.Compression = compression
+	}
+	if cfg.EncryptOnUploadOnly {
+		cfg.EncryptCommand = ""
+	}
+	if cfg.MinCompressionGainPercent <= 0 {
+		return cfg
+	}
+	sample := compressionSample(entries)
+	if len(sample) == 0 {
+		return cfg
+	}
+	var out countingWriter
+	w, err := newCompressor(cfg.autoCompressionLevel(entriesSize(entries)), &out)
+	if err == nil {
+		_, err = w.Write(sample)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		r.logger.Printf("failed to estimate compression gain, compressing: %v", err)
+		return cfg
+	}
+
+	gain := 100 - float64(out.n)*100/float64(len(sample))
+	if gain >= cfg.MinCompressionGainPercent {
+		return cfg
+	}
+	r.logger.Printf("compression would only save %.1f%% of a %d byte sample, storing the archive uncompressed", gain, len(sample))
+	cfg.Compression = compressionNone
+	return cfg
+}
+
+// compressionSample reads the start of every entry, see gainSampleSize.
+func compressionSample(entries []archiveEntry) []byte {
+	var sample bytes.Buffer
+	for _, entry := range entries {
+		limit := int64(min(gainSampleEntrySize, gainSampleSize-sample.Len()))
+		if limit <= 0 {
+			break
+		}
+		if entry.path == "" {
+			sample.Write(entry.data[:min(int64(len(entry.data)), limit)])
+			continue
+		}
+		file, err := os.Open(entry.path)
+		if err != nil {
+			continue
+		}
+		io.Copy(&sample, io.LimitReader(file, limit))
+		file.Close()
+	}
+	return sample.Bytes()
+}
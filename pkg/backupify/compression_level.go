@@ -0,0 +1,171 @@
+package backupify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// CompressionLevelAuto picks the compression level from the input size and
+// the number of CPUs, see autoCompressionLevel.
+const CompressionLevelAuto = "auto"
+
+// CompressionLevel is Config.CompressionLevel. In JSON it can be a number
+// as well as a string, so both 9 and "9" work.
+type CompressionLevel string
+
+func (l *CompressionLevel) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var level string
+		err := json.Unmarshal(data, &level)
+		*l = CompressionLevel(level)
+		return err
+	}
+	var level json.Number
+	err := json.Unmarshal(data, &level)
+	if err != nil {
+		return fmt.Errorf("compression_level must be a number or a string, got %s", data)
+	}
+	*l = CompressionLevel(level)
+	return nil
+}
+
+// Per-CPU input sizes up to which autoCompressionLevel picks the best and
+// the default level. Above the second one the fastest level is used.
+const (
+	autoBestMaxBytes    = 256 << 20
+	autoDefaultMaxBytes = 4 << 30
+)
+
+// autoCompressionLevel resolves CompressionLevelAuto for inputSize bytes:
+// inputs up to 256 MiB per CPU get the best level (9 for gzip, 19 for zstd),
+// up to 4 GiB per CPU the default one (6 and 3), and anything bigger the
+// fastest (1), so huge inputs on small hosts don't take all night.
+func (c Config) autoCompressionLevel(inputSize int64) Config {
+	if c.CompressionLevel != CompressionLevelAuto {
+		return c
+	}
+	best, def, fast := 9, 6, 1
+	switch c.compression() {
+	case CompressionZstd:
+		best, def, fast = 19, 3, 1
+	case CompressionBrotli:
+		best, def, fast = 9, 5, 1
+	}
+
+	perCPU := inputSize / int64(runtime.NumCPU())
+	level := fast
+	switch {
+	case perCPU <= autoBestMaxBytes:
+		level = best
+	case perCPU <= autoDefaultMaxBytes:
+		level = def
+	}
+	c.logger().Printf("compression level auto: %d for %d bytes on %d CPUs", level, inputSize, runtime.NumCPU())
+	c.CompressionLevel = CompressionLevel(strconv.Itoa(level))
+	return c
+}
+
+// compressionLevel returns the configured numeric level, or 0 for the
+// compressor's default.
+func (c Config) compressionLevel() int {
+	level, err := strconv.Atoi(string(c.CompressionLevel))
+	if err != nil {
+		return 0
+	}
+	return level
+}
+
+// validateCompressionLevel checks CompressionLevel against the range of the
+// built-in compressor.
+func (c Config) validateCompressionLevel() error {
+	if c.CompressionLevel == "" || c.CompressionLevel == CompressionLevelAuto {
+		return nil
+	}
+	max := gzip.BestCompression
+	switch c.compression() {
+	case CompressionZstd:
+		max = 22
+	case CompressionBrotli:
+		max = 11
+	}
+	level, err := strconv.Atoi(string(c.CompressionLevel))
+	if err != nil || level < 1 || level > max {
+		return fmt.Errorf("compression_level must be auto or 1-%d for %s, got %q", max, c.compression(), c.CompressionLevel)
+	}
+	return nil
+}
+
+// validateDatabaseCompression checks every DatabaseCompression codec the
+// way Compression is checked, including against CompressionLevel.
+func (c Config) validateDatabaseCompression() error {
+	if len(c.DatabaseCompression) == 0 {
+		return nil
+	}
+	if !c.PerDatabaseArchives || c.rawDumps() || c.CompressCommand != "" {
+		return fmt.Errorf("database_compression needs per_database_archives with the built-in compressor")
+	}
+	for db, compression := range c.DatabaseCompression {
+		override := c
+		override.Compression = compression
+		switch compression {
+		case CompressionGzip, CompressionZstd, CompressionBrotli:
+		default:
+			return fmt.Errorf("database_compression: %s must be gzip, zstd or brotli, got %q", db, compression)
+		}
+		if err := override.validateCompressionLevel(); err != nil {
+			return fmt.Errorf("database_compression: %s: %w", db, err)
+		}
+	}
+	return nil
+}
+
+// newGzipWriter is gzip.NewWriter at the configured level.
+func newGzipWriter(config Config, out io.Writer) *gzip.Writer {
+	level := config.compressionLevel()
+	if level == 0 {
+		return gzip.NewWriter(out)
+	}
+	w, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		return gzip.NewWriter(out)
+	}
+	return w
+}
+
+// entriesSize is the total size of the files going into an archive, used
+// to resolve CompressionLevelAuto.
+func entriesSize(entries []archiveEntry) int64 {
+	var total int64
+	for _, entry := range entries {
+		if entry.path == "" {
+			total += int64(len(entry.data))
+			continue
+		}
+		if info, err := os.Stat(entry.path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// dumpCompressionLevel resolves CompressionLevelAuto for a gzipped dump of
+// database, using the data size MySQL reports for it.
+func dumpCompressionLevel(ctx context.Context, config Config, database string) Config {
+	if config.CompressionLevel != CompressionLevelAuto {
+		return config
+	}
+	size, _, err := dumpEstimate(ctx, config, database)
+	if err != nil {
+		config.logger().Printf("failed to estimate size of %s, using the default compression level: %v", database, err)
+		config.CompressionLevel = ""
+		return config
+	}
+	return config.autoCompressionLevel(size)
+}
@@ -0,0 +1,1086 @@
+package backupify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config describes what to back up and where to ship it.
+type Config struct {
+	MySQLHost       string   `json:"mysql_host"`
+	MySQLUser       string   `json:"mysql_user"`
+	MySQLPassword   string   `json:"mysql_password"`
+	Databases       []string `json:"databases"`
+	BackupDirectory string   `json:"backup_directory"`
+	FTPHost         string   `json:"ftp_host"`
+	FTPUser         string   `json:"ftp_user"`
+	FTPPassword     string   `json:"ftp_password"`
+	// FTPDirectory may contain date placeholders, see Destination.
+	FTPDirectory string `json:"ftp_directory"`
+	// PidFile, when set, holds the process ID while a run is in progress.
+	PidFile string `json:"pid_file,omitempty"`
+	// StatusFile, when set, is rewritten as the run progresses with a
+	// RunStatus in JSON. Like PidFile it is removed when the run ends.
+	StatusFile string `json:"status_file,omitempty"`
+	// MetricsTextfilePath, when set, is rewritten after every run with the
+	// run's metrics in the Prometheus text format, for node_exporter's
+	// textfile collector. The name must end in .prom for it to be read.
+	MetricsTextfilePath string `json:"metrics_textfile_path,omitempty"`
+	// PreflightUploadCheck logs into every destination and writes and
+	// deletes a test file in its directory before dumping, so the run
+	// fails early when an upload couldn't succeed.
+	PreflightUploadCheck bool `json:"preflight_upload_check,omitempty"`
+	// WeekdayDirectories uploads into a subdirectory of every destination's
+	// directory named after the weekday of the run, mon to sun, for a
+	// seven-slot rotation. With RemoteKeepLast 1 each slot only keeps the
+	// newest backup.
+	WeekdayDirectories bool `json:"weekday_directories,omitempty"`
+	// FTPKeepAliveSeconds sends a NOOP on the FTP control connection after
+	// it has been idle this long, so servers and firewalls don't drop it
+	// while a big file is being transferred.
+	FTPKeepAliveSeconds int `json:"ftp_keepalive_seconds,omitempty"`
+	// ProxyURL routes connections to every destination through a SOCKS5
+	// proxy, as socks5://[user:password@]host:port. ssh destinations use it
+	// through nc as ProxyCommand, which doesn't support a user and
+	// password.
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// SQLMetadataQueries runs the metadata queries (change detection, table
+	// lists, size estimates, ...) over a pool of go-sql-driver connections
+	// reused across databases and runs, instead of starting a mysql client
+	// for each. They connect over TCP to port 3306 of MySQLHost.
+	SQLMetadataQueries bool `json:"sql_metadata_queries,omitempty"`
+	// DumpSSH runs mysqldump and the mysql client on another host over
+	// ssh, for servers whose MySQL port can't be reached. Host, User, Port,
+	// SSHKeyPath and the host key settings are used like for ssh
+	// destinations; MySQLHost is then as seen from that host, usually
+	// 127.0.0.1. Not supported with SQLMetadataQueries, TabExport and
+	// mydumper.
+	DumpSSH *Destination `json:"dump_ssh,omitempty"`
+
+	// GetServerPublicKey and ServerPublicKeyPath let caching_sha2_password
+	// authenticate over a non-TLS connection to MySQL 8, by requesting the
+	// server's RSA public key or reading it from a PEM file. They are
+	// passed to the MySQL clients as --get-server-public-key and
+	// --server-public-key-path.
+	GetServerPublicKey  bool   `json:"get_server_public_key,omitempty"`
+	ServerPublicKeyPath string `json:"server_public_key_path,omitempty"`
+
+	// CompressCommand, when set, is run with the tar stream on stdin and its
+	// stdout written to the archive (e.g. "pigz -p 4"). Built-in gzip is used
+	// otherwise.
+	CompressCommand string `json:"compress_command,omitempty"`
+	// CompressSuffix is the suffix of CompressCommand's format, ".gz" (the
+	// default), ".zst" or ".br", which restore and verify can read.
+	CompressSuffix string `json:"compress_suffix,omitempty"`
+
+	// Compression is the built-in compressor, CompressionGzip (the default),
+	// CompressionZstd, which writes .tar.zst archives, or CompressionBrotli
+	// for .tar.br archives. It is ignored when CompressCommand is set.
+	Compression string `json:"compression,omitempty"`
+	// DatabaseCompression overrides Compression for the per-database
+	// archives of the listed databases, e.g. gzip for one full of already
+	// compressed blobs. The others use Compression.
+	DatabaseCompression map[string]string `json:"database_compression,omitempty"`
+	// CompressionLevel is the level of the built-in compressor, 1-9 for
+	// gzip or 1-22 for zstd, or "auto" to pick one from the input size and
+	// the number of CPUs. Empty uses the compressor's default.
+	CompressionLevel CompressionLevel `json:"compression_level,omitempty"`
+	// ZstdDictionaryPath is a zstd dictionary, e.g. trained with the
+	// train-dict command, used to compress zstd archives. It helps a lot
+	// with many small, similar databases. The same dictionary is needed to
+	// restore or verify those archives.
+	ZstdDictionaryPath string `json:"zstd_dictionary_path,omitempty"`
+
+	// EncryptCommand, when set, is run like CompressCommand to encrypt the
+	// archive (e.g. "age -r age1..." or "gpg --encrypt -r backups"), and the
+	// archive gets an extra .enc suffix.
+	EncryptCommand string `json:"encrypt_command,omitempty"`
+	// DecryptCommand decrypts stdin to stdout (e.g. "age -d -i key.txt")
+	// so restore can load encrypted archives.
+	DecryptCommand string `json:"decrypt_command,omitempty"`
+	// EncryptOnUploadOnly keeps the local archive unencrypted and encrypts
+	// a temporary copy, with the .enc suffix, just for the upload.
+	EncryptOnUploadOnly bool `json:"encrypt_on_upload_only,omitempty"`
+	// PipelineOrder is PipelineCompressThenEncrypt (the default) or
+	// PipelineEncryptThenCompress.
+	PipelineOrder string `json:"pipeline_order,omitempty"`
+
+	// LatestSymlink keeps BackupDirectory/latest.tar.gz pointing at the
+	// archive of the most recent successful run.
+	LatestSymlink bool `json:"latest_symlink,omitempty"`
+
+	// Destinations are additional FTP servers the archive is uploaded to,
+	// besides the one described by the FTP* fields.
+	Destinations []Destination `json:"destinations,omitempty"`
+	// FailoverDestinations act as one more destination, named "failover":
+	// each file goes to the first of them that takes it, in order, instead
+	// of to all of them.
+	FailoverDestinations []Destination `json:"failover_destinations,omitempty"`
+	// DatabaseDestinations routes the backups of the listed databases to
+	// the destination of the given name only. Every other database goes to
+	// the destinations no database is routed to. Needs
+	// PerDatabaseArchives or StreamUploads.
+	DatabaseDestinations map[string]string `json:"database_destinations,omitempty"`
+	// UploadConcurrency bounds how many destinations are uploaded to at
+	// once. Zero uploads to all of them in parallel.
+	UploadConcurrency int `json:"upload_concurrency,omitempty"`
+	// InterDestinationDelaySeconds pauses between the uploads to
+	// consecutive destinations, to spread the load on a shared uplink. It
+	// needs an UploadConcurrency of 1 and can't be used with StreamUploads.
+	InterDestinationDelaySeconds float64 `json:"inter_destination_delay_seconds,omitempty"`
+	// MaxFTPConnections bounds how many FTP sessions are open at once
+	// across all destinations and uploads, for servers with a connection
+	// limit per client IP. Unlimited by default.
+	MaxFTPConnections int `json:"max_ftp_connections,omitempty"`
+	// ParallelUploadStreams uploads files to FTP destinations as up to
+	// this many parts at once, each over its own connection, with a
+	// <name>.parts.json manifest listing them. Parts are at least 16 MiB.
+	ParallelUploadStreams int `json:"parallel_upload_streams,omitempty"`
+	// UploadFailureMode controls what a failed upload does to the others.
+	// By default every destination is tried and any failure fails the run.
+	// With "fail-fast" the first failure cancels the other uploads of the
+	// file and no further files are uploaded; with "best-effort" a file
+	// counts as shipped, and the run succeeds, as long as one destination
+	// got it.
+	UploadFailureMode string `json:"upload_failure_mode,omitempty"`
+	// RemoteFileMode is an octal mode such as "600" applied to uploaded files
+	// with SITE CHMOD on FTP servers that support it.
+	RemoteFileMode string `json:"remote_file_mode,omitempty"`
+	// RemoteOverwritePolicy decides what an FTP upload does when a file
+	// of the same name is already on the server: "fail" (default) fails
+	// the upload, "skip" keeps the remote file, "rename" uploads under the
+	// first free name with a -1, -2, ... suffix and "overwrite" replaces it.
+	RemoteOverwritePolicy string `json:"remote_overwrite_policy,omitempty"`
+	// PostUploadCommand is run after every successful upload with the
+	// remote path and the SHA-256 of the file as arguments, e.g. to check
+	// the object on the server. An upload it exits non-zero for counts as
+	// failed.
+	PostUploadCommand string `json:"post_upload_command,omitempty"`
+
+	// TabExport dumps each database with mysqldump --tab into
+	// TabDirectory/<database>, producing a .sql schema file and a .txt data
+	// file per table instead of a single dump. The data files are written by
+	// the MySQL server, so TabDirectory must be on the server host, be
+	// writable by mysqld and be allowed by secure_file_priv; the MySQL user
+	// needs the FILE privilege.
+	TabExport    bool   `json:"tab_export,omitempty"`
+	TabDirectory string `json:"tab_directory,omitempty"`
+
+	// Manifest adds a MANIFEST.json entry to the archive listing the name,
+	// size and SHA-256 of every other entry.
+	Manifest bool `json:"manifest,omitempty"`
+	// Checksum writes a <archive>.sha256 sidecar in sha256sum format and
+	// uploads it next to the archive.
+	Checksum bool `json:"checksum,omitempty"`
+	// MinCompressionGainPercent, when positive, compresses a sample of the
+	// dumps before archiving and stores the archive as an uncompressed .tar
+	// if the sample shrank by less than this many percent.
+	MinCompressionGainPercent float64 `json:"min_compression_gain_percent,omitempty"`
+	// StreamChecksum computes the Checksum while the archive is uploaded
+	// instead of reading it once more beforehand; the .sha256 is written
+	// and uploaded after the archive. It can't be used with
+	// SigningKeyPath, AdditionalBackupDirs or ChunkStore, which need the
+	// checksum before the upload.
+	StreamChecksum bool `json:"stream_checksum,omitempty"`
+	// VerifyArchive reads every archive back through the decompressor and
+	// tar reader before shipping it and fails the run if that fails. It
+	// needs the built-in compressor or a gzip-compatible CompressCommand.
+	VerifyArchive bool `json:"verify_archive,omitempty"`
+	// VerifyEntryChecksums reads every file again after it was written into
+	// the archive and fails the run unless it hashes to the same SHA-256 as
+	// the bytes that were archived, to catch corruption by bad disks or
+	// memory. It doubles the reads of the dumps.
+	VerifyEntryChecksums bool `json:"verify_entry_checksums,omitempty"`
+
+	// SigningKeyPath is an Ed25519 private key in PKCS #8 PEM format. When
+	// set, each archive is signed into an <archive>.sig file that is
+	// uploaded next to it; verify -pubkey checks it.
+	SigningKeyPath string `json:"signing_key_path,omitempty"`
+
+	// Metadata adds a metadata.json first entry to the archive recording the
+	// tool version, hostname, MySQL host and the databases it contains.
+	Metadata bool `json:"metadata,omitempty"`
+	// CatalogPath is a local file every successful run appends a JSON line
+	// to, recording when it ran, the databases it backed up and the files
+	// it uploaded with their size, checksum and destinations. With
+	// UploadCatalog the same line is appended to catalog.jsonl in the
+	// directory of every FTP destination.
+	CatalogPath   string `json:"catalog_path,omitempty"`
+	UploadCatalog bool   `json:"upload_catalog,omitempty"`
+	// SizeDropThresholdPercent fails the run, without uploading, when an
+	// archive is more than this many percent smaller than the previous one
+	// recorded in the state file, which usually means data went missing.
+	SizeDropThresholdPercent float64 `json:"size_drop_threshold_percent,omitempty"`
+	// ReportArchiveDelta logs how many bytes of every archive's tar stream
+	// aren't in the previous archive, to judge what incremental or
+	// deduplicated backups would save. A signature of the last archive is
+	// kept in BackupDirectory for the comparison.
+	ReportArchiveDelta bool `json:"report_archive_delta,omitempty"`
+	// CDCDirectory is where the cdc command keeps the binlog files it
+	// streams from the server until they are uploaded, see RunCDC.
+	CDCDirectory string `json:"cdc_directory,omitempty"`
+	// CDCFlushSeconds is how often cdc uploads the finished binlog files.
+	// Defaults to 300.
+	CDCFlushSeconds int `json:"cdc_flush_seconds,omitempty"`
+	// CDCRotateBinlog makes cdc run FLUSH BINARY LOGS every
+	// CDCFlushSeconds, so the current file is finished and shipped then
+	// instead of when the server rotates it at max_binlog_size. It rotates
+	// the binary log for every other consumer of the server too.
+	CDCRotateBinlog bool `json:"cdc_rotate_binlog,omitempty"`
+	// MaxBackupAgeHours is how old the newest backup may be before the
+	// check-freshness command fails, see CheckFreshness.
+	MaxBackupAgeHours int `json:"max_backup_age_hours,omitempty"`
+	// CaptureServerVariables adds a server_info.txt entry with the output
+	// of SHOW GLOBAL VARIABLES and SHOW GLOBAL STATUS to every archive.
+	CaptureServerVariables bool `json:"capture_server_variables,omitempty"`
+	// RestoreScript adds a restore.sh to every archive with the mysql
+	// commands that load its dumps in the right order, taking the
+	// credentials from the environment.
+	RestoreScript bool `json:"restore_script,omitempty"`
+	// AppVersion is the version of the application whose data is backed
+	// up, e.g. a git commit or release tag. It is recorded in the metadata
+	// and appended to archive names as backup_<timestamp>-<version>.tar.gz.
+	// The command overrides it with $BACKUPIFY_APP_VERSION or -app-version.
+	AppVersion string `json:"app_version,omitempty"`
+	// Environment names the environment the config is for, e.g. prod or
+	// staging. It is appended to archive names after AppVersion, as
+	// backup_<timestamp>+<environment>.tar.gz, keeping the backups of each
+	// environment apart in retention, and included in the summary, events,
+	// metadata and every log message.
+	Environment string `json:"environment,omitempty"`
+	// Profiles are named sets of config keys, e.g. "databases",
+	// "compression", "encrypt_command", "remote_keep_last" or
+	// "destinations", that LoadConfigProfile merges over the rest of the
+	// config when the profile is selected, so one config file can hold
+	// several backup policies.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+	// ExtraFiles and ExtraDirs are additional files, and directories
+	// included recursively, stored in the archive under files/ with their
+	// path (without a leading slash), e.g. files/etc/app/config.yml.
+	ExtraFiles []string `json:"extra_files,omitempty"`
+	ExtraDirs  []string `json:"extra_dirs,omitempty"`
+
+	// PerDatabaseTimeoutMinutes, when positive, kills the dump of a database
+	// that takes longer and marks that database failed.
+	PerDatabaseTimeoutMinutes int `json:"per_database_timeout_minutes,omitempty"`
+
+	// CheckPrivileges runs SHOW GRANTS before dumping and fails the run when
+	// the MySQL user lacks a privilege the configured databases and options
+	// need. Privileges granted through roles are not seen.
+	CheckPrivileges bool `json:"check_privileges,omitempty"`
+
+	// WriteBufferKB, when positive, buffers dump files in memory and writes
+	// them out in chunks of this many KiB, which cuts the number of writes to
+	// network-mounted backup directories.
+	WriteBufferKB int `json:"write_buffer_kb,omitempty"`
+
+	// DumpRetries is how many times a dump that failed with a transient
+	// error (lock wait timeout, deadlock, lost connection) is retried, waiting
+	// DumpRetryDelaySeconds between attempts.
+	DumpRetries           int `json:"dump_retries,omitempty"`
+	DumpRetryDelaySeconds int `json:"dump_retry_delay_seconds,omitempty"`
+	// RetryBackoffBaseSeconds switches retries to exponential backoff: the
+	// first retry waits this long and every further one twice as long, up to
+	// ten minutes. RetryJitter randomizes each delay between half and the
+	// full value.
+	RetryBackoffBaseSeconds float64 `json:"retry_backoff_base_seconds,omitempty"`
+	RetryJitter             bool    `json:"retry_jitter,omitempty"`
+
+	// Schedule is the cron expression (e.g. "30 2 * * *" or "@daily") that
+	// the schedule command runs backups at.
+	Schedule string `json:"schedule,omitempty"`
+
+	// ServeAddress and ServeToken configure the serve command: the address
+	// to listen on (default :8080) and the bearer token POST /backup requires.
+	ServeAddress string `json:"serve_address,omitempty"`
+	ServeToken   string `json:"serve_token,omitempty"`
+
+	// PrintReport prints a table of the databases, archives and uploads of
+	// the run to stdout when the command line backup finishes.
+	PrintReport bool `json:"print_report,omitempty"`
+
+	// GzipDumps streams each dump through gzip into its own
+	// <database>_<timestamp>.sql.gz, which is uploaded as is instead of being
+	// collected into a tar archive. The uncompressed SQL is never written.
+	// Retention and restore handle these files like archives.
+	GzipDumps bool `json:"gzip_dumps,omitempty"`
+	// Archive can be set to false to upload every dump on its own as
+	// <database>_<timestamp>.sql (or .sql.gz with GzipDumps) instead of
+	// collecting them into a tar archive. Defaults to true.
+	Archive *bool `json:"archive,omitempty"`
+	// AllOrNothing only ships a run when every database was dumped (and,
+	// with PerDatabaseArchives, archived). Otherwise nothing is uploaded,
+	// and when an upload fails the files already uploaded are deleted
+	// again, so a destination never holds a partial run. Retention only
+	// runs after a complete upload.
+	AllOrNothing bool `json:"all_or_nothing,omitempty"`
+	// StreamUploads pipes each GzipDumps dump straight into every
+	// destination while mysqldump runs, so nothing is written to
+	// BackupDirectory. Failed dumps are not retried, as the stream can't be
+	// replayed.
+	StreamUploads bool `json:"stream_uploads,omitempty"`
+	// StreamLocalCopy also writes each streamed dump to BackupDirectory
+	// while it is uploaded, so a local copy is kept without reading the
+	// dump a second time.
+	StreamLocalCopy bool `json:"stream_local_copy,omitempty"`
+
+	// NiceLevel and IONiceClass lower the CPU and IO priority of mysqldump
+	// by running it under nice -n and ionice -c (1 realtime, 2 best-effort,
+	// 3 idle). Linux only; ignored elsewhere.
+	NiceLevel   int `json:"nice_level,omitempty"`
+	IONiceClass int `json:"ionice_class,omitempty"`
+
+	// MinSuccessRatio (0-1) and MaxFailedDatabases mark the run as failed
+	// when too many databases could not be dumped, even though the rest were
+	// archived and uploaded. Zero disables the respective check.
+	MinSuccessRatio    float64 `json:"min_success_ratio,omitempty"`
+	MaxFailedDatabases int     `json:"max_failed_databases,omitempty"`
+	// AllowEmptyBackup lets a run with an empty Databases go ahead with a
+	// warning, e.g. to ship just ExtraFiles. Without it the run fails with
+	// ErrNoDatabases instead of uploading an empty archive.
+	AllowEmptyBackup bool `json:"allow_empty_backup,omitempty"`
+	// SkipMissingDatabases leaves the databases that don't exist on the
+	// server out of the run, with a log message, instead of failing them.
+	SkipMissingDatabases bool `json:"skip_missing_databases,omitempty"`
+
+	// ExcludeTablePatterns are regular expressions matched against the
+	// table names of every database (e.g. "_cache$"); matching tables and
+	// views are passed to mysqldump as --ignore-table.
+	ExcludeTablePatterns []string `json:"exclude_table_patterns,omitempty"`
+
+	// ArchivePathPrefix puts the files of each database under a directory
+	// in the archive, e.g. "{database}/" or "{timestamp}/" (the run's
+	// timestamp), so archives extracted into one tree don't collide.
+	// restore strips it again, so it must be configured there too.
+	ArchivePathPrefix string `json:"archive_path_prefix,omitempty"`
+
+	// OrderByPrimary passes --order-by-primary so rows are dumped in a
+	// stable order between runs, at the cost of slower dumps.
+	OrderByPrimary bool `json:"order_by_primary,omitempty"`
+
+	// VerifyRestore restores every dump into a temporary
+	// verify_<database>_<timestamp> database, compares its table count with
+	// the source and drops it. A failed restore marks the database as failed.
+	// The MySQL user needs the CREATE and DROP privileges.
+	VerifyRestore bool `json:"verify_restore,omitempty"`
+
+	// PerDatabaseArchives gives every database its own archive, dumped,
+	// archived and uploaded independently of the others with up to
+	// DatabaseConcurrency databases in flight (one by default).
+	PerDatabaseArchives bool `json:"per_database_archives,omitempty"`
+	DatabaseConcurrency int  `json:"database_concurrency,omitempty"`
+	// SplitThresholdMB, when set, makes each run choose: a combined archive
+	// while the databases hold at most this many megabytes of data by
+	// information_schema, per-database archives above it.
+	SplitThresholdMB int `json:"split_threshold_mb,omitempty"`
+	// InterDatabaseDelaySeconds pauses between consecutive database dumps,
+	// so the server gets a break. It only applies while databases are
+	// dumped one at a time.
+	InterDatabaseDelaySeconds float64 `json:"inter_database_delay_seconds,omitempty"`
+	// TableGroups splits databases further: every named group of tables
+	// of a database gets its own dump and archive,
+	// backup_<database>.<group>_<timestamp>, and the archive of the
+	// database keeps the remaining tables. Needs PerDatabaseArchives.
+	TableGroups map[string]map[string][]string `json:"table_groups,omitempty"`
+
+	// ParallelCompression compresses the dump of each database for the
+	// combined archive on its own goroutine as soon as it is done, while
+	// the next databases are dumped, with up to CompressionWorkers at once
+	// (one per CPU by default). Needs the built-in gzip or zstd compressor
+	// and, with EncryptCommand, the compress-then-encrypt order.
+	ParallelCompression bool `json:"parallel_compression,omitempty"`
+	CompressionWorkers  int  `json:"compression_workers,omitempty"`
+
+	// PreBackupOptimize and PreBackupAnalyze run OPTIMIZE TABLE and ANALYZE
+	// TABLE on every table of a database before dumping it. Both are heavy,
+	// may lock tables and are off by default.
+	PreBackupOptimize bool `json:"pre_backup_optimize,omitempty"`
+	PreBackupAnalyze  bool `json:"pre_backup_analyze,omitempty"`
+
+	// DumpGrants adds a grants.sql to the archive that recreates all
+	// accounts (except the internal mysql.* ones) with their passwords and
+	// privileges, for restoring onto a fresh server. The MySQL user needs
+	// SELECT on mysql.user.
+	DumpGrants bool `json:"dump_grants,omitempty"`
+
+	// DumpViewsLast dumps the views of each database into a separate
+	// <database>.views.sql that is placed after all other dumps in the
+	// archive, so views that select from tables of databases dumped later
+	// still restore.
+	DumpViewsLast bool `json:"dump_views_last,omitempty"`
+
+	// SetGTIDPurged is passed to mysqldump as --set-gtid-purged: ON, OFF,
+	// AUTO or COMMENTED. Left to mysqldump's default when empty.
+	SetGTIDPurged string `json:"set_gtid_purged,omitempty"`
+	// MasterData passes --master-data=1 (a CHANGE MASTER TO statement) or 2
+	// (the same as a comment), so the dump records the binlog position it
+	// is consistent with; Metadata then includes it. FlushLogs runs FLUSH
+	// BINARY LOGS once before the first dump, so binlogs start a new file
+	// there. Together they give a full backup to replay binlogs from for
+	// point-in-time recovery. MasterData is not supported with mysqlpump
+	// and mydumper.
+	MasterData int  `json:"master_data,omitempty"`
+	FlushLogs  bool `json:"flush_logs,omitempty"`
+
+	// DumpExtraArgs are passed to mysqldump or mariadb-dump after the
+	// options the config selects. Only options known to be safe are
+	// accepted, see safeDumpOptions.
+	DumpExtraArgs []string `json:"dump_extra_args,omitempty"`
+
+	// DumpThrottleKBps limits how fast the dump's output is read, in KiB
+	// per second, so mysqldump reads the tables more slowly and leaves IO
+	// for the server's other work. Zero reads at full speed. Not supported
+	// with mydumper and tab_export, which write their files themselves.
+	DumpThrottleKBps int `json:"dump_throttle_kbps,omitempty"`
+
+	// Anonymize replaces the values of columns, keyed by
+	// database.table.column, while they are dumped: "null", "empty",
+	// "redact" for a fixed string, "hash" for a keyed digest of the value
+	// and "email" for an address made from it. Equal values get equal
+	// replacements, so joins still match. AnonymizeSalt is the key of the
+	// digests; without one they can be guessed from known values. Needs
+	// mysqldump or mariadb-dump without tab_export.
+	Anonymize     map[string]string `json:"anonymize,omitempty"`
+	AnonymizeSalt string            `json:"anonymize_salt,omitempty"`
+
+	// TransformCommand pipes every dump through a command that reads the
+	// SQL on stdin and writes it to stdout, e.g. a sed script that rewrites
+	// DEFINERs or host names. It runs after Anonymize, and the dump fails
+	// when the command exits non-zero. Not supported with mydumper and
+	// tab_export.
+	TransformCommand string `json:"transform_command,omitempty"`
+
+	// TzUTC can be set to false to pass --skip-tz-utc, so TIMESTAMP values
+	// are dumped in the server's time zone instead of being converted to
+	// UTC and back on restore. Not supported with mysqlpump and mydumper.
+	TzUTC *bool `json:"tz_utc,omitempty"`
+	// LockTables controls how mysqldump keeps each database consistent:
+	// "true" locks its tables (--lock-tables), "false" dumps it in a
+	// transaction without locks (--single-transaction --skip-lock-tables),
+	// and "auto" picks the transaction when all its tables are InnoDB.
+	// Empty leaves mysqldump's default.
+	LockTables string `json:"lock_tables,omitempty"`
+	// InsertIgnore writes INSERT IGNORE (--insert-ignore) and Replace
+	// REPLACE (--replace) statements, so a dump can be loaded into tables
+	// that already hold some of its rows. Only one of them can be set, and
+	// the tables are still dropped and created unless DumpExtraArgs has
+	// --skip-add-drop-table and --no-create-info.
+	InsertIgnore bool `json:"insert_ignore,omitempty"`
+	Replace      bool `json:"replace,omitempty"`
+	// HexBlob dumps BINARY, VARBINARY, BLOB and BIT columns in hexadecimal
+	// notation (--hex-blob), so binary values survive a restore through a
+	// client or connection that would otherwise reinterpret their bytes.
+	HexBlob bool `json:"hex_blob,omitempty"`
+
+	// ChunkStore enables the experimental deduplicating archive: instead of
+	// a .tar.gz, the tar stream is split into content-defined chunks stored
+	// by SHA-256 under this directory, plus a backup_<timestamp>.chunks.json
+	// manifest. Only chunks not already in the store are uploaded. Use the
+	// unchunk command to rebuild the tar.
+	ChunkStore string `json:"chunk_store,omitempty"`
+
+	// DumpTool selects the dump binary: mysqldump (default), mysqlpump,
+	// mariadb-dump or mydumper. DumpParallelism sets mysqlpump's
+	// --default-parallelism and mydumper's --threads.
+	// mysqlpump always writes CREATE DATABASE and qualified table names, so
+	// it can't be combined with TabExport, OrderByPrimary or VerifyRestore;
+	// mariadb-dump has no --set-gtid-purged. mydumper writes a directory per
+	// database, archived as mydumper/<database>/, which restore loads with
+	// myloader.
+	DumpTool        string `json:"dump_tool,omitempty"`
+	DumpParallelism int    `json:"dump_parallelism,omitempty"`
+	// ParallelTables dumps the tables of each database with this many
+	// mysqldump processes at once, each in a single transaction, all
+	// started from the same snapshot under a brief global read lock. Views
+	// go into a separate views dump. Needs RELOAD and PROCESS privileges.
+	ParallelTables int `json:"parallel_tables,omitempty"`
+	// ConsistentSnapshot dumps all databases at once, each in a single
+	// transaction opened under a brief global read lock, so the archive
+	// holds every database as of the same instant. Failed dumps are not
+	// retried. Needs RELOAD and PROCESS privileges.
+	ConsistentSnapshot bool `json:"consistent_snapshot,omitempty"`
+	// FailOnDumpWarnings fails the backup of a database when the dump tool
+	// exits successfully but prints a warning, such as a skipped table or
+	// a missing definer. The warning about the password on the command line
+	// is ignored.
+	FailOnDumpWarnings bool `json:"fail_on_dump_warnings,omitempty"`
+	// SkipInvalidDefinerViews dumps a database again without the view its
+	// dump failed on because the view's DEFINER no longer exists, instead
+	// of failing the database. The views left out are listed in the
+	// summary.
+	SkipInvalidDefinerViews bool `json:"skip_invalid_definer_views,omitempty"`
+	// ColumnStatistics controls mysqldump's --column-statistics. Unless it
+	// is set, mysqldump clients that know the option get
+	// --column-statistics=0, since mysqldump 8 enables it by default and
+	// then fails against MariaDB and older MySQL servers with "Unknown
+	// table 'COLUMN_STATISTICS'". Requires mysqldump 8.0+.
+	ColumnStatistics bool `json:"column_statistics,omitempty"`
+
+	// AdditionalBackupDirs are local directories, such as a NAS or USB
+	// mount, that each finished archive is copied to before uploading. A
+	// failed copy is logged and recorded in the summary but doesn't fail
+	// the run.
+	AdditionalBackupDirs []string `json:"additional_backup_dirs,omitempty"`
+
+	// RemoteKeepLast, when positive, keeps only that many of the newest
+	// backups of each kind (the archive, or each database's archive or
+	// dump) in the directory of every FTP destination after a successful
+	// upload, deleting older ones and their .sha256 files.
+	RemoteKeepLast int `json:"remote_keep_last,omitempty"`
+
+	// MinFreeDiskMB aborts the run before dumping when BackupDirectory (or
+	// TabDirectory and ChunkStore, when used) has less free space. Only
+	// checked on Linux.
+	MinFreeDiskMB int `json:"min_free_disk_mb,omitempty"`
+
+	// SpoolDir is where Spool moves archives and dumps instead of uploading
+	// them, to be uploaded later by DrainSpool (the drain-spool command).
+	SpoolDir string `json:"spool_dir,omitempty"`
+
+	// DeleteLocalAfterUpload removes the local archive and its .sha256
+	// sidecar once every destination has accepted it. It is kept when any
+	// upload fails. Can't be combined with LatestSymlink.
+	DeleteLocalAfterUpload bool `json:"delete_local_after_upload,omitempty"`
+	// VerifyRemoteHash has FTP servers that list HASH, XSHA256, XMD5 or MD5
+	// in FEAT hash every uploaded file, and fails the upload (deleting the
+	// file) when it doesn't match the local one. Other servers only get
+	// the size check every upload does.
+	VerifyRemoteHash bool `json:"verify_remote_hash,omitempty"`
+	// InMemoryArchiveMaxMB keeps dumps of at most this many MiB in memory,
+	// builds archives whose files add up to at most that in memory too and
+	// uploads them from there, without writing either to BackupDirectory.
+	// Needs DeleteLocalAfterUpload.
+	InMemoryArchiveMaxMB int `json:"in_memory_archive_max_mb,omitempty"`
+
+	// StateFile is where state is kept between runs. Defaults to
+	// .backupify-state.json in StateDirectory.
+	StateFile string `json:"state_file,omitempty"`
+	// StateDirectory holds the state file and the archive signatures.
+	// Defaults to BackupDirectory.
+	StateDirectory string `json:"state_directory,omitempty"`
+	// StateStore replaces the files in StateDirectory with another place
+	// to keep state, e.g. a database shared by several hosts.
+	StateStore StateStore `json:"-"`
+	// SkipUnchangedDatabases skips databases whose newest table UPDATE_TIME
+	// in information_schema is the same as at their last successful backup.
+	// Databases for which the server reports no update time are always
+	// backed up.
+	SkipUnchangedDatabases bool `json:"skip_unchanged_databases,omitempty"`
+	// DatabaseBatchSize limits each run to the next N databases of
+	// Databases that haven't been shipped in the current cycle, kept by name
+	// in the state file, so a full cycle is spread over several runs. A
+	// database that fails is tried again by the next run.
+	DatabaseBatchSize int `json:"database_batch_size,omitempty"`
+	// DumpOrder lists databases to dump first, in this order; the others
+	// follow in the order of Databases. Batches are still taken from
+	// Databases.
+	DumpOrder []string `json:"dump_order,omitempty"`
+	// IncrementalColumns maps "<database>.<table>" to a column such as
+	// updated_at. Those tables are dumped on their own, with just the rows
+	// whose column is at least its newest value at the last successful
+	// backup; the first backup dumps them whole.
+	IncrementalColumns map[string]string `json:"incremental_columns,omitempty"`
+	// IncrementalFullEvery dumps the IncrementalColumns tables whole again
+	// every that many backups, so a chain of incremental dumps never grows
+	// longer and retention can drop the older ones. RemoteKeepLast must be
+	// at least this many.
+	IncrementalFullEvery int `json:"incremental_full_every,omitempty"`
+	// ExportFormats maps "<database>.<table>" to "csv" or "json". Those
+	// tables are read over a go-sql-driver connection (TCP port 3306 of
+	// MySQLHost) and archived in that format; the SQL dump keeps only
+	// their definitions.
+	ExportFormats map[string]string `json:"export_formats,omitempty"`
+	// RedactLogValues are further secrets, such as webhook URLs or access
+	// keys, replaced with "***" in log messages along with the passwords
+	// and tokens of the config. Values shorter than 4 characters are kept.
+	RedactLogValues []string `json:"redact_log_values,omitempty"`
+	// SchemaOnlyAboveMB dumps just the definition of every table whose data
+	// and indexes take more than this many megabytes in information_schema,
+	// for compact development snapshots. 0 dumps every table whole.
+	SchemaOnlyAboveMB int `json:"schema_only_above_mb,omitempty"`
+
+	// SchemaGitRepo is a git working copy that every successful run dumps
+	// the schema of its databases into, as <database>.sql, and commits the
+	// changes to, for a history of the schema. SchemaGitPush pushes the
+	// commits to the upstream of the current branch.
+	SchemaGitRepo string `json:"schema_git_repo,omitempty"`
+	SchemaGitPush bool   `json:"schema_git_push,omitempty"`
+	// OTelEndpoint is the OTLP/HTTP collector, e.g. http://localhost:4318,
+	// that receives a trace of every run: a root span with a child for each
+	// database dump, stage and upload.
+	OTelEndpoint string `json:"otel_endpoint,omitempty"`
+	// CheckpointIntervalSeconds flushes every running dump to disk this
+	// often and records its progress in the run journal, so that -resume
+	// knows which dumps were cut short.
+	CheckpointIntervalSeconds int `json:"checkpoint_interval_seconds,omitempty"`
+	// StorageCostPerGB maps destination names to what a GiB stored there
+	// costs per month, in any currency, to estimate the cost of each run.
+	StorageCostPerGB map[string]float64 `json:"storage_cost_per_gb,omitempty"`
+
+	// Logger receives progress and error messages. Defaults to log.Default().
+	Logger *log.Logger `json:"-"`
+	// RunID identifies the run in log messages, events, the summary, the
+	// archive metadata and the catalog. A random UUID is generated when empty.
+	RunID string `json:"-"`
+	// Profile is the profile of Profiles LoadConfigProfile applied. It is
+	// included in every log message.
+	Profile string `json:"-"`
+	// retryUpload is set by UploadArchive, which uploads a file again that
+	// some destinations may already have, see remoteName.
+	retryUpload bool
+	// Spool moves the files of the run to SpoolDir instead of uploading
+	// them. It is set by the -spool flag.
+	Spool bool `json:"-"`
+	// AcceptSizeDrop ships archives that shrank by more than
+	// SizeDropThresholdPercent and records their sizes, after an expected
+	// drop. It is set by the -accept-size-drop flag.
+	AcceptSizeDrop bool `json:"-"`
+	// Resume continues the run whose journal is in the StateStore, reusing
+	// its timestamp and the dumps it had finished, instead of starting a
+	// new one. It is set by the -resume flag.
+	Resume bool `json:"-"`
+	// Progress, when set, receives a progress line for each dump that is
+	// rewritten in place, so it should be a terminal.
+	Progress io.Writer `json:"-"`
+	// ArchiveWriter, when set, receives the combined archive instead of a
+	// file in BackupDirectory, e.g. to pipe it into another program. Nothing
+	// is uploaded. It is set by the -stdout flag.
+	ArchiveWriter io.Writer `json:"-"`
+	// OnEvent, when set, is called for every Event of a run. It may be
+	// called from several goroutines at once.
+	OnEvent func(Event) `json:"-"`
+}
+
+// LoadConfig reads a JSON config file, or an "env:" path like
+// LoadConfigFiles. Unknown keys are an error.
+func LoadConfig(filename string) (Config, error) {
+	var config Config
+	data, err := readConfigSource(filename)
+	if err != nil {
+		return config, err
+	}
+	err = decodeConfig(data, &config, false)
+	return config, err
+}
+
+// rawDumps reports whether dump files are uploaded individually rather than
+// archived.
+func (c Config) rawDumps() bool {
+	return c.GzipDumps || (c.Archive != nil && !*c.Archive)
+}
+
+// Validate reports config values that can't work.
+func (c Config) Validate() error {
+	switch strings.ToUpper(c.SetGTIDPurged) {
+	case "", "ON", "OFF", "AUTO", "COMMENTED":
+	default:
+		return fmt.Errorf("set_gtid_purged must be one of ON, OFF, AUTO or COMMENTED, got %q", c.SetGTIDPurged)
+	}
+
+	if c.RemoteFileMode != "" {
+		if _, err := strconv.ParseUint(c.RemoteFileMode, 8, 32); err != nil {
+			return fmt.Errorf("remote_file_mode must be an octal mode like 600, got %q", c.RemoteFileMode)
+		}
+	}
+
+	if c.ProxyURL != "" {
+		u, err := c.parseProxyURL()
+		if err != nil {
+			return err
+		}
+		if c.DumpSSH != nil && u.User != nil {
+			return fmt.Errorf("proxy_url with a user and password is not supported for dump_ssh")
+		}
+		for _, dest := range slices.Concat(c.Destinations, c.FailoverDestinations) {
+			if dest.Type == DestinationSSH && u.User != nil {
+				return fmt.Errorf("destination %s: proxy_url with a user and password is not supported for ssh destinations", dest.Name)
+			}
+		}
+	}
+
+	for _, dest := range slices.Concat(c.Destinations, c.FailoverDestinations) {
+		switch dest.Type {
+		case "", DestinationFTP:
+		case DestinationSSH:
+			if dest.KnownHostsPath != "" && dest.InsecureIgnoreHostKey {
+				return fmt.Errorf("destination %s: known_hosts_path and insecure_ignore_host_key can't be used together", dest.Name)
+			}
+			if c.ChunkStore != "" {
+				return fmt.Errorf("destination %s: chunk_store is only supported with ftp destinations", dest.Name)
+			}
+		case DestinationCommand:
+			if strings.TrimSpace(dest.Command) == "" {
+				return fmt.Errorf("destination %s: a command destination needs a command", dest.Name)
+			}
+			if c.ChunkStore != "" {
+				return fmt.Errorf("destination %s: chunk_store is only supported with ftp destinations", dest.Name)
+			}
+		default:
+			return fmt.Errorf("destination %s: unknown type %q", dest.Name, dest.Type)
+		}
+	}
+
+	if (len(c.ExtraFiles) > 0 || len(c.ExtraDirs) > 0 || c.DumpGrants) && (c.PerDatabaseArchives || c.rawDumps()) {
+		return fmt.Errorf("extra_files, extra_dirs and dump_grants need a single combined archive")
+	}
+
+	switch c.compression() {
+	case CompressionGzip:
+		if c.ZstdDictionaryPath != "" {
+			return fmt.Errorf("zstd_dictionary_path needs compression zstd")
+		}
+	case CompressionZstd, CompressionBrotli:
+		if c.CompressCommand != "" {
+			return fmt.Errorf("compression and compress_command can't be used together")
+		}
+		if c.compression() == CompressionBrotli && c.ZstdDictionaryPath != "" {
+			return fmt.Errorf("zstd_dictionary_path needs compression zstd")
+		}
+	default:
+		return fmt.Errorf("compression must be gzip, zstd or brotli, got %q", c.Compression)
+	}
+
+	if _, err := c.excludeTablePatterns(); err != nil {
+		return err
+	}
+	if err := c.validateCompressCommand(); err != nil {
+		return err
+	}
+	if err := c.validateCompressionLevel(); err != nil {
+		return err
+	}
+	if err := c.validateDatabaseCompression(); err != nil {
+		return err
+	}
+	if c.CompressionLevel != "" && c.CompressCommand != "" {
+		return fmt.Errorf("compression_level can't be used with compress_command")
+	}
+
+	switch c.PipelineOrder {
+	case "", PipelineCompressThenEncrypt, PipelineEncryptThenCompress:
+	default:
+		return fmt.Errorf("pipeline_order must be %s or %s, got %q", PipelineCompressThenEncrypt, PipelineEncryptThenCompress, c.PipelineOrder)
+	}
+	if c.EncryptCommand != "" && (c.rawDumps() || c.ChunkStore != "") {
+		return fmt.Errorf("encrypt_command is not supported with raw dumps or chunk_store")
+	}
+	if c.EncryptOnUploadOnly && (c.EncryptCommand == "" || c.PipelineOrder == PipelineEncryptThenCompress || c.StreamChecksum) {
+		return fmt.Errorf("encrypt_on_upload_only needs encrypt_command with compress-then-encrypt and no stream_checksum")
+	}
+	if c.EncryptCommand != "" && c.VerifyArchive && !c.EncryptOnUploadOnly {
+		return fmt.Errorf("verify_archive can't read encrypted archives")
+	}
+
+	if c.StreamChecksum && (!c.Checksum || c.rawDumps()) {
+		return fmt.Errorf("stream_checksum needs checksum and an archive")
+	}
+	if c.StreamChecksum && (c.SigningKeyPath != "" || len(c.AdditionalBackupDirs) > 0 || c.ChunkStore != "") {
+		return fmt.Errorf("stream_checksum can't be used with signing_key_path, additional_backup_dirs or chunk_store")
+	}
+	if c.ParallelCompression {
+		if c.PerDatabaseArchives || c.rawDumps() || c.ChunkStore != "" || c.StreamUploads {
+			return fmt.Errorf("parallel_compression needs a single combined archive")
+		}
+		if c.CompressCommand != "" || c.compression() == CompressionBrotli || c.MinCompressionGainPercent > 0 || c.PipelineOrder == PipelineEncryptThenCompress {
+			return fmt.Errorf("parallel_compression can't be used with compress_command, brotli, min_compression_gain_percent or encrypt-then-compress")
+		}
+	}
+	if c.MinCompressionGainPercent < 0 || c.MinCompressionGainPercent > 100 {
+		return fmt.Errorf("min_compression_gain_percent must be between 0 and 100")
+	}
+	if c.MinCompressionGainPercent > 0 && (c.CompressCommand != "" || c.rawDumps() || c.ChunkStore != "") {
+		return fmt.Errorf("min_compression_gain_percent needs a tar archive made with the built-in compressor")
+	}
+	if err := c.validateParallelTables(); err != nil {
+		return err
+	}
+	if err := c.validateConsistentSnapshot(); err != nil {
+		return err
+	}
+	if err := c.validateDumpOrder(); err != nil {
+		return err
+	}
+	if err := c.validateIncrementalColumns(); err != nil {
+		return err
+	}
+	if err := c.validateExportFormats(); err != nil {
+		return err
+	}
+	if err := c.validateLockTables(); err != nil {
+		return err
+	}
+	if err := c.validateSchemaGitRepo(); err != nil {
+		return err
+	}
+	if err := c.validateSchemaOnlyAboveMB(); err != nil {
+		return err
+	}
+	if err := c.validateOTelEndpoint(); err != nil {
+		return err
+	}
+	if err := c.validateSplitThreshold(); err != nil {
+		return err
+	}
+	if c.CheckpointIntervalSeconds < 0 {
+		return fmt.Errorf("checkpoint_interval_seconds must not be negative")
+	}
+	if err := c.validateStorageCost(); err != nil {
+		return err
+	}
+	if err := c.validateSkipInvalidDefinerViews(); err != nil {
+		return err
+	}
+	if err := c.validateOverwritePolicy(); err != nil {
+		return err
+	}
+	if err := c.validateUploadFailureMode(); err != nil {
+		return err
+	}
+	if c.ParallelUploadStreams < 0 {
+		return fmt.Errorf("parallel_upload_streams must not be negative")
+	}
+	if c.ParallelUploadStreams > 1 && c.StreamChecksum {
+		return fmt.Errorf("parallel_upload_streams can't be used with stream_checksum")
+	}
+	if c.PostUploadCommand != "" && strings.TrimSpace(c.PostUploadCommand) == "" {
+		return fmt.Errorf("post_upload_command is empty")
+	}
+	if c.ArchivePathPrefix != "" {
+		if c.rawDumps() {
+			return fmt.Errorf("archive_path_prefix needs an archive")
+		}
+		if err := c.validateArchivePathPrefix(); err != nil {
+			return err
+		}
+	}
+	if c.CaptureServerVariables && c.rawDumps() {
+		return fmt.Errorf("capture_server_variables needs an archive")
+	}
+	if c.RestoreScript && c.rawDumps() {
+		return fmt.Errorf("restore_script needs an archive")
+	}
+	if c.SizeDropThresholdPercent > 0 && (c.rawDumps() || c.ChunkStore != "") {
+		return fmt.Errorf("size_drop_threshold_percent needs a .tar.gz archive")
+	}
+	if c.ReportArchiveDelta && (c.rawDumps() || c.ChunkStore != "" || c.StreamUploads || (c.EncryptCommand != "" && !c.EncryptOnUploadOnly)) {
+		return fmt.Errorf("report_archive_delta needs a local unencrypted archive")
+	}
+
+	if len(c.AdditionalBackupDirs) > 0 && (c.rawDumps() || c.ChunkStore != "") {
+		return fmt.Errorf("additional_backup_dirs need a .tar.gz archive")
+	}
+
+	if len(c.DatabaseDestinations) > 0 {
+		if !c.PerDatabaseArchives && !c.StreamUploads {
+			return fmt.Errorf("database_destinations needs per_database_archives or stream_uploads")
+		}
+		names := make(map[string]bool)
+		for _, dest := range c.destinations() {
+			names[dest.Name] = true
+		}
+		for db, name := range c.DatabaseDestinations {
+			if !names[name] {
+				return fmt.Errorf("database_destinations: database %s is routed to unknown destination %q", db, name)
+			}
+		}
+	}
+
+	if err := c.validateFailoverDestinations(); err != nil {
+		return err
+	}
+	if err := c.validateInMemoryArchive(); err != nil {
+		return err
+	}
+
+	if c.AllOrNothing && (c.StreamUploads || c.ChunkStore != "") {
+		return fmt.Errorf("all_or_nothing can't be used with stream_uploads or chunk_store")
+	}
+
+	if c.StreamUploads {
+		if !c.GzipDumps || c.PerDatabaseArchives {
+			return fmt.Errorf("stream_uploads needs gzip_dumps without per_database_archives")
+		}
+		if c.TabExport || c.VerifyRestore || c.DumpViewsLast || c.Checksum || c.SigningKeyPath != "" || c.LatestSymlink {
+			return fmt.Errorf("tab_export, verify_restore, dump_views_last, checksum, signing_key_path and latest_symlink need local files and can't be used with stream_uploads")
+		}
+		if len(c.destinations()) == 0 {
+			return fmt.Errorf("stream_uploads needs at least one destination")
+		}
+	}
+	if c.StreamLocalCopy && (!c.StreamUploads || c.DeleteLocalAfterUpload) {
+		return fmt.Errorf("stream_local_copy needs stream_uploads without delete_local_after_upload")
+	}
+
+	if c.ArchiveWriter != nil {
+		if c.PerDatabaseArchives || c.rawDumps() || c.ChunkStore != "" {
+			return fmt.Errorf("writing the archive to a stream needs a single combined archive")
+		}
+		if c.Checksum || c.VerifyArchive || c.SigningKeyPath != "" || len(c.AdditionalBackupDirs) > 0 || c.LatestSymlink || c.SizeDropThresholdPercent > 0 {
+			return fmt.Errorf("checksum, verify_archive, signing_key_path, additional_backup_dirs, latest_symlink and size_drop_threshold_percent need an archive file and can't be used when writing to a stream")
+		}
+	}
+
+	if c.Spool && c.SpoolDir == "" {
+		return fmt.Errorf("spool needs spool_dir")
+	}
+	if c.Spool && (c.StreamUploads || c.ChunkStore != "" || c.LatestSymlink || c.ArchiveWriter != nil) {
+		return fmt.Errorf("spool can't be used with stream_uploads, chunk_store, latest_symlink or stdout")
+	}
+	if c.DeleteLocalAfterUpload && c.LatestSymlink {
+		return fmt.Errorf("delete_local_after_upload and latest_symlink can't be used together")
+	}
+
+	if len(c.TableGroups) > 0 {
+		if err := c.validateTableGroups(); err != nil {
+			return err
+		}
+	}
+	if c.DumpSSH != nil {
+		if err := c.validateDumpSSH(); err != nil {
+			return err
+		}
+	}
+	if err := c.validateDumpExtraArgs(); err != nil {
+		return err
+	}
+	if c.InterDatabaseDelaySeconds < 0 {
+		return fmt.Errorf("inter_database_delay_seconds can't be negative")
+	}
+	if c.InterDestinationDelaySeconds < 0 {
+		return fmt.Errorf("inter_destination_delay_seconds can't be negative")
+	}
+	if c.InterDestinationDelaySeconds > 0 && c.UploadConcurrency != 1 {
+		return fmt.Errorf("inter_destination_delay_seconds needs upload_concurrency 1, destinations are uploaded to at the same time otherwise")
+	}
+	if c.InterDestinationDelaySeconds > 0 && c.StreamUploads {
+		return fmt.Errorf("inter_destination_delay_seconds can't be used with stream_uploads, which upload to every destination at once")
+	}
+	if c.DumpThrottleKBps < 0 {
+		return fmt.Errorf("dump_throttle_kbps can't be negative")
+	}
+	if c.DumpThrottleKBps > 0 && (c.dumpTool() == DumpToolMydumper || c.TabExport) {
+		return fmt.Errorf("dump_throttle_kbps can't be used with mydumper or tab_export")
+	}
+
+	if err := c.validateTransformCommand(); err != nil {
+		return err
+	}
+	if err := c.validateDecryptCommand(); err != nil {
+		return err
+	}
+	if len(c.Anonymize) > 0 {
+		if err := c.validateAnonymize(); err != nil {
+			return err
+		}
+	}
+
+	if c.MasterData < 0 || c.MasterData > 2 {
+		return fmt.Errorf("master_data must be 1 or 2, got %d", c.MasterData)
+	}
+	if c.MasterData != 0 && (c.dumpTool() == DumpToolMysqlpump || c.dumpTool() == DumpToolMydumper) {
+		return fmt.Errorf("master_data is not supported with %s", c.dumpTool())
+	}
+	// mysqldump doesn't reject --insert-ignore with --replace, so the
+	// options are checked wherever they come from.
+	insertIgnore := c.InsertIgnore || slices.Contains(c.DumpExtraArgs, "--insert-ignore")
+	replace := c.Replace || slices.Contains(c.DumpExtraArgs, "--replace")
+	if insertIgnore && replace {
+		return fmt.Errorf("insert_ignore and replace can't be used together, also not through dump_extra_args")
+	}
+	if insertIgnore && len(c.IncrementalColumns) > 0 {
+		return fmt.Errorf("insert_ignore can't be used with incremental_columns, whose dumps use --replace")
+	}
+
+	switch c.dumpTool() {
+	case DumpToolMysqldump:
+	case DumpToolMysqlpump:
+		if c.TzUTC != nil && !*c.TzUTC {
+			return fmt.Errorf("tz_utc false is not supported with mysqlpump")
+		}
+		if c.TabExport || c.OrderByPrimary || c.VerifyRestore || c.DumpViewsLast || len(c.ExcludeTablePatterns) > 0 {
+			return fmt.Errorf("tab_export, order_by_primary, verify_restore, dump_views_last and exclude_table_patterns are not supported with mysqlpump")
+		}
+	case DumpToolMariadbDump:
+		if c.SetGTIDPurged != "" {
+			return fmt.Errorf("set_gtid_purged is not supported with mariadb-dump")
+		}
+		if c.GetServerPublicKey || c.ServerPublicKeyPath != "" {
+			return fmt.Errorf("get_server_public_key and server_public_key_path are not supported with mariadb-dump")
+		}
+	case DumpToolMydumper:
+		if c.TabExport || c.OrderByPrimary || c.VerifyRestore || c.DumpViewsLast || len(c.ExcludeTablePatterns) > 0 || c.SetGTIDPurged != "" {
+			return fmt.Errorf("tab_export, order_by_primary, verify_restore, dump_views_last, exclude_table_patterns and set_gtid_purged are not supported with mydumper")
+		}
+		if c.GetServerPublicKey || c.ServerPublicKeyPath != "" {
+			return fmt.Errorf("get_server_public_key and server_public_key_path are not supported with mydumper")
+		}
+		if c.TzUTC != nil && !*c.TzUTC {
+			return fmt.Errorf("tz_utc false is not supported with mydumper")
+		}
+		if c.InsertIgnore || c.Replace || c.HexBlob {
+			return fmt.Errorf("insert_ignore, replace and hex_blob are not supported with mydumper")
+		}
+		if c.rawDumps() {
+			return fmt.Errorf("mydumper output needs an archive, gzip_dumps and archive false are not supported")
+		}
+	default:
+		return fmt.Errorf("dump_tool must be one of mysqldump, mysqlpump, mariadb-dump or mydumper, got %q", c.DumpTool)
+	}
+	return nil
+}
+
+const redacted = "***"
+
+// Redacted returns a copy of the config with passwords and tokens replaced,
+// suitable for printing.
+func (c Config) Redacted() Config {
+	redact := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return redacted
+	}
+	c.MySQLPassword = redact(c.MySQLPassword)
+	c.FTPPassword = redact(c.FTPPassword)
+	c.ServeToken = redact(c.ServeToken)
+	c.AnonymizeSalt = redact(c.AnonymizeSalt)
+	values := make([]string, len(c.RedactLogValues))
+	for i, value := range c.RedactLogValues {
+		values[i] = redact(value)
+	}
+	c.RedactLogValues = values
+	dests := make([]Destination, len(c.Destinations))
+	for i, dest := range c.Destinations {
+		dest.Password = redact(dest.Password)
+		dests[i] = dest
+	}
+	c.Destinations = dests
+	failover := make([]Destination, len(c.FailoverDestinations))
+	for i, dest := range c.FailoverDestinations {
+		dest.Password = redact(dest.Password)
+		failover[i] = dest
+	}
+	c.FailoverDestinations = failover
+	if c.DumpSSH != nil {
+		dumpSSH := *c.DumpSSH
+		dumpSSH.Password = redact(dumpSSH.Password)
+		c.DumpSSH = &dumpSSH
+	}
+	if u, err := url.Parse(c.ProxyURL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.ProxyURL = u.String()
+		}
+	}
+	// The selected profile is already merged in, and the others may hold
+	// passwords of their own.
+	c.Profiles = nil
+	return c
+}
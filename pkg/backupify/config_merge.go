@@ -0,0 +1,253 @@
+package backupify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadConfigFiles reads every path in order and deep-merges them into a
+// single Config, later files overriding earlier ones. A directory path is
+// expanded to the *.json files it contains, in lexical order. Nested objects
+// are merged key by key; arrays replace the earlier value unless
+// appendSlices is set, in which case they are concatenated. A path of
+// "env:" reads the JSON from the BACKUPIFY_CONFIG environment variable and
+// "env:NAME" from NAME instead. Keys that are not config fields, such as a
+// misspelt "mysql_hots", are an error naming the file unless allowUnknown
+// is set.
+func LoadConfigFiles(paths []string, appendSlices, allowUnknown bool) (Config, error) {
+	return LoadConfigProfile(paths, "", appendSlices, allowUnknown)
+}
+
+// LoadConfigProfile is LoadConfigFiles followed by merging the profile
+// named profile from Profiles over the result, the same way as another
+// file. An empty profile uses the config as it is.
+func LoadConfigProfile(paths []string, profile string, appendSlices, allowUnknown bool) (Config, error) {
+	var config Config
+
+	files, err := expandConfigPaths(paths)
+	if err != nil {
+		return config, err
+	}
+
+	merged := map[string]any{}
+	for _, file := range files {
+		data, err := readConfigSource(file)
+		if err != nil {
+			return config, err
+		}
+		var layer map[string]any
+		err = json.Unmarshal(data, &layer)
+		if err == nil && !allowUnknown {
+			err = decodeConfig(data, &Config{}, false)
+		}
+		if err != nil {
+			return config, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		mergeConfigMaps(merged, layer, appendSlices)
+	}
+	err = applyProfile(merged, profile, appendSlices, allowUnknown)
+	if err != nil {
+		return config, err
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return config, err
+	}
+	err = decodeConfig(data, &config, allowUnknown)
+	config.Profile = profile
+	return config, err
+}
+
+// decodeConfig decodes the JSON config in data, rejecting unknown keys
+// unless allowUnknown is set.
+func decodeConfig(data []byte, config *Config, allowUnknown bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if !allowUnknown {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(config)
+}
+
+// applyProfile checks the profiles of the merged config and merges the
+// one named profile over it.
+func applyProfile(merged map[string]any, profile string, appendSlices, allowUnknown bool) error {
+	profiles, _ := merged["profiles"].(map[string]any)
+	for name, value := range profiles {
+		layer, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("profile %s must be an object", name)
+		}
+		if _, ok := layer["profiles"]; ok {
+			return fmt.Errorf("profile %s can't have profiles of its own", name)
+		}
+		if allowUnknown {
+			continue
+		}
+		data, err := json.Marshal(layer)
+		if err == nil {
+			err = decodeConfig(data, &Config{}, false)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse profile %s: %w", name, err)
+		}
+	}
+	err := checkProfileDirectories(merged, profiles, appendSlices)
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+	layer, ok := profiles[profile].(map[string]any)
+	if !ok && len(profiles) == 0 {
+		return fmt.Errorf("unknown profile %q, the config has no profiles", profile)
+	}
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q, the config has %s", profile, strings.Join(names, ", "))
+	}
+	mergeConfigMaps(merged, layer, appendSlices)
+	return nil
+}
+
+// checkProfileDirectories rejects profiles that share a backup directory,
+// a state directory or file, or the directory of an FTP destination. The
+// archive names, state and journal of a run don't include its profile, so
+// the retention, freshness checks and state of one would count the runs of
+// the other.
+func checkProfileDirectories(merged map[string]any, profiles map[string]any, appendSlices bool) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	owners := map[string]string{}
+	for _, name := range names {
+		config, err := profileConfig(merged, profiles[name].(map[string]any), appendSlices)
+		if err != nil {
+			return fmt.Errorf("failed to parse profile %s: %w", name, err)
+		}
+		stateDirectory := config.StateDirectory
+		if stateDirectory == "" {
+			stateDirectory = config.BackupDirectory
+		}
+		places := []string{"backup_directory " + filepath.Clean(config.BackupDirectory)}
+		if config.StateFile != "" {
+			places = append(places, "state_file "+filepath.Clean(config.StateFile))
+		} else {
+			places = append(places, "state directory "+filepath.Clean(stateDirectory))
+		}
+		for _, dest := range expandFailover(config.destinations()) {
+			if dest.isFTP() {
+				places = append(places, "directory "+path.Clean("/"+dest.Directory)+" on "+dest.Host)
+			}
+		}
+		for _, place := range places {
+			if owner, ok := owners[place]; ok && owner != name {
+				return fmt.Errorf("profiles %s and %s share %s, give each profile its own", owner, name, place)
+			}
+			owners[place] = name
+		}
+	}
+	return nil
+}
+
+// profileConfig returns the config with the profile layer merged over a
+// copy of merged.
+func profileConfig(merged, layer map[string]any, appendSlices bool) (Config, error) {
+	var config Config
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return config, err
+	}
+	var copied map[string]any
+	err = json.Unmarshal(data, &copied)
+	if err != nil {
+		return config, err
+	}
+	mergeConfigMaps(copied, layer, appendSlices)
+	data, err = json.Marshal(copied)
+	if err != nil {
+		return config, err
+	}
+	return config, decodeConfig(data, &config, true)
+}
+
+func expandConfigPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if strings.HasPrefix(path, envConfigScheme) {
+			files = append(files, path)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// envConfigScheme prefixes config paths naming an environment variable,
+// EnvConfigVariable when no name follows.
+const envConfigScheme = "env:"
+
+// EnvConfigVariable is the environment variable an "env:" config path
+// reads the whole JSON config from.
+const EnvConfigVariable = "BACKUPIFY_CONFIG"
+
+// readConfigSource returns the contents of a config file or, for an env:
+// path, of the environment variable.
+func readConfigSource(path string) ([]byte, error) {
+	if !strings.HasPrefix(path, envConfigScheme) {
+		return os.ReadFile(path)
+	}
+	name := strings.TrimPrefix(path, envConfigScheme)
+	if name == "" {
+		name = EnvConfigVariable
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return []byte(value), nil
+}
+
+func mergeConfigMaps(dst, src map[string]any, appendSlices bool) {
+	for key, value := range src {
+		switch value := value.(type) {
+		case map[string]any:
+			if existing, ok := dst[key].(map[string]any); ok {
+				mergeConfigMaps(existing, value, appendSlices)
+				continue
+			}
+		case []any:
+			if existing, ok := dst[key].([]any); ok && appendSlices {
+				dst[key] = append(existing, value...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
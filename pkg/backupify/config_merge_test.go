@@ -0,0 +1,216 @@
+package backupify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeTestMap(t *testing.T, data string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", data, err)
+	}
+	return m
+}
+
+func TestMergeConfigMaps(t *testing.T) {
+	tests := []struct {
+		name         string
+		dst, src     string
+		appendSlices bool
+		want         string
+	}{
+		{
+			name: "later value wins",
+			dst:  `{"mysql_host": "a", "keep_local": 3}`,
+			src:  `{"mysql_host": "b"}`,
+			want: `{"mysql_host": "b", "keep_local": 3}`,
+		},
+		{
+			name: "objects merge key by key",
+			dst:  `{"anonymize": {"shop.users.email": "email", "shop.users.name": "redact"}}`,
+			src:  `{"anonymize": {"shop.users.name": "null"}}`,
+			want: `{"anonymize": {"shop.users.email": "email", "shop.users.name": "null"}}`,
+		},
+		{
+			name: "arrays replace",
+			dst:  `{"databases": ["shop", "crm"]}`,
+			src:  `{"databases": ["blog"]}`,
+			want: `{"databases": ["blog"]}`,
+		},
+		{
+			name:         "arrays append",
+			dst:          `{"databases": ["shop", "crm"]}`,
+			src:          `{"databases": ["blog"]}`,
+			appendSlices: true,
+			want:         `{"databases": ["shop", "crm", "blog"]}`,
+		},
+		{
+			name:         "array over scalar replaces",
+			dst:          `{"databases": "shop"}`,
+			src:          `{"databases": ["blog"]}`,
+			appendSlices: true,
+			want:         `{"databases": ["blog"]}`,
+		},
+		{
+			name: "object over scalar replaces",
+			dst:  `{"anonymize": null}`,
+			src:  `{"anonymize": {"shop.users.name": "null"}}`,
+			want: `{"anonymize": {"shop.users.name": "null"}}`,
+		},
+		{
+			name: "nested objects",
+			dst:  `{"profiles": {"nightly": {"compression": "zstd", "remote_keep_last": 7}}}`,
+			src:  `{"profiles": {"nightly": {"remote_keep_last": 14}, "hourly": {}}}`,
+			want: `{"profiles": {"nightly": {"compression": "zstd", "remote_keep_last": 14}, "hourly": {}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := decodeTestMap(t, tt.dst)
+			mergeConfigMaps(dst, decodeTestMap(t, tt.src), tt.appendSlices)
+			if want := decodeTestMap(t, tt.want); !reflect.DeepEqual(dst, want) {
+				t.Errorf("merged %v, want %v", dst, want)
+			}
+		})
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	const profiles = `"profiles": {
+		"nightly": {"backup_directory": "/backups/nightly", "databases": ["shop"], "compression_level": 1},
+		"weekly": {"backup_directory": "/backups/weekly", "compression_level": "19"}
+	}`
+	tests := []struct {
+		name         string
+		config       string
+		profile      string
+		appendSlices bool
+		allowUnknown bool
+		want         map[string]any
+		err          string
+	}{
+		{
+			name:    "no profile",
+			config:  `{"backup_directory": "/backups", "databases": ["crm"], ` + profiles + `}`,
+			profile: "",
+			want:    map[string]any{"backup_directory": "/backups", "databases": []any{"crm"}},
+		},
+		{
+			name:    "profile overrides",
+			config:  `{"backup_directory": "/backups", "databases": ["crm"], ` + profiles + `}`,
+			profile: "nightly",
+			want:    map[string]any{"backup_directory": "/backups/nightly", "databases": []any{"shop"}, "compression_level": float64(1)},
+		},
+		{
+			name:         "profile appends",
+			config:       `{"backup_directory": "/backups", "databases": ["crm"], ` + profiles + `}`,
+			profile:      "nightly",
+			appendSlices: true,
+			want:         map[string]any{"backup_directory": "/backups/nightly", "databases": []any{"crm", "shop"}},
+		},
+		{
+			name:    "unknown profile",
+			config:  `{"backup_directory": "/backups", ` + profiles + `}`,
+			profile: "hourly",
+			err:     `unknown profile "hourly", the config has nightly, weekly`,
+		},
+		{
+			name:    "no profiles",
+			config:  `{"backup_directory": "/backups"}`,
+			profile: "nightly",
+			err:     "the config has no profiles",
+		},
+		{
+			name:   "profile not an object",
+			config: `{"profiles": {"nightly": []}}`,
+			err:    "profile nightly must be an object",
+		},
+		{
+			name:   "nested profiles",
+			config: `{"profiles": {"nightly": {"backup_directory": "/n", "profiles": {}}}}`,
+			err:    "profile nightly can't have profiles of its own",
+		},
+		{
+			name:   "unknown key",
+			config: `{"profiles": {"nightly": {"backup_directory": "/n", "mysql_hots": "db"}}}`,
+			err:    "failed to parse profile nightly",
+		},
+		{
+			name:         "unknown key allowed",
+			config:       `{"profiles": {"nightly": {"backup_directory": "/n", "mysql_hots": "db"}}}`,
+			profile:      "nightly",
+			allowUnknown: true,
+			want:         map[string]any{"backup_directory": "/n", "mysql_hots": "db"},
+		},
+		{
+			name:   "shared backup directory",
+			config: `{"backup_directory": "/backups", "profiles": {"a": {}, "b": {"databases": ["shop"]}}}`,
+			err:    "profiles a and b share backup_directory /backups",
+		},
+		{
+			name:   "shared state file",
+			config: `{"state_file": "/var/lib/backupify.json", "profiles": {"a": {"backup_directory": "/a"}, "b": {"backup_directory": "/b"}}}`,
+			err:    "profiles a and b share state_file /var/lib/backupify.json",
+		},
+		{
+			name:   "shared ftp directory",
+			config: `{"ftp_host": "ftp.example.com", "ftp_directory": "backups/", "profiles": {"a": {"backup_directory": "/a"}, "b": {"backup_directory": "/b", "ftp_directory": "/backups"}}}`,
+			err:    "profiles a and b share directory /backups on ftp.example.com",
+		},
+		{
+			name:    "same ftp directory on other hosts",
+			config:  `{"ftp_host": "one.example.com", "ftp_directory": "backups", "profiles": {"a": {"backup_directory": "/a"}, "b": {"backup_directory": "/b", "ftp_host": "two.example.com"}}}`,
+			profile: "b",
+			want:    map[string]any{"backup_directory": "/b", "ftp_host": "two.example.com", "ftp_directory": "backups"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := decodeTestMap(t, tt.config)
+			err := applyProfile(merged, tt.profile, tt.appendSlices, tt.allowUnknown)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("applyProfile() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyProfile() = %v", err)
+			}
+			for key, want := range tt.want {
+				if got := merged[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "10-base.json")
+	local := filepath.Join(dir, "20-local.json")
+	os.WriteFile(base, []byte(`{"mysql_host": "db", "backup_directory": "/backups", "databases": ["shop"],
+		"profiles": {"nightly": {"backup_directory": "/backups/nightly", "compression_level": 3}}}`), 0o644)
+	os.WriteFile(local, []byte(`{"mysql_host": "replica"}`), 0o644)
+
+	config, err := LoadConfigProfile([]string{dir}, "nightly", false, false)
+	if err != nil {
+		t.Fatalf("LoadConfigProfile() = %v", err)
+	}
+	if config.MySQLHost != "replica" || config.BackupDirectory != "/backups/nightly" || config.CompressionLevel != "3" || config.Profile != "nightly" {
+		t.Errorf("got mysql_host %q, backup_directory %q, compression_level %q, profile %q", config.MySQLHost, config.BackupDirectory, config.CompressionLevel, config.Profile)
+	}
+
+	os.WriteFile(local, []byte(`{"mysql_hots": "replica"}`), 0o644)
+	_, err = LoadConfigProfile([]string{dir}, "nightly", false, false)
+	if err == nil || !strings.Contains(err.Error(), local) {
+		t.Errorf("LoadConfigProfile() = %v, want an error naming %s", err, local)
+	}
+}
@@ -0,0 +1,119 @@
+package backupify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// snapshotLock is FLUSH TABLES WITH READ LOCK held on a connection of its
+// own while dump processes open their transactions, so they all see the
+// same snapshot.
+type snapshotLock struct {
+	conn     *sql.Conn
+	baseline int
+	unlock   func()
+}
+
+// lockForSnapshot takes the global read lock and counts the transactions
+// of the backup user that were already open.
+func lockForSnapshot(ctx context.Context, config Config) (*snapshotLock, error) {
+	pool, err := metadataPool(config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mysql connection: %w", err)
+	}
+	_, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock tables: %w", err)
+	}
+	l := &snapshotLock{conn: conn}
+	l.unlock = sync.OnceFunc(func() { conn.ExecContext(context.Background(), "UNLOCK TABLES") })
+	l.baseline, err = openTransactions(ctx, config)
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// release waits until n dump processes have opened their transactions or
+// finished, and then releases the lock, also when waiting failed.
+func (l *snapshotLock) release(ctx context.Context, config Config, n int, finished *atomic.Int32) error {
+	err := waitForTransactions(ctx, config, l.baseline, n, finished)
+	l.unlock()
+	return err
+}
+
+// close releases the lock if it is still held and closes its connection.
+func (l *snapshotLock) close() {
+	l.unlock()
+	l.conn.Close()
+}
+
+// consistentDumps dumps every database of the run at once, with each
+// mysqldump in a single transaction opened under one global read lock, so
+// all databases are dumped as of the same instant. The results and entries
+// are in the order of r.databases.
+func (r *run) consistentDumps(ctx context.Context) ([]DatabaseResult, [][]archiveEntry, error) {
+	lock, err := lockForSnapshot(ctx, r.cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start consistent snapshot: %w", err)
+	}
+	defer lock.close()
+	r.logger.Printf("dumping %d databases from one snapshot", len(r.databases))
+
+	dumpCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]DatabaseResult, len(r.databases))
+	entries := make([][]archiveEntry, len(r.databases))
+	var finished atomic.Int32
+	var wg sync.WaitGroup
+	for i, db := range r.databases {
+		wg.Add(1)
+		go func(i int, db string) {
+			defer wg.Done()
+			defer finished.Add(1)
+			results[i], entries[i] = r.dumpDatabase(dumpCtx, db)
+		}(i, db)
+	}
+
+	err = lock.release(ctx, r.cfg, len(r.databases), &finished)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start consistent snapshot: %w", err)
+	}
+	return results, entries, nil
+}
+
+// validateConsistentSnapshot rejects options that would dump a database
+// outside the shared snapshot or block on the read lock.
+func (c Config) validateConsistentSnapshot() error {
+	if !c.ConsistentSnapshot {
+		return nil
+	}
+	switch {
+	case c.dumpTool() != DumpToolMysqldump && c.dumpTool() != DumpToolMariadbDump:
+		return fmt.Errorf("consistent_snapshot needs dump_tool mysqldump or mariadb-dump")
+	case c.PerDatabaseArchives || c.StreamUploads:
+		return fmt.Errorf("consistent_snapshot needs a single archive, it can't be used with per_database_archives or stream_uploads")
+	case c.ParallelTables > 1:
+		return fmt.Errorf("consistent_snapshot can't be used with parallel_tables")
+	case c.MasterData != 0 || c.FlushLogs:
+		return fmt.Errorf("consistent_snapshot can't be used with master_data or flush_logs, every dump would record a different position")
+	case c.PreBackupOptimize || c.PreBackupAnalyze:
+		return fmt.Errorf("consistent_snapshot can't be used with pre_backup_optimize or pre_backup_analyze, they would wait for the read lock")
+	case c.DumpSSH != nil:
+		return fmt.Errorf("consistent_snapshot can't be used with dump_ssh")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package backupify
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ArchiveFile is an entry of an archive as listed by ArchiveContents.
+type ArchiveFile struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+}
+
+// ArchiveContents lists the entries of an archive compressed with the zstd
+// dictionary at dictionaryPath, if any, without extracting them.
+func ArchiveContents(archivePath, dictionaryPath string) ([]ArchiveFile, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tarStream, err := decompressArchive(file, archivePath, dictionaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer tarStream.Close()
+
+	var files []ArchiveFile
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read archive: %w", err)
+		}
+		files = append(files, ArchiveFile{
+			Name:    header.Name,
+			Size:    header.Size,
+			Mode:    header.FileInfo().Mode(),
+			ModTime: header.ModTime,
+		})
+	}
+}
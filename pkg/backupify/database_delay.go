@@ -0,0 +1,28 @@
+package backupify
+
+import (
+	"context"
+	"time"
+)
+
+// pauseBeforeDatabase waits InterDatabaseDelaySeconds before the dump of
+// every database but the first, when databases are dumped one at a time.
+// It returns ctx's error once the run is cancelled.
+func (r *run) pauseBeforeDatabase(ctx context.Context, i int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if i == 0 || r.cfg.InterDatabaseDelaySeconds <= 0 || (r.cfg.PerDatabaseArchives && r.cfg.DatabaseConcurrency > 1) {
+		return nil
+	}
+	delay := time.Duration(r.cfg.InterDatabaseDelaySeconds * float64(time.Second))
+	r.logger.Printf("pausing %s before the next database", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
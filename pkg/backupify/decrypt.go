@@ -0,0 +1,69 @@
+package backupify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isEncryptedArchive reports whether archivePath was written with
+// EncryptCommand, in either pipeline order.
+func isEncryptedArchive(archivePath string) bool {
+	return strings.HasSuffix(archivePath, ".enc") || strings.Contains(filepath.Base(archivePath), ".tar.enc.")
+}
+
+// decryptArchive writes the plain archive of the encrypted one at
+// archivePath through DecryptCommand into a temporary directory next to
+// it and returns its path; the caller removes the directory. An
+// encrypt-then-compress archive is decompressed first and yields a plain
+// .tar.
+func decryptArchive(config Config, archivePath string) (string, error) {
+	if config.DecryptCommand == "" {
+		return "", fmt.Errorf("%s is encrypted, set decrypt_command to restore it", archivePath)
+	}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	name := filepath.Base(archivePath)
+	var in io.Reader = file
+	if before, compressed, ok := strings.Cut(name, ".tar.enc."); ok {
+		stream, err := decompressArchive(file, before+".tar."+compressed, config.ZstdDictionaryPath)
+		if err != nil {
+			return "", err
+		}
+		defer stream.Close()
+		in, name = stream, before+".tar"
+	} else {
+		name = strings.TrimSuffix(name, ".enc")
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(archivePath), ".decrypt-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create decrypted archive: %w", err)
+	}
+	plainPath := filepath.Join(dir, name)
+	out, err := os.Create(plainPath)
+	if err == nil {
+		err = runFilter(config.DecryptCommand, in, out)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to decrypt archive: %w", err)
+	}
+	return plainPath, nil
+}
+
+func (c Config) validateDecryptCommand() error {
+	if c.DecryptCommand != "" && len(strings.Fields(c.DecryptCommand)) == 0 {
+		return fmt.Errorf("decrypt_command must name a command")
+	}
+	return nil
+}
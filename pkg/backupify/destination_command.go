@@ -0,0 +1,84 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// isFTP reports whether dest is an FTP server, which the operations that
+// list or delete remote files need.
+func (d Destination) isFTP() bool {
+	return d.Type == "" || d.Type == DestinationFTP
+}
+
+// uploadToCommand pipes localFile into the command of dest, like
+// uploadToSSH, and then its .sha256 and .sig files, each in a run of its
+// own with BACKUPIFY_FILE naming it.
+func uploadToCommand(ctx context.Context, config Config, dest Destination, localFile string) (string, error) {
+	return streamWithSidecars(config, localFile, true, func(name string, input io.Reader) (string, error) {
+		return streamToCommand(ctx, config, dest, name, input)
+	})
+}
+
+// commandStderrTail is how much of the end of the stderr of a destination
+// command is kept for the error message.
+const commandStderrTail = 4 << 10
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[:copy(b.data, b.data[len(b.data)-b.max:])]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
+
+// streamToCommand runs dest.Command locally with input as its stdin, e.g.
+// "dd of=/dev/nst0 bs=256k" for a tape drive. {path} in the command is
+// replaced with Directory/name. The upload succeeds when it exits zero. Its
+// stdout is discarded and the end of its stderr goes into the error.
+func streamToCommand(ctx context.Context, config Config, dest Destination, name string, input io.Reader) (string, error) {
+	target := path.Join(dest.Directory, name)
+	args := strings.Fields(dest.Command)
+	for i, arg := range args {
+		args[i] = strings.ReplaceAll(arg, "{path}", target)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BACKUPIFY_DESTINATION="+dest.Name,
+		"BACKUPIFY_FILE="+name,
+		"BACKUPIFY_RUN_ID="+config.RunID,
+	)
+	cmd.Stdin = input
+	stderr := &tailBuffer{max: commandStderrTail}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("destination command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return target, nil
+}
+
+// preflightCommand checks that the command of dest can be found. Nothing
+// is written, as a tape drive can't take a test file back.
+func preflightCommand(dest Destination) error {
+	_, err := exec.LookPath(strings.Fields(dest.Command)[0])
+	if err != nil {
+		return fmt.Errorf("destination command not found: %w", err)
+	}
+	return nil
+}
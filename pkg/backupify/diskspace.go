@@ -0,0 +1,51 @@
+package backupify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkFreeDisk fails when a directory the run writes to has less than
+// MinFreeDiskMB available, so the run stops before a dump fills the disk.
+func checkFreeDisk(cfg Config) error {
+	if cfg.MinFreeDiskMB <= 0 {
+		return nil
+	}
+	dirs := []string{cfg.BackupDirectory}
+	if cfg.TabExport {
+		dirs = append(dirs, cfg.TabDirectory)
+	}
+	if cfg.ChunkStore != "" {
+		dirs = append(dirs, cfg.ChunkStore)
+	}
+	for _, dir := range dirs {
+		free, ok, err := freeDiskBytes(existingParent(dir))
+		if err != nil {
+			return fmt.Errorf("failed to get free disk space of %s: %w", dir, err)
+		}
+		if !ok {
+			cfg.logger().Printf("free disk space check is not supported on this platform")
+			return nil
+		}
+		if freeMB := free / (1 << 20); freeMB < uint64(cfg.MinFreeDiskMB) {
+			return fmt.Errorf("not enough free disk space in %s: %d MB available, %d MB required", dir, freeMB, cfg.MinFreeDiskMB)
+		}
+	}
+	return nil
+}
+
+// existingParent returns dir or its closest ancestor that exists, since
+// some directories are only created later in the run.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
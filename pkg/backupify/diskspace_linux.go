@@ -0,0 +1,14 @@
+package backupify
+
+import "syscall"
+
+// freeDiskBytes returns the space available to unprivileged users on the
+// file system holding dir.
+func freeDiskBytes(dir string) (uint64, bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, true, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), true, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package backupify
+
+// freeDiskBytes is not implemented outside Linux and reports false.
+func freeDiskBytes(dir string) (uint64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,422 @@
+package backupify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transientDumpErrors are stderr fragments of mysqldump failures that are
+// worth retrying.
+var transientDumpErrors = []string{
+	"Lock wait timeout exceeded",
+	"Deadlock found",
+	"Lost connection to MySQL server",
+	"MySQL server has gone away",
+}
+
+// dumpError is a failed mysqldump run together with what it wrote to stderr.
+type dumpError struct {
+	err    error
+	stderr string
+}
+
+func (e *dumpError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("failed to execute dump tool: %v", e.err)
+	}
+	return fmt.Sprintf("failed to execute dump tool: %v: %s", e.err, e.stderr)
+}
+
+func (e *dumpError) Unwrap() error {
+	return e.err
+}
+
+func (e *dumpError) transient() bool {
+	for _, fragment := range transientDumpErrors {
+		if strings.Contains(e.stderr, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpCommand builds the mysqldump command with the connection arguments
+// followed by args.
+func dumpCommand(ctx context.Context, config Config, args ...string) *exec.Cmd {
+	args = append(append(dumpArgs(config), dumpFlags(config)...), args...)
+	return serverCommand(ctx, config, config.dumpTool(), args)
+}
+
+// Supported values of Config.DumpTool.
+const (
+	DumpToolMysqldump   = "mysqldump"
+	DumpToolMysqlpump   = "mysqlpump"
+	DumpToolMariadbDump = "mariadb-dump"
+	DumpToolMydumper    = "mydumper"
+)
+
+func (c Config) dumpTool() string {
+	if c.DumpTool == "" {
+		return DumpToolMysqldump
+	}
+	return c.DumpTool
+}
+
+// dumpFlags returns the dump tool options selected in the config.
+func dumpFlags(config Config) []string {
+	var flags []string
+	if config.dumpTool() == DumpToolMysqlpump && config.DumpParallelism > 0 {
+		flags = append(flags, "--default-parallelism="+strconv.Itoa(config.DumpParallelism))
+	}
+	if config.dumpTool() == DumpToolMysqldump {
+		if config.ColumnStatistics {
+			flags = append(flags, "--column-statistics=1")
+		} else if supportsColumnStatistics(config) {
+			flags = append(flags, "--column-statistics=0")
+		}
+	}
+	if config.OrderByPrimary {
+		flags = append(flags, "--order-by-primary")
+	}
+	if config.SetGTIDPurged != "" {
+		flags = append(flags, "--set-gtid-purged="+strings.ToUpper(config.SetGTIDPurged))
+	}
+	if config.MasterData != 0 {
+		flags = append(flags, "--master-data="+strconv.Itoa(config.MasterData))
+	}
+	if config.ConsistentSnapshot {
+		flags = append(flags, "--single-transaction", "--skip-lock-tables")
+	}
+	if config.TzUTC != nil && !*config.TzUTC {
+		flags = append(flags, "--skip-tz-utc")
+	}
+	flags = append(flags, config.lockTablesFlags()...)
+	if config.InsertIgnore {
+		flags = append(flags, "--insert-ignore")
+	}
+	if config.Replace {
+		flags = append(flags, "--replace")
+	}
+	if config.HexBlob {
+		flags = append(flags, "--hex-blob")
+	}
+	return append(flags, config.DumpExtraArgs...)
+}
+
+// columnStatisticsClients caches supportsColumnStatistics per dump client.
+var columnStatisticsClients sync.Map
+
+// supportsColumnStatistics reports whether the mysqldump the dumps run with
+// knows --column-statistics, which mysqldump 5.7 rejects. Its --help is
+// read once per client.
+func supportsColumnStatistics(config Config) bool {
+	client := config.dumpTool()
+	if config.DumpSSH != nil {
+		client = config.DumpSSH.Host + ":" + client
+	}
+	if supported, ok := columnStatisticsClients.Load(client); ok {
+		return supported.(bool)
+	}
+	output, err := serverCommand(context.Background(), config, config.dumpTool(), []string{"--help"}).Output()
+	supported := err == nil && bytes.Contains(output, []byte("--column-statistics"))
+	columnStatisticsClients.Store(client, supported)
+	return supported
+}
+
+func dumpArgs(config Config) []string {
+	args := []string{
+		"-h", config.MySQLHost,
+		"-u", config.MySQLUser,
+		"-p" + config.MySQLPassword,
+	}
+	if config.GetServerPublicKey {
+		args = append(args, "--get-server-public-key")
+	}
+	if config.ServerPublicKeyPath != "" {
+		args = append(args, "--server-public-key-path="+config.ServerPublicKeyPath)
+	}
+	return args
+}
+
+// dumpContext limits the dump of a single database to
+// PerDatabaseTimeoutMinutes, so a hung mysqldump is killed and the other
+// databases go ahead.
+func dumpContext(ctx context.Context, config Config) (context.Context, context.CancelFunc) {
+	if config.PerDatabaseTimeoutMinutes <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(config.PerDatabaseTimeoutMinutes)*time.Minute)
+}
+
+// timeoutError replaces err with a clearer one when dumpCtx ran out of time,
+// and removes the partial files left behind.
+func timeoutError(config Config, dumpCtx context.Context, err error, partialFiles ...string) error {
+	if !errors.Is(dumpCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	for _, file := range partialFiles {
+		os.Remove(file)
+	}
+	return fmt.Errorf("dump timed out after %d minutes: %w", config.PerDatabaseTimeoutMinutes, context.DeadlineExceeded)
+}
+
+// backupDatabase dumps database into outputFile, retrying up to
+// config.DumpRetries times when mysqldump fails with a transient error such
+// as a lock wait timeout or deadlock. args replace the default arguments
+// naming what to dump, which are just the database.
+func backupDatabase(ctx context.Context, config Config, database string, outputFile string, args ...string) error {
+	return backupDatabaseTo(ctx, config, database, &dumpOutput{file: outputFile}, args...)
+}
+
+// dumpOutput is where a dump goes. With memoryLimit set the dump is kept in
+// data as long as it is no bigger than that, and only written to file when
+// it grows past it.
+type dumpOutput struct {
+	file        string
+	memoryLimit int64
+	data        []byte
+	inMemory    bool
+}
+
+// backupDatabaseTo is backupDatabase writing to output.
+func backupDatabaseTo(ctx context.Context, config Config, database string, output *dumpOutput, args ...string) error {
+	if len(args) == 0 {
+		args = []string{database}
+	}
+	outputFile := output.file
+	if strings.HasSuffix(outputFile, ".gz") {
+		config = dumpCompressionLevel(ctx, config, database)
+	}
+	config = dumpLockTables(ctx, config, database)
+	fixed := time.Duration(config.DumpRetryDelaySeconds) * time.Second
+	for attempt := 0; ; attempt++ {
+		err := dumpToOutput(ctx, config, output, args)
+		if err == nil {
+			return nil
+		}
+		dumpErr, ok := err.(*dumpError)
+		// A retry would see a later snapshot than the other databases.
+		if !ok || !dumpErr.transient() || attempt >= config.DumpRetries || config.ConsistentSnapshot {
+			return err
+		}
+
+		delay := retryDelay(config, fixed, attempt)
+		config.logger().Printf("dump of %s failed with a transient error, retrying in %s (attempt %d of %d): %v", database, delay, attempt+1, config.DumpRetries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// dumpToFile runs mysqldump into outputFile. When the file name ends in .gz
+// the dump is gzipped on the fly, so the uncompressed SQL never touches disk.
+func dumpToFile(ctx context.Context, config Config, outputFile string, args []string) error {
+	return dumpToOutput(ctx, config, &dumpOutput{file: outputFile}, args)
+}
+
+// dumpToOutput runs mysqldump into output, like dumpToFile.
+func dumpToOutput(ctx context.Context, config Config, output *dumpOutput, args []string) error {
+	outputFile := output.file
+	var outfile io.WriteCloser
+	var spill *spillWriter
+	if output.memoryLimit > 0 {
+		spill = &spillWriter{path: outputFile, limit: output.memoryLimit}
+		outfile = spill
+	} else {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create database copy file: %w", err)
+		}
+		outfile = file
+	}
+	defer outfile.Close()
+
+	var err error
+	var out io.Writer = outfile
+	var buffered *bufio.Writer
+	if config.WriteBufferKB > 0 && spill == nil {
+		buffered = bufio.NewWriterSize(outfile, config.WriteBufferKB<<10)
+		out = buffered
+	}
+
+	if strings.HasSuffix(outputFile, ".gz") {
+		gzWriter := newGzipWriter(config, out)
+		err = dumpToWriter(ctx, config, args, gzWriter)
+		if err != nil {
+			return err
+		}
+		err = gzWriter.Close()
+		if err != nil {
+			return fmt.Errorf("failed to finish compressed dump: %w", err)
+		}
+	} else {
+		err = dumpToWriter(ctx, config, args, out)
+		if err != nil {
+			return err
+		}
+	}
+
+	if buffered != nil {
+		err = buffered.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to write database copy file: %w", err)
+		}
+	}
+	err = outfile.Close()
+	if err != nil {
+		return err
+	}
+	output.data, output.inMemory = nil, false
+	if spill != nil && spill.file == nil {
+		output.data, output.inMemory = spill.buf.Bytes(), true
+	}
+	return nil
+}
+
+// spillWriter keeps what is written in memory up to limit bytes, and moves
+// it to a file at path once there is more.
+type spillWriter struct {
+	path  string
+	limit int64
+	buf   bytes.Buffer
+	file  *os.File
+	// closed is set once Close has run.
+	closed bool
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	if w.file == nil && int64(w.buf.Len()+len(p)) <= w.limit {
+		return w.buf.Write(p)
+	}
+	if w.file == nil {
+		file, err := os.Create(w.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create database copy file: %w", err)
+		}
+		w.file = file
+		_, err = w.buf.WriteTo(file)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write database copy file: %w", err)
+		}
+	}
+	return w.file.Write(p)
+}
+
+// Close closes the file, if the dump was moved to one. A dump that stayed
+// in memory removes the file an earlier attempt may have left.
+func (w *spillWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.file == nil {
+		err := os.Remove(w.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove database copy file: %w", err)
+		}
+		return nil
+	}
+	return w.file.Close()
+}
+
+func dumpToWriter(ctx context.Context, config Config, args []string, w io.Writer) error {
+	var transform *transformWriter
+	if config.TransformCommand != "" {
+		var err error
+		transform, err = startTransformCommand(config.TransformCommand, w)
+		if err != nil {
+			return err
+		}
+		w = transform
+	}
+	cmd := dumpCommand(ctx, config, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = w
+	var anon *anonymizer
+	if len(config.Anonymize) > 0 {
+		anon = newAnonymizer(config, dumpedDatabase(args), w)
+		cmd.Stdout = anon
+	}
+	cmd.Stdout = throttleDump(ctx, config, cmd.Stdout)
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if anon != nil && anon.err != nil {
+		// mysqldump only sees the closed pipe.
+		if transform != nil {
+			transform.Close()
+		}
+		return fmt.Errorf("failed to anonymize dump: %w", anon.err)
+	}
+	if err != nil {
+		// A transform command that exited early shows up as a broken pipe.
+		if transform != nil {
+			if terr := transform.Close(); terr != nil {
+				return terr
+			}
+		}
+		return &dumpError{err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	if anon != nil {
+		if err := anon.Close(); err != nil {
+			if transform != nil {
+				transform.Close()
+			}
+			return fmt.Errorf("failed to anonymize dump: %w", err)
+		}
+	}
+	if transform != nil {
+		if err := transform.Close(); err != nil {
+			return err
+		}
+	}
+	return checkDumpWarnings(config, stderr.String())
+}
+
+// backupDatabaseTab runs mysqldump --tab into TabDirectory/<database>, with
+// args as extra options, and returns the per-table files it produced. The
+// .txt data files are written by the MySQL server itself, so the directory
+// must be on the server host and writable by mysqld, and the user needs
+// the FILE privilege.
+func backupDatabaseTab(ctx context.Context, config Config, database string, args ...string) ([]string, error) {
+	config = dumpLockTables(ctx, config, database)
+	dir := filepath.Join(config.TabDirectory, database)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tab directory: %w", err)
+	}
+
+	cmd := dumpCommand(ctx, config, append(append([]string{"--tab=" + dir}, args...), database)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mysqldump: %w: %s", err, output)
+	}
+	err = checkDumpWarnings(config, string(output))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tab directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
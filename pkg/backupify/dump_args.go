@@ -0,0 +1,76 @@
+package backupify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// safeDumpOptions are the mysqldump options DumpExtraArgs may use. Options
+// that write files, read option files or load plugins are left out, since
+// they would let the config reach beyond the dump.
+var safeDumpOptions = map[string]bool{
+	"--add-drop-database":     true,
+	"--add-drop-table":        true,
+	"--add-drop-trigger":      true,
+	"--add-locks":             true,
+	"--complete-insert":       true,
+	"--compress":              true,
+	"--default-character-set": true,
+	"--events":                true,
+	"--hex-blob":              true,
+	"--insert-ignore":         true,
+	"--lock-tables":           true,
+	"--max-allowed-packet":    true,
+	"--net-buffer-length":     true,
+	"--no-create-info":        true,
+	"--no-data":               true,
+	"--no-tablespaces":        true,
+	"--port":                  true,
+	"--protocol":              true,
+	"--quick":                 true,
+	"--replace":               true,
+	"--routines":              true,
+	"--single-transaction":    true,
+	"--skip-add-drop-table":   true,
+	"--skip-add-locks":        true,
+	"--skip-comments":         true,
+	"--skip-dump-date":        true,
+	"--skip-extended-insert":  true,
+	"--skip-lock-tables":      true,
+	"--skip-quick":            true,
+	"--skip-triggers":         true,
+	"--ssl-ca":                true,
+	"--ssl-cert":              true,
+	"--ssl-key":               true,
+	"--ssl-mode":              true,
+	"--triggers":              true,
+	"--tz-utc":                true,
+}
+
+// unsafeArgChars are characters with a meaning to a shell. Arguments are
+// passed to mysqldump without one, but a value containing them is more
+// likely a mistake or an attempt to smuggle in a command than intended.
+const unsafeArgChars = ";&|`$<>\\\n\r"
+
+// validateDumpExtraArgs rejects DumpExtraArgs outside safeDumpOptions, and
+// database names that mysqldump would take for an option.
+func (c Config) validateDumpExtraArgs() error {
+	for _, arg := range c.DumpExtraArgs {
+		name, _, _ := strings.Cut(arg, "=")
+		if !safeDumpOptions[name] {
+			return fmt.Errorf("dump_extra_args: %q is not an allowed mysqldump option", arg)
+		}
+		if strings.ContainsAny(arg, unsafeArgChars) {
+			return fmt.Errorf("dump_extra_args: %q contains shell metacharacters", arg)
+		}
+	}
+	if len(c.DumpExtraArgs) > 0 && c.dumpTool() != DumpToolMysqldump && c.dumpTool() != DumpToolMariadbDump {
+		return fmt.Errorf("dump_extra_args is only supported with mysqldump and mariadb-dump")
+	}
+	for _, db := range c.Databases {
+		if strings.HasPrefix(db, "-") {
+			return fmt.Errorf("database name %q can't start with -", db)
+		}
+	}
+	return nil
+}
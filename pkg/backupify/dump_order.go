@@ -0,0 +1,45 @@
+package backupify
+
+import (
+	"fmt"
+	"sort"
+)
+
+// orderDatabases returns databases in DumpOrder: the databases it lists
+// first, in its order, and the others after them in their original order.
+func (c Config) orderDatabases(databases []string) []string {
+	if len(c.DumpOrder) == 0 {
+		return databases
+	}
+	rank := map[string]int{}
+	for i, db := range c.DumpOrder {
+		if _, ok := rank[db]; !ok {
+			rank[db] = i
+		}
+	}
+	ordered := append([]string(nil), databases...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, iok := rank[ordered[i]]
+		rj, jok := rank[ordered[j]]
+		if iok && jok {
+			return ri < rj
+		}
+		return iok
+	})
+	return ordered
+}
+
+// validateDumpOrder rejects DumpOrder entries that aren't in Databases,
+// which are most likely typos.
+func (c Config) validateDumpOrder() error {
+	known := map[string]bool{}
+	for _, db := range c.Databases {
+		known[db] = true
+	}
+	for _, db := range c.DumpOrder {
+		if !known[db] {
+			return fmt.Errorf("dump_order: %q is not in databases", db)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// serverCommand runs the MySQL tool name with args on this host, or over
+// ssh on DumpSSH when it is set. Priority settings apply on the host the
+// tool runs on.
+func serverCommand(ctx context.Context, config Config, name string, args []string) *exec.Cmd {
+	if config.DumpSSH == nil {
+		name, args = withPriority(config, name, args)
+		return exec.CommandContext(ctx, name, args...)
+	}
+
+	var words []string
+	if config.NiceLevel != 0 {
+		words = append(words, "nice", "-n", strconv.Itoa(config.NiceLevel))
+	}
+	if config.IONiceClass != 0 {
+		words = append(words, "ionice", "-c", strconv.Itoa(config.IONiceClass))
+	}
+	words = append(append(words, name), args...)
+	for i, word := range words {
+		words[i] = shellQuote(word)
+	}
+	sshArgs := append(sshProxyArgs(config), sshArgs(*config.DumpSSH)...)
+	return exec.CommandContext(ctx, "ssh", append(sshArgs, strings.Join(words, " "))...)
+}
+
+// validateDumpSSH checks DumpSSH and the options that need the dump tools
+// or the database on this host.
+func (c Config) validateDumpSSH() error {
+	if c.DumpSSH.Host == "" {
+		return fmt.Errorf("dump_ssh needs a host")
+	}
+	if c.DumpSSH.KnownHostsPath != "" && c.DumpSSH.InsecureIgnoreHostKey {
+		return fmt.Errorf("dump_ssh: known_hosts_path and insecure_ignore_host_key can't be used together")
+	}
+	if c.SQLMetadataQueries || c.TabExport || c.dumpTool() == DumpToolMydumper {
+		return fmt.Errorf("dump_ssh can't be used with sql_metadata_queries, tab_export or mydumper, which need the database or the dump files on this host")
+	}
+	return nil
+}
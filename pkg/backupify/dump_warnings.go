@@ -0,0 +1,47 @@
+package backupify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ignoredDumpWarnings are warnings every dump prints, since the password
+// is passed on the command line.
+var ignoredDumpWarnings = []string{
+	"Using a password on the command line interface can be insecure",
+}
+
+// dumpWarnings returns the lines of a dump tool's stderr that are warnings.
+func dumpWarnings(stderr string) []string {
+	var warnings []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.Contains(strings.ToLower(line), "warning") || isIgnoredWarning(line) {
+			continue
+		}
+		warnings = append(warnings, line)
+	}
+	return warnings
+}
+
+func isIgnoredWarning(line string) bool {
+	for _, fragment := range ignoredDumpWarnings {
+		if strings.Contains(line, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDumpWarnings fails a dump that exited successfully but printed
+// warnings, when FailOnDumpWarnings is set.
+func checkDumpWarnings(config Config, stderr string) error {
+	if !config.FailOnDumpWarnings {
+		return nil
+	}
+	warnings := dumpWarnings(stderr)
+	if len(warnings) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s printed warnings: %s", config.dumpTool(), strings.Join(warnings, "; "))
+}
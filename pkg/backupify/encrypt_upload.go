@@ -0,0 +1,77 @@
+package backupify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// uploadArchive uploads archivePath to dests. With EncryptOnUploadOnly the
+// local archive is plaintext and an encrypted copy, archivePath.enc with
+// its own checksum and signature, is uploaded instead and removed again
+// afterwards.
+func uploadArchive(ctx context.Context, config Config, dests []Destination, archivePath string) ([]UploadResult, error) {
+	if !config.EncryptOnUploadOnly || strings.HasSuffix(archivePath, ".enc") {
+		return uploadToAll(ctx, config, dests, archivePath)
+	}
+	encPath, err := encryptCopy(config, archivePath)
+	defer func() {
+		for _, file := range append(existingSidecars(encPath), encPath) {
+			os.Remove(file)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return uploadToAll(ctx, config, dests, encPath)
+}
+
+// encryptCopy writes archivePath through EncryptCommand into
+// archivePath.enc, together with its .sha256 and .sig when configured.
+func encryptCopy(config Config, archivePath string) (string, error) {
+	encPath := archivePath + ".enc"
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return encPath, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(encPath)
+	if err != nil {
+		return encPath, fmt.Errorf("failed to create encrypted copy: %w", err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	encryptor, err := startCompressCommand(config.EncryptCommand, io.MultiWriter(out, hash))
+	if err != nil {
+		return encPath, err
+	}
+	_, err = io.Copy(encryptor, in)
+	if closeErr := encryptor.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		return encPath, fmt.Errorf("failed to encrypt %s: %w", archivePath, err)
+	}
+
+	if config.Checksum {
+		err = writeChecksumFile(encPath, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			return encPath, err
+		}
+	}
+	if config.SigningKeyPath != "" {
+		err = signArchive(encPath, config.SigningKeyPath)
+		if err != nil {
+			return encPath, err
+		}
+	}
+	return encPath, nil
+}
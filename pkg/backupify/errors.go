@@ -0,0 +1,63 @@
+package backupify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors for use with errors.Is. Errors returned by Run and
+// UploadArchive wrap them, together with the name of the database or
+// destination involved where there is one.
+var (
+	ErrConfigInvalid = errors.New("invalid config")
+	ErrDumpFailed    = errors.New("dump failed")
+	ErrUploadFailed  = errors.New("upload failed")
+	// ErrArchiveShrank means an archive was more than
+	// SizeDropThresholdPercent smaller than the previous one and was not
+	// uploaded.
+	ErrArchiveShrank = errors.New("archive shrank")
+	// ErrBackupStale means CheckFreshness found no backup younger than
+	// MaxBackupAgeHours.
+	ErrBackupStale = errors.New("backup is stale")
+	// ErrNoDatabases means the run had no databases to back up and
+	// AllowEmptyBackup wasn't set.
+	ErrNoDatabases = errors.New("no databases to back up")
+)
+
+// DatabaseError is a failure to back up a single database. It matches
+// ErrDumpFailed.
+type DatabaseError struct {
+	Database string
+	Err      error
+}
+
+func (e *DatabaseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Database, e.Err)
+}
+
+func (e *DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DatabaseError) Is(target error) bool {
+	return target == ErrDumpFailed
+}
+
+// DestinationError is a failure to upload to a single destination. It
+// matches ErrUploadFailed.
+type DestinationError struct {
+	Destination string
+	Err         error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Destination, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DestinationError) Is(target error) bool {
+	return target == ErrUploadFailed
+}
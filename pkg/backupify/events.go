@@ -0,0 +1,48 @@
+package backupify
+
+import "time"
+
+// Event types passed to Config.OnEvent.
+const (
+	EventDatabaseStarted  = "db_started"
+	EventDatabaseFinished = "db_finished"
+	EventArchiveCreated   = "archive_created"
+	EventUploadStarted    = "upload_started"
+	EventUploadFinished   = "upload_finished"
+	EventDone             = "done"
+)
+
+// Event is a step of a run reported to Config.OnEvent as it happens.
+type Event struct {
+	Type        string    `json:"event"`
+	Time        time.Time `json:"time"`
+	RunID       string    `json:"run_id,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Database    string    `json:"database,omitempty"`
+	File        string    `json:"file,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	RemotePath  string    `json:"remote_path,omitempty"`
+	// Size is the size in bytes of the dump, archive or upload, when known.
+	Size    int64 `json:"size,omitempty"`
+	Skipped bool  `json:"skipped,omitempty"`
+	// EstimatedMonthlyCost is that of the run's uploads, on the done event.
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost,omitempty"`
+	Error                string  `json:"error,omitempty"`
+}
+
+func (c Config) emit(event Event) {
+	if c.OnEvent == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.RunID = c.RunID
+	event.Environment = c.Environment
+	c.OnEvent(event)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,70 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// excludeTablePatterns compiles ExcludeTablePatterns.
+func (c Config) excludeTablePatterns() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(c.ExcludeTablePatterns))
+	for i, pattern := range c.ExcludeTablePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_table_patterns entry %q: %w", pattern, err)
+		}
+		patterns[i] = re
+	}
+	return patterns, nil
+}
+
+// matchesAny reports whether name matches one of patterns.
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedTables returns the tables and views of database that match
+// ExcludeTablePatterns.
+func excludedTables(ctx context.Context, config Config, database string) ([]string, error) {
+	if len(config.ExcludeTablePatterns) == 0 {
+		return nil, nil
+	}
+	patterns, err := config.excludeTablePatterns()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := queryMySQL(ctx, config, "SHOW TABLES FROM "+quoteIdentifier(database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var excluded []string
+	for _, row := range rows {
+		if matchesAny(patterns, row[0]) {
+			excluded = append(excluded, row[0])
+		}
+	}
+	config.logger().Printf("excluding %d of %d tables of %s", len(excluded), len(rows), database)
+	return excluded, nil
+}
+
+// withoutExcluded drops the names in excluded from tables.
+func withoutExcluded(tables, excluded []string) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, name := range excluded {
+		skip[name] = true
+	}
+	var kept []string
+	for _, name := range tables {
+		if !skip[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
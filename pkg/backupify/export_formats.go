@@ -0,0 +1,222 @@
+package backupify
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Supported values of Config.ExportFormats.
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+// exportPrefix is the directory in the archive that holds the ExportFormats
+// tables, as export/<database>/<table>.<format>.
+const exportPrefix = "export/"
+
+// csvNull is how CSV exports write SQL NULL, as SELECT ... INTO OUTFILE does.
+const csvNull = `\N`
+
+// exportTables writes the ExportFormats tables of db, reading them over the
+// go-sql-driver pool in one read-only transaction, so the exports of a
+// database are consistent with each other.
+func (r *run) exportTables(ctx context.Context, db string, tables []string) ([]archiveEntry, error) {
+	pool, err := metadataPool(r.cfg)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := pool.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start export transaction: %w", err)
+	}
+	defer tx.Rollback()
+	var entries []archiveEntry
+	for _, table := range tables {
+		format := r.cfg.ExportFormats[db+"."+table]
+		file := filepath.Join(r.cfg.BackupDirectory, db+"."+table+"."+format)
+		r.logger.Printf("exporting %s.%s as %s -> %s", db, table, format, file)
+		err := exportTable(ctx, tx, db, table, format, file)
+		if err != nil {
+			return nil, fmt.Errorf("export of %s.%s: %w", db, table, err)
+		}
+		entries = append(entries, archiveEntry{path: file, name: r.entryName(db, exportPrefix+db+"/"+table+"."+format)})
+	}
+	return entries, nil
+}
+
+func exportTable(ctx context.Context, tx *sql.Tx, db, table, format, file string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+quoteIdentifier(db)+"."+quoteIdentifier(table))
+	if err != nil {
+		return fmt.Errorf("failed to execute mysql query: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("failed to execute mysql query: %w", err)
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer out.Close()
+	buffered := bufio.NewWriter(out)
+	var write func([]sql.RawBytes) error
+	if format == ExportFormatCSV {
+		write, err = csvRowWriter(buffered, columns)
+	} else {
+		write = jsonRowWriter(buffered, columns)
+	}
+	if err != nil {
+		return err
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return fmt.Errorf("failed to read mysql result: %w", err)
+		}
+		err = write(values)
+		if err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read mysql result: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return out.Close()
+}
+
+// csvRowWriter writes the header row and returns a writer for the rows.
+func csvRowWriter(w io.Writer, columns []*sql.ColumnType) (func([]sql.RawBytes) error, error) {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.Name()
+	}
+	if err := cw.Write(record); err != nil {
+		return nil, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return func(values []sql.RawBytes) error {
+		for i, value := range values {
+			record[i] = csvNull
+			if value != nil {
+				record[i] = string(value)
+			}
+		}
+		cw.Write(record)
+		cw.Flush()
+		return cw.Error()
+	}, nil
+}
+
+// jsonRowWriter returns a writer for the rows as JSON Lines, one object per
+// row with the columns in table order. Numeric columns are written as
+// numbers, binary ones as base64 strings and everything else as strings.
+func jsonRowWriter(w io.Writer, columns []*sql.ColumnType) func([]sql.RawBytes) error {
+	keys := make([][]byte, len(columns))
+	numeric := make([]bool, len(columns))
+	binary := make([]bool, len(columns))
+	for i, column := range columns {
+		keys[i], _ = json.Marshal(column.Name())
+		numeric[i] = isNumericColumn(column.DatabaseTypeName())
+		binary[i] = isBinaryColumn(column.DatabaseTypeName())
+	}
+	var line []byte
+	return func(values []sql.RawBytes) error {
+		line = append(line[:0], '{')
+		for i, value := range values {
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = append(append(line, keys[i]...), ':')
+			switch {
+			case value == nil:
+				line = append(line, "null"...)
+			case numeric[i]:
+				line = append(line, value...)
+			case binary[i]:
+				encoded, _ := json.Marshal([]byte(value))
+				line = append(line, encoded...)
+			default:
+				encoded, _ := json.Marshal(string(value))
+				line = append(line, encoded...)
+			}
+		}
+		line = append(line, '}', '\n')
+		_, err := w.Write(line)
+		return err
+	}
+}
+
+func isNumericColumn(typeName string) bool {
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return true
+	}
+	return false
+}
+
+// isBinaryColumn reports whether values of the type are bytes rather than
+// text, which JSON strings can't hold as they are.
+func isBinaryColumn(typeName string) bool {
+	switch typeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return true
+	}
+	return false
+}
+
+func (c Config) validateExportFormats() error {
+	if len(c.ExportFormats) == 0 {
+		return nil
+	}
+	switch {
+	case c.rawDumps() || c.StreamUploads || c.ChunkStore != "":
+		return fmt.Errorf("export_formats needs a tar archive")
+	case c.TabExport || c.dumpTool() == DumpToolMydumper:
+		return fmt.Errorf("export_formats can't be used with tab_export or dump_tool mydumper")
+	case c.ConsistentSnapshot || c.DumpSSH != nil:
+		return fmt.Errorf("export_formats can't be used with consistent_snapshot or dump_ssh, the tables are read over a connection of their own")
+	}
+	for key, format := range c.ExportFormats {
+		db, table, ok := strings.Cut(key, ".")
+		if !ok || db == "" || table == "" {
+			return fmt.Errorf("export_formats: %q must be <database>.<table>", key)
+		}
+		if format != ExportFormatCSV && format != ExportFormatJSON {
+			return fmt.Errorf("export_formats: %s must be %q or %q, got %q", key, ExportFormatCSV, ExportFormatJSON, format)
+		}
+		if _, ok := c.IncrementalColumns[key]; ok {
+			return fmt.Errorf("export_formats: %s is also in incremental_columns", key)
+		}
+		for column := range c.Anonymize {
+			if strings.HasPrefix(column, key+".") {
+				return fmt.Errorf("export_formats: %s has anonymize rules, which only apply to the SQL dump", key)
+			}
+		}
+		for _, grouped := range c.groupedTables(db) {
+			if grouped == table {
+				return fmt.Errorf("export_formats: %s is in a table group", key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package backupify
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// extraFilesPrefix is the archive directory extra files are stored under.
+const extraFilesPrefix = "files/"
+
+// extraFileEntries returns archive entries for ExtraFiles and everything
+// below ExtraDirs. Paths are kept under files/ in the archive, absolute
+// paths without their leading slash.
+func extraFileEntries(config Config) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	for _, file := range config.ExtraFiles {
+		entries = append(entries, archiveEntry{path: file, name: extraFileName(file)})
+	}
+	for _, dir := range config.ExtraDirs {
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				entries = append(entries, archiveEntry{path: file, name: extraFileName(file)})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect extra files from %s: %w", dir, err)
+		}
+	}
+	return entries, nil
+}
+
+func extraFileName(file string) string {
+	name := path.Clean(filepath.ToSlash(file))
+	name = strings.TrimLeft(name, "/")
+	for strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(name, "../")
+	}
+	return extraFilesPrefix + name
+}
@@ -0,0 +1,70 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// failoverDestinationName is the name of the destination FailoverDestinations
+// act as, e.g. in database_destinations.
+const failoverDestinationName = "failover"
+
+// expandFailover replaces failover groups in dests with their members, for
+// the operations that go to every server, such as retention.
+func expandFailover(dests []Destination) []Destination {
+	var expanded []Destination
+	for _, dest := range dests {
+		if len(dest.failover) > 0 {
+			expanded = append(expanded, dest.failover...)
+		} else {
+			expanded = append(expanded, dest)
+		}
+	}
+	return expanded
+}
+
+// uploadWithFailover runs upload for dest or, for the failover group, for
+// its members in order until one succeeds. It returns the remote path and
+// the name of the destination the file went to.
+func uploadWithFailover(ctx context.Context, config Config, dest Destination, upload func(context.Context, Destination) (string, error)) (string, string, error) {
+	if len(dest.failover) == 0 {
+		remotePath, err := upload(ctx, dest)
+		return remotePath, dest.Name, err
+	}
+	var errs []error
+	for _, member := range dest.failover {
+		remotePath, err := upload(ctx, member)
+		if err == nil {
+			if len(errs) > 0 {
+				config.logger().Printf("uploaded to failover destination %s: %v", member.Name, errors.Join(errs...))
+			}
+			return remotePath, member.Name, nil
+		}
+		errs = append(errs, &DestinationError{Destination: member.Name, Err: err})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", dest.Name, errors.Join(errs...)
+}
+
+func (c Config) validateFailoverDestinations() error {
+	if len(c.FailoverDestinations) == 0 {
+		return nil
+	}
+	if c.StreamUploads {
+		return fmt.Errorf("failover_destinations can't be used with stream_uploads, a stream can't be sent again")
+	}
+	names := map[string]bool{failoverDestinationName: true}
+	for _, dest := range c.destinations() {
+		names[dest.Name] = true
+	}
+	for _, dest := range c.FailoverDestinations {
+		if dest.Name == "" || names[dest.Name] {
+			return fmt.Errorf("failover_destinations: every destination needs a name of its own, not %q", dest.Name)
+		}
+		names[dest.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package backupify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeMySQL puts a mysql client first on PATH that prints replies[key] for
+// a query containing key, and nothing for other queries. Keys must not
+// overlap, as they are tried in no particular order.
+func fakeMySQL(t *testing.T, replies map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	i := 0
+	for key, reply := range replies {
+		i++
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("reply%d", i)), []byte(key+"\n"+reply), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write fake mysql reply: %v", err)
+		}
+	}
+	script := `#!/bin/sh
+for arg; do query=$arg; done
+for reply in "$FAKE_MYSQL_REPLIES"/reply*; do
+	[ -f "$reply" ] || continue
+	key=$(head -n 1 "$reply")
+	case $query in
+	*"$key"*) tail -n +2 "$reply"; exit 0 ;;
+	esac
+done
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(dir, "mysql"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake mysql: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_MYSQL_REPLIES", dir)
+}
+
+// fakeMysqldump puts a mysqldump first on PATH that prints dump for every
+// database it is asked for.
+func fakeMysqldump(t *testing.T, dump string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dump.sql"), []byte(dump), 0o644); err != nil {
+		t.Fatalf("failed to write fake dump: %v", err)
+	}
+	script := `#!/bin/sh
+[ "$1" = --help ] && exit 0
+cat "$FAKE_MYSQLDUMP_OUTPUT"
+`
+	if err := os.WriteFile(filepath.Join(dir, "mysqldump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake mysqldump: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_MYSQLDUMP_OUTPUT", filepath.Join(dir, "dump.sql"))
+}
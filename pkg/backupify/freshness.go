@@ -0,0 +1,144 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// FreshnessResult is the newest backup found in one location.
+type FreshnessResult struct {
+	// Location is a local directory or a destination name.
+	Location string    `json:"location"`
+	Newest   string    `json:"newest,omitempty"`
+	Created  time.Time `json:"created,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// CheckFreshness finds the newest backup in BackupDirectory,
+// AdditionalBackupDirs and the directories of the FTP destinations, and
+// fails with ErrBackupStale when it is older than MaxBackupAgeHours or
+// there is none. Directories with date placeholders are looked at as of
+// every time in the last MaxBackupAgeHours they render differently for. A
+// location that can't be read is reported in its result and doesn't fail
+// the check as long as another one has a recent backup.
+func CheckFreshness(ctx context.Context, config Config) ([]FreshnessResult, error) {
+	if config.MaxBackupAgeHours <= 0 {
+		return nil, fmt.Errorf("%w: max_backup_age_hours is not set", ErrConfigInvalid)
+	}
+	now := time.Now()
+	oldest := now.Add(-time.Duration(config.MaxBackupAgeHours) * time.Hour)
+
+	var results []FreshnessResult
+	for _, dir := range append([]string{config.BackupDirectory}, config.AdditionalBackupDirs...) {
+		results = append(results, localFreshness(dir))
+	}
+	for _, dest := range expandFailover(config.destinations()) {
+		if !dest.isFTP() {
+			continue
+		}
+		results = append(results, remoteFreshness(ctx, config, dest, windowDirectories(dest.Directory, oldest, now)))
+	}
+
+	var newest FreshnessResult
+	var errs []error
+	for _, result := range results {
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", result.Location, result.Error))
+		}
+		if result.Created.After(newest.Created) {
+			newest = result
+		}
+	}
+	switch {
+	case newest.Newest == "" && len(errs) > 0:
+		return results, fmt.Errorf("%w: no backup found: %w", ErrBackupStale, errors.Join(errs...))
+	case newest.Newest == "":
+		return results, fmt.Errorf("%w: no backup found", ErrBackupStale)
+	case newest.Created.Before(oldest):
+		return results, fmt.Errorf("%w: newest backup %s in %s is from %s, more than %d hours ago", ErrBackupStale, newest.Newest, newest.Location, newest.Created.Format(time.RFC3339), config.MaxBackupAgeHours)
+	}
+	return results, nil
+}
+
+// windowDirectories returns the distinct renderings of dir for the times
+// from oldest to now, stepping by the smallest date placeholder it has.
+func windowDirectories(dir string, oldest, now time.Time) []string {
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	switch {
+	case strings.Contains(dir, "{minute}"):
+		step = func(t time.Time) time.Time { return t.Add(time.Minute) }
+	case strings.Contains(dir, "{hour}"):
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	add := func(t time.Time) {
+		if rendered := renderRemoteDirectory(dir, t); !seen[rendered] {
+			seen[rendered] = true
+			dirs = append(dirs, rendered)
+		}
+	}
+	add(now)
+	if renderRemoteDirectory(dir, oldest) == dir {
+		return dirs
+	}
+	for t := oldest; t.Before(now); t = step(t) {
+		add(t)
+	}
+	return dirs
+}
+
+func localFreshness(dir string) FreshnessResult {
+	result := FreshnessResult{Location: dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var files []retainedFile
+	for _, entry := range entries {
+		if file, ok := parseRetainedFile(entry.Name(), time.Time{}); ok && entry.Type().IsRegular() {
+			files = append(files, file)
+		}
+	}
+	result.setNewest(files)
+	return result
+}
+
+func remoteFreshness(ctx context.Context, config Config, dest Destination, dirs []string) FreshnessResult {
+	result := FreshnessResult{Location: dest.Name}
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Quit()
+
+	var files []retainedFile
+	for _, dir := range dirs {
+		if dir == "" {
+			dir = "."
+		}
+		found, err := listRetainedFiles(conn, dir)
+		if err != nil && len(dirs) == 1 {
+			result.Error = err.Error()
+		}
+		files = append(files, found...)
+	}
+	result.setNewest(files)
+	return result
+}
+
+// setNewest records the newest of files by the timestamp in their names.
+func (r *FreshnessResult) setNewest(files []retainedFile) {
+	for _, file := range files {
+		created, err := time.ParseInLocation("20060102_150405", file.stamp, time.Local)
+		if err == nil && created.After(r.Created) {
+			r.Newest, r.Created = file.name, created
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+)
+
+// ftpControl is a bare FTP control connection for commands the ftp client
+// library doesn't expose, such as SITE CHMOD. No data connection is ever
+// opened on it.
+type ftpControl struct {
+	conn    *textproto.Conn
+	release func()
+}
+
+func dialFTPControl(ctx context.Context, config Config, dest Destination) (*ftpControl, error) {
+	dial, err := ftpDialFunc(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	release, err := acquireFTPSlot(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	netConn, err := dial("tcp", dest.Host)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to connect to ftp server: %w", err)
+	}
+	c := &ftpControl{conn: textproto.NewConn(netConn), release: release}
+	_, _, err = c.conn.ReadResponse(2)
+	if err != nil {
+		c.conn.Close()
+		release()
+		return nil, fmt.Errorf("failed to connect to ftp server: %w", err)
+	}
+
+	code, _, err := c.command("USER " + dest.User)
+	if err == nil && code == 331 {
+		code, _, err = c.command("PASS " + dest.Password)
+	}
+	if err == nil && code != 230 {
+		err = fmt.Errorf("unexpected reply %d", code)
+	}
+	if err != nil {
+		c.conn.Close()
+		release()
+		return nil, fmt.Errorf("failed to auth on ftp server: %w", err)
+	}
+	return c, nil
+}
+
+// command sends a raw command and returns the reply code and message.
+func (c *ftpControl) command(cmd string) (int, string, error) {
+	id, err := c.conn.Cmd("%s", cmd)
+	if err != nil {
+		return 0, "", err
+	}
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+	code, msg, err := c.conn.ReadResponse(0)
+	if _, ok := err.(*textproto.Error); ok {
+		err = nil
+	}
+	return code, msg, err
+}
+
+func (c *ftpControl) Close() error {
+	c.command("QUIT")
+	defer c.release()
+	return c.conn.Close()
+}
+
+// notSupported reports whether an FTP reply code means the command isn't
+// implemented by the server.
+func notSupported(code int) bool {
+	return code == 500 || code == 502 || code == 504
+}
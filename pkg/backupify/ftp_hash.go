@@ -0,0 +1,123 @@
+package backupify
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ftpHashCommand is a command that makes the server hash a file.
+type ftpHashCommand struct {
+	// feature is how FEAT lists it, and cmd what is sent before the path.
+	feature, cmd string
+	sha256       bool
+}
+
+// ftpHashCommands are tried in this order: the HASH command of
+// draft-bryan-ftpext-hash with SHA-256, then the older X commands.
+var ftpHashCommands = []ftpHashCommand{
+	{feature: "HASH", cmd: "HASH", sha256: true},
+	{feature: "XSHA256", cmd: "XSHA256", sha256: true},
+	{feature: "XMD5", cmd: "XMD5"},
+	{feature: "MD5", cmd: "MD5"},
+}
+
+// hashCommand picks the hash command the server lists in FEAT, selecting
+// SHA-256 for HASH. It reports false when there is none.
+func hashCommand(control *ftpControl) (ftpHashCommand, bool, error) {
+	code, msg, err := control.command("FEAT")
+	if err != nil {
+		return ftpHashCommand{}, false, err
+	}
+	if code != 211 {
+		return ftpHashCommand{}, false, nil
+	}
+	features := map[string]string{}
+	for _, line := range strings.Split(msg, "\n") {
+		name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		features[strings.ToUpper(name)] = strings.ToUpper(args)
+	}
+	for _, command := range ftpHashCommands {
+		args, ok := features[command.feature]
+		if !ok {
+			continue
+		}
+		if command.feature == "HASH" {
+			if !strings.Contains(args, "SHA-256") {
+				continue
+			}
+			if code, _, err := control.command("OPTS HASH SHA-256"); err != nil || code/100 != 2 {
+				continue
+			}
+		}
+		return command, true, nil
+	}
+	return ftpHashCommand{}, false, nil
+}
+
+// verifyRemoteHash has the server of dest hash remotePath and compares it
+// with the hash of what open returns, deleting the remote file when they
+// differ. Servers without a hash command are left to the size check of
+// the upload.
+func verifyRemoteHash(ctx context.Context, config Config, dest Destination, remotePath string, open func() (io.ReadCloser, error)) error {
+	control, err := dialFTPControl(ctx, config, dest)
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+
+	command, ok, err := hashCommand(control)
+	if err != nil {
+		return fmt.Errorf("failed to query ftp server features: %w", err)
+	}
+	if !ok {
+		config.logger().Printf("%s has no hash command, relying on the size check for %s", dest.Name, remotePath)
+		return nil
+	}
+
+	var h hash.Hash = md5.New()
+	if command.sha256 {
+		h = sha256.New()
+	}
+	input, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	_, err = io.Copy(h, input)
+	input.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read local file: %w", err)
+	}
+	want := hex.EncodeToString(h.Sum(nil))
+
+	code, msg, err := control.command(command.cmd + " " + remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s on the server: %w", remotePath, err)
+	}
+	if code/100 != 2 {
+		return fmt.Errorf("failed to hash %s on the server: %d %s", remotePath, code, msg)
+	}
+	got := hexField(msg, len(want))
+	if !strings.EqualFold(got, want) {
+		control.command("DELE " + remotePath)
+		return fmt.Errorf("%s hash of uploaded %s is %q, expected %s", command.cmd, remotePath, got, want)
+	}
+	return nil
+}
+
+// hexField returns the first word of a hash reply that is a hex string of
+// length n. Replies differ between commands, e.g. "SHA-256 0-10 <hash>
+// <file>" for HASH and "<file> <hash>" for MD5.
+func hexField(msg string, n int) string {
+	for _, field := range strings.Fields(msg) {
+		if _, err := hex.DecodeString(field); err == nil && len(field) == n {
+			return field
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package backupify
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestHexField(t *testing.T) {
+	const sha = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	const md5 = "098f6bcd4621d373cade4e832627b4f6"
+	tests := []struct {
+		msg  string
+		n    int
+		want string
+	}{
+		{"SHA-256 0-4 " + sha + " backups/a.tar.gz", 64, sha},
+		{"backups/a.tar.gz " + md5, 32, md5},
+		{md5, 32, md5},
+		{strings.ToUpper(md5), 32, strings.ToUpper(md5)},
+		{"SHA-256 0-4 " + sha + " backups/a.tar.gz", 32, ""},
+		{"backups/cafe " + md5, 32, md5},
+		{"file not found", 32, ""},
+		{"", 64, ""},
+	}
+	for _, tt := range tests {
+		if got := hexField(tt.msg, tt.n); got != tt.want {
+			t.Errorf("hexField(%q, %d) = %q, want %q", tt.msg, tt.n, got, tt.want)
+		}
+	}
+}
+
+// scriptedControl returns an ftpControl whose server answers each command
+// with replies[command], or 502.
+func scriptedControl(t *testing.T, replies map[string]string) *ftpControl {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		reader := bufio.NewReader(server)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			reply, ok := replies[strings.TrimRight(line, "\r\n")]
+			if !ok {
+				reply = "502 not implemented"
+			}
+			fmt.Fprintf(server, "%s\r\n", strings.ReplaceAll(reply, "\n", "\r\n"))
+		}
+	}()
+	control := &ftpControl{conn: textproto.NewConn(client), release: func() {}}
+	t.Cleanup(func() { control.Close() })
+	return control
+}
+
+func TestHashCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies map[string]string
+		want    string
+		ok      bool
+	}{
+		{
+			name: "hash with sha-256",
+			replies: map[string]string{
+				"FEAT":              "211-Features:\n HASH SHA-1;SHA-256*;MD5\n XMD5\n211 End",
+				"OPTS HASH SHA-256": "200 SHA-256",
+			},
+			want: "HASH",
+			ok:   true,
+		},
+		{
+			name: "hash without sha-256",
+			replies: map[string]string{
+				"FEAT": "211-Features:\n HASH SHA-1*;MD5\n XMD5\n211 End",
+			},
+			want: "XMD5",
+			ok:   true,
+		},
+		{
+			name: "sha-256 refused",
+			replies: map[string]string{
+				"FEAT":              "211-Features:\n HASH SHA-256\n XSHA256\n211 End",
+				"OPTS HASH SHA-256": "504 no",
+			},
+			want: "XSHA256",
+			ok:   true,
+		},
+		{
+			name: "md5 only",
+			replies: map[string]string{
+				"FEAT": "211-Features:\n MDTM\n md5\n211 End",
+			},
+			want: "MD5",
+			ok:   true,
+		},
+		{
+			name: "no hash command",
+			replies: map[string]string{
+				"FEAT": "211-Features:\n MDTM\n SIZE\n211 End",
+			},
+		},
+		{
+			name:    "no feat",
+			replies: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, ok, err := hashCommand(scriptedControl(t, tt.replies))
+			if err != nil {
+				t.Fatalf("hashCommand() = %v", err)
+			}
+			if ok != tt.ok || command.cmd != tt.want {
+				t.Errorf("hashCommand() = %q, %v, want %q, %v", command.cmd, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
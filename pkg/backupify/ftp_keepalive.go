@@ -0,0 +1,193 @@
+package backupify
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// withKeepAlive makes dial wrap the control connection in a keepAliveConn.
+// The ftp package dials data connections with the same function, so only
+// the first connection is wrapped.
+func withKeepAlive(dial dialFunc, interval time.Duration) dialFunc {
+	var once sync.Once
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		wrapped := conn
+		once.Do(func() { wrapped = newKeepAliveConn(conn, interval) })
+		return wrapped, nil
+	}
+}
+
+// keepAliveConn writes a NOOP whenever the control connection has not been
+// written to for interval, e.g. during a long STOR. The ftp client never
+// sees those NOOPs: every command written, ours or the client's, is queued,
+// and the replies, which the server sends in order, are matched to it and
+// removed when they answer a NOOP. A server that answers a NOOP during a
+// transfer before the transfer's own reply is handled too, as only a NOOP
+// is answered with 200 then.
+type keepAliveConn struct {
+	net.Conn
+	interval time.Duration
+	done     chan struct{}
+	stop     sync.Once
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	// commands are the commands waiting for their reply, oldest first;
+	// true for our NOOPs.
+	commands []bool
+	// transfer is set once the oldest command got a preliminary reply.
+	transfer bool
+	// multiLine is the code of the multi-line reply being read, and
+	// dropping whether it answers a NOOP.
+	multiLine []byte
+	dropping  bool
+
+	// Only touched by Read.
+	buf     [4096]byte
+	in, out []byte
+	midLine bool
+	readErr error
+}
+
+func newKeepAliveConn(conn net.Conn, interval time.Duration) *keepAliveConn {
+	c := &keepAliveConn{Conn: conn, interval: interval, done: make(chan struct{}), lastWrite: time.Now()}
+	go c.keepAlive()
+	return c
+}
+
+func (c *keepAliveConn) keepAlive() {
+	ticker := time.NewTicker(c.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		if time.Since(c.lastWrite) >= c.interval {
+			_, err := c.Conn.Write([]byte("NOOP\r\n"))
+			if err == nil {
+				c.commands = append(c.commands, true)
+			}
+			c.lastWrite = time.Now()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *keepAliveConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastWrite = time.Now()
+	n, err := c.Conn.Write(p)
+	for range bytes.Count(p[:n], []byte("\n")) {
+		c.commands = append(c.commands, false)
+	}
+	return n, err
+}
+
+func (c *keepAliveConn) Read(p []byte) (int, error) {
+	for len(c.out) == 0 && c.readErr == nil {
+		n, err := c.Conn.Read(c.buf[:])
+		c.in = append(c.in, c.buf[:n]...)
+		c.readErr = err
+		c.filter()
+	}
+	if len(c.out) == 0 {
+		err := c.readErr
+		c.readErr = nil
+		return 0, err
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// filter moves the complete lines read so far to out, dropping the replies
+// to our NOOPs. An incomplete line is passed on right away unless it could
+// still turn out to be such a reply.
+func (c *keepAliveConn) filter() {
+	for {
+		i := bytes.IndexByte(c.in, '\n')
+		if i < 0 {
+			break
+		}
+		line := c.in[:i+1]
+		if c.midLine || !c.noopReply(line) {
+			c.out = append(c.out, line...)
+		}
+		c.midLine = false
+		c.in = c.in[i+1:]
+	}
+
+	c.mu.Lock()
+	waiting := slices.Contains(c.commands, true) || c.dropping
+	c.mu.Unlock()
+	if !c.midLine && !waiting && len(c.in) >= 4 {
+		// The rest of the line is passed on without looking at it again.
+		c.noopReply(c.in)
+		c.midLine = true
+	}
+	if c.midLine {
+		c.out = append(c.out, c.in...)
+		c.in = c.in[:0]
+	}
+}
+
+// noopReply matches the reply line starting line to its command and
+// reports whether it answers one of our NOOPs.
+func (c *keepAliveConn) noopReply(line []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.multiLine != nil {
+		// Only the last line of a multi-line reply starts with its code
+		// and a space.
+		if len(line) >= 4 && bytes.Equal(line[:3], c.multiLine) && line[3] == ' ' {
+			c.multiLine = nil
+		}
+		dropping := c.dropping
+		if c.multiLine == nil {
+			c.dropping = false
+		}
+		return dropping
+	}
+	if len(line) < 4 || len(c.commands) == 0 {
+		return false
+	}
+	code := line[:3]
+	if line[3] == '-' {
+		c.multiLine = bytes.Clone(code)
+	}
+	if code[0] == '1' {
+		// A preliminary reply, the command's final one follows.
+		c.transfer = !c.commands[0]
+		return false
+	}
+	i := 0
+	if c.transfer && string(code) == "200" {
+		if j := slices.Index(c.commands, true); j > 0 {
+			i = j
+		}
+	}
+	noop := c.commands[i]
+	c.commands = slices.Delete(c.commands, i, i+1)
+	if i == 0 {
+		c.transfer = false
+	}
+	c.dropping = noop && c.multiLine != nil
+	return noop
+}
+
+func (c *keepAliveConn) Close() error {
+	c.stop.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,58 @@
+package backupify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// ftpSlots is the process-wide semaphore behind MaxFTPConnections. It is
+// replaced when a config with another limit comes along; sessions opened
+// under the old one release into the old channel.
+var ftpSlots struct {
+	mu    sync.Mutex
+	limit int
+	ch    chan struct{}
+}
+
+// acquireFTPSlot waits until fewer than MaxFTPConnections FTP sessions are
+// open and returns the function that gives the slot back.
+func acquireFTPSlot(ctx context.Context, config Config) (func(), error) {
+	if config.MaxFTPConnections <= 0 {
+		return func() {}, nil
+	}
+	ftpSlots.mu.Lock()
+	if ftpSlots.limit != config.MaxFTPConnections {
+		ftpSlots.limit = config.MaxFTPConnections
+		ftpSlots.ch = make(chan struct{}, config.MaxFTPConnections)
+	}
+	ch := ftpSlots.ch
+	ftpSlots.mu.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-ch }) }, nil
+}
+
+// ftpConn is a logged in FTP session that holds a MaxFTPConnections slot
+// until Quit.
+type ftpConn struct {
+	*ftp.ServerConn
+	release func()
+}
+
+// Quit logs out and gives the slot back. Calling it again does nothing.
+func (c *ftpConn) Quit() error {
+	if c.release == nil {
+		return nil
+	}
+	err := c.ServerConn.Quit()
+	c.release()
+	c.release = nil
+	return err
+}
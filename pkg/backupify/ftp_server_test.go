@@ -0,0 +1,166 @@
+package backupify
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// fakeFTPServer is just enough of an FTP server for the tests: it accepts
+// any login and answers SIZE and LIST from files, which maps paths to
+// sizes.
+type fakeFTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	files    map[string]int64
+	// sizeCode, when set, is the reply to every SIZE command.
+	sizeCode int
+	commands []string
+}
+
+func newFakeFTPServer(t *testing.T, files map[string]int64) *fakeFTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeFTPServer{listener: listener, files: files}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// dial logs in to the server.
+func (s *fakeFTPServer) dial(t *testing.T) *ftpConn {
+	t.Helper()
+	conn, err := ftp.Dial(s.listener.Addr().String(), ftp.DialWithTimeout(5*time.Second))
+	if err == nil {
+		err = conn.Login("user", "password")
+	}
+	if err != nil {
+		t.Fatalf("failed to connect to the test server: %v", err)
+	}
+	c := &ftpConn{ServerConn: conn, release: func() {}}
+	t.Cleanup(func() { c.Quit() })
+	return c
+}
+
+// received returns the commands the server got with the given verb.
+func (s *fakeFTPServer) received(verb string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var commands []string
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, verb+" ") || command == verb {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...any) { fmt.Fprintf(conn, format+"\r\n", args...) }
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+
+	reply("220 ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		switch verb {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 ok")
+		case "SIZE":
+			s.mu.Lock()
+			code := s.sizeCode
+			size, ok := s.files[arg]
+			s.mu.Unlock()
+			switch {
+			case code != 0:
+				reply("%d no", code)
+			case ok:
+				reply("213 %d", size)
+			default:
+				reply("550 %s: no such file", arg)
+			}
+		case "EPSV":
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				reply("425 %v", err)
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "LIST":
+			if data == nil {
+				reply("425 no data connection")
+				continue
+			}
+			reply("150 here comes the listing")
+			dataConn, err := data.Accept()
+			data.Close()
+			data = nil
+			if err != nil {
+				reply("425 %v", err)
+				continue
+			}
+			for _, line := range s.listing(arg) {
+				fmt.Fprintf(dataConn, "%s\r\n", line)
+			}
+			dataConn.Close()
+			reply("226 done")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 %s not implemented", verb)
+		}
+	}
+}
+
+// listing returns ls -l lines for the files in dir.
+func (s *fakeFTPServer) listing(dir string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []string
+	for file, size := range s.files {
+		if path.Dir(file) == path.Clean(dir) {
+			lines = append(lines, fmt.Sprintf("-rw-r--r--   1 owner    group    %8d Jan 02 15:04 %s", size, path.Base(file)))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
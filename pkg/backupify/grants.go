@@ -0,0 +1,76 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+const grantsName = "grants.sql"
+
+// queryRaw runs query with the mysql client in raw mode, so values such as
+// grants come back unescaped, one row per line.
+func queryRaw(ctx context.Context, config Config, query string) ([]string, error) {
+	cmd := mysqlCommand(ctx, config, "-N", "-B", "-r", "-e", query)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mysql query: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// showCreateUser returns the CREATE USER statement of account. MySQL 8
+// password hashes are binary, so they are requested as hex where the server
+// supports it.
+func showCreateUser(ctx context.Context, config Config, account string) (string, error) {
+	lines, err := queryRaw(ctx, config, "SET SESSION print_identified_with_as_hex = ON; SHOW CREATE USER "+account)
+	if err != nil {
+		lines, err = queryRaw(ctx, config, "SHOW CREATE USER "+account)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no CREATE USER statement for %s", account)
+	}
+	return strings.Replace(lines[0], "CREATE USER ", "CREATE USER IF NOT EXISTS ", 1), nil
+}
+
+// grantsEntry builds grants.sql, which recreates every account except the
+// server's internal mysql.* ones, together with its privileges.
+func (r *run) grantsEntry(ctx context.Context) (archiveEntry, error) {
+	users, err := queryMySQL(ctx, r.cfg, "SELECT user, host FROM mysql.user WHERE user NOT LIKE 'mysql.%' ORDER BY user, host")
+	if err != nil {
+		return archiveEntry{}, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var sql strings.Builder
+	for _, user := range users {
+		account := quoteString(user[0]) + "@" + quoteString(user[1])
+		create, err := showCreateUser(ctx, r.cfg, account)
+		if err != nil {
+			return archiveEntry{}, fmt.Errorf("failed to dump user %s: %w", account, err)
+		}
+		grants, err := queryRaw(ctx, r.cfg, "SHOW GRANTS FOR "+account)
+		if err != nil {
+			return archiveEntry{}, fmt.Errorf("failed to dump grants of %s: %w", account, err)
+		}
+		fmt.Fprintf(&sql, "-- %s\n%s;\n", account, create)
+		for _, grant := range grants {
+			sql.WriteString(grant + ";\n")
+		}
+	}
+	sql.WriteString("FLUSH PRIVILEGES;\n")
+	return archiveEntry{name: grantsName, data: []byte(sql.String())}, nil
+}
@@ -0,0 +1,121 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// archiveInMemory builds the archive of entries in memory when
+// InMemoryArchiveMaxMB is set and the dumps going into it are no bigger
+// than that. It reports false when the archive has to be written to
+// archivePath instead.
+func (r *run) archiveInMemory(archiveCfg Config, entries []archiveEntry, archivePath string) ([]byte, bool, error) {
+	if r.cfg.InMemoryArchiveMaxMB <= 0 || entriesSize(entries) > int64(r.cfg.InMemoryArchiveMaxMB)<<20 {
+		return nil, false, nil
+	}
+	r.logger.Printf("creating archive in memory -> %s", filepath.Base(archivePath))
+	var buf bytes.Buffer
+	err := writeArchive(archiveCfg, entries, &buf)
+	if err != nil {
+		return nil, true, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// openArchive opens archivePath, or data when the archive was built in
+// memory.
+func openArchive(archivePath string, data []byte) (io.ReadCloser, error) {
+	if data != nil {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return os.Open(archivePath)
+}
+
+// dumpsInMemory reports whether dumps are kept in memory for
+// archiveInMemory, which needs InMemoryArchiveMaxMB and nothing that reads
+// the dump file while or after it is written.
+func (r *run) dumpsInMemory() bool {
+	return r.cfg.InMemoryArchiveMaxMB > 0 && !r.cfg.VerifyRestore && r.cfg.Progress == nil && r.cfg.CheckpointIntervalSeconds <= 0
+}
+
+// uploadFromMemory uploads data to every destination as name.
+func uploadFromMemory(ctx context.Context, config Config, dests []Destination, name string, data []byte) ([]UploadResult, error) {
+	results, err := forEachDestination(ctx, config, dests, name, func(ctx context.Context, dest Destination) (string, error) {
+		switch dest.Type {
+		case DestinationSSH:
+			return streamToSSH(ctx, config, dest, name, bytes.NewReader(data))
+		case DestinationCommand:
+			return streamToCommand(ctx, config, dest, name, bytes.NewReader(data))
+		}
+		return storToFTP(ctx, config, dest, name, data)
+	})
+	for i := range results {
+		results[i].Size = int64(len(data))
+	}
+	return results, err
+}
+
+// storToFTP uploads data to dest as name, like uploadToFTP does with a
+// file.
+func storToFTP(ctx context.Context, config Config, dest Destination, name string, data []byte) (string, error) {
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		return "", err
+	}
+	name, skip, err := remoteName(config, conn, dest.Directory, name, int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	if skip {
+		return path.Join(dest.Directory, name), nil
+	}
+	remotePath, err := storSized(config, conn, dest.Directory, name, int64(len(data)), func() (io.Reader, error) {
+		return bytes.NewReader(data), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if config.VerifyRemoteHash {
+		conn.Quit()
+		err = verifyRemoteHash(ctx, config, dest, remotePath, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		})
+		if err != nil {
+			return remotePath, err
+		}
+	}
+	if config.RemoteFileMode != "" {
+		conn.Quit()
+		chmodRemote(ctx, config, dest, []string{remotePath})
+	}
+	return remotePath, nil
+}
+
+func (c Config) validateInMemoryArchive() error {
+	switch {
+	case c.InMemoryArchiveMaxMB < 0:
+		return fmt.Errorf("in_memory_archive_max_mb must not be negative")
+	case c.InMemoryArchiveMaxMB == 0:
+		return nil
+	case !c.DeleteLocalAfterUpload:
+		return fmt.Errorf("in_memory_archive_max_mb needs delete_local_after_upload, small archives are never written locally")
+	case c.rawDumps() || c.StreamUploads || c.ChunkStore != "" || c.Spool:
+		return fmt.Errorf("in_memory_archive_max_mb needs tar archives uploaded by the run")
+	case c.Checksum || c.SigningKeyPath != "" || len(c.AdditionalBackupDirs) > 0:
+		return fmt.Errorf("checksum, signing_key_path and additional_backup_dirs write files next to the archive and can't be used with in_memory_archive_max_mb")
+	case c.AllOrNothing || c.EncryptOnUploadOnly:
+		return fmt.Errorf("all_or_nothing and encrypt_on_upload_only need the archive file and can't be used with in_memory_archive_max_mb")
+	}
+	return nil
+}
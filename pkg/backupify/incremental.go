@@ -0,0 +1,206 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// incrementalPrefix is the directory in the archive that holds the dumps of
+// IncrementalColumns tables, as incremental/<database>/<table>.sql.
+const incrementalPrefix = "incremental/"
+
+// tablesOf returns the tables of db among the "<database>.<table>" keys of
+// m, sorted.
+func tablesOf(m map[string]string, db string) []string {
+	var tables []string
+	for key := range m {
+		if table, ok := strings.CutPrefix(key, db+"."); ok {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// incrementalCursor returns the condition that selects the rows of
+// db.table changed since cursor, and the cursor to record for this run:
+// the newest value of the column. TIMESTAMP columns are compared as Unix
+// times, so the session time zone of mysqldump doesn't matter.
+func incrementalCursor(ctx context.Context, config Config, db, table, column, cursor string) (string, string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT data_type FROM information_schema.columns WHERE table_schema = "+quoteString(db)+" AND table_name = "+quoteString(table)+" AND column_name = "+quoteString(column))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up %s.%s.%s: %w", db, table, column, err)
+	}
+	if len(rows) == 0 {
+		return "", "", fmt.Errorf("incremental_columns: %s.%s has no column %s", db, table, column)
+	}
+	timestamp := strings.EqualFold(rows[0][0], "timestamp")
+
+	newest := "MAX(" + quoteIdentifier(column) + ")"
+	if timestamp {
+		newest = "UNIX_TIMESTAMP(" + newest + ")"
+	}
+	rows, err = queryMySQL(ctx, config, "SELECT "+newest+" FROM "+quoteIdentifier(db)+"."+quoteIdentifier(table))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to query newest %s of %s.%s: %w", column, db, table, err)
+	}
+	next := cursor
+	if len(rows) > 0 && rows[0][0] != "NULL" {
+		next = rows[0][0]
+	}
+	if cursor == "" {
+		return "", next, nil
+	}
+	if timestamp {
+		return quoteIdentifier(column) + " >= FROM_UNIXTIME(" + cursor + ")", next, nil
+	}
+	return quoteIdentifier(column) + " >= " + quoteString(cursor), next, nil
+}
+
+// incrementalPosition is where the incremental dumps of a table are: the
+// cursor of the next dump and how many dumps since the last full one.
+type incrementalPosition struct {
+	Cursor string
+	Deltas int
+}
+
+// dumpIncremental dumps the IncrementalColumns tables of db on their own.
+// A table dumped before only gets its definition, as CREATE TABLE IF NOT
+// EXISTS, and the rows whose column is at least the newest value seen then,
+// as REPLACE statements; the first run, and every IncrementalFullEvery-th
+// one after it, dumps the whole table. The new positions are recorded once
+// the database has been shipped.
+func (r *run) dumpIncremental(ctx context.Context, db string, tables []string) ([]archiveEntry, error) {
+	cfg := r.cfg
+	positions := map[string]incrementalPosition{}
+	var entries []archiveEntry
+	for _, table := range tables {
+		key := db + "." + table
+		position := r.state.incrementalPosition(key)
+		if cfg.IncrementalFullEvery > 0 && position.Deltas+1 >= cfg.IncrementalFullEvery {
+			position = incrementalPosition{}
+		}
+		where, next, err := incrementalCursor(ctx, cfg, db, table, cfg.IncrementalColumns[key], position.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		file := filepath.Join(cfg.BackupDirectory, db+"."+table+".incremental.sql")
+		if where == "" {
+			r.logger.Printf("creating full backup of incremental table %s -> %s", key, file)
+			err = backupDatabase(ctx, cfg, db, file, db, table)
+			position.Deltas = 0
+		} else {
+			r.logger.Printf("creating incremental backup of %s -> %s", key, file)
+			err = dumpIncrementalDelta(ctx, cfg, db, table, where, file)
+			position.Deltas++
+		}
+		if err != nil {
+			return nil, fmt.Errorf("incremental dump of %s: %w", key, err)
+		}
+		position.Cursor = next
+		positions[key] = position
+		entries = append(entries, archiveEntry{path: file, name: r.entryName(db, incrementalPrefix+db+"/"+table+".sql")})
+	}
+	r.mu.Lock()
+	r.pendingCursors[db] = positions
+	r.mu.Unlock()
+	return entries, nil
+}
+
+// dumpIncrementalDelta writes the definition of db.table, which loads
+// without touching an existing table, followed by the rows matching where
+// as REPLACE statements into file. An archive with only deltas of the
+// table still restores it, with the rows it has.
+func dumpIncrementalDelta(ctx context.Context, config Config, db, table, where, file string) error {
+	err := backupDatabase(ctx, config, db, file, "--no-data", "--skip-add-drop-table", "--skip-triggers", db, table)
+	if err != nil {
+		return err
+	}
+	schema, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read table definition: %w", err)
+	}
+	schema = createTableIfNotExists(schema)
+	err = os.WriteFile(file, schema, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write table definition: %w", err)
+	}
+
+	rows := file + ".rows"
+	defer os.Remove(rows)
+	err = backupDatabase(ctx, config, db, rows, "--no-create-info", "--replace", "--where="+where, db, table)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open database copy file: %w", err)
+	}
+	defer out.Close()
+	err = appendFile(out, rows)
+	if err != nil {
+		return fmt.Errorf("failed to append incremental rows: %w", err)
+	}
+	return out.Close()
+}
+
+// createTableIfNotExists turns the CREATE TABLE statements of a mysqldump
+// schema into CREATE TABLE IF NOT EXISTS.
+func createTableIfNotExists(schema []byte) []byte {
+	return createTablePattern.ReplaceAll(schema, []byte("${1}CREATE TABLE IF NOT EXISTS "))
+}
+
+var createTablePattern = regexp.MustCompile(`(?m)^(\s*)CREATE TABLE (?:IF NOT EXISTS )?`)
+
+// incrementalDatabase returns the database of an incremental/<database>/
+// <table>.sql archive entry.
+func incrementalDatabase(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, incrementalPrefix)
+	if !ok || !strings.HasSuffix(rest, ".sql") {
+		return "", false
+	}
+	db, _, ok := strings.Cut(rest, "/")
+	return db, ok
+}
+
+func (c Config) validateIncrementalColumns() error {
+	if len(c.IncrementalColumns) == 0 {
+		return nil
+	}
+	switch {
+	case c.rawDumps() || c.StreamUploads || c.ChunkStore != "":
+		return fmt.Errorf("incremental_columns needs a tar archive")
+	case c.TabExport || c.dumpTool() != DumpToolMysqldump && c.dumpTool() != DumpToolMariadbDump:
+		return fmt.Errorf("incremental_columns needs dump_tool mysqldump or mariadb-dump without tab_export")
+	case c.ConsistentSnapshot:
+		return fmt.Errorf("incremental_columns can't be used with consistent_snapshot, the tables are dumped on their own")
+	case c.IncrementalFullEvery < 0:
+		return fmt.Errorf("incremental_full_every must not be negative")
+	case c.RemoteKeepLast > 0 && c.IncrementalFullEvery == 0:
+		return fmt.Errorf("incremental_columns with remote_keep_last needs incremental_full_every, or retention deletes the only full dump of the tables")
+	case c.RemoteKeepLast > 0 && c.RemoteKeepLast < c.IncrementalFullEvery:
+		return fmt.Errorf("remote_keep_last must be at least incremental_full_every, or retention deletes the full dump the later ones build on")
+	}
+	for key, column := range c.IncrementalColumns {
+		db, table, ok := strings.Cut(key, ".")
+		if !ok || db == "" || table == "" || column == "" {
+			return fmt.Errorf("incremental_columns: %q must map <database>.<table> to a column", key)
+		}
+		for anonymized := range c.Anonymize {
+			if strings.HasPrefix(anonymized, key+".") {
+				return fmt.Errorf("incremental_columns: %s has anonymize rules, which can't find the columns in its row-only dumps", key)
+			}
+		}
+		for _, grouped := range c.groupedTables(db) {
+			if grouped == table {
+				return fmt.Errorf("incremental_columns: %s is in a table group", key)
+			}
+		}
+	}
+	return nil
+}
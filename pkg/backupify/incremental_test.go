@@ -0,0 +1,148 @@
+package backupify
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncrementalCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataType string
+		newest   string
+		cursor   string
+		where    string
+		next     string
+		err      string
+	}{
+		{name: "first run", dataType: "int", newest: "42", where: "", next: "42"},
+		{name: "integer column", dataType: "bigint", newest: "42", cursor: "17", where: "`id` >= '17'", next: "42"},
+		{name: "timestamp column", dataType: "TIMESTAMP", newest: "1704164645", cursor: "1704000000", where: "`id` >= FROM_UNIXTIME(1704000000)", next: "1704164645"},
+		{name: "datetime column", dataType: "datetime", newest: "2024-01-02 03:04:05", cursor: "2024-01-01 00:00:00", where: "`id` >= '2024-01-01 00:00:00'", next: "2024-01-02 03:04:05"},
+		{name: "quoted cursor", dataType: "varchar", newest: "b", cursor: `it's\`, where: "`id` >= 'it\\'s\\\\'", next: "b"},
+		{name: "empty table keeps the cursor", dataType: "int", newest: "NULL", cursor: "17", where: "`id` >= '17'", next: "17"},
+		{name: "empty table on the first run", dataType: "int", newest: "NULL", where: "", next: ""},
+		{name: "missing column", dataType: "", newest: "42", err: "shop.orders has no column id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := map[string]string{"MAX(": tt.newest + "\n"}
+			if tt.dataType != "" {
+				replies["information_schema"] = tt.dataType + "\n"
+			}
+			fakeMySQL(t, replies)
+			where, next, err := incrementalCursor(context.Background(), Config{}, "shop", "orders", "id", tt.cursor)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("incrementalCursor() = %q, %q, %v, want an error containing %q", where, next, err, tt.err)
+				}
+				return
+			}
+			if err != nil || where != tt.where || next != tt.next {
+				t.Fatalf("incrementalCursor() = %q, %q, %v, want %q, %q", where, next, err, tt.where, tt.next)
+			}
+		})
+	}
+}
+
+func TestTablesOf(t *testing.T) {
+	columns := map[string]string{
+		"shop.orders":   "updated_at",
+		"shop.audit":    "id",
+		"shopping.cart": "id",
+		"crm.contacts":  "modified",
+	}
+	tests := []struct {
+		db   string
+		want []string
+	}{
+		{"shop", []string{"audit", "orders"}},
+		{"crm", []string{"contacts"}},
+		{"blog", nil},
+	}
+	for _, tt := range tests {
+		if got := tablesOf(columns, tt.db); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tablesOf(%q) = %v, want %v", tt.db, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTableIfNotExists(t *testing.T) {
+	tests := []struct {
+		name, schema, want string
+	}{
+		{
+			name:   "plain",
+			schema: "DROP TABLE IF EXISTS `a`;\nCREATE TABLE `a` (\n  `id` int\n);\n",
+			want:   "DROP TABLE IF EXISTS `a`;\nCREATE TABLE IF NOT EXISTS `a` (\n  `id` int\n);\n",
+		},
+		{
+			name:   "already if not exists",
+			schema: "CREATE TABLE IF NOT EXISTS `a` (`id` int);\n",
+			want:   "CREATE TABLE IF NOT EXISTS `a` (`id` int);\n",
+		},
+		{
+			name:   "indented",
+			schema: "/*!40101 SET x */;\n  CREATE TABLE `a` (`id` int);\n",
+			want:   "/*!40101 SET x */;\n  CREATE TABLE IF NOT EXISTS `a` (`id` int);\n",
+		},
+		{
+			name:   "not at the start of a line",
+			schema: "INSERT INTO `a` VALUES ('CREATE TABLE `b`');\n",
+			want:   "INSERT INTO `a` VALUES ('CREATE TABLE `b`');\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(createTableIfNotExists([]byte(tt.schema))); got != tt.want {
+				t.Errorf("createTableIfNotExists() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncrementalDatabase(t *testing.T) {
+	tests := []struct {
+		name string
+		db   string
+		ok   bool
+	}{
+		{"incremental/shop/orders.sql", "shop", true},
+		{"incremental/shop/orders.sql.gz", "", false},
+		{"incremental/orders.sql", "", false},
+		{"shop.sql", "", false},
+	}
+	for _, tt := range tests {
+		db, ok := incrementalDatabase(tt.name)
+		if ok != tt.ok || ok && db != tt.db {
+			t.Errorf("incrementalDatabase(%q) = %q, %v, want %q, %v", tt.name, db, ok, tt.db, tt.ok)
+		}
+	}
+}
+
+func TestValidateIncrementalColumns(t *testing.T) {
+	columns := map[string]string{"shop.orders": "updated_at"}
+	tests := []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"valid", Config{IncrementalColumns: columns}, true},
+		{"no column", Config{IncrementalColumns: map[string]string{"shop.orders": ""}}, false},
+		{"no table", Config{IncrementalColumns: map[string]string{"shop": "updated_at"}}, false},
+		{"table group", Config{IncrementalColumns: columns, TableGroups: map[string]map[string][]string{"shop": {"big": {"orders"}}}}, false},
+		{"anonymized table", Config{IncrementalColumns: columns, Anonymize: map[string]string{"shop.orders.email": AnonymizeEmail}}, false},
+		{"anonymized other table", Config{IncrementalColumns: columns, Anonymize: map[string]string{"shop.orders_archive.email": AnonymizeEmail}}, true},
+		{"consistent snapshot", Config{IncrementalColumns: columns, ConsistentSnapshot: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateIncrementalColumns()
+			if (err == nil) != tt.ok {
+				t.Errorf("validateIncrementalColumns() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
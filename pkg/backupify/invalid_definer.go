@@ -0,0 +1,97 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// invalidDefinerErrors are stderr fragments of dumps that failed on a view
+// whose DEFINER no longer exists: error 1449, or 1356 when the view can't be
+// read with its definer's rights.
+var invalidDefinerErrors = []string{
+	"specified as a definer",
+	"(1449)",
+	"(1356)",
+}
+
+// invalidDefinerStatement finds the view in the statement mysqldump reports
+// as failed, e.g. "Couldn't execute 'SHOW FIELDS FROM `v_orders`'".
+var invalidDefinerStatement = regexp.MustCompile("Couldn't execute '[^`']*`((?:[^`]|``)+)`")
+
+// invalidDefinerView reports whether err is a dump that failed on a view
+// with an invalid definer, and returns the view when the error names it.
+func invalidDefinerView(err error) (string, bool) {
+	var dumpErr *dumpError
+	if !errors.As(err, &dumpErr) {
+		return "", false
+	}
+	matched := false
+	for _, fragment := range invalidDefinerErrors {
+		if strings.Contains(dumpErr.stderr, fragment) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return "", false
+	}
+	m := invalidDefinerStatement.FindStringSubmatch(dumpErr.stderr)
+	if m == nil {
+		return "", true
+	}
+	return strings.ReplaceAll(m[1], "``", "`"), true
+}
+
+// dumpSkippingInvalidViews runs backupDatabaseTo with args(nil) and, with
+// SkipInvalidDefinerViews, dumps again without each view it fails on
+// because of an invalid definer. When the error doesn't name the view, as
+// for a failed LOCK TABLES, every view of db is left out. It returns the
+// views left out; args returning nil means nothing is left to dump.
+func dumpSkippingInvalidViews(ctx context.Context, config Config, db string, output *dumpOutput, args func(skipped []string) []string) ([]string, error) {
+	var skipped []string
+	for {
+		dumpArgs := args(skipped)
+		if dumpArgs == nil {
+			return skipped, nil
+		}
+		err := backupDatabaseTo(ctx, config, db, output, dumpArgs...)
+		if err == nil || !config.SkipInvalidDefinerViews {
+			return skipped, err
+		}
+		view, ok := invalidDefinerView(err)
+		if !ok {
+			return skipped, err
+		}
+		if view == "" {
+			views, listErr := listViews(ctx, config, db)
+			if listErr != nil || len(views) == 0 || len(skipped) == len(views) {
+				return skipped, err
+			}
+			config.logger().Printf("dump of %s failed on a view with an invalid definer, dumping it without its views: %v", db, err)
+			skipped = views
+			continue
+		}
+		if slices.Contains(skipped, view) {
+			return skipped, err
+		}
+		config.logger().Printf("view %s.%s has an invalid definer, dumping %s without it", db, view, db)
+		skipped = append(skipped, view)
+	}
+}
+
+func (c Config) validateSkipInvalidDefinerViews() error {
+	if !c.SkipInvalidDefinerViews {
+		return nil
+	}
+	if tool := c.dumpTool(); tool != DumpToolMysqldump && tool != DumpToolMariadbDump {
+		return fmt.Errorf("skip_invalid_definer_views needs dump_tool mysqldump or mariadb-dump")
+	}
+	if c.TabExport || c.StreamUploads || c.ConsistentSnapshot {
+		return fmt.Errorf("skip_invalid_definer_views can't be used with tab_export, stream_uploads or consistent_snapshot, which can't dump a database again")
+	}
+	return nil
+}
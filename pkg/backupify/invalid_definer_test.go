@@ -0,0 +1,64 @@
+package backupify
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestInvalidDefinerView(t *testing.T) {
+	exit := errors.New("exit status 2")
+	tests := []struct {
+		name string
+		err  error
+		view string
+		ok   bool
+	}{
+		{
+			name: "show fields",
+			err:  &dumpError{err: exit, stderr: "mysqldump: Couldn't execute 'SHOW FIELDS FROM `v_orders`': The user specified as a definer ('old'@'%') does not exist (1449)"},
+			view: "v_orders",
+			ok:   true,
+		},
+		{
+			name: "show create table",
+			err:  &dumpError{err: exit, stderr: "mysqldump: Couldn't execute 'show create table `v_sales`': View 'shop.v_sales' references invalid table(s) or column(s) or function(s) or definer/invoker of view lack rights to use them (1356)"},
+			view: "v_sales",
+			ok:   true,
+		},
+		{
+			name: "backticks in the name",
+			err:  &dumpError{err: exit, stderr: "mysqldump: Couldn't execute 'SHOW FIELDS FROM `we``ird`': (1449)"},
+			view: "we`ird",
+			ok:   true,
+		},
+		{
+			name: "view not named",
+			err:  &dumpError{err: exit, stderr: "mysqldump: Got error: 1449: The user specified as a definer ('old'@'%') does not exist when using LOCK TABLES"},
+			view: "",
+			ok:   true,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("database shop: %w", &dumpError{err: exit, stderr: "Couldn't execute 'SHOW FIELDS FROM `v`': (1449)"}),
+			view: "v",
+			ok:   true,
+		},
+		{
+			name: "other dump error",
+			err:  &dumpError{err: exit, stderr: "mysqldump: Got error: 1045: Access denied for user 'backup'@'localhost' (using password: YES)"},
+		},
+		{
+			name: "not a dump error",
+			err:  errors.New("The user specified as a definer ('old'@'%') does not exist (1449)"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view, ok := invalidDefinerView(tt.err)
+			if view != tt.view || ok != tt.ok {
+				t.Errorf("invalidDefinerView() = %q, %v, want %q, %v", view, ok, tt.view, tt.ok)
+			}
+		})
+	}
+}
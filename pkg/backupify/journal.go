@@ -0,0 +1,225 @@
+package backupify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// journalKey is the StateStore key of the run journal.
+const journalKey = "journal"
+
+// journaledFile is a dump file recorded in the run journal.
+type journaledFile struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type journalData struct {
+	// RunID is the timestamp of the run, which names its files.
+	RunID     string                     `json:"run_id"`
+	Started   time.Time                  `json:"started"`
+	Databases map[string][]journaledFile `json:"databases"`
+	// InProgress are the dumps that were still running at the last
+	// checkpoint, which a resumed run dumps again.
+	InProgress map[string]journalCheckpoint `json:"in_progress,omitempty"`
+}
+
+// journalCheckpoint is how far a dump had got when it was last flushed.
+type journalCheckpoint struct {
+	File string    `json:"file"`
+	Size int64     `json:"size"`
+	At   time.Time `json:"at"`
+}
+
+// journal records the dumps a run has finished in the StateStore, so that a
+// run that was interrupted can be resumed without dumping them again. It is
+// cleared once the run succeeds. It is safe for concurrent use.
+type journal struct {
+	mu    sync.Mutex
+	store StateStore
+	data  journalData
+}
+
+// openJournal starts the journal of a run started at started. With resume
+// set, the journal of an interrupted run is picked up instead if there is
+// one, and the returned time is when that run started.
+func openJournal(cfg Config, started time.Time, resume bool) (*journal, time.Time, error) {
+	j := &journal{
+		store: cfg.stateStore(),
+		data: journalData{
+			RunID:     started.Format("20060102_150405"),
+			Started:   started,
+			Databases: map[string][]journaledFile{},
+		},
+	}
+	if !resume {
+		return j, started, nil
+	}
+
+	data, err := j.store.Get(journalKey)
+	if err != nil {
+		return nil, started, fmt.Errorf("failed to read run journal: %w", err)
+	}
+	if len(data) == 0 {
+		cfg.logger().Printf("no interrupted run to resume, starting a new one")
+		return j, started, nil
+	}
+	var previous journalData
+	err = json.Unmarshal(data, &previous)
+	if err != nil {
+		return nil, started, fmt.Errorf("failed to parse run journal: %w", err)
+	}
+	if previous.Databases == nil {
+		previous.Databases = map[string][]journaledFile{}
+	}
+	for db, checkpoint := range previous.InProgress {
+		cfg.logger().Printf("dump of %s was interrupted after %d MB at %s, dumping it again", db, checkpoint.Size>>20, checkpoint.At.Format(time.RFC3339))
+		os.Remove(checkpoint.File)
+	}
+	previous.InProgress = nil
+	j.data = previous
+	cfg.logger().Printf("resuming run %s with %d databases already dumped", previous.RunID, len(previous.Databases))
+	return j, previous.Started, nil
+}
+
+// completed returns the archive entries of db when the journal has its
+// dump and every file is still there with the recorded size.
+func (j *journal) completed(db string) ([]archiveEntry, bool) {
+	j.mu.Lock()
+	files, ok := j.data.Databases[db]
+	j.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]archiveEntry, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil || info.Size() != file.Size {
+			return nil, false
+		}
+		entries[i] = archiveEntry{path: file.Path, name: file.Name}
+	}
+	return entries, true
+}
+
+// record adds the finished dump of db and saves the journal. The files are
+// flushed to disk first, so a crash can't leave the journal pointing at
+// dumps that were never written. Dumps kept in memory are not recorded, a
+// resumed run dumps them again.
+func (j *journal) record(db string, entries []archiveEntry) error {
+	var files []journaledFile
+	for _, entry := range entries {
+		if entry.path == "" {
+			return nil
+		}
+		size, err := syncFile(entry.path)
+		if err != nil {
+			return err
+		}
+		files = append(files, journaledFile{Path: entry.path, Name: entry.name, Size: size})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.data.Databases[db] = files
+	delete(j.data.InProgress, db)
+	return j.save()
+}
+
+// checkpoint records that the dump of db into file has reached size.
+func (j *journal) checkpoint(db, file string, size int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, done := j.data.Databases[db]; done {
+		return nil
+	}
+	if j.data.InProgress == nil {
+		j.data.InProgress = map[string]journalCheckpoint{}
+	}
+	j.data.InProgress[db] = journalCheckpoint{File: file, Size: size, At: time.Now()}
+	return j.save()
+}
+
+// save writes the journal to the store. j.mu must be held.
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = j.store.Set(journalKey, data)
+	if err != nil {
+		return fmt.Errorf("failed to write run journal: %w", err)
+	}
+	return nil
+}
+
+// remove clears the journal of a finished run.
+func (j *journal) remove() error {
+	if store, ok := j.store.(fileStateStore); ok {
+		err := os.Remove(store.path(journalKey))
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return j.store.Set(journalKey, nil)
+}
+
+// syncFile flushes path to disk and returns its size.
+func syncFile(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to flush %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// watchCheckpoints flushes the dump of db into file every
+// CheckpointIntervalSeconds and records how far it has got in the journal,
+// until the returned function is called.
+func (r *run) watchCheckpoints(ctx context.Context, db, file string) func() {
+	if r.cfg.CheckpointIntervalSeconds <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Duration(r.cfg.CheckpointIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				size, err := syncFile(file)
+				if err != nil {
+					continue
+				}
+				if err := r.journal.checkpoint(db, file, size); err != nil {
+					r.logger.Printf("failed to record checkpoint of %s: %v", db, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
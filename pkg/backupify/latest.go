@@ -0,0 +1,60 @@
+package backupify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// updateLatest points BackupDirectory/latest.tar.gz (or the suffix of the
+// archive format in use) at archivePath. The link
+// is created under a temporary name and renamed over the old one so readers
+// never observe a missing or half-written file. A copy is made when the
+// filesystem does not support symlinks.
+func updateLatest(config Config, archivePath string) error {
+	base := filepath.Base(archivePath)
+	latestArchiveName := "latest" + config.archiveSuffix()
+	if i := strings.Index(base, ".tar"); i >= 0 {
+		latestArchiveName = "latest" + base[i:]
+	}
+	latestPath := filepath.Join(config.BackupDirectory, latestArchiveName)
+	tmpPath := latestPath + ".tmp"
+	os.Remove(tmpPath)
+
+	err := os.Symlink(base, tmpPath)
+	if err != nil {
+		err = copyFile(archivePath, tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", latestArchiveName, err)
+		}
+	}
+
+	err = os.Rename(tmpPath, latestPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to update %s: %w", latestArchiveName, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
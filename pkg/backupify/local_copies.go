@@ -0,0 +1,43 @@
+package backupify
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// LocalCopy is the outcome of copying an archive to one of the
+// AdditionalBackupDirs.
+type LocalCopy struct {
+	Directory string `json:"directory"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// copyToLocalDirs copies archivePath, and its .sha256 and .sig files if
+// there are any, into every AdditionalBackupDirs entry. A failing
+// directory is logged and recorded in summary without affecting the
+// others or the run.
+func (r *run) copyToLocalDirs(summary *Summary, archivePath string) {
+	files := append([]string{archivePath}, existingSidecars(archivePath)...)
+
+	for _, dir := range r.cfg.AdditionalBackupDirs {
+		result := LocalCopy{Directory: dir}
+		err := os.MkdirAll(dir, os.ModePerm)
+		for _, file := range files {
+			if err != nil {
+				break
+			}
+			err = copyFile(file, filepath.Join(dir, filepath.Base(file)))
+		}
+		if err != nil {
+			r.logger.Printf("failed to copy %s to %s: %v", archivePath, dir, err)
+			result.Error = err.Error()
+		} else {
+			result.Path = filepath.Join(dir, filepath.Base(archivePath))
+		}
+
+		r.mu.Lock()
+		summary.LocalCopies = append(summary.LocalCopies, result)
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,64 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Supported values of Config.LockTables.
+const (
+	LockTablesAuto = "auto"
+	LockTablesOn   = "true"
+	LockTablesOff  = "false"
+)
+
+// lockTablesFlags are the mysqldump flags of LockTables once "auto" has
+// been resolved for a database.
+func (c Config) lockTablesFlags() []string {
+	switch c.LockTables {
+	case LockTablesOn:
+		return []string{"--lock-tables"}
+	case LockTablesOff:
+		return []string{"--single-transaction", "--skip-lock-tables"}
+	}
+	return nil
+}
+
+// dumpLockTables resolves LockTablesAuto for database: a transaction when
+// all of its tables are InnoDB, table locks otherwise. When the engines
+// can't be queried mysqldump's own default is used.
+func dumpLockTables(ctx context.Context, config Config, database string) Config {
+	if config.LockTables != LockTablesAuto {
+		return config
+	}
+	rows, err := queryMySQL(ctx, config, "SELECT COUNT(*) FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND engine <> 'InnoDB' AND table_schema = "+quoteString(database))
+	config.LockTables = ""
+	if err != nil {
+		config.logger().Printf("failed to look up storage engines of %s, using the default locking: %v", database, err)
+		return config
+	}
+	if len(rows) > 0 && rows[0][0] != "0" {
+		config.logger().Printf("%s has %s non-InnoDB tables, dumping it with --lock-tables", database, rows[0][0])
+		config.LockTables = LockTablesOn
+	} else {
+		config.LockTables = LockTablesOff
+	}
+	return config
+}
+
+func (c Config) validateLockTables() error {
+	switch c.LockTables {
+	case "":
+		return nil
+	case LockTablesAuto, LockTablesOn, LockTablesOff:
+	default:
+		return fmt.Errorf("lock_tables must be auto, true or false, got %q", c.LockTables)
+	}
+	if tool := c.dumpTool(); tool != DumpToolMysqldump && tool != DumpToolMariadbDump {
+		return fmt.Errorf("lock_tables needs dump_tool mysqldump or mariadb-dump")
+	}
+	if c.ConsistentSnapshot || c.ParallelTables > 1 {
+		return fmt.Errorf("lock_tables can't be used with consistent_snapshot or parallel_tables, which use a transaction of their own")
+	}
+	return nil
+}
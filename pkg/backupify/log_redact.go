@@ -0,0 +1,96 @@
+package backupify
+
+import (
+	"io"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// minRedactLength is the length below which secrets are left in log
+// messages, as redacting them would mangle ordinary words.
+const minRedactLength = 4
+
+// redactingLoggers caches the loggers logger returns for a logger and its
+// secrets, so each message doesn't build a new one.
+var redactingLoggers sync.Map
+
+type redactingKey struct {
+	logger  *log.Logger
+	secrets string
+}
+
+// logSecrets returns the passwords and tokens of the config and
+// RedactLogValues, longest first so that a secret containing another one is
+// redacted whole.
+func (c Config) logSecrets() []string {
+	secrets := slices.Clone(c.RedactLogValues)
+	secrets = append(secrets, c.MySQLPassword, c.FTPPassword, c.ServeToken, c.AnonymizeSalt)
+	for _, dest := range slices.Concat(c.Destinations, c.FailoverDestinations) {
+		secrets = append(secrets, dest.Password)
+	}
+	if c.DumpSSH != nil {
+		secrets = append(secrets, c.DumpSSH.Password)
+	}
+	if u, err := url.Parse(c.ProxyURL); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			secrets = append(secrets, password, url.QueryEscape(password))
+		}
+	}
+	secrets = slices.DeleteFunc(secrets, func(secret string) bool {
+		return len(secret) < minRedactLength
+	})
+	slices.SortFunc(secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	return slices.Compact(secrets)
+}
+
+// RedactingWriter returns a writer that replaces the secrets of config with
+// "***" in what is written to w. Each Write is redacted on its own, as a
+// log.Logger writes every message with a single call.
+func RedactingWriter(config Config, w io.Writer) io.Writer {
+	secrets := config.logSecrets()
+	if len(secrets) == 0 {
+		return w
+	}
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, redacted)
+	}
+	return &redactingWriter{w: w, replacer: strings.NewReplacer(pairs...)}
+}
+
+type redactingWriter struct {
+	w        io.Writer
+	replacer *strings.Replacer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	_, err := w.replacer.WriteString(w.w, string(p))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redactingLogger returns base writing through RedactingWriter, or base
+// itself when it already does, like the logger withRunID derives.
+func (c Config) redactingLogger(base *log.Logger) *log.Logger {
+	if _, ok := base.Writer().(*redactingWriter); ok {
+		return base
+	}
+	secrets := c.logSecrets()
+	if len(secrets) == 0 {
+		return base
+	}
+	key := redactingKey{logger: base, secrets: strings.Join(secrets, "\x00")}
+	if logger, ok := redactingLoggers.Load(key); ok {
+		return logger.(*log.Logger)
+	}
+	logger := log.New(RedactingWriter(c, base.Writer()), base.Prefix(), base.Flags())
+	actual, _ := redactingLoggers.LoadOrStore(key, logger)
+	return actual.(*log.Logger)
+}
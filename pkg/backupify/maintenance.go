@@ -0,0 +1,52 @@
+package backupify
+
+import (
+	"context"
+	"strings"
+)
+
+// listBaseTables returns the tables of database, leaving out views.
+func listBaseTables(ctx context.Context, config Config, database string) ([]string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema = "+quoteString(database))
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, len(rows))
+	for i, row := range rows {
+		tables[i] = quoteIdentifier(database) + "." + quoteIdentifier(row[0])
+	}
+	return tables, nil
+}
+
+// maintainDatabase runs OPTIMIZE TABLE and then ANALYZE TABLE on every table
+// of database, as enabled by PreBackupOptimize and PreBackupAnalyze. Both
+// can take a long time and lock tables on some engines. Failures are logged
+// and the dump goes ahead regardless.
+func (r *run) maintainDatabase(ctx context.Context, db string) {
+	var statements []string
+	if r.cfg.PreBackupOptimize {
+		statements = append(statements, "OPTIMIZE")
+	}
+	if r.cfg.PreBackupAnalyze {
+		statements = append(statements, "ANALYZE")
+	}
+	if len(statements) == 0 {
+		return
+	}
+
+	tables, err := listBaseTables(ctx, r.cfg, db)
+	if err != nil {
+		r.logger.Printf("failed to list tables of %s: %v", db, err)
+		return
+	}
+	if len(tables) == 0 {
+		return
+	}
+	for _, statement := range statements {
+		r.logger.Printf("running %s TABLE on %s", statement, db)
+		_, err := queryMySQL(ctx, r.cfg, statement+" NO_WRITE_TO_BINLOG TABLE "+strings.Join(tables, ", "))
+		if err != nil {
+			r.logger.Printf("%s TABLE on %s failed: %v", statement, db, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package backupify
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+const metadataName = "metadata.json"
+
+// Version is the version of the tool recorded in archive metadata. It is set
+// at build time with -ldflags "-X backupify-mysql/pkg/backupify.Version=...".
+var Version = "dev"
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// archiveStamp is the part of archive names after the database: the run's
+// timestamp, followed by -<AppVersion> and +<Environment> when set. The
+// different separator tells the environment apart from a version.
+func (r *run) archiveStamp() string {
+	stamp := r.timestamp
+	if r.cfg.AppVersion != "" {
+		stamp += "-" + unsafeNameChars.ReplaceAllString(r.cfg.AppVersion, "_")
+	}
+	if r.cfg.Environment != "" {
+		stamp += "+" + unsafeNameChars.ReplaceAllString(r.cfg.Environment, "_")
+	}
+	return stamp
+}
+
+// Metadata describes where an archive came from. It is stored as the first
+// entry of the archive when Config.Metadata is set.
+type Metadata struct {
+	ToolVersion string `json:"tool_version"`
+	// ServerVersion is the VERSION() of the server the dumps were made on.
+	ServerVersion string    `json:"server_version,omitempty"`
+	RunID         string    `json:"run_id,omitempty"`
+	Hostname      string    `json:"hostname"`
+	MySQLHost     string    `json:"mysql_host"`
+	AppVersion    string    `json:"app_version,omitempty"`
+	Environment   string    `json:"environment,omitempty"`
+	Databases     []string  `json:"databases"`
+	Created       time.Time `json:"created"`
+	// Binlog is the binlog position of each database's dump with
+	// MasterData. Every database is dumped on its own, so they differ.
+	Binlog map[string]BinlogPosition `json:"binlog,omitempty"`
+}
+
+// metadataEntry builds the metadata.json entry for the databases that made
+// it into the archive.
+func (r *run) metadataEntry(ctx context.Context, results []DatabaseResult) (archiveEntry, error) {
+	hostname, _ := os.Hostname()
+	version, err := serverVersion(ctx, r.cfg)
+	if err != nil {
+		r.logger.Print(err)
+	}
+	meta := Metadata{
+		ToolVersion:   Version,
+		ServerVersion: version,
+		RunID:         r.cfg.RunID,
+		Hostname:      hostname,
+		MySQLHost:     r.cfg.MySQLHost,
+		AppVersion:    r.cfg.AppVersion,
+		Environment:   r.cfg.Environment,
+		Created:       r.started,
+	}
+	for _, result := range results {
+		if result.Error == "" && !result.Skipped {
+			meta.Databases = append(meta.Databases, result.Name)
+			if r.cfg.MasterData == 0 {
+				continue
+			}
+			if position, ok := dumpBinlogPosition(result.File); ok {
+				if meta.Binlog == nil {
+					meta.Binlog = map[string]BinlogPosition{}
+				}
+				meta.Binlog[result.Name] = position
+			}
+		}
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return archiveEntry{}, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return archiveEntry{name: metadataName, data: data}, nil
+}
+
+// withMetadata prepends the metadata entry to entries when enabled.
+func (r *run) withMetadata(ctx context.Context, results []DatabaseResult, entries []archiveEntry) ([]archiveEntry, error) {
+	if !r.cfg.Metadata {
+		return entries, nil
+	}
+	entry, err := r.metadataEntry(ctx, results)
+	if err != nil {
+		return nil, err
+	}
+	return append([]archiveEntry{entry}, entries...), nil
+}
+
+// ReadMetadata returns the metadata of an archive compressed with the zstd
+// dictionary at dictionaryPath, if any. Since it is the first entry, only
+// the start of the archive is read. It returns an error when the archive has
+// no metadata.
+func ReadMetadata(archivePath, dictionaryPath string) (Metadata, error) {
+	var meta Metadata
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return meta, err
+	}
+	defer file.Close()
+
+	tarStream, err := decompressArchive(file, archivePath, dictionaryPath)
+	if err != nil {
+		return meta, err
+	}
+	defer tarStream.Close()
+
+	tarReader := tar.NewReader(tarStream)
+	header, err := tarReader.Next()
+	if err == io.EOF || (err == nil && header.Name != metadataName) {
+		return meta, fmt.Errorf("archive %s has no %s", archivePath, metadataName)
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read archive: %w", err)
+	}
+	err = json.NewDecoder(tarReader).Decode(&meta)
+	if err != nil {
+		return meta, fmt.Errorf("failed to parse %s: %w", metadataName, err)
+	}
+	return meta, nil
+}
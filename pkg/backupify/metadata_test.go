@@ -0,0 +1,29 @@
+package backupify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveStamp(t *testing.T) {
+	tests := []struct {
+		appVersion, environment string
+		want                    string
+	}{
+		{"", "", "20240102_030405"},
+		{"1.4.0", "", "20240102_030405-1.4.0"},
+		{"", "prod", "20240102_030405+prod"},
+		{"1.4.0", "prod", "20240102_030405-1.4.0+prod"},
+		{"v2/rc 1", "eu west", "20240102_030405-v2_rc_1+eu_west"},
+	}
+	for _, tt := range tests {
+		r := &run{cfg: Config{AppVersion: tt.appVersion, Environment: tt.environment}, timestamp: "20240102_030405"}
+		stamp := r.archiveStamp()
+		if stamp != tt.want {
+			t.Errorf("archiveStamp() with %q, %q = %q, want %q", tt.appVersion, tt.environment, stamp, tt.want)
+		}
+		if _, ok := parseRetainedFile("backup_"+stamp+".tar.gz", time.Time{}); !ok {
+			t.Errorf("backup_%s.tar.gz is not a retained file", stamp)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package backupify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsTextfile is the Prometheus text format of a run's metrics, for
+// node_exporter's textfile collector.
+type metricsTextfile struct {
+	labels string
+	b      strings.Builder
+}
+
+// metric writes a gauge with its HELP and TYPE lines.
+func (m *metricsTextfile) metric(name, help string) {
+	fmt.Fprintf(&m.b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes a value of name with the common labels and extra, a
+// label="value" pair or empty.
+func (m *metricsTextfile) sample(name, extra string, value float64) {
+	labels := m.labels
+	if extra != "" {
+		labels = strings.TrimPrefix(labels+","+extra, ",")
+	}
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(&m.b, "%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// metricLabel formats a label pair, escaping the value.
+func metricLabel(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+// writeMetricsTextfile writes the metrics of a finished run to
+// MetricsTextfilePath. The success timestamps of a failed run are carried
+// over from the previous file, so they keep showing the last good backup.
+// The file is replaced atomically, so the collector never reads half of it.
+func writeMetricsTextfile(cfg Config, summary Summary, started, finished time.Time, runErr error) error {
+	previous := readMetricsTextfile(cfg.MetricsTextfilePath)
+	m := &metricsTextfile{}
+	if cfg.Environment != "" {
+		m.labels = metricLabel("environment", cfg.Environment)
+	}
+	success := runErr == nil
+
+	m.metric("backupify_last_run_timestamp_seconds", "Time the last backup run finished.")
+	m.sample("backupify_last_run_timestamp_seconds", "", float64(finished.Unix()))
+	m.metric("backupify_last_run_success", "Whether the last backup run succeeded.")
+	m.sample("backupify_last_run_success", "", boolMetric(success))
+	m.metric("backupify_last_run_duration_seconds", "Duration of the last backup run.")
+	m.sample("backupify_last_run_duration_seconds", "", finished.Sub(started).Seconds())
+	m.metric("backupify_last_success_timestamp_seconds", "Time the last successful backup run finished.")
+	m.sample("backupify_last_success_timestamp_seconds", "", lastSuccess(previous, "backupify_last_success_timestamp_seconds", m.labels, success, finished))
+
+	uploaded := map[string]int64{}
+	for _, upload := range summary.Uploads {
+		if upload.Error == "" {
+			uploaded[path.Base(upload.RemotePath)] = upload.Size
+		}
+	}
+	var size int64
+	for _, n := range uploaded {
+		size += n
+	}
+	failed := 0
+	for _, db := range summary.Databases {
+		if db.Error != "" {
+			failed++
+		}
+	}
+	m.metric("backupify_last_run_uploaded_bytes", "Size of the files the last backup run uploaded.")
+	m.sample("backupify_last_run_uploaded_bytes", "", float64(size))
+	m.metric("backupify_last_run_failed_databases", "Databases that failed in the last backup run.")
+	m.sample("backupify_last_run_failed_databases", "", float64(failed))
+	if len(cfg.StorageCostPerGB) > 0 {
+		m.metric("backupify_last_run_estimated_monthly_cost", "Estimated monthly storage cost of the files the last backup run uploaded.")
+		m.sample("backupify_last_run_estimated_monthly_cost", "", summary.EstimatedMonthlyCost)
+	}
+
+	databases := append([]DatabaseResult(nil), summary.Databases...)
+	sort.Slice(databases, func(i, j int) bool { return databases[i].Name < databases[j].Name })
+	m.metric("backupify_database_success", "Whether the database was backed up in the last run.")
+	for _, db := range databases {
+		m.sample("backupify_database_success", metricLabel("database", db.Name), boolMetric(db.Error == ""))
+	}
+	m.metric("backupify_database_last_success_timestamp_seconds", "Time the database was last backed up.")
+	for _, db := range databases {
+		label := metricLabel("database", db.Name)
+		labels := strings.TrimPrefix(m.labels+","+label, ",")
+		ok := success && db.Error == "" && !db.Skipped
+		m.sample("backupify_database_last_success_timestamp_seconds", label, lastSuccess(previous, "backupify_database_last_success_timestamp_seconds", labels, ok, finished))
+	}
+
+	return writeFileAtomic(cfg.MetricsTextfilePath, []byte(m.b.String()))
+}
+
+// lastSuccess returns now for a success, or else the previous value of the
+// sample, or zero.
+func lastSuccess(previous map[string]float64, name, labels string, success bool, now time.Time) float64 {
+	if success {
+		return float64(now.Unix())
+	}
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	return previous[name]
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readMetricsTextfile returns the samples of an earlier textfile by name
+// and labels. A missing or unreadable file has none.
+func readMetricsTextfile(file string) map[string]float64 {
+	samples := map[string]float64{}
+	f, err := os.Open(file)
+	if err != nil {
+		return samples
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndexByte(line, ' ')
+		if strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(line[i+1:], 64); err == nil {
+			samples[line[:i]] = value
+		}
+	}
+	return samples
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames
+// it into place.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
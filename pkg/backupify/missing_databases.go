@@ -0,0 +1,33 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// withoutMissingDatabases leaves the databases the server doesn't have out
+// of r.databases, for SkipMissingDatabases.
+func (r *run) withoutMissingDatabases(ctx context.Context) error {
+	rows, err := queryMySQL(ctx, r.cfg, "SHOW DATABASES")
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	existing := map[string]bool{}
+	for _, row := range rows {
+		existing[row[0]] = true
+	}
+	var kept, missing []string
+	for _, db := range r.databases {
+		if existing[db] {
+			kept = append(kept, db)
+		} else {
+			missing = append(missing, db)
+		}
+	}
+	if len(missing) > 0 {
+		r.logger.Printf("skipping databases missing on the server: %s", strings.Join(missing, ", "))
+	}
+	r.databases = kept
+	return nil
+}
@@ -0,0 +1,133 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mydumperPrefix is the archive directory mydumper output is stored under,
+// as mydumper/<database>/<file>.
+const mydumperPrefix = "mydumper/"
+
+// mydumperArgs returns the connection and thread options shared by
+// mydumper and myloader.
+func mydumperArgs(config Config) []string {
+	args := []string{
+		"--host=" + config.MySQLHost,
+		"--user=" + config.MySQLUser,
+		"--password=" + config.MySQLPassword,
+	}
+	if config.DumpParallelism > 0 {
+		args = append(args, "--threads="+strconv.Itoa(config.DumpParallelism))
+	}
+	return args
+}
+
+// backupDatabaseMydumper runs mydumper for database into
+// BackupDirectory/<database>.mydumper and returns the files it produced.
+// The directory is emptied first, as mydumper would mix in the files of
+// the previous run.
+func backupDatabaseMydumper(ctx context.Context, config Config, database string) (string, []string, error) {
+	dir := filepath.Join(config.BackupDirectory, database+".mydumper")
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return dir, nil, fmt.Errorf("failed to clean mydumper directory: %w", err)
+	}
+
+	args := append(mydumperArgs(config), "--database="+database, "--outputdir="+dir)
+	name, args := withPriority(config, DumpToolMydumper, args)
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return dir, nil, fmt.Errorf("failed to execute mydumper: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	err = checkDumpWarnings(config, string(output))
+	if err != nil {
+		return dir, nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dir, nil, fmt.Errorf("failed to read mydumper directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dir, files, nil
+}
+
+// myloaderRestore collects the mydumper output of the archive in a
+// temporary directory and loads every database in it with myloader.
+type myloaderRestore struct {
+	root      string
+	databases []string
+}
+
+// add writes the archive entry name, read from r, below the temporary
+// directory. It reports false for entries that are not mydumper output.
+func (m *myloaderRestore) add(name string, r io.Reader) (bool, error) {
+	rest, ok := strings.CutPrefix(name, mydumperPrefix)
+	db, file, found := strings.Cut(rest, "/")
+	if !ok || !found || db == "" || file == "" || strings.Contains(file, "/") {
+		return false, nil
+	}
+	if m.root == "" {
+		root, err := os.MkdirTemp("", "backupify-myloader-")
+		if err != nil {
+			return true, fmt.Errorf("failed to create myloader directory: %w", err)
+		}
+		m.root = root
+	}
+
+	dir := filepath.Join(m.root, db)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.Mkdir(dir, 0o700)
+		if err != nil {
+			return true, fmt.Errorf("failed to create myloader directory: %w", err)
+		}
+		m.databases = append(m.databases, db)
+	}
+	out, err := os.Create(filepath.Join(dir, path.Base(file)))
+	if err != nil {
+		return true, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	if err != nil {
+		return true, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return true, out.Close()
+}
+
+// load runs myloader for every collected database, or only for
+// onlyDatabase when set.
+func (m *myloaderRestore) load(ctx context.Context, config Config, onlyDatabase string) error {
+	for _, db := range m.databases {
+		if onlyDatabase != "" && db != onlyDatabase {
+			continue
+		}
+		config.logger().Printf("restoring database %s with myloader", db)
+		args := append(mydumperArgs(config), "--directory="+filepath.Join(m.root, db), "--database="+db, "--overwrite-tables")
+		output, err := exec.CommandContext(ctx, "myloader", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("database %s: failed to execute myloader: %w: %s", db, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// cleanup removes the temporary directory.
+func (m *myloaderRestore) cleanup() {
+	if m.root != "" {
+		os.RemoveAll(m.root)
+	}
+}
@@ -0,0 +1,51 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// mysqlCommand builds a mysql client command with the connection arguments
+// followed by args.
+func mysqlCommand(ctx context.Context, config Config, args ...string) *exec.Cmd {
+	return serverCommand(ctx, config, "mysql", append(dumpArgs(config), args...))
+}
+
+// queryMySQL runs query with the mysql client, or on the shared connection
+// pool with SQLMetadataQueries, and returns the result rows split into
+// columns.
+func queryMySQL(ctx context.Context, config Config, query string) ([][]string, error) {
+	if config.SQLMetadataQueries {
+		return queryPool(ctx, config, query)
+	}
+	cmd := mysqlCommand(ctx, config, "-N", "-B", "-e", query)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mysql query: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
+
+// quoteIdentifier quotes a MySQL identifier with backticks.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteString quotes a MySQL string literal.
+func quoteString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,129 @@
+package backupify
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// metadataPools are the connection pools of SQLMetadataQueries, one per
+// server and account, shared by every run in the process.
+var (
+	metadataPoolsMu sync.Mutex
+	metadataPools   = map[string]*sql.DB{}
+)
+
+// metadataPool returns the pool for the MySQL connection settings of config,
+// opening it on first use.
+func metadataPool(config Config) (*sql.DB, error) {
+	dsn, err := metadataDSN(config)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataPoolsMu.Lock()
+	defer metadataPoolsMu.Unlock()
+	if db, ok := metadataPools[dsn]; ok {
+		return db, nil
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mysql connection: %w", err)
+	}
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxIdleTime(time.Minute)
+	metadataPools[dsn] = db
+	return db, nil
+}
+
+// metadataDSN builds the go-sql-driver DSN from the same settings the mysql
+// client is given. A ServerPublicKeyPath key is registered with the driver
+// under its path.
+func metadataDSN(config Config) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = config.MySQLUser
+	cfg.Passwd = config.MySQLPassword
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(config.MySQLHost, "3306")
+	if config.ServerPublicKeyPath != "" {
+		key, err := loadServerPublicKey(config.ServerPublicKeyPath)
+		if err != nil {
+			return "", err
+		}
+		mysql.RegisterServerPubKey(config.ServerPublicKeyPath, key)
+		cfg.ServerPubKey = config.ServerPublicKeyPath
+	}
+	return cfg.FormatDSN(), nil
+}
+
+func loadServerPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse server public key %s: no PEM block", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server public key %s: %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server public key %s is not an RSA key", path)
+	}
+	return rsaKey, nil
+}
+
+// queryPool runs query on the metadata pool. Values are returned as the
+// mysql client prints them in batch mode, with NULL for SQL NULL.
+func queryPool(ctx context.Context, config Config, query string) ([][]string, error) {
+	db, err := metadataPool(config)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mysql query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mysql query: %w", err)
+	}
+	var result [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mysql result: %w", err)
+		}
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = "NULL"
+			if value.Valid {
+				row[i] = value.String
+			}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mysql result: %w", err)
+	}
+	return result, nil
+}
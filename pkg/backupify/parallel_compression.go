@@ -0,0 +1,236 @@
+package backupify
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// archiveSegment is the compressed tar stream of the dump of one database,
+// without the end-of-archive marker. gzip members and zstd frames can be
+// concatenated, and so can the tar streams inside, so the segments are
+// copied into the archive as they are.
+type archiveSegment struct {
+	entries  []archiveEntry
+	path     string
+	manifest []ManifestEntry
+	err      error
+}
+
+// segmentCompressor compresses the dumps of a combined archive on
+// CompressionWorkers goroutines while the next databases are being dumped.
+// The queue holds as many dumps as there are workers, so dumping waits when
+// compression falls behind.
+type segmentCompressor struct {
+	cfg      Config
+	jobs     chan *archiveSegment
+	wg       sync.WaitGroup
+	segments []*archiveSegment
+}
+
+func (r *run) newSegmentCompressor() *segmentCompressor {
+	workers := r.cfg.CompressionWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	c := &segmentCompressor{cfg: r.cfg, jobs: make(chan *archiveSegment, workers)}
+	for i := 0; i < workers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for segment := range c.jobs {
+				segment.err = c.compress(segment)
+			}
+		}()
+	}
+	return c
+}
+
+// add queues the dumps in entries and returns the entries that stand in
+// for them in the archive. Views dumps go last in the archive, so they are
+// returned as they are and compressed with the rest.
+func (c *segmentCompressor) add(entries []archiveEntry) []archiveEntry {
+	var dumps, views []archiveEntry
+	for _, entry := range entries {
+		if isViewsDump(entry.name) {
+			views = append(views, entry)
+		} else {
+			dumps = append(dumps, entry)
+		}
+	}
+	if len(dumps) == 0 {
+		return views
+	}
+	segment := &archiveSegment{entries: dumps}
+	c.segments = append(c.segments, segment)
+	c.jobs <- segment
+	return append([]archiveEntry{{segment: segment}}, views...)
+}
+
+// wait returns once every queued dump is compressed.
+func (c *segmentCompressor) wait() error {
+	close(c.jobs)
+	c.wg.Wait()
+	var errs []error
+	for _, segment := range c.segments {
+		if segment.err != nil {
+			errs = append(errs, segment.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// remove deletes the compressed segments.
+func (c *segmentCompressor) remove() {
+	for _, segment := range c.segments {
+		if segment.path != "" {
+			os.Remove(segment.path)
+		}
+	}
+}
+
+func (c *segmentCompressor) compress(segment *archiveSegment) error {
+	file, err := os.CreateTemp(c.cfg.BackupDirectory, ".segment-*")
+	if err != nil {
+		return fmt.Errorf("failed to create compressed segment: %w", err)
+	}
+	defer file.Close()
+	segment.path = file.Name()
+
+	compressor, err := newCompressor(c.cfg.autoCompressionLevel(entriesSize(segment.entries)), file)
+	if err != nil {
+		return err
+	}
+	segment.manifest, err = writeTarSegment(c.cfg, compressor, segment.entries)
+	if err != nil {
+		compressor.Close()
+		return err
+	}
+	err = compressor.Close()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write compressed segment: %w", err)
+	}
+	return nil
+}
+
+// writeTarSegment writes entries to w as tar without the end-of-archive
+// marker.
+func writeTarSegment(config Config, w io.Writer, entries []archiveEntry) ([]ManifestEntry, error) {
+	tarWriter := tar.NewWriter(w)
+	var manifest []ManifestEntry
+	for _, entry := range entries {
+		manifestEntry, err := addFileToArchive(config, tarWriter, entry)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, manifestEntry)
+	}
+	err := tarWriter.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeSegmentedArchive writes entries to w like writeArchive, copying the
+// compressed segments and compressing the entries between them.
+func writeSegmentedArchive(config Config, entries []archiveEntry, w io.Writer) error {
+	if config.EncryptCommand != "" {
+		encryptor, err := startCompressCommand(config.EncryptCommand, w)
+		if err != nil {
+			return err
+		}
+		err = writeSegments(config, entries, encryptor)
+		closeErr := encryptor.Close()
+		if err != nil {
+			return err
+		}
+		return closeErr
+	}
+	return writeSegments(config, entries, w)
+}
+
+func writeSegments(config Config, entries []archiveEntry, w io.Writer) error {
+	var manifest []ManifestEntry
+	var pending []archiveEntry
+	flush := func(last bool) error {
+		if len(pending) == 0 && !last {
+			return nil
+		}
+		compressor, err := newCompressor(config.autoCompressionLevel(entriesSize(pending)), w)
+		if err != nil {
+			return err
+		}
+		written, err := writeTarSegment(config, compressor, pending)
+		if err == nil && last {
+			err = finishTar(config, compressor, append(manifest, written...))
+		}
+		if err != nil {
+			compressor.Close()
+			return err
+		}
+		manifest = append(manifest, written...)
+		pending = nil
+		return compressor.Close()
+	}
+
+	for _, entry := range entries {
+		if entry.segment == nil {
+			pending = append(pending, entry)
+			continue
+		}
+		if err := flush(false); err != nil {
+			return err
+		}
+		err := appendFile(w, entry.segment.path)
+		if err != nil {
+			return fmt.Errorf("failed to write compressed segment into archive: %w", err)
+		}
+		manifest = append(manifest, entry.segment.manifest...)
+	}
+	return flush(true)
+}
+
+// finishTar writes the manifest, if enabled, and the end-of-archive marker.
+func finishTar(config Config, w io.Writer, manifest []ManifestEntry) error {
+	tarWriter := tar.NewWriter(w)
+	if config.Manifest {
+		err := addManifest(tarWriter, manifest)
+		if err != nil {
+			return err
+		}
+	}
+	err := tarWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// appendFile copies the file at path to w.
+func appendFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// hasSegments reports whether entries include compressed segments.
+func hasSegments(entries []archiveEntry) bool {
+	for _, entry := range entries {
+		if entry.segment != nil {
+			return true
+		}
+	}
+	return false
+}
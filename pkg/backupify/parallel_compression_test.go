@@ -0,0 +1,115 @@
+package backupify
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSegmentedArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		archive     string
+	}{
+		{"gzip", CompressionGzip, "backup.tar.gz"},
+		{"zstd", CompressionZstd, "backup.tar.zst"},
+		{"none", compressionNone, "backup.tar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := Config{BackupDirectory: dir, Compression: tt.compression, CompressionWorkers: 2, Manifest: true}
+			dumps := map[string]string{
+				"shop.sql":       "CREATE TABLE `orders` (`id` int);\n",
+				"shop.views.sql": "CREATE VIEW `v_orders` AS SELECT 1;\n",
+				"crm.sql":        "CREATE TABLE `contacts` (`id` int);\n",
+				"blog.sql":       "CREATE TABLE `posts` (`id` int);\n",
+			}
+			for name, dump := range dumps {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(dump), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entry := func(name string) archiveEntry {
+				return archiveEntry{path: filepath.Join(dir, name), name: name}
+			}
+
+			c := (&run{cfg: config}).newSegmentCompressor()
+			var entries []archiveEntry
+			entries = append(entries, c.add([]archiveEntry{entry("shop.sql"), entry("shop.views.sql")})...)
+			entries = append(entries, archiveEntry{name: "metadata.json", data: []byte(`{}`)})
+			entries = append(entries, c.add([]archiveEntry{entry("crm.sql")})...)
+			entries = append(entries, c.add([]archiveEntry{entry("blog.sql")})...)
+			if err := c.wait(); err != nil {
+				t.Fatalf("wait() = %v", err)
+			}
+			defer c.remove()
+			if !hasSegments(entries) {
+				t.Fatal("hasSegments() = false")
+			}
+
+			var archive bytes.Buffer
+			if err := writeSegmentedArchive(config, entries, &archive); err != nil {
+				t.Fatalf("writeSegmentedArchive() = %v", err)
+			}
+			reader, err := decompressArchive(&archive, tt.archive, "")
+			if err != nil {
+				t.Fatalf("decompressArchive() = %v", err)
+			}
+			defer reader.Close()
+
+			var names []string
+			var manifest []ManifestEntry
+			tarReader := tar.NewReader(reader)
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to read archive after %v: %v", names, err)
+				}
+				data, err := io.ReadAll(tarReader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, header.Name)
+				if header.Name == manifestName {
+					if err := json.Unmarshal(data, &manifest); err != nil {
+						t.Fatalf("invalid manifest: %v", err)
+					}
+				} else if want, ok := dumps[header.Name]; ok && string(data) != want {
+					t.Errorf("%s = %q, want %q", header.Name, data, want)
+				}
+			}
+
+			want := []string{"shop.sql", "shop.views.sql", "metadata.json", "crm.sql", "blog.sql", manifestName}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("archive entries = %v, want %v", names, want)
+			}
+			var listed []string
+			for _, entry := range manifest {
+				listed = append(listed, entry.Name)
+			}
+			if !reflect.DeepEqual(listed, want[:len(want)-1]) {
+				t.Errorf("manifest entries = %v, want %v", listed, want[:len(want)-1])
+			}
+
+			c.remove()
+			for _, entry := range entries {
+				if entry.segment == nil {
+					continue
+				}
+				if _, err := os.Stat(entry.segment.path); !os.IsNotExist(err) {
+					t.Errorf("segment %s left behind: %v", entry.segment.path, err)
+				}
+			}
+		})
+	}
+}
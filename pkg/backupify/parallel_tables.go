@@ -0,0 +1,216 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// parallelTablesSyncTimeout is how long the dump processes of a database
+// may take to open their transactions while the read lock is held.
+const parallelTablesSyncTimeout = 2 * time.Minute
+
+// tableSize is a base table and its size according to information_schema.
+type tableSize struct {
+	name string
+	size int64
+}
+
+// listTableSizes returns the base tables of database, biggest first.
+func listTableSizes(ctx context.Context, config Config, database string) ([]tableSize, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT table_name, COALESCE(data_length, 0) + COALESCE(index_length, 0) FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema = "+quoteString(database)+" ORDER BY 2 DESC, 1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables of %s: %w", database, err)
+	}
+	tables := make([]tableSize, len(rows))
+	for i, row := range rows {
+		size, _ := strconv.ParseInt(row[1], 10, 64)
+		tables[i] = tableSize{name: row[0], size: size}
+	}
+	return tables, nil
+}
+
+// tableBuckets spreads tables over at most n buckets of about the same
+// total size, always adding the next biggest table to the smallest bucket.
+// Buckets of the same size take the table in the one with fewer tables, so
+// empty tables don't all end up in the first one and no bucket is left
+// empty, which would dump the whole database.
+func tableBuckets(tables []tableSize, n int) [][]string {
+	n = min(n, len(tables))
+	buckets := make([][]string, n)
+	sizes := make([]int64, n)
+	for _, table := range tables {
+		smallest := 0
+		for i := range sizes {
+			if sizes[i] < sizes[smallest] || (sizes[i] == sizes[smallest] && len(buckets[i]) < len(buckets[smallest])) {
+				smallest = i
+			}
+		}
+		buckets[smallest] = append(buckets[smallest], table.name)
+		sizes[smallest] += table.size
+	}
+	return buckets
+}
+
+// partFile is the name of the dump of bucket i of backupFile, e.g.
+// shop.part1.sql for shop.sql.
+func partFile(backupFile string, i int) string {
+	dir, name := filepath.Split(backupFile)
+	j := strings.LastIndex(name, ".sql")
+	return dir + name[:j] + ".part" + strconv.Itoa(i+1) + name[j:]
+}
+
+// dumpTablesParallel dumps the base tables of db, except skipped, with
+// ParallelTables mysqldump processes at once and concatenates their output
+// into backupFile. Each process dumps its share of the tables in a single
+// transaction. They all open their transactions while a global read lock
+// is held by another connection, so they see the same snapshot, and the
+// lock is released as soon as they have.
+func dumpTablesParallel(ctx context.Context, config Config, db, backupFile string, skipped []string) error {
+	tables, err := listTableSizes(ctx, config, db)
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{}
+	for _, table := range skipped {
+		skip[table] = true
+	}
+	kept := tables[:0]
+	for _, table := range tables {
+		if !skip[table.name] {
+			kept = append(kept, table)
+		}
+	}
+	buckets := tableBuckets(kept, config.ParallelTables)
+	if len(buckets) <= 1 {
+		return backupDatabase(ctx, config, db, backupFile, append(ignoreTableArgs(db, skipped), db)...)
+	}
+
+	lock, err := lockForSnapshot(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer lock.close()
+
+	// A failed part can't be retried: it would see a later snapshot.
+	partConfig := config
+	partConfig.DumpRetries = 0
+	dumpCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make([]error, len(buckets))
+	var finished atomic.Int32
+	var wg sync.WaitGroup
+	for i, bucket := range buckets {
+		args := append([]string{"--single-transaction", "--skip-lock-tables"}, db)
+		if i > 0 {
+			// Routines and events, if dumped, only go into the first part.
+			args = append([]string{"--skip-routines", "--skip-events"}, args...)
+		}
+		wg.Add(1)
+		go func(i int, args []string) {
+			defer wg.Done()
+			defer finished.Add(1)
+			errs[i] = backupDatabase(dumpCtx, partConfig, db, partFile(backupFile, i), args...)
+		}(i, append(args, bucket...))
+	}
+
+	err = lock.release(ctx, config, len(buckets), &finished)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	defer func() {
+		for i := range buckets {
+			os.Remove(partFile(backupFile, i))
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	for i, partErr := range errs {
+		if partErr != nil {
+			return fmt.Errorf("part %d of %d: %w", i+1, len(buckets), partErr)
+		}
+	}
+	config.logger().Printf("dumped %d tables of %s in %d parts", len(kept), db, len(buckets))
+	return concatParts(backupFile, len(buckets))
+}
+
+// openTransactions counts the InnoDB transactions of the backup user.
+func openTransactions(ctx context.Context, config Config) (int, error) {
+	rows, err := queryPool(ctx, config, "SELECT COUNT(*) FROM information_schema.innodb_trx t JOIN information_schema.processlist p ON p.id = t.trx_mysql_thread_id WHERE p.user = "+quoteString(config.MySQLUser))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	n, _ := strconv.Atoi(rows[0][0])
+	return n, nil
+}
+
+// waitForTransactions waits until n more transactions than baseline are
+// open, counting dump processes that already finished as well.
+func waitForTransactions(ctx context.Context, config Config, baseline, n int, finished *atomic.Int32) error {
+	deadline := time.Now().Add(parallelTablesSyncTimeout)
+	for {
+		open, err := openTransactions(ctx, config)
+		if err != nil {
+			return err
+		}
+		if open-baseline+int(finished.Load()) >= n {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("dump processes didn't start their transactions within %s", parallelTablesSyncTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// concatParts joins the n part dumps into backupFile. gzipped parts join
+// into a valid multi-member gzip file.
+func concatParts(backupFile string, n int) error {
+	out, err := os.Create(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to create database copy file: %w", err)
+	}
+	defer out.Close()
+	for i := 0; i < n; i++ {
+		err = appendFile(out, partFile(backupFile, i))
+		if err != nil {
+			os.Remove(backupFile)
+			return fmt.Errorf("failed to join dump parts: %w", err)
+		}
+	}
+	return out.Close()
+}
+
+// validateParallelTables checks what per-table parallel dumps can't be
+// combined with.
+func (c Config) validateParallelTables() error {
+	if c.ParallelTables < 0 {
+		return fmt.Errorf("parallel_tables must not be negative")
+	}
+	if c.ParallelTables <= 1 {
+		return nil
+	}
+	switch {
+	case c.dumpTool() != DumpToolMysqldump && c.dumpTool() != DumpToolMariadbDump:
+		return fmt.Errorf("parallel_tables needs dump_tool mysqldump or mariadb-dump")
+	case c.TabExport:
+		return fmt.Errorf("parallel_tables can't be used with tab_export")
+	case c.MasterData != 0 || c.FlushLogs:
+		return fmt.Errorf("parallel_tables can't be used with master_data or flush_logs, the parts would record different positions")
+	case c.DumpSSH != nil:
+		return fmt.Errorf("parallel_tables can't be used with dump_ssh")
+	}
+	return nil
+}
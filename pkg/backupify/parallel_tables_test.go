@@ -0,0 +1,77 @@
+package backupify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableBuckets(t *testing.T) {
+	tests := []struct {
+		name   string
+		tables []tableSize
+		n      int
+		want   [][]string
+	}{
+		{
+			name:   "no tables",
+			tables: nil,
+			n:      4,
+			want:   [][]string{},
+		},
+		{
+			name:   "fewer tables than buckets",
+			tables: []tableSize{{"orders", 300}, {"users", 100}},
+			n:      4,
+			want:   [][]string{{"orders"}, {"users"}},
+		},
+		{
+			name:   "next biggest goes to the smallest bucket",
+			tables: []tableSize{{"a", 500}, {"b", 300}, {"c", 200}, {"d", 100}, {"e", 100}},
+			n:      2,
+			want:   [][]string{{"a", "d"}, {"b", "c", "e"}},
+		},
+		{
+			name:   "equal sizes go to the bucket with fewer tables",
+			tables: []tableSize{{"a", 0}, {"b", 0}, {"c", 0}},
+			n:      2,
+			want:   [][]string{{"a", "c"}, {"b"}},
+		},
+		{
+			name:   "empty tables fill every bucket",
+			tables: []tableSize{{"a", 100}, {"b", 0}, {"c", 0}, {"d", 0}},
+			n:      3,
+			want:   [][]string{{"a"}, {"b", "d"}, {"c"}},
+		},
+		{
+			name:   "single bucket",
+			tables: []tableSize{{"a", 5}, {"b", 3}},
+			n:      1,
+			want:   [][]string{{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tableBuckets(tt.tables, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tableBuckets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartFile(t *testing.T) {
+	tests := []struct {
+		backupFile string
+		i          int
+		want       string
+	}{
+		{"/backups/shop.sql", 0, "/backups/shop.part1.sql"},
+		{"/backups/shop_20240101_000000.sql.gz", 2, "/backups/shop_20240101_000000.part3.sql.gz"},
+		{"my.sql.db.sql", 1, "my.sql.db.part2.sql"},
+	}
+	for _, tt := range tests {
+		if got := partFile(tt.backupFile, tt.i); got != tt.want {
+			t.Errorf("partFile(%q, %d) = %q, want %q", tt.backupFile, tt.i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// partsSuffix is appended to the name of a file uploaded in parts for the
+// manifest that lists them.
+const partsSuffix = ".parts.json"
+
+// minUploadPartSize keeps small files from being split into tiny parts.
+const minUploadPartSize = 16 << 20
+
+// PartsManifest lists the parts a file was uploaded in, in order.
+// Concatenated they make up the file.
+type PartsManifest struct {
+	Name  string       `json:"name"`
+	Size  int64        `json:"size"`
+	Parts []UploadPart `json:"parts"`
+}
+
+// UploadPart is a part of a file uploaded with ParallelUploadStreams.
+type UploadPart struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// uploadPartName is the remote name of part i of name, e.g.
+// backup_20240101_000000.tar.gz.part1.
+func uploadPartName(name string, i int) string {
+	return name + ".part" + strconv.Itoa(i+1)
+}
+
+// uploadParts returns how many parts a file of size bytes is uploaded in.
+func (c Config) uploadParts(size int64) int {
+	if c.ParallelUploadStreams <= 1 {
+		return 1
+	}
+	return int(min(int64(c.ParallelUploadStreams), max(size/minUploadPartSize, 1)))
+}
+
+// uploadPartsToFTP uploads localFile to dest as n parts of about the same
+// size, each over an FTP connection of its own, followed by the manifest
+// <name>.parts.json and the sidecar files. It returns the remote path of
+// the manifest.
+func uploadPartsToFTP(ctx context.Context, config Config, dest Destination, localFile string, n int) (string, error) {
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		conn.Quit()
+		return "", err
+	}
+	manifestName, skip, err := remoteName(config, conn, dest.Directory, filepath.Base(localFile)+partsSuffix, -1)
+	// The parts need the connections, and this one would sit idle.
+	conn.Quit()
+	if err != nil {
+		return "", err
+	}
+	manifestPath := path.Join(dest.Directory, manifestName)
+	if skip {
+		return manifestPath, nil
+	}
+
+	name := strings.TrimSuffix(manifestName, partsSuffix)
+	size := info.Size()
+	partSize := (size + int64(n) - 1) / int64(n)
+	manifest := PartsManifest{Name: name, Size: size, Parts: make([]UploadPart, n)}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range manifest.Parts {
+		offset := int64(i) * partSize
+		part := &manifest.Parts[i]
+		part.Name, part.Size = uploadPartName(name, i), min(partSize, size-offset)
+		wg.Add(1)
+		go func(i int, offset int64) {
+			defer wg.Done()
+			part.SHA256, errs[i] = storPart(ctx, config, dest, localFile, part.Name, offset, part.Size)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("part %d of %d: %w", i+1, n, errs[i])
+			}
+		}(i, offset)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	conn, err = dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+	_, err = storSized(config, conn, dest.Directory, manifestName, int64(len(data)), func() (io.Reader, error) {
+		return bytes.NewReader(data), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload parts manifest: %w", err)
+	}
+	uploaded := []string{manifestPath}
+	for _, part := range manifest.Parts {
+		uploaded = append(uploaded, path.Join(dest.Directory, part.Name))
+	}
+	sidecars, err := storSidecars(config, conn, dest.Directory, localFile, name)
+	if err != nil {
+		return manifestPath, err
+	}
+	uploaded = append(uploaded, sidecars...)
+	config.logger().Printf("uploaded %s to %s in %d parts", name, dest.Name, n)
+
+	if config.RemoteFileMode != "" {
+		conn.Quit()
+		chmodRemote(ctx, config, dest, uploaded)
+	}
+	return manifestPath, nil
+}
+
+// storPart uploads length bytes of localFile from offset as name and
+// returns their SHA-256.
+func storPart(ctx context.Context, config Config, dest Destination, localFile, name string, offset, length int64) (string, error) {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	h := sha256.New()
+	remotePath, err := storSized(config, conn, dest.Directory, name, length, func() (io.Reader, error) {
+		h.Reset()
+		return io.TeeReader(io.NewSectionReader(file, offset, length), h), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if config.VerifyRemoteHash {
+		conn.Quit()
+		err = verifyRemoteHash(ctx, config, dest, remotePath, func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(file, offset, length)), nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// retrParts downloads the parts listed in the manifest of name in dir and
+// writes them to w one after the other, checking their sizes and checksums.
+func retrParts(conn *ftpConn, dir, name string, w io.Writer) error {
+	response, err := conn.Retr(path.Join(dir, name+partsSuffix))
+	if err != nil {
+		return err
+	}
+	var manifest PartsManifest
+	err = json.NewDecoder(response).Decode(&manifest)
+	response.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse %s%s: %w", name, partsSuffix, err)
+	}
+
+	for _, part := range manifest.Parts {
+		response, err := conn.Retr(path.Join(dir, part.Name))
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", part.Name, err)
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(w, h), response)
+		response.Close()
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", part.Name, err)
+		}
+		if n != part.Size || hex.EncodeToString(h.Sum(nil)) != part.SHA256 {
+			return fmt.Errorf("downloaded %s doesn't match the parts manifest", part.Name)
+		}
+	}
+	return nil
+}
+
+// deleteParts deletes the parts of remotePath, numbered from 1 up to the
+// first that isn't there, and returns their paths.
+func deleteParts(conn *ftpConn, remotePath string) []string {
+	var deleted []string
+	for i := 0; ; i++ {
+		part := uploadPartName(remotePath, i)
+		if conn.Delete(part) != nil {
+			return deleted
+		}
+		deleted = append(deleted, part)
+	}
+}
@@ -0,0 +1,161 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// perDatabase runs the dump, archive and upload pipeline for every database
+// independently, DatabaseConcurrency at a time, so each database ships its
+// own backup_<database>_<timestamp>.tar.gz as soon as it is ready. Every
+// table group of a database gets its own backup_<database>.<group> archive.
+func (r *run) perDatabase(ctx context.Context, summary *Summary) error {
+	limit := r.cfg.DatabaseConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+
+	units := r.perDatabaseUnits()
+	outcomes := make([]databaseOutcome, len(units))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, db := range units {
+		wg.Add(1)
+		go func(i int, db string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := r.pauseBeforeDatabase(ctx, i); err != nil {
+				outcomes[i] = databaseOutcome{result: DatabaseResult{Name: db, Error: err.Error(), err: err}, err: err}
+				return
+			}
+
+			o := &outcomes[i]
+			var entries []archiveEntry
+			done := r.stage("dump of "+db, &summary.DumpMS)
+			o.result, entries = r.dumpDatabase(ctx, db)
+			done()
+			if o.result.Error != "" || o.result.Skipped {
+				return
+			}
+			o.archive, o.uploads, o.err = r.shipDatabase(ctx, o.result, entries, summary)
+			if r.cfg.AllOrNothing {
+				if r.cfg.rawDumps() {
+					o.entries = entries
+				}
+				return
+			}
+			if o.err == nil {
+				r.commitState(db)
+			}
+		}(i, db)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, o := range outcomes {
+		summary.Databases = append(summary.Databases, o.result)
+		if o.archive != "" {
+			summary.Archives = append(summary.Archives, o.archive)
+		}
+		summary.Uploads = append(summary.Uploads, o.uploads...)
+		if o.err != nil && !r.cfg.AllOrNothing {
+			errs = append(errs, fmt.Errorf("%s: %w", o.result.Name, o.err))
+		}
+	}
+	if r.cfg.AllOrNothing {
+		if err := r.commitStaged(ctx, summary, outcomes); err != nil {
+			return err
+		}
+	}
+	// Every database has its own series of archives, so the ones that
+	// failed this time keep all of theirs.
+	r.pruneRemote(ctx, summary)
+	return errors.Join(errs...)
+}
+
+// databaseOutcome is what perDatabase got for a single database.
+type databaseOutcome struct {
+	result  DatabaseResult
+	archive string
+	uploads []UploadResult
+	err     error
+	// entries are the raw dumps staged for upload with AllOrNothing.
+	entries []archiveEntry
+}
+
+// shipDatabase archives (unless the dumps are shipped raw) and uploads the
+// files of a single database. With AllOrNothing the upload is left to
+// commitStaged. Stage durations are added to summary.
+func (r *run) shipDatabase(ctx context.Context, result DatabaseResult, entries []archiveEntry, summary *Summary) (string, []UploadResult, error) {
+	db := result.Name
+	database, _ := r.cfg.tableGroup(db)
+	dests := r.cfg.destinationsFor(r.dests, database)
+	if len(dests) == 0 {
+		return "", nil, errNoDestination
+	}
+	if r.cfg.rawDumps() {
+		if r.cfg.AllOrNothing {
+			return "", nil, nil
+		}
+		var uploaded Summary
+		done := r.stage("upload of "+db, &summary.UploadMS)
+		err := uploadDumps(ctx, r.cfg, &uploaded, dests, entries)
+		done()
+		return "", uploaded.Uploads, err
+	}
+
+	if r.cfg.CaptureServerVariables {
+		if info, ok := r.serverInfoEntry(ctx); ok {
+			entries = append(entries, info)
+		}
+	}
+	entries, err := r.withMetadata(ctx, []DatabaseResult{result}, entries)
+	if err != nil {
+		return "", nil, err
+	}
+	entries = r.withRestoreScript(entries)
+	archiveCfg := r.archiveConfig(database, entries)
+	archivePath := filepath.Join(r.cfg.BackupDirectory, fmt.Sprintf("backup_%s_%s%s", db, r.archiveStamp(), archiveCfg.archiveSuffix()))
+	done := r.stage("archive of "+db, &summary.ArchiveMS)
+	data, inMemory, err := r.archiveInMemory(archiveCfg, entries, archivePath)
+	if err == nil && !inMemory {
+		r.logger.Printf("creating archive -> %s", archivePath)
+		err = archiveFiles(archiveCfg, entries, archivePath)
+	}
+	done()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to archive: %w", err)
+	}
+	shipped := archivePath
+	if inMemory {
+		shipped = filepath.Base(archivePath)
+	}
+	_, err = r.finishArchive(summary, db, db, archivePath, data)
+	if err != nil {
+		return shipped, nil, err
+	}
+	if r.cfg.AllOrNothing {
+		return archivePath, nil, nil
+	}
+
+	r.logger.Printf("uploading -> %s", archivePath)
+	done = r.stage("upload of "+db, &summary.UploadMS)
+	var uploads []UploadResult
+	if inMemory {
+		uploads, err = uploadFromMemory(ctx, r.cfg, dests, shipped, data)
+	} else {
+		uploads, err = uploadArchive(ctx, r.cfg, dests, archivePath)
+	}
+	done()
+	if err != nil {
+		return shipped, uploads, fmt.Errorf("failed to upload: %w", err)
+	}
+	if r.cfg.DeleteLocalAfterUpload && !inMemory {
+		removeLocalArchive(r.cfg, archivePath)
+	}
+	return shipped, uploads, nil
+}
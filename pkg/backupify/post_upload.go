@@ -0,0 +1,48 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runPostUploadCommand runs PostUploadCommand for a file that was uploaded
+// to the destination dest as remotePath, with the remote path and the
+// SHA-256 (empty when unknown) as its last two arguments and in BACKUPIFY_*
+// environment variables.
+func runPostUploadCommand(ctx context.Context, config Config, dest, remotePath, sum string) error {
+	args := append(strings.Fields(config.PostUploadCommand), remotePath, sum)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BACKUPIFY_DESTINATION="+dest,
+		"BACKUPIFY_REMOTE_PATH="+remotePath,
+		"BACKUPIFY_SHA256="+sum,
+		"BACKUPIFY_RUN_ID="+config.RunID,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("post upload command failed for %s: %w: %s", remotePath, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// verifyUploads runs PostUploadCommand for every successful upload in
+// results and turns the ones it rejects into failed uploads.
+func verifyUploads(ctx context.Context, config Config, results []UploadResult, errs []error, sum string) {
+	if config.PostUploadCommand == "" {
+		return
+	}
+	for i, result := range results {
+		if errs[i] != nil {
+			continue
+		}
+		err := runPostUploadCommand(ctx, config, result.Destination, result.RemotePath, sum)
+		if err != nil {
+			config.logger().Printf("%v", err)
+			results[i].Error = err.Error()
+			errs[i] = &DestinationError{Destination: result.Destination, Err: err}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// preflightUploads logs into every destination and writes and deletes a
+// small file in its directory, so an expired password or a read-only
+// directory fails the run before anything is dumped. Of the failover
+// destinations one writable is enough.
+func (r *run) preflightUploads(ctx context.Context) error {
+	name := ".backupify-preflight-" + r.timestamp
+	var errs []error
+	for _, dest := range r.dests {
+		_, used, err := uploadWithFailover(ctx, r.cfg, dest, func(ctx context.Context, dest Destination) (string, error) {
+			return "", preflightDestination(ctx, r.cfg, dest, name)
+		})
+		if err != nil {
+			errs = append(errs, &DestinationError{Destination: dest.Name, Err: err})
+			continue
+		}
+		r.logger.Printf("destination %s is writable", used)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("upload check failed: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// DestinationCheck is the outcome of CheckDestinations for one destination.
+type DestinationCheck struct {
+	Destination string `json:"destination"`
+	Type        string `json:"type"`
+	Error       string `json:"error,omitempty"`
+}
+
+// CheckDestinations runs the upload check of PreflightUploadCheck against
+// every destination, each of the failover destinations included, without
+// dumping anything. It returns an error when any of them fails.
+func CheckDestinations(ctx context.Context, config Config) ([]DestinationCheck, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	now := time.Now()
+	name := ".backupify-preflight-" + now.Format("20060102_150405")
+	var results []DestinationCheck
+	var errs []error
+	for _, dest := range expandFailover(renderDestinations(config.destinations(), now)) {
+		result := DestinationCheck{Destination: dest.Name, Type: dest.Type}
+		if result.Type == "" {
+			result.Type = DestinationFTP
+		}
+		err := preflightDestination(ctx, config, dest, name)
+		if err != nil {
+			result.Error = err.Error()
+			errs = append(errs, &DestinationError{Destination: dest.Name, Err: err})
+		}
+		results = append(results, result)
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("destination check failed: %w", errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// preflightDestination checks that dest accepts uploads, with the test
+// file called name where one is written.
+func preflightDestination(ctx context.Context, config Config, dest Destination, name string) error {
+	switch dest.Type {
+	case DestinationSSH:
+		return preflightSSH(ctx, config, dest, name)
+	case DestinationCommand:
+		return preflightCommand(dest)
+	}
+	return preflightFTP(ctx, config, dest, name)
+}
+
+func preflightFTP(ctx context.Context, config Config, dest Destination, name string) error {
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		return err
+	}
+	remotePath := path.Join(dest.Directory, name)
+	err = conn.Stor(remotePath, strings.NewReader("ok\n"))
+	if err != nil {
+		return fmt.Errorf("failed to upload test file: %w", err)
+	}
+	err = conn.Delete(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to delete test file %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// preflightSSH writes and removes the test file with the default command.
+// A custom Command may do anything with its input, so then only the login
+// is checked.
+func preflightSSH(ctx context.Context, config Config, dest Destination, name string) error {
+	command := "true"
+	if dest.Command == "" {
+		remotePath := shellQuote(path.Join(dest.Directory, name))
+		command = "cat > " + remotePath + " && rm -f " + remotePath
+	}
+	cmd := exec.CommandContext(ctx, "ssh", append(append(sshProxyArgs(config), sshArgs(dest)...), command)...)
+	cmd.Stdin = strings.NewReader("ok\n")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ssh command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package backupify
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// withPriority prefixes name/args with nice and ionice according to
+// NiceLevel and IONiceClass. Wrappers that aren't installed are skipped.
+func withPriority(config Config, name string, args []string) (string, []string) {
+	if config.IONiceClass != 0 {
+		if path, err := exec.LookPath("ionice"); err == nil {
+			args = append([]string{"-c", strconv.Itoa(config.IONiceClass), name}, args...)
+			name = path
+		}
+	}
+	if config.NiceLevel != 0 {
+		if path, err := exec.LookPath("nice"); err == nil {
+			args = append([]string{"-n", strconv.Itoa(config.NiceLevel), name}, args...)
+			name = path
+		}
+	}
+	return name, args
+}
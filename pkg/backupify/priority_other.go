@@ -0,0 +1,8 @@
+//go:build !linux
+
+package backupify
+
+// withPriority is a no-op outside Linux.
+func withPriority(config Config, name string, args []string) (string, []string) {
+	return name, args
+}
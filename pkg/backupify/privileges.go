@@ -0,0 +1,172 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// databasePrivileges are the privileges mysqldump needs on every database
+// it dumps: SELECT and LOCK TABLES for the data, SHOW VIEW and TRIGGER for
+// the views and triggers it writes by default.
+var databasePrivileges = []string{"SELECT", "LOCK TABLES", "SHOW VIEW", "TRIGGER"}
+
+// grantPattern splits a line of SHOW GRANTS into the privilege list and the
+// object it applies to.
+var grantPattern = regexp.MustCompile(`^GRANT (.+?) ON (\S+) TO `)
+
+// requiredGlobalPrivileges returns the server-wide privileges the dump
+// options need, each once.
+func requiredGlobalPrivileges(config Config) []string {
+	var privileges []string
+	switch config.dumpTool() {
+	case DumpToolMysqldump:
+		// mysqldump 8 dumps tablespaces from INFORMATION_SCHEMA.FILES.
+		privileges = append(privileges, "PROCESS")
+	case DumpToolMydumper:
+		// mydumper takes FLUSH TABLES WITH READ LOCK for a consistent
+		// snapshot.
+		privileges = append(privileges, "RELOAD", "PROCESS")
+	}
+	if config.ParallelTables > 1 || config.ConsistentSnapshot {
+		// The parts, or the databases, start from one snapshot under FLUSH
+		// TABLES WITH READ LOCK, waiting for each other in
+		// INFORMATION_SCHEMA.INNODB_TRX.
+		privileges = append(privileges, "RELOAD")
+		if config.dumpTool() != DumpToolMysqldump {
+			privileges = append(privileges, "PROCESS")
+		}
+	}
+	if config.MasterData != 0 || config.FlushLogs {
+		privileges = append(privileges, "RELOAD")
+	}
+	if config.MasterData != 0 {
+		privileges = append(privileges, "REPLICATION CLIENT")
+	}
+	if config.TabExport {
+		privileges = append(privileges, "FILE")
+	}
+	var unique []string
+	for _, privilege := range privileges {
+		if !slices.Contains(unique, privilege) {
+			unique = append(unique, privilege)
+		}
+	}
+	return unique
+}
+
+// grants are the privileges of the current user, by database pattern ("*"
+// for global ones).
+type grants map[string]map[string]bool
+
+// parseGrants reads the rows of SHOW GRANTS. Role grants are not expanded
+// and table and routine level grants are ignored, as the dump needs the
+// privileges for whole databases.
+func parseGrants(rows [][]string) grants {
+	g := grants{}
+	for _, row := range rows {
+		m := grantPattern.FindStringSubmatch(row[0])
+		if m == nil {
+			continue
+		}
+		db, table, ok := strings.Cut(m[2], ".")
+		if !ok || table != "*" {
+			continue
+		}
+		db = strings.Trim(db, "`")
+		if g[db] == nil {
+			g[db] = map[string]bool{}
+		}
+		for _, privilege := range strings.Split(m[1], ",") {
+			privilege = strings.TrimSpace(privilege)
+			if privilege == "ALL PRIVILEGES" {
+				privilege = "ALL"
+			}
+			g[db][privilege] = true
+		}
+	}
+	return g
+}
+
+// has reports whether privilege is granted on database, either globally or
+// through a database pattern.
+func (g grants) has(database, privilege string) bool {
+	for pattern, privileges := range g {
+		if !privileges[privilege] && !privileges["ALL"] {
+			continue
+		}
+		if pattern == "*" || matchesGrantPattern(pattern, database) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGrantPattern matches database against a grant's database name,
+// where % and _ are wildcards unless escaped with a backslash.
+func matchesGrantPattern(pattern, database string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	matched, err := regexp.MatchString(re.String(), database)
+	return err == nil && matched
+}
+
+// checkPrivileges fails when the MySQL user lacks a privilege the dump of
+// databases needs, listing every missing one, so the run stops before
+// spending time on dumps that would fail partway.
+func checkPrivileges(ctx context.Context, config Config, databases []string) error {
+	rows, err := queryMySQL(ctx, config, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return fmt.Errorf("failed to check privileges: %w", err)
+	}
+	if !config.SQLMetadataQueries {
+		// The mysql client escapes backslashes in batch output.
+		for _, row := range rows {
+			row[0] = strings.ReplaceAll(row[0], `\\`, `\`)
+		}
+	}
+	g := parseGrants(rows)
+
+	var missing []string
+	for _, privilege := range requiredGlobalPrivileges(config) {
+		if !hasGlobal(g, privilege) {
+			missing = append(missing, privilege+" ON *.*")
+		}
+	}
+	for _, db := range databases {
+		for _, privilege := range databasePrivileges {
+			if !g.has(db, privilege) {
+				missing = append(missing, privilege+" ON "+quoteIdentifier(db)+".*")
+			}
+		}
+	}
+	if config.DumpGrants && !g.has("mysql", "SELECT") {
+		missing = append(missing, "SELECT ON `mysql`.*")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing privileges for %s: %s", config.MySQLUser, strings.Join(missing, ", "))
+	}
+	config.logger().Printf("privileges of %s checked for %d databases", config.MySQLUser, len(databases))
+	return nil
+}
+
+// hasGlobal reports whether privilege is granted ON *.*.
+func hasGlobal(g grants, privilege string) bool {
+	return g["*"][privilege] || g["*"]["ALL"]
+}
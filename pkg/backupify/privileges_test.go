@@ -0,0 +1,143 @@
+package backupify
+
+import (
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequiredGlobalPrivileges(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"mysqldump", Config{}, []string{"PROCESS"}},
+		{"mariadb-dump", Config{DumpTool: DumpToolMariadbDump}, nil},
+		{"mydumper", Config{DumpTool: DumpToolMydumper}, []string{"RELOAD", "PROCESS"}},
+		{"mydumper with consistent snapshot", Config{DumpTool: DumpToolMydumper, ConsistentSnapshot: true}, []string{"RELOAD", "PROCESS"}},
+		{"parallel tables", Config{ParallelTables: 4}, []string{"PROCESS", "RELOAD"}},
+		{"mariadb-dump with consistent snapshot", Config{DumpTool: DumpToolMariadbDump, ConsistentSnapshot: true}, []string{"RELOAD", "PROCESS"}},
+		{"master data", Config{MasterData: 2}, []string{"PROCESS", "RELOAD", "REPLICATION CLIENT"}},
+		{"flush logs", Config{DumpTool: DumpToolMariadbDump, FlushLogs: true}, []string{"RELOAD"}},
+		{"tab export", Config{TabExport: true}, []string{"PROCESS", "FILE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requiredGlobalPrivileges(tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requiredGlobalPrivileges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrants(t *testing.T) {
+	g := parseGrants([][]string{
+		{"GRANT PROCESS, RELOAD ON *.* TO `backup`@`%`"},
+		{"GRANT SELECT, LOCK TABLES, SHOW VIEW, TRIGGER ON `shop`.* TO `backup`@`%`"},
+		{"GRANT ALL PRIVILEGES ON `crm\\_%`.* TO `backup`@`%`"},
+		{"GRANT SELECT ON `blog`.`posts` TO `backup`@`%`"},
+		{"GRANT `reporting`@`%` TO `backup`@`%`"},
+	})
+	tests := []struct {
+		database, privilege string
+		want                bool
+	}{
+		{"shop", "SELECT", true},
+		{"shop", "TRIGGER", true},
+		{"shop", "EVENT", false},
+		{"crm_eu", "SHOW VIEW", true},
+		{"crmXeu", "SELECT", false},
+		{"crm_", "SELECT", true},
+		{"blog", "SELECT", false},
+		{"other", "PROCESS", true},
+		{"other", "SELECT", false},
+	}
+	for _, tt := range tests {
+		if got := g.has(tt.database, tt.privilege); got != tt.want {
+			t.Errorf("has(%q, %q) = %v, want %v", tt.database, tt.privilege, got, tt.want)
+		}
+	}
+	if !hasGlobal(g, "RELOAD") || hasGlobal(g, "FILE") {
+		t.Errorf("hasGlobal() = %v, %v, want true, false", hasGlobal(g, "RELOAD"), hasGlobal(g, "FILE"))
+	}
+}
+
+func TestMatchesGrantPattern(t *testing.T) {
+	tests := []struct {
+		pattern, database string
+		want              bool
+	}{
+		{"shop", "shop", true},
+		{"shop", "shop2", false},
+		{"shop%", "shop_eu", true},
+		{"shop_", "shop1", true},
+		{"shop_", "shop", false},
+		{`shop\_eu`, "shop_eu", true},
+		{`shop\_eu`, "shopXeu", false},
+		{`shop\%`, "shop%", true},
+		{`shop\%`, "shop_eu", false},
+		{"sh.p", "shop", false},
+		{"%", "anything", true},
+	}
+	for _, tt := range tests {
+		if got := matchesGrantPattern(tt.pattern, tt.database); got != tt.want {
+			t.Errorf("matchesGrantPattern(%q, %q) = %v, want %v", tt.pattern, tt.database, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPrivileges(t *testing.T) {
+	tests := []struct {
+		name      string
+		grants    string
+		config    Config
+		databases []string
+		err       string
+	}{
+		{
+			name: "all granted",
+			grants: "GRANT PROCESS ON *.* TO `backup`@`%`\n" +
+				"GRANT SELECT, LOCK TABLES, SHOW VIEW, TRIGGER ON `shop\\\\_%`.* TO `backup`@`%`\n",
+			databases: []string{"shop_eu", "shop_us"},
+		},
+		{
+			name:      "all privileges",
+			grants:    "GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION\n",
+			config:    Config{DumpTool: DumpToolMydumper, MasterData: 1, DumpGrants: true},
+			databases: []string{"shop"},
+		},
+		{
+			name:   "escaped wildcard",
+			grants: "GRANT PROCESS ON *.* TO `backup`@`%`\nGRANT SELECT, LOCK TABLES, SHOW VIEW, TRIGGER ON `shop\\\\_eu`.* TO `backup`@`%`\n",
+			// The grant is for shop_eu only, not every shop?eu.
+			databases: []string{"shopXeu"},
+			err:       "SELECT ON `shopXeu`.*, LOCK TABLES ON `shopXeu`.*, SHOW VIEW ON `shopXeu`.*, TRIGGER ON `shopXeu`.*",
+		},
+		{
+			name:      "missing global and grants",
+			grants:    "GRANT SELECT, LOCK TABLES, SHOW VIEW, TRIGGER ON `shop`.* TO `backup`@`%`\n",
+			config:    Config{DumpTool: DumpToolMydumper, ConsistentSnapshot: true, DumpGrants: true},
+			databases: []string{"shop"},
+			err:       "missing privileges for backup: RELOAD ON *.*, PROCESS ON *.*, SELECT ON `mysql`.*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeMySQL(t, map[string]string{"SHOW GRANTS": tt.grants})
+			config := tt.config
+			config.MySQLUser = "backup"
+			config.Logger = log.New(io.Discard, "", 0)
+			err := checkPrivileges(context.Background(), config, tt.databases)
+			if tt.err == "" && err != nil {
+				t.Fatalf("checkPrivileges() = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("checkPrivileges() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
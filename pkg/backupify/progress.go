@@ -0,0 +1,65 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const progressInterval = time.Second
+
+// dumpEstimate returns the approximate data size and row count of database
+// from information_schema, which InnoDB only maintains roughly.
+func dumpEstimate(ctx context.Context, config Config, database string) (int64, int64, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT COALESCE(SUM(data_length), 0), COALESCE(SUM(table_rows), 0) FROM information_schema.tables WHERE table_schema = "+quoteString(database))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return 0, 0, fmt.Errorf("no result estimating size of %s", database)
+	}
+	size, _ := strconv.ParseInt(rows[0][0], 10, 64)
+	count, _ := strconv.ParseInt(rows[0][1], 10, 64)
+	return size, count, nil
+}
+
+// watchProgress reports to config.Progress how far the dump of database
+// into file has got, by comparing the file size with the estimated size of
+// the database, until the returned function is called.
+func watchProgress(ctx context.Context, config Config, database, file string) func() {
+	if config.Progress == nil {
+		return func() {}
+	}
+	estimate, rowCount, err := dumpEstimate(ctx, config, database)
+	if err != nil || estimate == 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				fmt.Fprintf(config.Progress, "\r%s: done%20s\n", database, "")
+				return
+			case <-ticker.C:
+				info, err := os.Stat(file)
+				if err != nil {
+					continue
+				}
+				percent := min(info.Size()*100/estimate, 99)
+				fmt.Fprintf(config.Progress, "\r%s: %d%% (%d MB of ~%d MB, ~%d rows)", database, percent, info.Size()>>20, estimate>>20, rowCount)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
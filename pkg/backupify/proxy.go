@@ -0,0 +1,64 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/jlaffaye/ftp"
+	"golang.org/x/net/proxy"
+)
+
+// dialFunc is the signature of ftp.DialWithDialFunc.
+type dialFunc func(network, address string) (net.Conn, error)
+
+// parseProxyURL checks that ProxyURL is a SOCKS5 URL with a host.
+func (c Config) parseProxyURL() (*url.URL, error) {
+	u, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	if (u.Scheme != "socks5" && u.Scheme != "socks5h") || u.Host == "" {
+		return nil, fmt.Errorf("proxy_url must be socks5://host:port, got %q", c.ProxyURL)
+	}
+	return u, nil
+}
+
+// ftpDialFunc returns the function FTP connections are dialed with: directly,
+// or through ProxyURL when set.
+func ftpDialFunc(ctx context.Context, config Config) (dialFunc, error) {
+	direct := &net.Dialer{Timeout: ftp.DefaultDialTimeout}
+	if config.ProxyURL == "" {
+		return func(network, address string) (net.Conn, error) {
+			return direct.DialContext(ctx, network, address)
+		}, nil
+	}
+	u, err := config.parseProxyURL()
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := proxy.FromURL(u, direct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up proxy: %w", err)
+	}
+	return func(network, address string) (net.Conn, error) {
+		if d, ok := dialer.(proxy.ContextDialer); ok {
+			return d.DialContext(ctx, network, address)
+		}
+		return dialer.Dial(network, address)
+	}, nil
+}
+
+// sshProxyArgs returns the ssh options that connect through ProxyURL with
+// the OpenBSD netcat.
+func sshProxyArgs(config Config) []string {
+	if config.ProxyURL == "" {
+		return nil
+	}
+	u, err := config.parseProxyURL()
+	if err != nil {
+		return nil
+	}
+	return []string{"-o", "ProxyCommand=nc -X 5 -x " + u.Host + " %h %p"}
+}
@@ -0,0 +1,143 @@
+package backupify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RekeyOptions configures RekeyArchive.
+type RekeyOptions struct {
+	// DecryptCommand decrypts stdin to stdout with the old key.
+	DecryptCommand string
+	// EncryptCommand encrypts stdin to stdout with the new key, like
+	// Config.EncryptCommand.
+	EncryptCommand string
+	// VerifyCommand decrypts stdin to stdout with the new key. The
+	// re-encrypted archive is decrypted with it and compared with the
+	// original before it is kept.
+	VerifyCommand string
+	// OutputDir is where the re-encrypted archive is written. Empty
+	// replaces the archive in place.
+	OutputDir string
+	// SigningKeyPath re-signs archives that have a .sig sidecar, whose
+	// signature no longer matches once the archive changes.
+	SigningKeyPath string
+}
+
+// RekeyArchive re-encrypts a compress-then-encrypt archive with a new key
+// without dumping again, and returns the path of the new archive. Its
+// .sha256 and .sig sidecars are written again when the archive had them.
+func RekeyArchive(archivePath string, opts RekeyOptions) (string, error) {
+	blank := func(command string) bool { return len(strings.Fields(command)) == 0 }
+	if blank(opts.DecryptCommand) || blank(opts.EncryptCommand) || blank(opts.VerifyCommand) {
+		return "", errors.New("rekey needs a decrypt, encrypt and verify command")
+	}
+	if !strings.HasSuffix(archivePath, ".enc") {
+		return "", fmt.Errorf("%s is not a compress-then-encrypt archive", archivePath)
+	}
+	_, err := os.Stat(archivePath + signatureSuffix)
+	signed := err == nil
+	if signed && opts.SigningKeyPath == "" {
+		return "", fmt.Errorf("%s is signed, a signing key is needed to sign it again", archivePath)
+	}
+	_, err = os.Stat(archivePath + checksumSuffix)
+	checksummed := err == nil
+
+	dir := opts.OutputDir
+	if dir == "" {
+		dir = filepath.Dir(archivePath)
+	}
+	target := filepath.Join(dir, filepath.Base(archivePath))
+	tmp, err := os.CreateTemp(dir, filepath.Base(archivePath)+".rekey.*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create re-encrypted archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	src, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer src.Close()
+
+	// The plaintext is hashed on its way from the old key to the new one,
+	// so the verification doesn't need to decrypt the original again.
+	plain := sha256.New()
+	pr, pw := io.Pipe()
+	encrypted := make(chan error, 1)
+	go func() {
+		err := runFilter(opts.EncryptCommand, pr, tmp)
+		pr.CloseWithError(err)
+		encrypted <- err
+	}()
+	err = runFilter(opts.DecryptCommand, src, io.MultiWriter(plain, pw))
+	pw.CloseWithError(err)
+	// A failed encryption also breaks the decryption's output, so it is
+	// checked first.
+	if encryptErr := <-encrypted; encryptErr != nil {
+		return "", fmt.Errorf("failed to encrypt archive: %w", encryptErr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt archive: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write re-encrypted archive: %w", err)
+	}
+
+	check, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to open re-encrypted archive: %w", err)
+	}
+	defer check.Close()
+	verified := sha256.New()
+	err = runFilter(opts.VerifyCommand, check, verified)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt re-encrypted archive: %w", err)
+	}
+	if !bytes.Equal(plain.Sum(nil), verified.Sum(nil)) {
+		return "", errors.New("re-encrypted archive doesn't decrypt to the original")
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to replace archive: %w", err)
+	}
+	if checksummed {
+		if _, err := writeChecksum(target); err != nil {
+			return target, err
+		}
+	}
+	if signed {
+		if err := signArchive(target, opts.SigningKeyPath); err != nil {
+			return target, err
+		}
+	}
+	return target, nil
+}
+
+// runFilter runs command with in as stdin and out as stdout.
+func runFilter(command string, in io.Reader, out io.Writer) error {
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
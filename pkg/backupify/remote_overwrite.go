@@ -0,0 +1,130 @@
+package backupify
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Supported values of Config.RemoteOverwritePolicy.
+const (
+	OverwriteFail      = "fail"
+	OverwriteReplace   = "overwrite"
+	OverwriteSkip      = "skip"
+	OverwriteRename    = "rename"
+	maxOverwriteRename = 100
+)
+
+func (c Config) overwritePolicy() string {
+	if c.RemoteOverwritePolicy == "" {
+		return OverwriteFail
+	}
+	return c.RemoteOverwritePolicy
+}
+
+func (c Config) validateOverwritePolicy() error {
+	switch c.overwritePolicy() {
+	case OverwriteFail, OverwriteReplace, OverwriteSkip, OverwriteRename:
+		return nil
+	}
+	return fmt.Errorf("remote_overwrite_policy must be fail, overwrite, skip or rename, got %q", c.RemoteOverwritePolicy)
+}
+
+// remoteName returns the name to upload name under in dir according to
+// the overwrite policy, and whether the upload should be skipped because
+// the file is already there. When retrying an upload, as -only-upload and
+// DrainSpool do, a remote file of the local size (any size when size is
+// negative) is taken to be the one an earlier attempt uploaded, so a
+// destination that took the file doesn't fail the retry.
+func remoteName(config Config, conn *ftpConn, dir, name string, size int64) (string, bool, error) {
+	policy := config.overwritePolicy()
+	if policy == OverwriteReplace && !config.retryUpload {
+		return name, false, nil
+	}
+	remoteSize, exists, err := remoteFileSize(conn, dir, name)
+	if err != nil {
+		return "", false, err
+	}
+	if !exists {
+		return name, false, nil
+	}
+	remotePath := path.Join(dir, name)
+	if config.retryUpload && (size < 0 || remoteSize == size) {
+		config.logger().Printf("%s was already uploaded, skipping the upload", remotePath)
+		return name, true, nil
+	}
+	switch policy {
+	case OverwriteReplace:
+		return name, false, nil
+	case OverwriteSkip:
+		config.logger().Printf("%s already exists, skipping the upload", remotePath)
+		return name, true, nil
+	case OverwriteRename:
+		stem, ext := splitBackupName(name)
+		for i := 1; i <= maxOverwriteRename; i++ {
+			renamed := stem + "-" + strconv.Itoa(i) + ext
+			_, exists, err := remoteFileSize(conn, dir, renamed)
+			if err != nil {
+				return "", false, err
+			}
+			if !exists {
+				config.logger().Printf("%s already exists, uploading as %s", remotePath, renamed)
+				return renamed, false, nil
+			}
+		}
+		return "", false, fmt.Errorf("%s and %d renamed copies already exist on the server", remotePath, maxOverwriteRename)
+	}
+	return "", false, fmt.Errorf("%s already exists on the server, see remote_overwrite_policy", remotePath)
+}
+
+// remoteFileSize returns the size of the file name in dir and whether it
+// exists. SIZE is tried first; the directory listing is only used when the
+// server doesn't implement SIZE, not when SIZE fails for the file.
+func remoteFileSize(conn *ftpConn, dir, name string) (int64, bool, error) {
+	size, err := conn.FileSize(path.Join(dir, name))
+	if err == nil {
+		return size, true, nil
+	}
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return 0, false, fmt.Errorf("failed to check for %s: %w", path.Join(dir, name), err)
+	}
+	if !sizeUnsupported(reply.Code) {
+		// 550 and the like: the file isn't there.
+		return 0, false, nil
+	}
+	entries, err := conn.List(dir)
+	if err != nil {
+		// A directory that can't be listed doesn't exist yet.
+		return 0, false, nil
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return int64(entry.Size), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// sizeUnsupported reports whether a SIZE reply code means the server
+// doesn't know the command.
+func sizeUnsupported(code int) bool {
+	return code == ftp.StatusBadCommand || code == ftp.StatusNotImplemented || code == ftp.StatusNotImplementedParameter
+}
+
+// splitBackupName splits name before its archive or dump suffix, so a
+// renamed copy keeps the suffix retention recognizes.
+func splitBackupName(name string) (string, string) {
+	for _, suffix := range []string{".tar", ".sql"} {
+		if i := strings.Index(name, suffix); i > 0 {
+			return name[:i], name[i:]
+		}
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
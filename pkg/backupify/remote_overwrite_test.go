@@ -0,0 +1,86 @@
+package backupify
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/jlaffaye/ftp"
+)
+
+func TestRemoteName(t *testing.T) {
+	const name = "backup_20240102_030405.tar.gz"
+	existing := map[string]int64{"backups/" + name: 100}
+	tests := []struct {
+		name     string
+		policy   string
+		retry    bool
+		files    map[string]int64
+		sizeCode int
+		size     int64
+		want     string
+		skip     bool
+		err      string
+	}{
+		{name: "new file", files: map[string]int64{}, size: 100, want: name},
+		{name: "fail", files: existing, size: 100, err: "already exists on the server"},
+		{name: "overwrite", policy: OverwriteReplace, files: existing, size: 100, want: name},
+		{name: "skip", policy: OverwriteSkip, files: existing, size: 50, want: name, skip: true},
+		{
+			name:   "rename",
+			policy: OverwriteRename,
+			files:  map[string]int64{"backups/" + name: 100, "backups/backup_20240102_030405-1.tar.gz": 100},
+			size:   100,
+			want:   "backup_20240102_030405-2.tar.gz",
+		},
+		{name: "retry of an uploaded file", retry: true, files: existing, size: 100, want: name, skip: true},
+		{name: "retry of any size", retry: true, files: existing, size: -1, want: name, skip: true},
+		{name: "retry of a different file", retry: true, files: existing, size: 50, err: "already exists on the server"},
+		{name: "retry with overwrite", policy: OverwriteReplace, retry: true, files: existing, size: 50, want: name},
+		{name: "retry of a new file", retry: true, files: map[string]int64{}, size: 100, want: name},
+		{name: "size unsupported, listed", sizeCode: ftp.StatusNotImplemented, files: existing, size: 100, err: "already exists on the server"},
+		{name: "size unsupported, retry", sizeCode: ftp.StatusBadCommand, retry: true, files: existing, size: 100, want: name, skip: true},
+		{name: "size unsupported, not listed", sizeCode: ftp.StatusNotImplemented, files: map[string]int64{"backups/other.tar.gz": 1}, size: 100, want: name},
+		{name: "size fails for the file", sizeCode: ftp.StatusFileUnavailable, files: existing, size: 100, want: name},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeFTPServer(t, tt.files)
+			server.sizeCode = tt.sizeCode
+			config := Config{RemoteOverwritePolicy: tt.policy, Logger: log.New(io.Discard, "", 0), retryUpload: tt.retry}
+			got, skip, err := remoteName(config, server.dial(t), "backups", name, tt.size)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("remoteName() = %q, %v, %v, want an error containing %q", got, skip, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want || skip != tt.skip {
+				t.Fatalf("remoteName() = %q, %v, %v, want %q, %v", got, skip, err, tt.want, tt.skip)
+			}
+			listed := len(server.received("LIST")) > 0
+			if wantList := sizeUnsupported(tt.sizeCode); listed != wantList {
+				t.Errorf("listed the directory: %v, want %v", listed, wantList)
+			}
+		})
+	}
+}
+
+func TestSplitBackupName(t *testing.T) {
+	tests := []struct {
+		name, stem, ext string
+	}{
+		{"backup_20240102_030405.tar.gz", "backup_20240102_030405", ".tar.gz"},
+		{"backup_shop_20240102_030405.tar.zst.enc", "backup_shop_20240102_030405", ".tar.zst.enc"},
+		{"shop_20240102_030405.sql.gz", "shop_20240102_030405", ".sql.gz"},
+		{"catalog.jsonl", "catalog", ".jsonl"},
+		{"README", "README", ""},
+	}
+	for _, tt := range tests {
+		stem, ext := splitBackupName(tt.name)
+		if stem != tt.stem || ext != tt.ext {
+			t.Errorf("splitBackupName(%q) = %q, %q, want %q, %q", tt.name, stem, ext, tt.stem, tt.ext)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package backupify
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// renderRemoteDirectory expands the date placeholders {year}, {month},
+// {day}, {hour}, {minute} and {weekday} (mon to sun) in dir using t.
+func renderRemoteDirectory(dir string, t time.Time) string {
+	return strings.NewReplacer(
+		"{year}", t.Format("2006"),
+		"{month}", t.Format("01"),
+		"{day}", t.Format("02"),
+		"{hour}", t.Format("15"),
+		"{minute}", t.Format("04"),
+		"{weekday}", strings.ToLower(t.Format("Mon")),
+	).Replace(dir)
+}
+
+// weekdayDirectory is appended to the directory of every destination with
+// WeekdayDirectories.
+const weekdayDirectory = "{weekday}"
+
+func renderDestinations(dests []Destination, t time.Time) []Destination {
+	rendered := make([]Destination, len(dests))
+	for i, dest := range dests {
+		dest.Directory = renderRemoteDirectory(dest.Directory, t)
+		dest.failover = renderDestinations(dest.failover, t)
+		rendered[i] = dest
+	}
+	return rendered
+}
+
+// ensureRemoteDir makes sure dir exists on the server, creating it and any
+// missing parents. A MakeDir that fails because another client created the
+// directory in the meantime is not an error. The working directory is
+// restored afterwards so relative paths keep working.
+func ensureRemoteDir(conn *ftpConn, dir string) error {
+	if dir == "" || dir == "." || dir == "/" {
+		return nil
+	}
+	home, err := conn.CurrentDir()
+	if err != nil {
+		return fmt.Errorf("failed to get remote working directory: %w", err)
+	}
+	defer conn.ChangeDir(home)
+
+	if !path.IsAbs(dir) {
+		dir = path.Join(home, dir)
+	}
+	if conn.ChangeDir(dir) == nil {
+		return nil
+	}
+
+	current := "/"
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current = path.Join(current, part)
+		if conn.ChangeDir(current) == nil {
+			continue
+		}
+		err := conn.MakeDir(current)
+		if err != nil && conn.ChangeDir(current) != nil {
+			return fmt.Errorf("failed to create remote directory %s: %w", current, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package backupify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveNamePattern matches backup_<timestamp>.tar.gz and
+// backup_<database>_<timestamp>.tar.gz, or .tar.zst, .tar.br or .tar, with an
+// optional -<app version> and +<environment> after the timestamp and .enc
+// for encrypted archives in either pipeline order.
+var archiveNamePattern = regexp.MustCompile(`^backup_(?:(.+)_)?(\d{8}_\d{6})(?:-[A-Za-z0-9._-]+?)?(?:\+[A-Za-z0-9._-]+)?\.tar(?:\.enc)?(?:\.gz|\.zst|\.br)?(?:\.enc)?$`)
+
+// BackupArchive is an archive found in a backup directory, with the time
+// parsed from its name.
+type BackupArchive struct {
+	Name     string
+	Database string
+	Created  time.Time
+}
+
+// parseArchiveName parses the timestamp embedded in an archive name. It
+// reports false for files that are not backup archives.
+func parseArchiveName(name string) (BackupArchive, bool) {
+	match := archiveNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return BackupArchive{}, false
+	}
+	created, err := time.ParseInLocation("20060102_150405", match[2], time.Local)
+	if err != nil {
+		return BackupArchive{}, false
+	}
+	return BackupArchive{Name: name, Database: match[1], Created: created}, true
+}
+
+func sortedArchives(names []string) []BackupArchive {
+	var archives []BackupArchive
+	for _, name := range names {
+		archive, ok := parseArchiveName(name)
+		if ok {
+			archives = append(archives, archive)
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Created.Before(archives[j].Created)
+	})
+	return archives
+}
+
+// ListLocalArchives returns the archives in dir, oldest first.
+func ListLocalArchives(dir string) ([]BackupArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return sortedArchives(names), nil
+}
+
+// findDestination returns the FTP destination called name.
+func (c Config) findDestination(name string) (Destination, error) {
+	for _, dest := range expandFailover(c.destinations()) {
+		if dest.Name != name {
+			continue
+		}
+		if !dest.isFTP() {
+			return dest, fmt.Errorf("destination %s: listing %s destinations is not supported", name, dest.Type)
+		}
+		if dest.Directory != renderRemoteDirectory(dest.Directory, time.Time{}) {
+			return dest, fmt.Errorf("destination %s: listing a date-partitioned directory is not supported", name)
+		}
+		return dest, nil
+	}
+	return Destination{}, fmt.Errorf("unknown destination %q", name)
+}
+
+// ListRemoteArchives returns the archives in the directory of the FTP
+// destination called name, oldest first.
+func ListRemoteArchives(ctx context.Context, config Config, name string) ([]BackupArchive, error) {
+	dest, err := config.findDestination(name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Quit()
+
+	dir := dest.Directory
+	if dir == "" {
+		dir = "."
+	}
+	paths, err := conn.NameList(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote directory: %w", err)
+	}
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		// Files uploaded in parts are listed by their parts manifest.
+		names[i] = strings.TrimSuffix(path.Base(p), partsSuffix)
+	}
+	return sortedArchives(names), nil
+}
+
+// DownloadArchive fetches archive name from the FTP destination called
+// destName into localDir and returns the local path. An archive uploaded
+// in parts is put back together.
+func DownloadArchive(ctx context.Context, config Config, destName, name, localDir string) (string, error) {
+	dest, err := config.findDestination(destName)
+	if err != nil {
+		return "", err
+	}
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	localPath := filepath.Join(localDir, name)
+	file, err := os.Create(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create local archive: %w", err)
+	}
+	defer file.Close()
+
+	_, parts, err := remoteFileSize(conn, dest.Directory, name+partsSuffix)
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+	if parts {
+		err = retrParts(conn, dest.Directory, name, file)
+	} else {
+		err = retrFile(conn, path.Join(dest.Directory, name), file)
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return "", fmt.Errorf("failed to download archive: %w", err)
+	}
+	return localPath, file.Close()
+}
+
+func retrFile(conn *ftpConn, remotePath string, w io.Writer) error {
+	response, err := conn.Retr(remotePath)
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+	_, err = io.Copy(w, response)
+	return err
+}
+
+// SelectArchive returns the newest archive created strictly before before,
+// or the newest archive overall when before is zero. archives must be
+// sorted oldest first.
+func SelectArchive(archives []BackupArchive, before time.Time) (BackupArchive, error) {
+	for i := len(archives) - 1; i >= 0; i-- {
+		if before.IsZero() || archives[i].Created.Before(before) {
+			return archives[i], nil
+		}
+	}
+	if before.IsZero() {
+		return BackupArchive{}, errors.New("no backup archives found")
+	}
+	return BackupArchive{}, fmt.Errorf("no backup archive older than %s", before.Format(time.RFC3339))
+}
+
+// RestoreOptions configures RestoreArchive.
+type RestoreOptions struct {
+	// OnlyDatabase restores just this database. Dumps of other databases
+	// are searched for sections mysqldump marked with USE `<database>`,
+	// so a single database can be taken out of a multi-database dump too.
+	// grants.sql is skipped.
+	OnlyDatabase string
+	// AllowVersionMismatch restores a dump made on a newer release series
+	// than the target server's, or on MariaDB into MySQL and the other way
+	// around, with a warning instead of failing. Needs the archive's
+	// metadata.json.
+	AllowVersionMismatch bool
+}
+
+// RestoreArchive loads every <database>.sql dump in an archive into
+// the database of the same name, creating it if needed. <database>.views.sql
+// dumps are loaded like the others; they come last in the archive. A
+// grants.sql is run without a default database. mydumper output is loaded
+// with myloader once the whole archive has been read. A single .sql or
+// .sql.gz dump is loaded with restoreDump. Encrypted archives are
+// decrypted with DecryptCommand first.
+func RestoreArchive(ctx context.Context, config Config, archivePath string, opts RestoreOptions) error {
+	if strings.HasSuffix(archivePath, ".sql") || strings.HasSuffix(archivePath, ".sql.gz") {
+		return restoreDump(ctx, config, archivePath, opts)
+	}
+	if isEncryptedArchive(archivePath) {
+		plainPath, err := decryptArchive(config, archivePath)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(plainPath))
+		archivePath = plainPath
+	}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	tarStream, err := decompressArchive(file, archivePath, config.ZstdDictionaryPath)
+	if err != nil {
+		return err
+	}
+	defer tarStream.Close()
+
+	logger := config.logger()
+	var myloader myloaderRestore
+	defer myloader.cleanup()
+	prefix := config.archivePrefixPattern()
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return myloader.load(ctx, config, opts.OnlyDatabase)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		header.Name = trimArchivePrefix(prefix, header.Name)
+		if header.Name == metadataName {
+			var meta Metadata
+			if err := json.NewDecoder(tarReader).Decode(&meta); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", metadataName, err)
+			}
+			if err := checkRestoreVersion(ctx, config, meta.ServerVersion, opts.AllowVersionMismatch); err != nil {
+				return err
+			}
+			continue
+		}
+		if ok, err := myloader.add(header.Name, tarReader); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if db, ok := incrementalDatabase(header.Name); ok {
+			if opts.OnlyDatabase != "" && db != opts.OnlyDatabase {
+				continue
+			}
+			logger.Printf("restoring %s", header.Name)
+			_, err = queryMySQL(ctx, config, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(db))
+			if err != nil {
+				return fmt.Errorf("failed to create database %s: %w", db, err)
+			}
+			err = restoreStream(ctx, config, db, tarReader)
+			if err != nil {
+				return fmt.Errorf("%s: %w", header.Name, err)
+			}
+			continue
+		}
+		if strings.Contains(header.Name, "/") || !strings.HasSuffix(header.Name, ".sql") {
+			continue
+		}
+		if header.Name == grantsName && opts.OnlyDatabase != "" {
+			continue
+		}
+		if header.Name == grantsName {
+			logger.Printf("restoring users and grants")
+			err = restoreStream(ctx, config, "", tarReader)
+			if err != nil {
+				return fmt.Errorf("%s: %w", grantsName, err)
+			}
+			continue
+		}
+
+		db := strings.TrimSuffix(strings.TrimSuffix(header.Name, ".sql"), viewsSuffix)
+		if opts.OnlyDatabase != "" && db != opts.OnlyDatabase {
+			err = restoreOnly(ctx, config, opts.OnlyDatabase, db, tarReader)
+			if err != nil {
+				return fmt.Errorf("%s from %s: %w", opts.OnlyDatabase, header.Name, err)
+			}
+			continue
+		}
+		logger.Printf("restoring database %s", db)
+		_, err = queryMySQL(ctx, config, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(db))
+		if err != nil {
+			return fmt.Errorf("failed to create database %s: %w", db, err)
+		}
+		if opts.OnlyDatabase != "" {
+			err = restoreOnly(ctx, config, db, db, tarReader)
+		} else {
+			err = restoreStream(ctx, config, db, tarReader)
+		}
+		if err != nil {
+			return fmt.Errorf("database %s: %w", db, err)
+		}
+	}
+}
+
+// restoreDump loads a <database>_<timestamp>.sql or .sql.gz dump, uploaded
+// on its own with "archive": false, into the database in its name.
+func restoreDump(ctx context.Context, config Config, dumpPath string, opts RestoreOptions) error {
+	name := filepath.Base(dumpPath)
+	if isViewsDump(name) {
+		i := strings.LastIndex(name, viewsSuffix+".sql")
+		name = name[:i] + name[i+len(viewsSuffix):]
+	}
+	m := retainedNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return fmt.Errorf("%s is not a database dump", dumpPath)
+	}
+	db := strings.TrimSuffix(m[1], "_")
+	if opts.OnlyDatabase != "" && opts.OnlyDatabase != db {
+		return fmt.Errorf("%s is a dump of %s, not %s", dumpPath, db, opts.OnlyDatabase)
+	}
+
+	file, err := os.Open(dumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dump: %w", err)
+	}
+	defer file.Close()
+	var input io.Reader = file
+	if strings.HasSuffix(dumpPath, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read dump: %w", err)
+		}
+		defer gzReader.Close()
+		input = gzReader
+	}
+
+	config.logger().Printf("restoring database %s", db)
+	_, err = queryMySQL(ctx, config, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(db))
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", db, err)
+	}
+	err = restoreStream(ctx, config, db, input)
+	if err != nil {
+		return fmt.Errorf("database %s: %w", db, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package backupify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+)
+
+// Markers mysqldump writes when a dump covers several databases
+// (--databases or --all-databases).
+const (
+	currentDatabaseMarker = "-- Current Database: `"
+	useMarker             = "USE `"
+)
+
+// markedDatabase returns the database a marker line switches to.
+func markedDatabase(line string) (string, bool) {
+	var rest string
+	switch {
+	case strings.HasPrefix(line, currentDatabaseMarker):
+		rest = line[len(currentDatabaseMarker):]
+	case strings.HasPrefix(line, useMarker):
+		rest = line[len(useMarker):]
+	default:
+		return "", false
+	}
+	// Backticks inside the name are doubled.
+	var name strings.Builder
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != '`' {
+			name.WriteByte(rest[i])
+			continue
+		}
+		if i+1 < len(rest) && rest[i+1] == '`' {
+			name.WriteByte('`')
+			i++
+			continue
+		}
+		return name.String(), true
+	}
+	return "", false
+}
+
+// filterDatabase copies the statements of database from a dump of current
+// to w, skipping the sections mysqldump marked as belonging to other
+// databases. The comments and SET statements before the first marker of a
+// dump of another database are held back and written before the first
+// statement of database, as they set up the session.
+func filterDatabase(r io.Reader, w io.Writer, database, current string) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var preamble bytes.Buffer
+	keeping := current == database
+	inPreamble := !keeping
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if name, ok := markedDatabase(string(line)); ok {
+				keeping, inPreamble = name == database, false
+			}
+			switch {
+			case keeping:
+				if preamble.Len() > 0 {
+					if _, werr := preamble.WriteTo(w); werr != nil {
+						return werr
+					}
+				}
+				if _, werr := w.Write(line); werr != nil {
+					return werr
+				}
+			case inPreamble && isPreamble(line):
+				preamble.Write(line)
+			default:
+				inPreamble = false
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isPreamble reports whether line belongs to the header mysqldump writes
+// before the first statement.
+func isPreamble(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return len(line) == 0 || bytes.HasPrefix(line, []byte("--")) || bytes.HasPrefix(line, []byte("/*!"))
+}
+
+// restoreOnly restores the statements of database found in a dump of
+// current, running mysql only when there are any.
+func restoreOnly(ctx context.Context, config Config, database, current string, input io.Reader) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(filterDatabase(input, pw, database, current))
+	}()
+	defer pr.Close()
+
+	filtered := bufio.NewReader(pr)
+	_, err := filtered.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != database {
+		current = ""
+	}
+	return restoreStream(ctx, config, current, filtered)
+}
@@ -0,0 +1,94 @@
+package backupify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkedDatabase(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		ok   bool
+	}{
+		{"-- Current Database: `shop`\n", "shop", true},
+		{"USE `shop`;\n", "shop", true},
+		{"USE `we``ird`;\n", "we`ird", true},
+		{"USE `unterminated\n", "", false},
+		{"INSERT INTO `shop` VALUES (1);\n", "", false},
+		{"-- Current Database: shop\n", "", false},
+	}
+	for _, tt := range tests {
+		name, ok := markedDatabase(tt.line)
+		if name != tt.name || ok != tt.ok {
+			t.Errorf("markedDatabase(%q) = %q, %v, want %q, %v", tt.line, name, ok, tt.name, tt.ok)
+		}
+	}
+}
+
+func TestFilterDatabase(t *testing.T) {
+	const header = "-- MySQL dump 10.13\n/*!40101 SET NAMES utf8mb4 */;\n\n"
+	const multi = header +
+		"-- Current Database: `shop`\nUSE `shop`;\nINSERT INTO `orders` VALUES (1);\n" +
+		"-- Current Database: `crm`\nUSE `crm`;\nINSERT INTO `contacts` VALUES (2);\n" +
+		"-- Current Database: `shop`\nUSE `shop`;\nINSERT INTO `orders` VALUES (3);\n"
+	tests := []struct {
+		name     string
+		dump     string
+		database string
+		current  string
+		want     string
+	}{
+		{
+			name:     "sections of the database with the header",
+			dump:     multi,
+			database: "shop",
+			want: header +
+				"-- Current Database: `shop`\nUSE `shop`;\nINSERT INTO `orders` VALUES (1);\n" +
+				"-- Current Database: `shop`\nUSE `shop`;\nINSERT INTO `orders` VALUES (3);\n",
+		},
+		{
+			name:     "another database",
+			dump:     multi,
+			database: "crm",
+			want:     header + "-- Current Database: `crm`\nUSE `crm`;\nINSERT INTO `contacts` VALUES (2);\n",
+		},
+		{
+			name:     "missing database",
+			dump:     multi,
+			database: "blog",
+			want:     "",
+		},
+		{
+			name:     "dump of the database without markers",
+			dump:     header + "INSERT INTO `orders` VALUES (1);\n",
+			database: "shop",
+			current:  "shop",
+			want:     header + "INSERT INTO `orders` VALUES (1);\n",
+		},
+		{
+			name:     "dump of another database without markers",
+			dump:     header + "INSERT INTO `orders` VALUES (1);\n",
+			database: "shop",
+			current:  "crm",
+			want:     "",
+		},
+		{
+			name:     "no trailing newline",
+			dump:     "USE `shop`;\nINSERT INTO `orders` VALUES (1);",
+			database: "shop",
+			want:     "USE `shop`;\nINSERT INTO `orders` VALUES (1);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := filterDatabase(strings.NewReader(tt.dump), &out, tt.database, tt.current); err != nil {
+				t.Fatalf("filterDatabase() = %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("filterDatabase():\ngot  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
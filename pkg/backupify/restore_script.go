@@ -0,0 +1,106 @@
+package backupify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const restoreScriptName = "restore.sh"
+
+// restoreScriptHeader loads the connection settings from the environment,
+// so the script never contains credentials.
+const restoreScriptHeader = `#!/bin/sh
+# Restores the databases in this archive, made by backupify-mysql on %s.
+#
+# Extract the archive, then run for example:
+#   MYSQL_HOST=db.example.com MYSQL_USER=root MYSQL_PWD=secret sh restore.sh
+# MYSQL_HOST defaults to localhost, MYSQL_PORT to 3306 and MYSQL_USER to root.
+#
+# The tables of every database are loaded before any views, which may select
+# from other databases, and users and grants go last, once the objects they
+# refer to exist. Tables that already exist are replaced by the dumps.
+set -eu
+cd "$(dirname "$0")"
+: "${MYSQL_HOST:=localhost}" "${MYSQL_PORT:=3306}" "${MYSQL_USER:=root}"
+mysql_cmd() { mysql -h "$MYSQL_HOST" -P "$MYSQL_PORT" -u "$MYSQL_USER" "$@"; }
+`
+
+// withRestoreScript adds restore.sh, the shell commands that load the
+// dumps in entries, with RestoreScript.
+func (r *run) withRestoreScript(entries []archiveEntry) []archiveEntry {
+	if !r.cfg.RestoreScript {
+		return entries
+	}
+	script := restoreScript(r.cfg, r.started, entries)
+	return append(entries, archiveEntry{name: restoreScriptName, data: []byte(script), mode: 0755})
+}
+
+func restoreScript(config Config, created time.Time, entries []archiveEntry) string {
+	var names []string
+	for _, entry := range entries {
+		if entry.segment != nil {
+			for _, dump := range entry.segment.entries {
+				names = append(names, dump.name)
+			}
+			continue
+		}
+		names = append(names, entry.name)
+	}
+
+	var tables, views, grants []string
+	seen := map[string]bool{}
+	createDatabase := func(db string) {
+		if !seen[db] {
+			seen[db] = true
+			tables = append(tables, "", "echo "+shellQuote("restoring database "+db),
+				"mysql_cmd -e "+shellQuote("CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(db)))
+		}
+	}
+	prefix := config.archivePrefixPattern()
+	for _, name := range names {
+		base := trimArchivePrefix(prefix, name)
+		if db, ok := incrementalDatabase(base); ok {
+			createDatabase(db)
+			tables = append(tables, "mysql_cmd "+shellQuote(db)+" < "+shellQuote(name))
+			continue
+		}
+		switch {
+		case base == grantsName:
+			grants = append(grants, "", "echo 'restoring users and grants'", "mysql_cmd < "+shellQuote(name))
+		case strings.HasPrefix(base, mydumperPrefix):
+			db, _, _ := strings.Cut(strings.TrimPrefix(base, mydumperPrefix), "/")
+			if !seen[db] {
+				seen[db] = true
+				dir := strings.TrimSuffix(name, strings.TrimPrefix(base, mydumperPrefix+db))
+				tables = append(tables, "", "echo "+shellQuote("restoring database "+db+" with myloader"),
+					`myloader -h "$MYSQL_HOST" -P "$MYSQL_PORT" -u "$MYSQL_USER" --password="${MYSQL_PWD:-}" --directory=`+shellQuote(strings.TrimSuffix(dir, "/"))+" --database="+shellQuote(db)+" --overwrite-tables")
+			}
+		case strings.Contains(base, "/"):
+			// mysqldump --tab output: a schema .sql and a data .txt per
+			// table, which sort in that order.
+			db, _, _ := strings.Cut(base, "/")
+			if strings.HasSuffix(base, ".sql") {
+				createDatabase(db)
+				tables = append(tables, "mysql_cmd "+shellQuote(db)+" < "+shellQuote(name))
+			} else if strings.HasSuffix(base, ".txt") {
+				tables = append(tables, `mysqlimport --local -h "$MYSQL_HOST" -P "$MYSQL_PORT" -u "$MYSQL_USER" `+shellQuote(db)+" "+shellQuote(name))
+			}
+		case isViewsDump(base):
+			db := strings.TrimSuffix(base, viewsSuffix+".sql")
+			views = append(views, "", "echo "+shellQuote("restoring views of "+db), "mysql_cmd "+shellQuote(db)+" < "+shellQuote(name))
+		case strings.HasSuffix(base, ".sql"):
+			db := strings.TrimSuffix(base, ".sql")
+			createDatabase(db)
+			tables = append(tables, "mysql_cmd "+shellQuote(db)+" < "+shellQuote(name))
+		}
+	}
+
+	var script strings.Builder
+	fmt.Fprintf(&script, restoreScriptHeader, created.Format(time.RFC3339))
+	for _, line := range append(append(tables, views...), grants...) {
+		script.WriteString(line + "\n")
+	}
+	script.WriteString("\necho 'restore finished'\n")
+	return script.String()
+}
@@ -0,0 +1,65 @@
+package backupify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseArchiveName(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		created  string
+		ok       bool
+	}{
+		{name: "backup_20240102_030405.tar.gz", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.zst", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.br", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.gz.enc", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.enc.gz", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405-1.4.0.tar.gz", created: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405+prod.tar.gz", created: "20240102_030405", ok: true},
+		{name: "backup_shop_20240102_030405-1.4.0+staging.tar.zst", database: "shop", created: "20240102_030405", ok: true},
+		{name: "backup_shop_20240102_030405.tar.gz", database: "shop", created: "20240102_030405", ok: true},
+		{name: "backup_my_shop_20240102_030405.tar.gz", database: "my_shop", created: "20240102_030405", ok: true},
+		{name: "backup_20241302_030405.tar.gz"},
+		{name: "backup_20240102_030405.tar.gz.sha256"},
+		{name: "backup_20240102_030405.zip"},
+		{name: "shop_20240102_030405.sql.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, ok := parseArchiveName(tt.name)
+			if ok != tt.ok {
+				t.Fatalf("parseArchiveName() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			created, _ := time.ParseInLocation("20060102_150405", tt.created, time.Local)
+			if archive.Name != tt.name || archive.Database != tt.database || !archive.Created.Equal(created) {
+				t.Errorf("parseArchiveName() = %+v, want database %q created %v", archive, tt.database, created)
+			}
+		})
+	}
+}
+
+func TestSortedArchives(t *testing.T) {
+	got := sortedArchives([]string{
+		"backup_20240103_000000.tar.gz",
+		"catalog.jsonl",
+		"backup_20240101_000000.tar.gz",
+		"backup_20240101_000000.tar.gz.sha256",
+		"backup_shop_20240102_000000.tar.zst",
+	})
+	var names []string
+	for _, archive := range got {
+		names = append(names, archive.Name)
+	}
+	want := []string{"backup_20240101_000000.tar.gz", "backup_shop_20240102_000000.tar.zst", "backup_20240103_000000.tar.gz"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("sortedArchives() = %v, want %v", names, want)
+	}
+}
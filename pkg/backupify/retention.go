@@ -0,0 +1,254 @@
+package backupify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// retainedNamePattern matches the files a run uploads: archives, including
+// per-database and encrypted ones, and raw dumps. The part around the
+// timestamp, leaving out the app version but not the environment, names
+// the series a file belongs to.
+var retainedNamePattern = regexp.MustCompile(`^(.+_)(\d{8}_\d{6})(?:-[A-Za-z0-9._-]+?)?(\+[A-Za-z0-9._-]+)?(\.tar(?:\.gz|\.zst|\.br)?(?:\.enc)?|\.tar\.enc\.(?:gz|zst|br)|\.sql|\.sql\.gz)$`)
+
+// retainedFile is an uploaded backup file considered for pruning.
+type retainedFile struct {
+	name    string
+	series  string
+	stamp   string
+	modTime time.Time
+	// parts is set for a file uploaded with ParallelUploadStreams, found
+	// by its parts manifest.
+	parts bool
+}
+
+func parseRetainedFile(name string, modTime time.Time) (retainedFile, bool) {
+	if stem, ok := strings.CutSuffix(name, partsSuffix); ok {
+		file, ok := parseRetainedFile(stem, modTime)
+		file.parts = true
+		return file, ok
+	}
+	match := retainedNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return retainedFile{}, false
+	}
+	suffix := match[4]
+	if strings.HasPrefix(suffix, ".tar") {
+		// Archives stored uncompressed because of MinCompressionGainPercent
+		// belong to the same series as the compressed ones.
+		suffix = strings.NewReplacer(".gz", "", ".zst", "", ".br", "").Replace(suffix)
+	}
+	return retainedFile{name: name, series: match[1] + match[3] + suffix, stamp: match[2], modTime: modTime}, true
+}
+
+// expiredFiles returns the files beyond the newest keep of each series.
+// Files are ordered by modification time when the server reported one and
+// by the timestamp in their name otherwise.
+func expiredFiles(files []retainedFile, keep int) []retainedFile {
+	series := map[string][]retainedFile{}
+	for _, file := range files {
+		series[file.series] = append(series[file.series], file)
+	}
+
+	var expired []retainedFile
+	for _, group := range series {
+		sort.Slice(group, func(i, j int) bool {
+			if !group[i].modTime.Equal(group[j].modTime) {
+				return group[i].modTime.After(group[j].modTime)
+			}
+			return group[i].stamp > group[j].stamp
+		})
+		if len(group) > keep {
+			expired = append(expired, group[keep:]...)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].name < expired[j].name })
+	return expired
+}
+
+// listRetainedFiles lists the backup files in dir. It uses LIST, which the
+// ftp client sends as MLSD when the server supports it, for structured
+// entries with reliable modification times. Servers whose LIST output can't
+// be parsed fall back to NLST and the timestamps in the names.
+func listRetainedFiles(conn *ftpConn, dir string) ([]retainedFile, error) {
+	var files []retainedFile
+	entries, err := conn.List(dir)
+	if err == nil && len(entries) > 0 {
+		for _, entry := range entries {
+			if entry.Type != ftp.EntryTypeFile {
+				continue
+			}
+			if file, ok := parseRetainedFile(path.Base(entry.Name), entry.Time); ok {
+				files = append(files, file)
+			}
+		}
+		return files, nil
+	}
+
+	names, err := conn.NameList(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote directory: %w", err)
+	}
+	for _, name := range names {
+		if file, ok := parseRetainedFile(path.Base(name), time.Time{}); ok {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// pruneFTP deletes the backups beyond RemoteKeepLast in the directory of
+// dest, together with their .sha256 and .sig files, and returns the deleted
+// paths. With dryRun nothing is deleted and the paths are those that would
+// be.
+func pruneFTP(ctx context.Context, config Config, dest Destination, dryRun bool) ([]string, error) {
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Quit()
+
+	dir := dest.Directory
+	if dir == "" {
+		dir = "."
+	}
+	files, err := listRetainedFiles(conn, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, file := range expiredFiles(files, config.RemoteKeepLast) {
+		remotePath := path.Join(dest.Directory, file.name)
+		if dryRun {
+			deleted = append(deleted, expiredPaths(conn, remotePath, file)...)
+			continue
+		}
+		if file.parts {
+			err := conn.Delete(remotePath + partsSuffix)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete %s: %w", remotePath+partsSuffix, err)
+			}
+			deleted = append(append(deleted, remotePath+partsSuffix), deleteParts(conn, remotePath)...)
+		} else {
+			err := conn.Delete(remotePath)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete %s: %w", remotePath, err)
+			}
+			deleted = append(deleted, remotePath)
+		}
+		// Not every backup has sidecar files, so failures here are expected.
+		for _, suffix := range sidecarSuffixes {
+			if conn.Delete(remotePath+suffix) == nil {
+				deleted = append(deleted, remotePath+suffix)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// expiredPaths returns the remote files pruneFTP deletes for file: its
+// parts manifest and parts or the file itself, and whichever sidecar files
+// are there.
+func expiredPaths(conn *ftpConn, remotePath string, file retainedFile) []string {
+	paths := []string{remotePath}
+	if file.parts {
+		paths = []string{remotePath + partsSuffix}
+		if response, err := conn.Retr(remotePath + partsSuffix); err == nil {
+			var manifest PartsManifest
+			json.NewDecoder(response).Decode(&manifest)
+			response.Close()
+			for _, part := range manifest.Parts {
+				paths = append(paths, path.Join(path.Dir(remotePath), part.Name))
+			}
+		}
+	}
+	for _, suffix := range sidecarSuffixes {
+		if _, err := conn.FileSize(remotePath + suffix); err == nil {
+			paths = append(paths, remotePath+suffix)
+		}
+	}
+	return paths
+}
+
+// PruneResult is the outcome of applying RemoteKeepLast to a destination.
+// For a dry run Deleted lists the files that would be deleted.
+type PruneResult struct {
+	Destination string   `json:"destination"`
+	Deleted     []string `json:"deleted,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// pruneRemote applies RemoteKeepLast to every FTP destination and records
+// the outcomes in summary. The backups have been shipped by then, so a
+// destination that fails to prune is logged and left for the next run
+// instead of failing this one. With date-partitioned directories only the
+// directory of this run is pruned.
+func (r *run) pruneRemote(ctx context.Context, summary *Summary) {
+	if r.cfg.RemoteKeepLast <= 0 || r.cfg.Spool {
+		return
+	}
+	summary.Prunes = append(summary.Prunes, pruneDestinations(ctx, r.cfg, r.dests, false)...)
+}
+
+// pruneDestinations applies RemoteKeepLast to every FTP destination in
+// dests, logging what it deletes.
+func pruneDestinations(ctx context.Context, config Config, dests []Destination, dryRun bool) []PruneResult {
+	logger := config.logger()
+	var results []PruneResult
+	for _, dest := range expandFailover(dests) {
+		if !dest.isFTP() {
+			logger.Printf("skipping retention for %s destination %s", dest.Type, dest.Name)
+			continue
+		}
+		deleted, err := pruneFTP(ctx, config, dest, dryRun)
+		for _, file := range deleted {
+			if dryRun {
+				logger.Printf("would prune %s from %s", file, dest.Name)
+			} else {
+				logger.Printf("pruned %s from %s", file, dest.Name)
+			}
+		}
+		result := PruneResult{Destination: dest.Name, Deleted: deleted}
+		if err != nil {
+			logger.Printf("failed to prune %s: %v", dest.Name, err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Prune applies RemoteKeepLast to every FTP destination without running a
+// backup, e.g. after the policy changed. Date placeholders in remote
+// directories are filled in for now. With dryRun nothing is deleted and the
+// results list what would be.
+func Prune(ctx context.Context, config Config, dryRun bool) ([]PruneResult, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	if config.RemoteKeepLast <= 0 {
+		return nil, fmt.Errorf("%w: remote_keep_last is not set", ErrConfigInvalid)
+	}
+	results := pruneDestinations(ctx, config, renderDestinations(config.destinations(), time.Now()), dryRun)
+	var errs []error
+	for _, result := range results {
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", result.Destination, result.Error))
+		}
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("failed to prune: %w", errors.Join(errs...))
+	}
+	return results, nil
+}
@@ -0,0 +1,133 @@
+package backupify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRetainedFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		series string
+		stamp  string
+		parts  bool
+		ok     bool
+	}{
+		{name: "backup_20240102_030405.tar.gz", series: "backup_.tar", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar", series: "backup_.tar", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.zst.enc", series: "backup_.tar.enc", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.enc.br", series: "backup_.tar.enc", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405-1.4.0.tar.gz", series: "backup_.tar", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405+prod.tar.gz", series: "backup_+prod.tar", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405-1.4.0+staging.tar.gz", series: "backup_+staging.tar", stamp: "20240102_030405", ok: true},
+		{name: "backup_shop_20240102_030405.tar.gz", series: "backup_shop_.tar", stamp: "20240102_030405", ok: true},
+		{name: "shop_20240102_030405.sql.gz", series: "shop_.sql.gz", stamp: "20240102_030405", ok: true},
+		{name: "shop_20240102_030405.sql", series: "shop_.sql", stamp: "20240102_030405", ok: true},
+		{name: "backup_20240102_030405.tar.gz.parts.json", series: "backup_.tar", stamp: "20240102_030405", parts: true, ok: true},
+		{name: "backup_20240102_030405.tar.gz.sha256"},
+		{name: "backup_20240102_030405.tar.gz.sig"},
+		{name: "backup_2024010_030405.tar.gz"},
+		{name: "_20240102_030405.tar.gz"},
+		{name: "catalog.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, ok := parseRetainedFile(tt.name, time.Time{})
+			if ok != tt.ok {
+				t.Fatalf("parseRetainedFile() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (file.series != tt.series || file.stamp != tt.stamp || file.parts != tt.parts) {
+				t.Errorf("parseRetainedFile() = series %q, stamp %q, parts %v, want %q, %q, %v", file.series, file.stamp, file.parts, tt.series, tt.stamp, tt.parts)
+			}
+		})
+	}
+}
+
+func TestExpiredFiles(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 3, 0, 0, 0, time.UTC) }
+	file := func(name string, modTime time.Time) retainedFile {
+		f, ok := parseRetainedFile(name, modTime)
+		if !ok {
+			t.Fatalf("parseRetainedFile(%q) failed", name)
+		}
+		return f
+	}
+	tests := []struct {
+		name  string
+		files []retainedFile
+		keep  int
+		want  []string
+	}{
+		{
+			name: "by modification time",
+			files: []retainedFile{
+				file("backup_20240103_030000.tar.gz", day(1)),
+				file("backup_20240102_030000.tar.gz", day(3)),
+				file("backup_20240101_030000.tar.gz", day(2)),
+			},
+			keep: 2,
+			want: []string{"backup_20240103_030000.tar.gz"},
+		},
+		{
+			name: "by name without modification times",
+			files: []retainedFile{
+				file("backup_20240101_030000.tar.gz", time.Time{}),
+				file("backup_20240103_030000.tar.gz", time.Time{}),
+				file("backup_20240102_030000.tar.gz", time.Time{}),
+			},
+			keep: 1,
+			want: []string{"backup_20240101_030000.tar.gz", "backup_20240102_030000.tar.gz"},
+		},
+		{
+			name: "each series on its own",
+			files: []retainedFile{
+				file("backup_shop_20240101_030000.tar.gz", day(1)),
+				file("backup_shop_20240102_030000.tar.gz", day(2)),
+				file("backup_crm_20240101_030000.tar.gz", day(1)),
+			},
+			keep: 1,
+			want: []string{"backup_shop_20240101_030000.tar.gz"},
+		},
+		{
+			name: "uncompressed archives share the series",
+			files: []retainedFile{
+				file("backup_20240101_030000.tar", day(1)),
+				file("backup_20240102_030000.tar.gz", day(2)),
+			},
+			keep: 1,
+			want: []string{"backup_20240101_030000.tar"},
+		},
+		{
+			name: "each environment on its own",
+			files: []retainedFile{
+				file("backup_20240101_030000+prod.tar.gz", day(1)),
+				file("backup_20240101_040000+staging.tar.gz", day(1)),
+				file("backup_20240102_030000-1.4.0+prod.tar.gz", day(2)),
+				file("backup_20240102_040000+staging.tar.gz", day(2)),
+				file("backup_20240103_030000+prod.tar.gz", day(3)),
+			},
+			keep: 2,
+			want: []string{"backup_20240101_030000+prod.tar.gz"},
+		},
+		{
+			name: "nothing beyond keep",
+			files: []retainedFile{
+				file("backup_20240101_030000.tar.gz", day(1)),
+			},
+			keep: 3,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, file := range expiredFiles(tt.files, tt.keep) {
+				got = append(got, file.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expiredFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package backupify
+
+import (
+	"math/rand"
+	"time"
+)
+
+const maxRetryDelay = 10 * time.Minute
+
+// retryDelay returns how long to wait before retry number attempt (0-based).
+// With RetryBackoffBase set the delay doubles on every attempt starting from
+// the base, up to maxRetryDelay; otherwise fixed is used. RetryJitter picks a
+// random delay between half and the full value so that many jobs failing at
+// once don't retry in lockstep.
+func retryDelay(config Config, fixed time.Duration, attempt int) time.Duration {
+	delay := fixed
+	if config.RetryBackoffBaseSeconds > 0 {
+		delay = time.Duration(config.RetryBackoffBaseSeconds * float64(time.Second))
+		for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+			delay *= 2
+		}
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	if config.RetryJitter && delay > 0 {
+		half := delay / 2
+		delay = half + time.Duration(rand.Int63n(int64(delay-half)+1))
+	}
+	return delay
+}
@@ -0,0 +1,37 @@
+package backupify
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+)
+
+// newRunID returns a random (version 4) UUID.
+func newRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// withRunID assigns the run a RunID unless the caller chose one, and
+// prefixes every log message with it, the Environment and the Profile, so
+// the lines of interleaved runs can be told apart.
+func (c Config) withRunID() Config {
+	if c.RunID == "" {
+		c.RunID = newRunID()
+	}
+	prefix := "run=" + c.RunID + " "
+	if c.Profile != "" {
+		prefix = "profile=" + c.Profile + " " + prefix
+	}
+	if c.Environment != "" {
+		prefix = "env=" + c.Environment + " " + prefix
+	}
+	base := c.logger()
+	c.Logger = log.New(base.Writer(), base.Prefix()+prefix, base.Flags()|log.Lmsgprefix)
+	return c
+}
@@ -0,0 +1,145 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// commitSchema dumps the schema of every database the run backed up into
+// SchemaGitRepo as <database>.sql and commits the changes, pushing them
+// with SchemaGitPush. Failures are logged, the data backup has succeeded.
+func (r *run) commitSchema(ctx context.Context, summary *Summary) {
+	config := r.cfg
+	// Keep what changes on every dump out of the files, or each run would
+	// make a commit.
+	config.MasterData, config.ConsistentSnapshot = 0, false
+	config.WriteBufferKB, config.DumpThrottleKBps = 0, 0
+	config.Anonymize = nil
+	if config.dumpTool() == DumpToolMysqldump {
+		config.SetGTIDPurged = "off"
+	}
+
+	var files []string
+	for _, db := range summary.Databases {
+		if db.Error != "" || db.Skipped {
+			continue
+		}
+		file := filepath.Join(config.SchemaGitRepo, db.Name+".sql")
+		args := []string{"--no-data", "--skip-dump-date", "--routines", "--events", "--triggers", db.Name}
+		err := dumpToFile(ctx, config, file, args)
+		if err == nil {
+			err = stripAutoIncrement(file)
+		}
+		if err != nil {
+			r.logger.Printf("failed to dump schema of %s: %v", db.Name, err)
+			continue
+		}
+		files = append(files, filepath.Base(file))
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	err := schemaGit(ctx, config.SchemaGitRepo, append([]string{"add", "--"}, files...)...)
+	if err != nil {
+		r.logger.Printf("failed to commit schema: %v", err)
+		return
+	}
+	changed, err := schemaStaged(ctx, config.SchemaGitRepo)
+	if err != nil {
+		r.logger.Printf("failed to commit schema: %v", err)
+		return
+	}
+	if !changed {
+		r.logger.Printf("schema unchanged since the last commit in %s", config.SchemaGitRepo)
+		return
+	}
+	message := fmt.Sprintf("Schema snapshot %s (run %s)", r.started.UTC().Format(time.RFC3339), config.RunID)
+	err = schemaGit(ctx, config.SchemaGitRepo, "commit", "-m", message)
+	if err != nil {
+		r.logger.Printf("failed to commit schema: %v", err)
+		return
+	}
+	summary.SchemaCommit, err = schemaGitOutput(ctx, config.SchemaGitRepo, "rev-parse", "HEAD")
+	if err != nil {
+		r.logger.Printf("failed to read schema commit: %v", err)
+	}
+	r.logger.Printf("committed schema changes to %s: %s", config.SchemaGitRepo, summary.SchemaCommit)
+	if config.SchemaGitPush {
+		err = schemaGit(ctx, config.SchemaGitRepo, "push")
+		if err != nil {
+			r.logger.Printf("failed to push schema: %v", err)
+		}
+	}
+}
+
+// autoIncrementPattern matches the AUTO_INCREMENT table option mysqldump
+// writes after the columns of a table.
+var autoIncrementPattern = regexp.MustCompile(`(?m)^(\).*?) AUTO_INCREMENT=\d+`)
+
+// stripAutoIncrement removes the AUTO_INCREMENT table options from the
+// schema dump in file, as they change with every insert.
+func stripAutoIncrement(file string) error {
+	schema, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read schema dump: %w", err)
+	}
+	err = os.WriteFile(file, autoIncrementPattern.ReplaceAll(schema, []byte("$1")), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write schema dump: %w", err)
+	}
+	return nil
+}
+
+// schemaStaged reports whether the index of repo differs from HEAD, so
+// changes to files not written by this run don't make a commit of their
+// own.
+func schemaStaged(ctx context.Context, repo string) (bool, error) {
+	err := schemaGit(ctx, repo, "diff", "--cached", "--quiet")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+func schemaGit(ctx context.Context, repo string, args ...string) error {
+	_, err := schemaGitOutput(ctx, repo, args...)
+	return err
+}
+
+// schemaGitOutput runs git in repo and returns its trimmed output.
+func schemaGitOutput(ctx context.Context, repo string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (c Config) validateSchemaGitRepo() error {
+	if c.SchemaGitRepo == "" {
+		if c.SchemaGitPush {
+			return fmt.Errorf("schema_git_push needs schema_git_repo")
+		}
+		return nil
+	}
+	if tool := c.dumpTool(); tool != DumpToolMysqldump && tool != DumpToolMariadbDump {
+		return fmt.Errorf("schema_git_repo needs dump_tool mysqldump or mariadb-dump")
+	}
+	if c.TabExport {
+		return fmt.Errorf("schema_git_repo can't be used with tab_export")
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// schemaOnlyTables returns the base tables of db bigger than
+// SchemaOnlyAboveMB according to information_schema, leaving out skipped.
+func schemaOnlyTables(ctx context.Context, config Config, db string, skipped []string) ([]string, error) {
+	if config.SchemaOnlyAboveMB <= 0 {
+		return nil, nil
+	}
+	tables, err := listTableSizes(ctx, config, db)
+	if err != nil {
+		return nil, err
+	}
+	var big []string
+	for _, table := range tables {
+		if table.size > int64(config.SchemaOnlyAboveMB)<<20 {
+			big = append(big, table.name)
+		}
+	}
+	return withoutExcluded(big, skipped), nil
+}
+
+// schemaOnlyFile is the name of the schema dump of the big tables that goes
+// with backupFile, e.g. shop.schema.sql for shop.sql.
+func schemaOnlyFile(backupFile string) string {
+	dir, name := filepath.Split(backupFile)
+	i := strings.LastIndex(name, ".sql")
+	return dir + name[:i] + ".schema" + name[i:]
+}
+
+// appendSchemaOnly dumps the definitions of tables without their rows and
+// appends them to backupFile, like the parts of dumpTablesParallel are
+// joined. Routines and events are already in backupFile.
+func appendSchemaOnly(ctx context.Context, config Config, db, backupFile string, tables []string) error {
+	file := schemaOnlyFile(backupFile)
+	defer os.Remove(file)
+	args := append([]string{"--no-data", "--skip-routines", "--skip-events", db}, tables...)
+	err := backupDatabase(ctx, config, db, file, args...)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(backupFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open database copy file: %w", err)
+	}
+	defer out.Close()
+	err = appendFile(out, file)
+	if err != nil {
+		return fmt.Errorf("failed to append schema dump: %w", err)
+	}
+	return out.Close()
+}
+
+func (c Config) validateSchemaOnlyAboveMB() error {
+	switch {
+	case c.SchemaOnlyAboveMB < 0:
+		return fmt.Errorf("schema_only_above_mb must not be negative")
+	case c.SchemaOnlyAboveMB == 0:
+		return nil
+	}
+	if tool := c.dumpTool(); tool != DumpToolMysqldump && tool != DumpToolMariadbDump {
+		return fmt.Errorf("schema_only_above_mb needs dump_tool mysqldump or mariadb-dump")
+	}
+	if c.TabExport || c.StreamUploads || c.ConsistentSnapshot {
+		return fmt.Errorf("schema_only_above_mb can't be used with tab_export, stream_uploads or consistent_snapshot")
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const serverInfoName = "server_info.txt"
+
+// serverInfoEntry returns the server_info.txt archive entry with the output
+// of SHOW GLOBAL VARIABLES and SHOW GLOBAL STATUS, one tab-separated name
+// and value per line. It is only context for diagnosing a restore, so
+// failing to collect it is logged and the entry left out.
+func (r *run) serverInfoEntry(ctx context.Context) (archiveEntry, bool) {
+	var info strings.Builder
+	for _, query := range []string{"SHOW GLOBAL VARIABLES", "SHOW GLOBAL STATUS"} {
+		rows, err := queryMySQL(ctx, r.cfg, query)
+		if err != nil {
+			r.logger.Printf("failed to capture server variables: %v", err)
+			return archiveEntry{}, false
+		}
+		fmt.Fprintf(&info, "# %s\n", query)
+		for _, row := range rows {
+			info.WriteString(strings.Join(row, "\t") + "\n")
+		}
+		info.WriteString("\n")
+	}
+	return archiveEntry{name: serverInfoName, data: []byte(info.String())}, true
+}
@@ -0,0 +1,83 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// serverVersion returns the VERSION() of the MySQL server, e.g.
+// "8.0.36-log" or "10.11.6-MariaDB".
+func serverVersion(ctx context.Context, config Config) (string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT VERSION()")
+	if err != nil {
+		return "", fmt.Errorf("failed to read server version: %w", err)
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return "", fmt.Errorf("failed to read server version: no result")
+	}
+	return rows[0][0], nil
+}
+
+// releaseSeries returns the major and minor version of a server version,
+// the release series (5.7, 8.0, 10.11) whose syntax a dump is written in.
+func releaseSeries(version string) (major, minor int, ok bool) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// checkRestoreVersion compares the version of the server a dump was made on
+// with the one it is restored into. A dump from a newer release series can
+// use syntax the older server doesn't know, so that fails unless allowed;
+// any other change of series is logged.
+func checkRestoreVersion(ctx context.Context, config Config, source string, allowMismatch bool) error {
+	if source == "" {
+		return nil
+	}
+	target, err := serverVersion(ctx, config)
+	if err != nil {
+		return err
+	}
+	sourceMajor, sourceMinor, ok := releaseSeries(source)
+	targetMajor, targetMinor, ok2 := releaseSeries(target)
+	if !ok || !ok2 {
+		config.logger().Printf("can't compare server versions %q and %q", source, target)
+		return nil
+	}
+	if isMariaDB(source) != isMariaDB(target) {
+		// MariaDB and MySQL version numbers are not comparable.
+		return versionMismatch(config, fmt.Sprintf("dump made on %s is restored into %s", source, target), allowMismatch)
+	}
+	if sourceMajor == targetMajor && sourceMinor == targetMinor {
+		return nil
+	}
+	if sourceMajor > targetMajor || (sourceMajor == targetMajor && sourceMinor > targetMinor) {
+		return versionMismatch(config, fmt.Sprintf("dump made on %s is restored into older %s", source, target), allowMismatch)
+	}
+	config.logger().Printf("dump made on %s is restored into newer %s", source, target)
+	return nil
+}
+
+func isMariaDB(version string) bool {
+	return strings.Contains(strings.ToLower(version), "mariadb")
+}
+
+func versionMismatch(config Config, message string, allowMismatch bool) error {
+	if !allowMismatch {
+		return fmt.Errorf("%s, which may not understand it", message)
+	}
+	config.logger().Printf("warning: %s", message)
+	return nil
+}
@@ -0,0 +1,123 @@
+package backupify
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const signatureSuffix = ".sig"
+
+// sidecarSuffixes are the files written next to an archive that are
+// uploaded, copied and removed together with it.
+var sidecarSuffixes = []string{checksumSuffix, signatureSuffix}
+
+// existingSidecars returns the sidecar files of archivePath that exist.
+func existingSidecars(archivePath string) []string {
+	var files []string
+	for _, suffix := range sidecarSuffixes {
+		if _, err := os.Stat(archivePath + suffix); err == nil {
+			files = append(files, archivePath+suffix)
+		}
+	}
+	return files
+}
+
+func readPEM(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	return block.Bytes, nil
+}
+
+// loadSigningKey reads an Ed25519 private key in PKCS #8 PEM format, as
+// written by "openssl genpkey -algorithm ed25519".
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+	return private, nil
+}
+
+// loadPublicKey reads an Ed25519 public key in PKIX PEM format, as written
+// by "openssl pkey -pubout".
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return public, nil
+}
+
+// signArchive writes the <archive>.sig sidecar: the base64 Ed25519
+// signature of the archive's SHA-256, so the archive is only read once.
+func signArchive(archivePath, keyPath string) error {
+	key, err := loadSigningKey(keyPath)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum archive: %w", err)
+	}
+	digest, _ := hex.DecodeString(sum)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest))
+	err = os.WriteFile(archivePath+signatureSuffix, []byte(signature+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write signature file: %w", err)
+	}
+	return nil
+}
+
+// verifySignature checks the <archive>.sig sidecar against publicKeyPath.
+func verifySignature(archivePath, publicKeyPath string) error {
+	key, err := loadPublicKey(publicKeyPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(archivePath + signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to read signature file: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	sum, err := fileSHA256(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum archive: %w", err)
+	}
+	digest, _ := hex.DecodeString(sum)
+	if !ed25519.Verify(key, digest, signature) {
+		return errors.New("archive signature is invalid")
+	}
+	return nil
+}
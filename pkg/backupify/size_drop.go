@@ -0,0 +1,33 @@
+package backupify
+
+import (
+	"fmt"
+)
+
+// combinedSeries is the ArchiveSizes key of the combined archive; per
+// database archives use the database name.
+const combinedSeries = ""
+
+// checkSizeDrop compares size, that of archivePath, with the last archive of
+// the same series recorded in the state file, and fails with
+// ErrArchiveShrank when it is more than SizeDropThresholdPercent smaller,
+// unless AcceptSizeDrop is set. Otherwise the new size becomes the one the
+// next run is compared with once the archive has been shipped.
+func (r *run) checkSizeDrop(series, archivePath string, size int64) error {
+	if r.cfg.SizeDropThresholdPercent <= 0 {
+		return nil
+	}
+	previous := r.state.archiveSize(series)
+	if previous > 0 {
+		drop := float64(previous-size) / float64(previous) * 100
+		if drop > r.cfg.SizeDropThresholdPercent && r.cfg.AcceptSizeDrop {
+			r.logger.Printf("accepting %s with %d bytes, %.1f%% less than the %d bytes of the previous run", archivePath, size, drop, previous)
+		} else if drop > r.cfg.SizeDropThresholdPercent {
+			return fmt.Errorf("%w: %s has %d bytes, %.1f%% less than the %d bytes of the previous run", ErrArchiveShrank, archivePath, size, drop, previous)
+		}
+	}
+	r.mu.Lock()
+	r.pendingSizes[series] = size
+	r.mu.Unlock()
+	return nil
+}
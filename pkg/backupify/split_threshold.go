@@ -0,0 +1,49 @@
+package backupify
+
+import (
+	"context"
+	"fmt"
+)
+
+// splitArchives reports whether the databases of the run add up to more
+// than SplitThresholdMB of data in information_schema, so that they get
+// archives of their own rather than a combined one.
+func (r *run) splitArchives(ctx context.Context) (bool, error) {
+	var total int64
+	for _, db := range r.databases {
+		size, _, err := dumpEstimate(ctx, r.cfg, db)
+		if err != nil {
+			return false, fmt.Errorf("failed to estimate size of %s: %w", db, err)
+		}
+		total += size
+	}
+	split := total > int64(r.cfg.SplitThresholdMB)<<20
+	if split {
+		r.logger.Printf("databases hold %d MB, above split_threshold_mb, creating per-database archives", total>>20)
+	} else {
+		r.logger.Printf("databases hold %d MB, creating a combined archive", total>>20)
+	}
+	return split, nil
+}
+
+// validateSplitThreshold checks that the config is valid both with and
+// without PerDatabaseArchives, as the run picks one of them.
+func (c Config) validateSplitThreshold() error {
+	switch {
+	case c.SplitThresholdMB < 0:
+		return fmt.Errorf("split_threshold_mb must not be negative")
+	case c.SplitThresholdMB == 0:
+		return nil
+	case c.PerDatabaseArchives:
+		return fmt.Errorf("split_threshold_mb chooses per_database_archives itself, don't set both")
+	case c.rawDumps() || c.ChunkStore != "":
+		return fmt.Errorf("split_threshold_mb needs tar archives")
+	}
+	split := c
+	split.SplitThresholdMB = 0
+	split.PerDatabaseArchives = true
+	if err := split.Validate(); err != nil {
+		return fmt.Errorf("split_threshold_mb: with per_database_archives: %w", err)
+	}
+	return nil
+}
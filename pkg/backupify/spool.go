@@ -0,0 +1,105 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// spoolDestination is the destination name of files moved to SpoolDir.
+const spoolDestination = "spool"
+
+// spoolFile moves localFile and its sidecars into SpoolDir in place of
+// uploading them. The sidecars go first, so DrainSpool never sees an
+// archive without its .sha256.
+func spoolFile(config Config, localFile string) ([]UploadResult, error) {
+	result := UploadResult{Destination: spoolDestination}
+	if info, err := os.Stat(localFile); err == nil {
+		result.Size = info.Size()
+	}
+	result.SHA256, _ = readChecksum(localFile + checksumSuffix)
+
+	err := os.MkdirAll(config.SpoolDir, os.ModePerm)
+	if err == nil {
+		for _, file := range append(existingSidecars(localFile), localFile) {
+			err = moveFile(file, filepath.Join(config.SpoolDir, filepath.Base(file)))
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to spool %s: %w", filepath.Base(localFile), err)
+		result.Error = err.Error()
+		return []UploadResult{result}, err
+	}
+	result.RemotePath = filepath.Join(config.SpoolDir, filepath.Base(localFile))
+	config.logger().Printf("spooled %s -> %s", localFile, result.RemotePath)
+	return []UploadResult{result}, nil
+}
+
+// moveFile renames src to dst, copying it through a temporary file when
+// they are on different filesystems.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	tmp := dst + uploadTempSuffix
+	err = copyFile(src, tmp)
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// DrainSpool uploads every archive and dump in SpoolDir, oldest first, to
+// the destinations and removes it once all of them have it. Files that
+// fail to upload stay for the next drain. RemoteKeepLast is applied
+// afterwards.
+func DrainSpool(ctx context.Context, config Config) ([]UploadResult, error) {
+	if config.SpoolDir == "" {
+		return nil, fmt.Errorf("%w: spool_dir is not set", ErrConfigInvalid)
+	}
+	config.Spool = false
+	entries, err := os.ReadDir(config.SpoolDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+	var files []retainedFile
+	for _, entry := range entries {
+		if file, ok := parseRetainedFile(entry.Name(), time.Time{}); ok && entry.Type().IsRegular() {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].stamp < files[j].stamp })
+
+	var results []UploadResult
+	var errs []error
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		path := filepath.Join(config.SpoolDir, file.name)
+		uploads, err := UploadArchive(ctx, config, path)
+		results = append(results, uploads...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.name, err))
+			continue
+		}
+		removeLocalArchive(config, path)
+	}
+	if len(files) > 0 {
+		r := &run{cfg: config, logger: config.logger(), dests: renderDestinations(config.destinations(), time.Now())}
+		r.pruneRemote(ctx, &Summary{})
+	}
+	return results, errors.Join(errs...)
+}
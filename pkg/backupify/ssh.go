@@ -0,0 +1,73 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// sshArgs returns the ssh options and target for dest.
+func sshArgs(dest Destination) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	switch {
+	case dest.InsecureIgnoreHostKey:
+		args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	case dest.KnownHostsPath != "":
+		args = append(args, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+dest.KnownHostsPath)
+	default:
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+	}
+	if dest.SSHKeyPath != "" {
+		args = append(args, "-i", dest.SSHKeyPath)
+	}
+	if dest.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(dest.Port))
+	}
+	target := dest.Host
+	if dest.User != "" {
+		target = dest.User + "@" + dest.Host
+	}
+	return append(args, target)
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// uploadToSSH pipes localFile into dest.Command run over ssh. {path} in the
+// command is replaced with the quoted remote path Directory/<file name>; the
+// default command writes the file there with cat. The .sha256 and .sig
+// files follow the same way, unless the command doesn't use {path} and so
+// can't tell them from the file, e.g. replaying a dump into mysql.
+func uploadToSSH(ctx context.Context, config Config, dest Destination, localFile string) (string, error) {
+	sidecars := dest.Command == "" || strings.Contains(dest.Command, "{path}")
+	return streamWithSidecars(config, localFile, sidecars, func(name string, input io.Reader) (string, error) {
+		return streamToSSH(ctx, config, dest, name, input)
+	})
+}
+
+// streamToSSH pipes input into dest.Command as the file called name.
+func streamToSSH(ctx context.Context, config Config, dest Destination, name string, input io.Reader) (string, error) {
+	remotePath := path.Join(dest.Directory, name)
+	command := dest.Command
+	if command == "" {
+		command = "cat > {path}"
+	}
+	command = strings.ReplaceAll(command, "{path}", shellQuote(remotePath))
+
+	cmd := exec.CommandContext(ctx, "ssh", append(append(sshProxyArgs(config), sshArgs(dest)...), command)...)
+	cmd.Stdin = input
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("ssh command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return remotePath, nil
+}
@@ -0,0 +1,173 @@
+package backupify
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DatabaseState is what is remembered about a database between runs.
+type DatabaseState struct {
+	LastBackup time.Time `json:"last_backup"`
+	// LastUpdateTime is the newest information_schema UPDATE_TIME seen when
+	// the database was last backed up.
+	LastUpdateTime string `json:"last_update_time,omitempty"`
+}
+
+type stateData struct {
+	Databases map[string]DatabaseState `json:"databases"`
+	// BatchDone are the databases shipped in the current cycle of
+	// DatabaseBatchSize batches; the next batch is taken from the others.
+	BatchDone []string `json:"batch_done,omitempty"`
+	// ArchiveSizes are the sizes of the last archives, keyed by database
+	// for per-database archives and by "" for the combined one.
+	ArchiveSizes map[string]int64 `json:"archive_sizes,omitempty"`
+	// CDCBinlog is the last binlog file RunCDC shipped, from before it kept
+	// its position under cdcKey. It is only read.
+	CDCBinlog string `json:"cdc_binlog,omitempty"`
+	// IncrementalCursors are the newest values of the IncrementalColumns
+	// columns when their tables were last shipped, keyed by
+	// "<database>.<table>".
+	IncrementalCursors map[string]string `json:"incremental_cursors,omitempty"`
+	// IncrementalDeltas count the incremental dumps of each table since
+	// its last full dump, for IncrementalFullEvery.
+	IncrementalDeltas map[string]int `json:"incremental_deltas,omitempty"`
+}
+
+// state is the JSON state of the stateful features, kept under stateKey in
+// a StateStore. It is safe for concurrent use.
+type state struct {
+	mu    sync.Mutex
+	store StateStore
+	data  stateData
+	dirty bool
+}
+
+// loadState reads the state from store; a missing state yields an empty
+// one.
+func loadState(store StateStore) (*state, error) {
+	s := &state{store: store, data: stateData{Databases: map[string]DatabaseState{}}}
+	data, err := store.Get(stateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if data == nil {
+		return s, nil
+	}
+	err = json.Unmarshal(data, &s.data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if s.data.Databases == nil {
+		s.data.Databases = map[string]DatabaseState{}
+	}
+	return s, nil
+}
+
+func (s *state) database(name string) DatabaseState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Databases[name]
+}
+
+func (s *state) setDatabase(name string, db DatabaseState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Databases[name] = db
+	s.dirty = true
+}
+
+func (s *state) archiveSize(series string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.ArchiveSizes[series]
+}
+
+func (s *state) setArchiveSize(series string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.ArchiveSizes == nil {
+		s.data.ArchiveSizes = map[string]int64{}
+	}
+	s.data.ArchiveSizes[series] = size
+	s.dirty = true
+}
+
+func (s *state) cdcBinlog() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.CDCBinlog
+}
+
+func (s *state) incrementalPosition(table string) incrementalPosition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return incrementalPosition{Cursor: s.data.IncrementalCursors[table], Deltas: s.data.IncrementalDeltas[table]}
+}
+
+func (s *state) setIncrementalPosition(table string, position incrementalPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.IncrementalCursors == nil {
+		s.data.IncrementalCursors = map[string]string{}
+	}
+	if s.data.IncrementalDeltas == nil {
+		s.data.IncrementalDeltas = map[string]int{}
+	}
+	s.data.IncrementalCursors[table] = position.Cursor
+	s.data.IncrementalDeltas[table] = position.Deltas
+	s.dirty = true
+}
+
+// batchDone reports which databases were shipped in the current cycle of
+// batches.
+func (s *state) batchDone() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := map[string]bool{}
+	for _, db := range s.data.BatchDone {
+		done[db] = true
+	}
+	return done
+}
+
+// setBatchDone records the databases shipped in the current cycle of
+// batches; nil starts a new cycle.
+func (s *state) setBatchDone(dbs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.BatchDone = dbs
+	s.dirty = true
+}
+
+// markBatched adds db to the databases shipped in the current cycle.
+func (s *state) markBatched(db string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(s.data.BatchDone, db) {
+		s.data.BatchDone = append(s.data.BatchDone, db)
+		s.dirty = true
+	}
+}
+
+// save writes the state back to its store. It does nothing when the state
+// hasn't changed.
+func (s *state) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = s.store.Set(stateKey, data)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
@@ -0,0 +1,81 @@
+package backupify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateStore keeps what the stateful features remember between runs:
+// skipped unchanged databases, the batch cursor, archive sizes for the
+// size drop check, archive signatures, the CDC position and the run
+// journal. Keys are short names such as "state", "cdc" or "signature-all".
+// Implementations must be safe for concurrent use.
+type StateStore interface {
+	// Get returns the value stored under key, or nil when there is none.
+	Get(key string) ([]byte, error)
+	// Set stores value under key, replacing the previous value.
+	Set(key string, value []byte) error
+}
+
+// stateKey is the key of the state shared by most stateful features.
+const stateKey = "state"
+
+// fileStateStore keeps every key in .backupify-<key>.json in dir, or the
+// state key in stateFile when that is set.
+type fileStateStore struct {
+	dir       string
+	stateFile string
+}
+
+// stateStore returns Config.StateStore, or the file store in
+// StateDirectory.
+func (c Config) stateStore() StateStore {
+	if c.StateStore != nil {
+		return c.StateStore
+	}
+	dir := c.StateDirectory
+	if dir == "" {
+		dir = c.BackupDirectory
+	}
+	return fileStateStore{dir: dir, stateFile: c.StateFile}
+}
+
+func (s fileStateStore) path(key string) string {
+	if key == stateKey && s.stateFile != "" {
+		return s.stateFile
+	}
+	return filepath.Join(s.dir, ".backupify-"+key+".json")
+}
+
+func (s fileStateStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Set writes value to a temporary file and renames it into place.
+func (s fileStateStore) Set(key string, value []byte) error {
+	path := s.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, value, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package backupify
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// estimateStorageCost fills in the monthly storage cost of every successful
+// upload from StorageCostPerGB, by the destination that took it, and
+// returns the total.
+func (c Config) estimateStorageCost(uploads []UploadResult) float64 {
+	var total float64
+	for i, upload := range uploads {
+		rate, ok := c.StorageCostPerGB[upload.Destination]
+		if !ok || upload.Error != "" {
+			continue
+		}
+		uploads[i].EstimatedMonthlyCost = roundCost(float64(upload.Size) / (1 << 30) * rate)
+		total += uploads[i].EstimatedMonthlyCost
+	}
+	return roundCost(total)
+}
+
+// roundCost rounds to a hundredth of a cent.
+func roundCost(cost float64) float64 {
+	return math.Round(cost*10000) / 10000
+}
+
+func (c Config) validateStorageCost() error {
+	var names []string
+	for _, dest := range expandFailover(c.destinations()) {
+		names = append(names, dest.Name)
+	}
+	for name, rate := range c.StorageCostPerGB {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("storage_cost_per_gb: unknown destination %q", name)
+		}
+		if rate < 0 {
+			return fmt.Errorf("storage_cost_per_gb: the rate of %s must not be negative", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package backupify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// streamDumps pipes every database through gzip straight into the
+// destinations as <database>_<timestamp>.sql.gz, so nothing is written to
+// BackupDirectory. A tar archive needs the size of each entry up front, so
+// streamed dumps are always uploaded on their own.
+func (r *run) streamDumps(ctx context.Context, summary *Summary) error {
+	defer r.stage("stream", &summary.DumpMS)()
+
+	var errs []error
+	for i, db := range r.databases {
+		if err := r.pauseBeforeDatabase(ctx, i); err != nil {
+			return err
+		}
+		result, uploads, err := r.streamDatabase(ctx, db)
+		summary.Databases = append(summary.Databases, result)
+		summary.Uploads = append(summary.Uploads, uploads...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db, err))
+			if r.cfg.UploadFailureMode == UploadFailFast {
+				break
+			}
+			continue
+		}
+		if result.Error == "" {
+			r.commitState(db)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to upload: %w", errors.Join(errs...))
+	}
+	r.pruneRemote(ctx, summary)
+	return nil
+}
+
+// streamDatabase dumps db into every destination at once. A failed dump is
+// reported in the result like in dumpDatabase; the returned error covers the
+// destinations that failed while the dump itself succeeded.
+func (r *run) streamDatabase(ctx context.Context, db string) (result DatabaseResult, uploads []UploadResult, err error) {
+	cfg, logger := r.cfg, r.logger
+	cfg.emit(Event{Type: EventDatabaseStarted, Database: db})
+	defer func() {
+		cfg.emit(Event{Type: EventDatabaseFinished, Database: db, File: result.File, Skipped: result.Skipped, Error: result.Error})
+	}()
+
+	if cfg.SkipUnchangedDatabases {
+		unchanged, updated := r.unchanged(ctx, db)
+		if unchanged {
+			logger.Printf("skipping database %s, unchanged since %s", db, updated)
+			return DatabaseResult{Name: db, Skipped: true}, nil, nil
+		}
+		r.setPending(db, DatabaseState{LastBackup: r.started, LastUpdateTime: updated})
+	}
+
+	dests := cfg.destinationsFor(r.dests, db)
+	if len(dests) == 0 {
+		return DatabaseResult{Name: db}, nil, errNoDestination
+	}
+	dumpCtx, cancel := dumpContext(ctx, cfg)
+	defer cancel()
+	excluded, err := excludedTables(ctx, cfg, db)
+	if err != nil {
+		logger.Printf("failed to backup database %s: %v", db, err)
+		return DatabaseResult{Name: db, Error: err.Error(), err: err}, nil, nil
+	}
+
+	name := fmt.Sprintf("%s_%s.sql.gz", db, r.timestamp)
+	logger.Printf("streaming database backup %s -> %s", db, name)
+	readers := make([]*io.PipeReader, len(dests))
+	writers := make([]*io.PipeWriter, len(dests))
+	for i := range dests {
+		readers[i], writers[i] = io.Pipe()
+	}
+
+	// Every destination has to read at the same time, or the dump blocks on
+	// the ones that haven't started yet.
+	uploads = make([]UploadResult, len(dests))
+	errs := make([]error, len(dests))
+	uploadCtx, cancelUploads := context.WithCancel(ctx)
+	defer cancelUploads()
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for i, dest := range dests {
+		wg.Add(1)
+		go func(i int, dest Destination) {
+			defer wg.Done()
+			cfg.emit(Event{Type: EventUploadStarted, File: name, Destination: dest.Name})
+			remotePath, err := streamTo(uploadCtx, cfg, dest, name, readers[i])
+			readers[i].CloseWithError(errUploadStopped)
+			if err != nil && cfg.UploadFailureMode == UploadFailFast && ctx.Err() == nil {
+				first := false
+				failOnce.Do(func() {
+					first = true
+					cancelUploads()
+				})
+				if !first {
+					err = errUploadSkipped
+				}
+			}
+			cfg.emit(Event{Type: EventUploadFinished, File: name, Destination: dest.Name, RemotePath: remotePath, Error: errorString(err)})
+			uploads[i] = UploadResult{Destination: dest.Name, RemotePath: remotePath}
+			if err != nil {
+				uploads[i].Error = err.Error()
+				errs[i] = &DestinationError{Destination: dest.Name, Err: err}
+			}
+		}(i, dest)
+	}
+
+	out := &fanoutWriter{writers: make([]io.Writer, len(writers))}
+	for i, w := range writers {
+		out.writers[i] = w
+	}
+	var local *localCopyWriter
+	if cfg.StreamLocalCopy {
+		local, err = createLocalCopy(filepath.Join(cfg.BackupDirectory, name))
+		if err != nil {
+			logger.Printf("failed to create local copy of %s: %v", db, err)
+		} else {
+			out.writers = append(out.writers, local)
+		}
+	}
+	gzWriter := newGzipWriter(dumpCompressionLevel(ctx, cfg, db), out)
+	err = dumpToWriter(dumpCtx, dumpLockTables(ctx, cfg, db), append(ignoreTableArgs(db, excluded), db), gzWriter)
+	if err == nil {
+		err = gzWriter.Close()
+	}
+	for _, w := range writers {
+		w.CloseWithError(err)
+	}
+	wg.Wait()
+	if local != nil {
+		local.finish(cfg, err)
+	}
+	if err == nil {
+		verifyUploads(ctx, cfg, uploads, errs, "")
+	}
+
+	uploadErr := uploadError(cfg, name, errs)
+	if err != nil && uploadErr != nil && out.failed() {
+		// The dump only stopped because no destination was left to read it.
+		return DatabaseResult{Name: db}, uploads, uploadErr
+	}
+	if err != nil {
+		err = timeoutError(cfg, dumpCtx, err)
+		logger.Printf("failed to backup database %s: %v", db, err)
+		return DatabaseResult{Name: db, Error: err.Error(), err: err}, uploads, nil
+	}
+	return DatabaseResult{Name: db, File: name}, uploads, uploadErr
+}
+
+// errUploadStopped is what the dump sees writing to a destination whose
+// upload already ended.
+var errUploadStopped = errors.New("upload stopped")
+
+// streamTo uploads input to dest as name.
+func streamTo(ctx context.Context, config Config, dest Destination, name string, input io.Reader) (string, error) {
+	switch dest.Type {
+	case DestinationSSH:
+		return streamToSSH(ctx, config, dest, name, input)
+	case DestinationCommand:
+		return streamToCommand(ctx, config, dest, name, input)
+	}
+
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		return "", err
+	}
+	remotePath := path.Join(dest.Directory, name)
+	tmpPath := remotePath + uploadTempSuffix
+	counter := &countingReader{r: input}
+	err = conn.Stor(tmpPath, counter)
+	if err != nil {
+		conn.Delete(tmpPath)
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	size, err := conn.FileSize(tmpPath)
+	if err == nil && size != counter.n {
+		conn.Delete(tmpPath)
+		return "", fmt.Errorf("uploaded %s has %d bytes, expected %d", tmpPath, size, counter.n)
+	}
+	if err != nil {
+		config.logger().Printf("can't check size of uploaded %s: %v", tmpPath, err)
+	}
+
+	// Unlike storFile there is no local copy to upload again under the
+	// final name, so a failed rename fails the upload.
+	err = conn.Rename(tmpPath, remotePath)
+	if err != nil {
+		return tmpPath, fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	if config.RemoteFileMode != "" {
+		conn.Quit()
+		chmodRemote(ctx, config, dest, []string{remotePath})
+	}
+	return remotePath, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// localCopyWriter writes the streamed dump to a local file for
+// StreamLocalCopy. A failed write is kept for finish, and fanoutWriter drops
+// the copy while the uploads go on.
+type localCopyWriter struct {
+	file *os.File
+	err  error
+}
+
+func createLocalCopy(path string) (*localCopyWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &localCopyWriter{file: file}, nil
+}
+
+func (l *localCopyWriter) Write(p []byte) (int, error) {
+	n, err := l.file.Write(p)
+	if err != nil {
+		l.err = err
+	}
+	return n, err
+}
+
+// finish closes the local copy, and removes it unless both the copy and the
+// dump succeeded.
+func (l *localCopyWriter) finish(config Config, dumpErr error) {
+	err := l.file.Close()
+	if l.err != nil {
+		err = l.err
+	}
+	if err != nil {
+		config.logger().Printf("failed to write local copy %s: %v", l.file.Name(), err)
+	}
+	if err != nil || dumpErr != nil {
+		os.Remove(l.file.Name())
+		return
+	}
+	config.logger().Printf("kept local copy %s", l.file.Name())
+}
+
+// fanoutWriter copies every write to all writers. A writer that fails is
+// dropped so the remaining destinations still get the whole stream; the
+// write only fails once no writer is left.
+type fanoutWriter struct {
+	writers []io.Writer
+}
+
+// failed reports whether every writer has failed.
+func (f *fanoutWriter) failed() bool {
+	return len(f.writers) == 0
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	var lastErr error
+	live := f.writers[:0]
+	for _, w := range f.writers {
+		_, err := w.Write(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		live = append(live, w)
+	}
+	f.writers = live
+	if len(live) == 0 {
+		return 0, fmt.Errorf("all uploads failed: %w", lastErr)
+	}
+	return len(p), nil
+}
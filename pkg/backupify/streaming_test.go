@@ -0,0 +1,139 @@
+package backupify
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write after the first ok ones.
+type failingWriter struct {
+	ok     int
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > w.ok {
+		return 0, errUploadStopped
+	}
+	return len(p), nil
+}
+
+func TestFanoutWriter(t *testing.T) {
+	var kept strings.Builder
+	broken := &failingWriter{ok: 1}
+	out := &fanoutWriter{writers: []io.Writer{broken, &kept}}
+
+	for _, chunk := range []string{"one ", "two ", "three"} {
+		if _, err := out.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Write(%q) = %v", chunk, err)
+		}
+	}
+	if kept.String() != "one two three" {
+		t.Errorf("remaining writer got %q, want the whole stream", kept.String())
+	}
+	if broken.writes != 2 {
+		t.Errorf("failed writer written %d times, want 2", broken.writes)
+	}
+	if len(out.writers) != 1 || out.failed() {
+		t.Errorf("fanoutWriter has %d writers, failed() = %v, want 1 and false", len(out.writers), out.failed())
+	}
+
+}
+
+func TestFanoutWriterAllFailed(t *testing.T) {
+	out := &fanoutWriter{writers: []io.Writer{&failingWriter{}, &failingWriter{}}}
+	if _, err := out.Write([]byte("one")); !errors.Is(err, errUploadStopped) {
+		t.Errorf("Write() with no writer left = %v, want %v", err, errUploadStopped)
+	}
+	if !out.failed() {
+		t.Error("failed() = false with no writer left")
+	}
+}
+
+func TestStreamDatabase(t *testing.T) {
+	var dump strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&dump, "INSERT INTO `orders` VALUES (%d,'%x');\n", i, i*7919)
+	}
+	tests := []struct {
+		name     string
+		commands []string
+		failed   []bool
+	}{
+		{"every destination", []string{"tee {path}", "tee {path}"}, []bool{false, false}},
+		{"one destination failed", []string{"false", "tee {path}"}, []bool{true, false}},
+		{"every destination failed", []string{"false", "false"}, []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeMySQL(t, nil)
+			fakeMysqldump(t, dump.String())
+			dir := t.TempDir()
+			var dests []Destination
+			for i, command := range tt.commands {
+				remote := filepath.Join(dir, fmt.Sprintf("dest%d", i))
+				if err := os.Mkdir(remote, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				dests = append(dests, Destination{Name: filepath.Base(remote), Type: DestinationCommand, Directory: remote, Command: command})
+			}
+			r, err := newRun(Config{
+				BackupDirectory: dir,
+				Destinations:    dests,
+				StreamUploads:   true,
+				GzipDumps:       true,
+				Logger:          log.New(io.Discard, "", 0),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, uploads, err := r.streamDatabase(context.Background(), "shop")
+			if result.Error != "" {
+				t.Fatalf("streamDatabase() reported a failed dump: %s", result.Error)
+			}
+			var destErr *DestinationError
+			if anyFailed := tt.failed[0] || tt.failed[1]; anyFailed != errors.As(err, &destErr) {
+				t.Fatalf("streamDatabase() = %v, want a destination error %v", err, anyFailed)
+			}
+			for i, upload := range uploads {
+				if failed := upload.Error != ""; failed != tt.failed[i] {
+					t.Errorf("upload to %s failed: %v (%s), want %v", upload.Destination, failed, upload.Error, tt.failed[i])
+				}
+				if tt.failed[i] {
+					continue
+				}
+				if got := gunzipFile(t, filepath.Join(dests[i].Directory, result.File)); got != dump.String() {
+					t.Errorf("%s got %d bytes of the dump, want %d", upload.Destination, len(got), dump.Len())
+				}
+			}
+		})
+	}
+}
+
+func gunzipFile(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,150 @@
+package backupify
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusInterval is how often the status file is rewritten while nothing
+// else changes, so its Updated time shows the run is alive.
+const statusInterval = 10 * time.Second
+
+// RunStatus is what StatusFile holds while a run is in progress.
+type RunStatus struct {
+	PID     int       `json:"pid"`
+	RunID   string    `json:"run_id,omitempty"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+	// Stage is "starting", "dump", "compress", "archive", "upload" or
+	// "stream".
+	Stage string `json:"stage"`
+	// Databases are the databases being dumped right now.
+	Databases []string `json:"databases,omitempty"`
+	// DatabasesDone of DatabasesTotal databases are dumped, skipped or
+	// failed.
+	DatabasesDone  int `json:"databases_done"`
+	DatabasesTotal int `json:"databases_total"`
+	// Uploads are the files being uploaded right now.
+	Uploads []StatusUpload `json:"uploads,omitempty"`
+}
+
+// StatusUpload is an upload in progress.
+type StatusUpload struct {
+	File        string `json:"file"`
+	Destination string `json:"destination"`
+}
+
+// supervisor keeps PidFile and StatusFile for the duration of a run. A nil
+// supervisor does nothing.
+type supervisor struct {
+	cfg    Config
+	mu     sync.Mutex
+	status RunStatus
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startSupervision writes PidFile and the first StatusFile, and starts
+// refreshing the status file. It returns nil when neither is configured.
+func startSupervision(cfg Config) *supervisor {
+	if cfg.PidFile == "" && cfg.StatusFile == "" {
+		return nil
+	}
+	s := &supervisor{cfg: cfg, stop: make(chan struct{}), done: make(chan struct{})}
+	if cfg.PidFile != "" {
+		err := writeFileAtomic(cfg.PidFile, []byte(strconv.Itoa(os.Getpid())+"\n"))
+		if err != nil {
+			cfg.logger().Printf("failed to write pid file: %v", err)
+		}
+	}
+	now := time.Now()
+	s.status = RunStatus{PID: os.Getpid(), RunID: cfg.RunID, Started: now, Stage: "starting"}
+	s.update(nil)
+	go s.refresh()
+	return s
+}
+
+func (s *supervisor) refresh() {
+	defer close(s.done)
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.update(nil)
+		}
+	}
+}
+
+// update applies change to the status and rewrites the status file.
+func (s *supervisor) update(change func(*RunStatus)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if change != nil {
+		change(&s.status)
+	}
+	if s.cfg.StatusFile == "" {
+		return
+	}
+	s.status.Updated = time.Now()
+	data, err := json.MarshalIndent(s.status, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.cfg.StatusFile, data)
+	}
+	if err != nil {
+		s.cfg.logger().Printf("failed to write status file: %v", err)
+	}
+}
+
+// setStage records the stage a stage name such as "dump of shop" belongs
+// to.
+func (s *supervisor) setStage(name string) {
+	stage, _, _ := strings.Cut(name, " ")
+	s.update(func(status *RunStatus) { status.Stage = stage })
+}
+
+func (s *supervisor) setTotal(n int) {
+	s.update(func(status *RunStatus) { status.DatabasesTotal = n })
+}
+
+// event updates the status from an event of the run.
+func (s *supervisor) event(event Event) {
+	s.update(func(status *RunStatus) {
+		switch event.Type {
+		case EventDatabaseStarted:
+			status.Databases = append(status.Databases, event.Database)
+		case EventDatabaseFinished:
+			status.Databases = slices.DeleteFunc(status.Databases, func(db string) bool { return db == event.Database })
+			status.DatabasesDone++
+		case EventUploadStarted:
+			status.Uploads = append(status.Uploads, StatusUpload{File: event.File, Destination: event.Destination})
+		case EventUploadFinished:
+			upload := StatusUpload{File: event.File, Destination: event.Destination}
+			status.Uploads = slices.DeleteFunc(status.Uploads, func(u StatusUpload) bool { return u == upload })
+		}
+	})
+}
+
+// finish stops refreshing and removes both files.
+func (s *supervisor) finish() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	for _, file := range []string{s.cfg.StatusFile, s.cfg.PidFile} {
+		if file != "" {
+			os.Remove(file)
+		}
+	}
+}
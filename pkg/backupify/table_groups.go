@@ -0,0 +1,81 @@
+package backupify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// groupSeparator joins a database and the name of one of its TableGroups
+// into the name of the group's dump and archive, e.g. shop.orders.
+const groupSeparator = "."
+
+// perDatabaseUnits returns what perDatabase dumps and archives on its own:
+// every database and, for databases with TableGroups, each of their groups.
+func (r *run) perDatabaseUnits() []string {
+	var units []string
+	for _, db := range r.databases {
+		units = append(units, db)
+		groups := make([]string, 0, len(r.cfg.TableGroups[db]))
+		for group := range r.cfg.TableGroups[db] {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		for _, group := range groups {
+			units = append(units, db+groupSeparator+group)
+		}
+	}
+	return units
+}
+
+// tableGroup returns the database of unit and the tables of its group, or
+// unit itself and no tables when it is a whole database.
+func (c Config) tableGroup(unit string) (string, []string) {
+	for db, groups := range c.TableGroups {
+		group, ok := strings.CutPrefix(unit, db+groupSeparator)
+		if !ok {
+			continue
+		}
+		if tables, ok := groups[group]; ok {
+			return db, tables
+		}
+	}
+	return unit, nil
+}
+
+// groupedTables returns the tables of db that are dumped with one of its
+// groups, which the dump of the rest of the database leaves out.
+func (c Config) groupedTables(db string) []string {
+	var tables []string
+	for _, group := range c.TableGroups[db] {
+		tables = append(tables, group...)
+	}
+	return tables
+}
+
+func (c Config) validateTableGroups() error {
+	if !c.PerDatabaseArchives || c.rawDumps() {
+		return fmt.Errorf("table_groups needs per_database_archives")
+	}
+	if c.TabExport || c.VerifyRestore || c.SkipUnchangedDatabases || c.dumpTool() == DumpToolMydumper {
+		return fmt.Errorf("table_groups can't be used with tab_export, verify_restore, skip_unchanged_databases or mydumper")
+	}
+	for db, groups := range c.TableGroups {
+		seen := map[string]string{}
+		for group, tables := range groups {
+			if group == "" || strings.ContainsAny(group, "/"+groupSeparator) {
+				return fmt.Errorf("table_groups: %s has an invalid group name %q", db, group)
+			}
+			if len(tables) == 0 {
+				return fmt.Errorf("table_groups: group %s of %s has no tables", group, db)
+			}
+			for _, table := range tables {
+				if other, ok := seen[table]; ok {
+					return fmt.Errorf("table_groups: table %s.%s is in groups %s and %s", db, table, other, group)
+				}
+				seen[table] = group
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package backupify
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledWriter passes writes on at no more than rate bytes per second on
+// average. As the dump's stdout is only read as fast as it is written out,
+// mysqldump, and the reads it makes on the server, slow down with it.
+type throttledWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	rate    float64
+	started time.Time
+	n       int64
+}
+
+// throttleDump wraps w in the DumpThrottleKBps limit, if one is set.
+func throttleDump(ctx context.Context, config Config, w io.Writer) io.Writer {
+	if config.DumpThrottleKBps <= 0 {
+		return w
+	}
+	return &throttledWriter{ctx: ctx, w: w, rate: float64(config.DumpThrottleKBps) * 1024, started: time.Now()}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.n += int64(n)
+	if err != nil {
+		return n, err
+	}
+	ahead := time.Duration(float64(t.n)/t.rate*float64(time.Second)) - time.Since(t.started)
+	if ahead <= 0 {
+		return n, nil
+	}
+	timer := time.NewTimer(ahead)
+	defer timer.Stop()
+	select {
+	case <-t.ctx.Done():
+		return n, t.ctx.Err()
+	case <-timer.C:
+		return n, nil
+	}
+}
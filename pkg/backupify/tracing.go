@@ -0,0 +1,267 @@
+package backupify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otelServiceName is the service.name resource attribute of the spans.
+const otelServiceName = "backupify-mysql"
+
+// otelExportTimeout bounds the export of the spans at the end of a run.
+const otelExportTimeout = 10 * time.Second
+
+// Status codes and the span kind of OTLP.
+const (
+	otelStatusOK     = 1
+	otelStatusError  = 2
+	otelKindInternal = 1
+)
+
+// tracer collects the spans of a run for OTelEndpoint: the run is the root
+// span, with a child for every database dump, stage and upload. The spans
+// are exported together over OTLP/HTTP when the run has finished.
+type tracer struct {
+	cfg     Config
+	traceID string
+	root    *otelSpan
+	mu      sync.Mutex
+	spans   []*otelSpan
+	open    map[string]*otelSpan
+}
+
+// otelSpan is a span in the OTLP JSON encoding.
+type otelSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otelAttribute `json:"attributes,omitempty"`
+	Status       otelStatus      `json:"status"`
+
+	started time.Time
+}
+
+type otelAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func stringAttribute(key, value string) otelAttribute {
+	return otelAttribute{Key: key, Value: map[string]any{"stringValue": value}}
+}
+
+// intAttribute encodes value as a string, as OTLP JSON does for 64-bit
+// integers.
+func intAttribute(key string, value int64) otelAttribute {
+	return otelAttribute{Key: key, Value: map[string]any{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+func boolAttribute(key string, value bool) otelAttribute {
+	return otelAttribute{Key: key, Value: map[string]any{"boolValue": value}}
+}
+
+func otelID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// startTrace starts the root span of a run, or returns nil without
+// OTelEndpoint. The methods of a nil tracer do nothing.
+func startTrace(cfg Config) *tracer {
+	if cfg.OTelEndpoint == "" {
+		return nil
+	}
+	t := &tracer{cfg: cfg, traceID: otelID(16), open: map[string]*otelSpan{}}
+	t.root = t.newSpan("backup", "")
+	t.root.Attributes = append(t.root.Attributes, stringAttribute("backupify.run_id", cfg.RunID))
+	if cfg.Environment != "" {
+		t.root.Attributes = append(t.root.Attributes, stringAttribute("backupify.environment", cfg.Environment))
+	}
+	return t
+}
+
+func (t *tracer) newSpan(name, parent string) *otelSpan {
+	now := time.Now()
+	return &otelSpan{TraceID: t.traceID, SpanID: otelID(8), ParentSpanID: parent, Name: name, Kind: otelKindInternal, Start: unixNano(now), started: now}
+}
+
+// end finishes span with the duration and, when err isn't empty, an error
+// status.
+func (s *otelSpan) end(err string) {
+	now := time.Now()
+	s.End = unixNano(now)
+	s.Attributes = append(s.Attributes, intAttribute("backupify.duration_ms", now.Sub(s.started).Milliseconds()))
+	s.Status = otelStatus{Code: otelStatusOK}
+	if err != "" {
+		s.Status = otelStatus{Code: otelStatusError, Message: err}
+	}
+}
+
+// start opens a child span of the run under key, for finish to close.
+func (t *tracer) start(key, name string, attrs ...otelAttribute) {
+	span := t.newSpan(name, t.root.SpanID)
+	span.Attributes = attrs
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open[key] = span
+}
+
+// finish closes the span opened under key.
+func (t *tracer) finish(key, err string, attrs ...otelAttribute) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span, ok := t.open[key]
+	if !ok {
+		return
+	}
+	delete(t.open, key)
+	span.Attributes = append(span.Attributes, attrs...)
+	span.end(err)
+	t.spans = append(t.spans, span)
+}
+
+// stage returns a function that ends a span for a stage of the run.
+func (t *tracer) stage(name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	key := "stage\x00" + name + "\x00" + otelID(4)
+	t.start(key, name)
+	return func() { t.finish(key, "") }
+}
+
+// event turns the database and upload events of the run into spans.
+func (t *tracer) event(event Event) {
+	if t == nil {
+		return
+	}
+	uploadKey := "upload\x00" + event.File + "\x00" + event.Destination
+	switch event.Type {
+	case EventDatabaseStarted:
+		t.start("db\x00"+event.Database, "dump "+event.Database, stringAttribute("db.name", event.Database))
+	case EventDatabaseFinished:
+		t.finish("db\x00"+event.Database, event.Error, intAttribute("backupify.size_bytes", event.Size), boolAttribute("backupify.skipped", event.Skipped))
+	case EventArchiveCreated:
+		span := t.newSpan("archive created", t.root.SpanID)
+		span.Attributes = []otelAttribute{stringAttribute("backupify.file", event.File), intAttribute("backupify.size_bytes", event.Size)}
+		span.end("")
+		t.mu.Lock()
+		t.spans = append(t.spans, span)
+		t.mu.Unlock()
+	case EventUploadStarted:
+		t.start(uploadKey, "upload to "+event.Destination, stringAttribute("backupify.file", event.File), stringAttribute("backupify.destination", event.Destination))
+	case EventUploadFinished:
+		t.finish(uploadKey, event.Error, stringAttribute("backupify.remote_path", event.RemotePath), intAttribute("backupify.size_bytes", event.Size))
+	}
+}
+
+// export ends the root span with the totals of summary and exports every
+// span. A failed export is logged, as it doesn't affect the backup.
+func (t *tracer) export(summary Summary, runErr error) {
+	if t == nil {
+		return
+	}
+	var uploaded int64
+	for _, upload := range summary.Uploads {
+		if upload.Error == "" {
+			uploaded += upload.Size
+		}
+	}
+	t.root.Attributes = append(t.root.Attributes,
+		intAttribute("backupify.databases", int64(len(summary.Databases))),
+		intAttribute("backupify.dump_ms", summary.DumpMS),
+		intAttribute("backupify.archive_ms", summary.ArchiveMS),
+		intAttribute("backupify.upload_ms", summary.UploadMS),
+		intAttribute("backupify.uploaded_bytes", uploaded),
+	)
+	t.root.end(errorString(runErr))
+
+	t.mu.Lock()
+	spans := append([]*otelSpan{t.root}, t.spans...)
+	t.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), otelExportTimeout)
+	defer cancel()
+	if err := exportSpans(ctx, t.cfg, spans); err != nil {
+		t.cfg.logger().Printf("failed to export traces to %s: %v", t.cfg.OTelEndpoint, err)
+	}
+}
+
+// exportSpans posts spans to the OTLP/HTTP traces endpoint in the JSON
+// encoding.
+func exportSpans(ctx context.Context, cfg Config, spans []*otelSpan) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otelAttribute{
+				stringAttribute("service.name", otelServiceName),
+				stringAttribute("service.version", cfg.AppVersion),
+			}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": otelServiceName},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.otelTracesURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// otelTracesURL is OTelEndpoint with the /v1/traces path of OTLP/HTTP
+// unless it has a path of its own.
+func (c Config) otelTracesURL() string {
+	u, err := url.Parse(c.OTelEndpoint)
+	if err != nil || strings.Trim(u.Path, "/") != "" {
+		return c.OTelEndpoint
+	}
+	u.Path = "/v1/traces"
+	return u.String()
+}
+
+func (c Config) validateOTelEndpoint() error {
+	if c.OTelEndpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(c.OTelEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("otel_endpoint must be an http or https URL such as http://localhost:4318, got %q", c.OTelEndpoint)
+	}
+	return nil
+}
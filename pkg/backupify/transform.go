@@ -0,0 +1,65 @@
+package backupify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// transformWriter pipes a dump through Config.TransformCommand, which
+// reads the SQL on stdin and writes the rewritten SQL to stdout.
+type transformWriter struct {
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func startTransformCommand(command string, out io.Writer) (*transformWriter, error) {
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = out
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transform command stdin: %w", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transform command %s: %w", args[0], err)
+	}
+	return &transformWriter{stdin: stdin, cmd: cmd, stderr: stderr}, nil
+}
+
+func (w *transformWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Close waits for the command, which fails the dump unless it exits zero.
+func (w *transformWriter) Close() error {
+	w.stdin.Close()
+	err := w.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("transform command %s failed: %w: %s", w.cmd.Path, err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+func (c Config) validateTransformCommand() error {
+	if c.TransformCommand == "" {
+		return nil
+	}
+	if len(strings.Fields(c.TransformCommand)) == 0 {
+		return fmt.Errorf("transform_command must name a command")
+	}
+	if c.dumpTool() == DumpToolMydumper {
+		return fmt.Errorf("transform_command is not supported with mydumper")
+	}
+	if c.TabExport {
+		return fmt.Errorf("transform_command can't be used with tab_export")
+	}
+	return nil
+}
@@ -0,0 +1,529 @@
+package backupify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Destination types.
+const (
+	DestinationFTP     = "ftp"
+	DestinationSSH     = "ssh"
+	DestinationCommand = "command"
+)
+
+// Destination is a server the archive is uploaded to. Directory may contain
+// the date placeholders {year}, {month}, {day}, {hour}, {minute} and
+// {weekday}, which are filled in from the run's start time.
+type Destination struct {
+	Name string `json:"name"`
+	// Type is ftp (default), ssh or command. An ssh destination pipes the
+	// file into Command run on Host with the system ssh client, a command
+	// destination into Command run locally, e.g. to write to a tape drive.
+	Type      string `json:"type,omitempty"`
+	Host      string `json:"host"`
+	Port      int    `json:"port,omitempty"`
+	User      string `json:"user"`
+	Password  string `json:"password"`
+	Directory string `json:"directory"`
+	// SSHKeyPath is the private key used by ssh destinations.
+	SSHKeyPath string `json:"ssh_key_path,omitempty"`
+	// KnownHostsPath is the known_hosts file the host key of an ssh
+	// destination must be listed in. Unknown or changed keys fail the
+	// upload. Without it the user's known_hosts is used the same way.
+	KnownHostsPath string `json:"known_hosts_path,omitempty"`
+	// InsecureIgnoreHostKey accepts any host key. It allows
+	// man-in-the-middle attacks and is only meant for development.
+	InsecureIgnoreHostKey bool `json:"insecure_ignore_host_key,omitempty"`
+	// Command is the remote command of an ssh destination, e.g.
+	// "mysql mydb". {path} is replaced with the quoted remote file path.
+	// Defaults to "cat > {path}". For a command destination it is the local
+	// command, split on spaces, with {path} replaced by Directory/<file>.
+	Command string `json:"command,omitempty"`
+
+	// failover are the members of the FailoverDestinations group.
+	failover []Destination
+}
+
+// UploadResult is the outcome of uploading to a single destination.
+type UploadResult struct {
+	Destination string `json:"destination"`
+	RemotePath  string `json:"remote_path,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Size and SHA256 describe the uploaded file. SHA256 is only known
+	// when a .sha256 sidecar was written.
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Failover is set when Destination is the one of FailoverDestinations
+	// that took the file.
+	Failover bool `json:"failover,omitempty"`
+	// EstimatedMonthlyCost is what storing the file costs per month at the
+	// StorageCostPerGB rate of Destination.
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost,omitempty"`
+}
+
+// destinations returns the configured destinations, with the top-level FTP
+// settings acting as a destination named "default" when FTPHost is set and
+// FailoverDestinations as one named "failover".
+func (c Config) destinations() []Destination {
+	var dests []Destination
+	if c.FTPHost != "" {
+		dests = append(dests, Destination{
+			Name:      "default",
+			Host:      c.FTPHost,
+			User:      c.FTPUser,
+			Password:  c.FTPPassword,
+			Directory: c.FTPDirectory,
+		})
+	}
+	dests = append(dests, c.Destinations...)
+	if len(c.FailoverDestinations) > 0 {
+		dests = append(dests, Destination{Name: failoverDestinationName, failover: slices.Clone(c.FailoverDestinations)})
+	}
+	if c.WeekdayDirectories {
+		for i := range dests {
+			dests[i].Directory = path.Join(dests[i].Directory, weekdayDirectory)
+			for j := range dests[i].failover {
+				dests[i].failover[j].Directory = path.Join(dests[i].failover[j].Directory, weekdayDirectory)
+			}
+		}
+	}
+	return dests
+}
+
+// destinationsFor returns the destinations the backup of database goes to:
+// the one it is routed to by DatabaseDestinations, or otherwise every
+// destination that no database is routed to.
+func (c Config) destinationsFor(dests []Destination, database string) []Destination {
+	if len(c.DatabaseDestinations) == 0 {
+		return dests
+	}
+	routed, ok := c.DatabaseDestinations[database]
+	reserved := make(map[string]bool)
+	for _, name := range c.DatabaseDestinations {
+		reserved[name] = true
+	}
+	var selected []Destination
+	for _, dest := range dests {
+		if (ok && dest.Name == routed) || (!ok && !reserved[dest.Name]) {
+			selected = append(selected, dest)
+		}
+	}
+	return selected
+}
+
+// errNoDestination is returned for a database that DatabaseDestinations
+// leaves without any destination.
+var errNoDestination = errors.New("no destination for database, all of them are reserved by database_destinations")
+
+// UploadArchive uploads an existing archive, and its .sha256 file if there
+// is one, to all configured destinations without dumping anything. Date
+// placeholders in remote directories use the time in the archive name when
+// it has one.
+func UploadArchive(ctx context.Context, config Config, archivePath string) ([]UploadResult, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	_, err = os.Stat(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if config.Checksum && !config.StreamChecksum {
+		if _, err := os.Stat(archivePath + checksumSuffix); os.IsNotExist(err) {
+			_, err = writeChecksum(archivePath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	created, dests := time.Now(), config.destinations()
+	if archive, ok := parseArchiveName(filepath.Base(archivePath)); ok {
+		created = archive.Created
+		if archive.Database != "" {
+			dests = config.destinationsFor(dests, archive.Database)
+		}
+	}
+	config.logger().Printf("uploading -> %s", archivePath)
+	config.retryUpload = true
+	return uploadArchive(ctx, config, renderDestinations(dests, created), archivePath)
+}
+
+// uploadToAll uploads localFile to every destination concurrently, at most
+// config.UploadConcurrency at a time. A failing destination does not stop
+// the others. With Spool the file is moved to SpoolDir instead.
+func uploadToAll(ctx context.Context, config Config, dests []Destination, localFile string) ([]UploadResult, error) {
+	if config.Spool {
+		return spoolFile(config, localFile)
+	}
+	return forEachDestination(ctx, config, dests, localFile, func(ctx context.Context, dest Destination) (string, error) {
+		switch dest.Type {
+		case DestinationSSH:
+			return uploadToSSH(ctx, config, dest, localFile)
+		case DestinationCommand:
+			return uploadToCommand(ctx, config, dest, localFile)
+		}
+		return uploadToFTP(ctx, config, dest, localFile)
+	})
+}
+
+// forEachDestination runs upload for every destination concurrently, at most
+// config.UploadConcurrency at a time, and collects the results. Upload
+// events are reported for file. With UploadFailFast the first failure
+// cancels the uploads still running and skips the ones not started yet.
+func forEachDestination(ctx context.Context, config Config, dests []Destination, file string, upload func(context.Context, Destination) (string, error)) ([]UploadResult, error) {
+	limit := config.UploadConcurrency
+	if limit <= 0 || limit > len(dests) {
+		limit = len(dests)
+	}
+
+	var size int64
+	if info, err := os.Stat(file); err == nil {
+		size = info.Size()
+	}
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var failOnce sync.Once
+
+	results := make([]UploadResult, len(dests))
+	errs := make([]error, len(dests))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	var startedMu sync.Mutex
+	started := 0
+	for i, dest := range dests {
+		wg.Add(1)
+		go func(i int, dest Destination) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			startedMu.Lock()
+			first := started == 0
+			started++
+			startedMu.Unlock()
+			var remotePath string
+			used := dest.Name
+			err := pauseBeforeDestination(uploadCtx, config, first)
+			if err == nil {
+				config.emit(Event{Type: EventUploadStarted, File: file, Destination: dest.Name})
+				remotePath, used, err = uploadWithFailover(uploadCtx, config, dest, upload)
+			}
+			if err != nil && config.UploadFailureMode == UploadFailFast && ctx.Err() == nil {
+				first := false
+				failOnce.Do(func() {
+					first = true
+					cancel()
+				})
+				if !first {
+					err = errUploadSkipped
+				}
+			}
+			config.emit(Event{Type: EventUploadFinished, File: file, Destination: dest.Name, RemotePath: remotePath, Size: size, Error: errorString(err)})
+			results[i] = UploadResult{Destination: used, RemotePath: remotePath, Size: size, Failover: used != dest.Name}
+			if err != nil {
+				results[i].Error = err.Error()
+				errs[i] = &DestinationError{Destination: used, Err: err}
+			}
+		}(i, dest)
+	}
+	wg.Wait()
+
+	// With StreamChecksum the sidecar is only written by the uploads.
+	sum, _ := readChecksum(file + checksumSuffix)
+	for i := range results {
+		results[i].SHA256 = sum
+	}
+	verifyUploads(ctx, config, results, errs, sum)
+	return results, uploadError(config, file, errs)
+}
+
+func uploadToFTP(ctx context.Context, config Config, dest Destination, localFile string) (string, error) {
+	if info, err := os.Stat(localFile); err == nil && config.uploadParts(info.Size()) > 1 {
+		return uploadPartsToFTP(ctx, config, dest, localFile, config.uploadParts(info.Size()))
+	}
+	conn, err := dialFTP(ctx, config, dest)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Quit()
+
+	err = ensureRemoteDir(conn, dest.Directory)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	name, skip, err := remoteName(config, conn, dest.Directory, filepath.Base(localFile), info.Size())
+	if err != nil {
+		return "", err
+	}
+	if skip {
+		return path.Join(dest.Directory, name), nil
+	}
+
+	var h hash.Hash
+	if config.StreamChecksum {
+		h = sha256.New()
+	}
+	remotePath, err := storFileHashed(config, conn, dest.Directory, localFile, name, h)
+	if err != nil {
+		return "", err
+	}
+	if h != nil {
+		err = writeChecksumFile(localFile, hex.EncodeToString(h.Sum(nil)))
+		if err != nil {
+			return remotePath, err
+		}
+	}
+	sidecars, err := storSidecars(config, conn, dest.Directory, localFile, name)
+	if err != nil {
+		return remotePath, err
+	}
+	uploaded := append([]string{remotePath}, sidecars...)
+
+	if config.VerifyRemoteHash {
+		conn.Quit()
+		err = verifyRemoteHash(ctx, config, dest, remotePath, func() (io.ReadCloser, error) {
+			return os.Open(localFile)
+		})
+		if err != nil {
+			return remotePath, err
+		}
+	}
+	if config.RemoteFileMode != "" {
+		// SITE CHMOD needs a connection of its own; don't hold two slots.
+		conn.Quit()
+		chmodRemote(ctx, config, dest, uploaded)
+	}
+	return remotePath, nil
+}
+
+// streamWithSidecars ships localFile with stream, which writes input to the
+// destination as the file called name, and then, with sidecars, its .sha256
+// and .sig files. With StreamChecksum the .sha256 file is written from the
+// bytes streamed.
+func streamWithSidecars(config Config, localFile string, sidecars bool, stream func(name string, input io.Reader) (string, error)) (string, error) {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	var input io.Reader = file
+	h := sha256.New()
+	if config.StreamChecksum {
+		input = io.TeeReader(file, h)
+	}
+	remotePath, err := stream(filepath.Base(localFile), input)
+	if err != nil {
+		return remotePath, err
+	}
+	if config.StreamChecksum {
+		err = writeChecksumFile(localFile, hex.EncodeToString(h.Sum(nil)))
+		if err != nil {
+			return remotePath, err
+		}
+	}
+	if !sidecars {
+		return remotePath, nil
+	}
+	for _, sidecar := range existingSidecars(localFile) {
+		err = streamSidecar(sidecar, stream)
+		if err != nil {
+			return remotePath, err
+		}
+	}
+	return remotePath, nil
+}
+
+func streamSidecar(sidecar string, stream func(name string, input io.Reader) (string, error)) error {
+	file, err := os.Open(sidecar)
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	_, err = stream(filepath.Base(sidecar), file)
+	return err
+}
+
+// storSidecars uploads the .sha256 and .sig files of localFile, if there
+// are any, next to name in dir and returns their remote paths.
+func storSidecars(config Config, conn *ftpConn, dir, localFile, name string) ([]string, error) {
+	var uploaded []string
+	for _, sidecar := range existingSidecars(localFile) {
+		sidecarName := name + strings.TrimPrefix(sidecar, localFile)
+		sidecarPath, err := storFileHashed(config, conn, dir, sidecar, sidecarName, nil)
+		if err != nil {
+			return uploaded, fmt.Errorf("failed to upload %s: %w", filepath.Base(sidecar), err)
+		}
+		uploaded = append(uploaded, sidecarPath)
+	}
+	return uploaded, nil
+}
+
+// chmodRemote restricts the permissions of uploaded files with SITE CHMOD.
+// Servers that don't support it are skipped with a warning.
+func chmodRemote(ctx context.Context, config Config, dest Destination, files []string) {
+	control, err := dialFTPControl(ctx, config, dest)
+	if err != nil {
+		config.logger().Printf("failed to set permissions on %s: %v", dest.Name, err)
+		return
+	}
+	defer control.Close()
+
+	for _, file := range files {
+		code, msg, err := control.command("SITE CHMOD " + config.RemoteFileMode + " " + file)
+		switch {
+		case err != nil:
+			config.logger().Printf("failed to set permissions of %s on %s: %v", file, dest.Name, err)
+			return
+		case notSupported(code):
+			config.logger().Printf("%s doesn't support SITE CHMOD, leaving permissions of %s unchanged", dest.Name, file)
+			return
+		case code/100 != 2:
+			config.logger().Printf("failed to set permissions of %s on %s: %d %s", file, dest.Name, code, msg)
+		}
+	}
+}
+
+// dialFTP connects and logs in to dest.
+func dialFTP(ctx context.Context, config Config, dest Destination) (*ftpConn, error) {
+	release, err := acquireFTPSlot(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := loginFTP(ctx, config, dest)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &ftpConn{ServerConn: conn, release: release}, nil
+}
+
+func loginFTP(ctx context.Context, config Config, dest Destination) (*ftp.ServerConn, error) {
+	options := []ftp.DialOption{ftp.DialWithContext(ctx)}
+	if config.ProxyURL != "" || config.FTPKeepAliveSeconds > 0 {
+		dial, err := ftpDialFunc(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		if config.FTPKeepAliveSeconds > 0 {
+			dial = withKeepAlive(dial, time.Duration(config.FTPKeepAliveSeconds)*time.Second)
+		}
+		options = append(options, ftp.DialWithDialFunc(dial))
+	}
+	conn, err := ftp.Dial(dest.Host, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ftp server: %w", err)
+	}
+
+	err = conn.Login(dest.User, dest.Password)
+	if err != nil {
+		conn.Quit()
+		return nil, fmt.Errorf("failed to auth on ftp server: %w", err)
+	}
+	return conn, nil
+}
+
+const uploadTempSuffix = ".tmp"
+
+// storFile uploads localFile into the remote directory dir, creating it if
+// needed, and returns the remote path. The file is written under a .tmp
+// name and only renamed to its final name once the whole transfer succeeded
+// and the remote size matches, so consumers never see a partial file.
+// Servers that can't rename get the file stored under its final name
+// directly.
+func storFile(config Config, conn *ftpConn, dir string, localFile string) (string, error) {
+	return storFileHashed(config, conn, dir, localFile, filepath.Base(localFile), nil)
+}
+
+// storFileHashed is storFile that uploads under name and also feeds the
+// uploaded bytes to h, when not nil, so the file doesn't have to be read
+// again to checksum it.
+func storFileHashed(config Config, conn *ftpConn, dir string, localFile string, name string, h hash.Hash) (string, error) {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+
+	err = ensureRemoteDir(conn, dir)
+	if err != nil {
+		return "", err
+	}
+	return storSized(config, conn, dir, name, info.Size(), func() (io.Reader, error) {
+		_, err := file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind local file: %w", err)
+		}
+		if h == nil {
+			return file, nil
+		}
+		h.Reset()
+		return io.TeeReader(file, h), nil
+	})
+}
+
+// storSized uploads the size bytes input returns under name in dir the way
+// storFile does. input is called again when the file has to be uploaded a
+// second time under its final name.
+func storSized(config Config, conn *ftpConn, dir, name string, size int64, input func() (io.Reader, error)) (string, error) {
+	remotePath := path.Join(dir, name)
+	tmpPath := remotePath + uploadTempSuffix
+	r, err := input()
+	if err != nil {
+		return "", err
+	}
+	err = conn.Stor(tmpPath, r)
+	if err != nil {
+		conn.Delete(tmpPath)
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	remoteSize, err := conn.FileSize(tmpPath)
+	if err == nil && remoteSize != size {
+		conn.Delete(tmpPath)
+		return "", fmt.Errorf("uploaded %s has %d bytes, expected %d", tmpPath, remoteSize, size)
+	}
+	if err != nil {
+		config.logger().Printf("can't check size of uploaded %s: %v", tmpPath, err)
+	}
+
+	err = conn.Rename(tmpPath, remotePath)
+	if err == nil {
+		return remotePath, nil
+	}
+	config.logger().Printf("failed to rename %s, uploading under the final name instead: %v", tmpPath, err)
+	conn.Delete(tmpPath)
+	r, err = input()
+	if err != nil {
+		return "", err
+	}
+	err = conn.Stor(remotePath, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	return remotePath, nil
+}
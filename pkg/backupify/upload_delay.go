@@ -0,0 +1,29 @@
+package backupify
+
+import (
+	"context"
+	"time"
+)
+
+// pauseBeforeDestination waits InterDestinationDelaySeconds before the
+// upload to every destination but the first. Validate makes sure
+// destinations are uploaded to one at a time then. It returns ctx's error
+// once the uploads are cancelled.
+func pauseBeforeDestination(ctx context.Context, config Config, first bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if first || config.InterDestinationDelaySeconds <= 0 {
+		return nil
+	}
+	delay := time.Duration(config.InterDestinationDelaySeconds * float64(time.Second))
+	config.logger().Printf("pausing %s before the next destination", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,46 @@
+package backupify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Supported values of Config.UploadFailureMode.
+const (
+	UploadFailFast   = "fail-fast"
+	UploadBestEffort = "best-effort"
+)
+
+// errUploadSkipped is the error of uploads that were not attempted, or were
+// cancelled, because another destination failed first with UploadFailFast.
+var errUploadSkipped = errors.New("skipped after another destination failed")
+
+func (c Config) validateUploadFailureMode() error {
+	switch c.UploadFailureMode {
+	case "", UploadFailFast:
+	case UploadBestEffort:
+		if c.AllOrNothing {
+			return fmt.Errorf("upload_failure_mode best-effort can't be used with all_or_nothing")
+		}
+	default:
+		return fmt.Errorf("upload_failure_mode must be fail-fast or best-effort, got %q", c.UploadFailureMode)
+	}
+	return nil
+}
+
+// uploadError joins the errors of the uploads of file to each destination.
+// With UploadBestEffort, failures are only logged as long as one
+// destination got the file.
+func uploadError(config Config, file string, errs []error) error {
+	err := errors.Join(errs...)
+	if err == nil || config.UploadFailureMode != UploadBestEffort {
+		return err
+	}
+	for _, e := range errs {
+		if e == nil {
+			config.logger().Printf("upload of %s failed for some destinations, continuing: %v", file, err)
+			return nil
+		}
+	}
+	return err
+}
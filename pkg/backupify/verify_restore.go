@@ -0,0 +1,99 @@
+package backupify
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// verifyRestore restores dumpFiles in order into a scratch database, checks
+// that it ends up with as many tables as the source database and drops it
+// again. It needs the CREATE and DROP privileges.
+func verifyRestore(ctx context.Context, config Config, database, timestamp string, dumpFiles ...string) error {
+	scratch := fmt.Sprintf("verify_%s_%s", database, timestamp)
+	if len(scratch) > 64 {
+		scratch = scratch[:64]
+	}
+
+	_, err := queryMySQL(ctx, config, "CREATE DATABASE "+quoteIdentifier(scratch))
+	if err != nil {
+		return fmt.Errorf("failed to create scratch database: %w", err)
+	}
+	defer func() {
+		_, err := queryMySQL(context.WithoutCancel(ctx), config, "DROP DATABASE "+quoteIdentifier(scratch))
+		if err != nil {
+			config.logger().Printf("failed to drop scratch database %s: %v", scratch, err)
+		}
+	}()
+
+	for _, dumpFile := range dumpFiles {
+		err = restoreFile(ctx, config, scratch, dumpFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	want, err := countTables(ctx, config, database)
+	if err != nil {
+		return err
+	}
+	got, err := countTables(ctx, config, scratch)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("restored %s tables, expected %s", got, want)
+	}
+	return nil
+}
+
+// restoreFile feeds a .sql or .sql.gz dump into database with the mysql
+// client.
+func restoreFile(ctx context.Context, config Config, database, dumpFile string) error {
+	file, err := os.Open(dumpFile)
+	if err != nil {
+		return fmt.Errorf("failed to open dump: %w", err)
+	}
+	defer file.Close()
+
+	var input io.Reader = file
+	if strings.HasSuffix(dumpFile, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read compressed dump: %w", err)
+		}
+		defer gzReader.Close()
+		input = gzReader
+	}
+	return restoreStream(ctx, config, database, input)
+}
+
+// restoreStream feeds an uncompressed dump read from input into database
+// with the mysql client, or into no particular database when it is empty.
+func restoreStream(ctx context.Context, config Config, database string, input io.Reader) error {
+	var args []string
+	if database != "" {
+		args = append(args, database)
+	}
+	cmd := mysqlCommand(ctx, config, args...)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restore dump: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func countTables(ctx context.Context, config Config, database string) (string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = "+quoteString(database))
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return "", fmt.Errorf("no result counting tables of %s", database)
+	}
+	return rows[0][0], nil
+}
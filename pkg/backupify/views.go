@@ -0,0 +1,55 @@
+package backupify
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const viewsSuffix = ".views"
+
+// listViews returns the views of database.
+func listViews(ctx context.Context, config Config, database string) ([]string, error) {
+	rows, err := queryMySQL(ctx, config, "SELECT table_name FROM information_schema.tables WHERE table_type = 'VIEW' AND table_schema = "+quoteString(database))
+	if err != nil {
+		return nil, err
+	}
+	views := make([]string, len(rows))
+	for i, row := range rows {
+		views[i] = row[0]
+	}
+	return views, nil
+}
+
+// ignoreTableArgs returns the --ignore-table options that leave tables
+// (views or tables matching ExcludeTablePatterns) out of the dump of
+// database.
+func ignoreTableArgs(database string, tables []string) []string {
+	args := make([]string, len(tables))
+	for i, table := range tables {
+		args[i] = "--ignore-table=" + database + "." + table
+	}
+	return args
+}
+
+// viewsFile returns the name of the views dump that goes with backupFile,
+// e.g. shop.views.sql for shop.sql.
+func viewsFile(backupFile string) string {
+	dir, name := filepath.Split(backupFile)
+	i := strings.LastIndex(name, ".sql")
+	return dir + name[:i] + viewsSuffix + name[i:]
+}
+
+func isViewsDump(name string) bool {
+	return strings.Contains(name, viewsSuffix+".sql")
+}
+
+// sortViewsLast moves the views dumps behind every other entry, so that
+// restoring the archive in order creates all base tables, including those
+// of other databases, before the views that select from them.
+func sortViewsLast(entries []archiveEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return !isViewsDump(entries[i].name) && isViewsDump(entries[j].name)
+	})
+}
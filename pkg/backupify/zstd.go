@@ -0,0 +1,256 @@
+package backupify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported values of Config.Compression.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+func (c Config) compression() string {
+	if c.Compression == "" {
+		return CompressionGzip
+	}
+	return c.Compression
+}
+
+// compressionSuffix is the file name suffix of the built-in compressor or
+// of CompressCommand.
+func (c Config) compressionSuffix() string {
+	if c.CompressCommand != "" {
+		if c.CompressSuffix != "" {
+			return c.CompressSuffix
+		}
+		return ".gz"
+	}
+	switch c.compression() {
+	case CompressionZstd:
+		return ".zst"
+	case CompressionBrotli:
+		return ".br"
+	case compressionNone:
+		return ""
+	}
+	return ".gz"
+}
+
+func loadDictionary(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zstd dictionary: %w", err)
+	}
+	return data, nil
+}
+
+// keptDictionaryPattern matches the suffix train-dict adds to the previous
+// dictionary when it writes a new one.
+var keptDictionaryPattern = regexp.MustCompile(`^\.\d{8}_\d{6}$`)
+
+// loadDictionaries reads the dictionary at path and the ones kept next to
+// it by retraining, as <path>.<timestamp>. The decoder picks the one an
+// archive was written with by its ID.
+func loadDictionaries(path string) ([][]byte, error) {
+	dictionary, err := loadDictionary(path)
+	if dictionary == nil {
+		return nil, err
+	}
+	dictionaries := [][]byte{dictionary}
+	kept, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kept zstd dictionaries: %w", err)
+	}
+	for _, name := range kept {
+		if !keptDictionaryPattern.MatchString(strings.TrimPrefix(name, path)) {
+			continue
+		}
+		dictionary, err := loadDictionary(name)
+		if err != nil {
+			return nil, err
+		}
+		dictionaries = append(dictionaries, dictionary)
+	}
+	return dictionaries, nil
+}
+
+// newZstdWriter compresses into out with zstd, using the dictionary at
+// ZstdDictionaryPath if set.
+func newZstdWriter(config Config, out io.Writer) (io.WriteCloser, error) {
+	var options []zstd.EOption
+	dictionary, err := loadDictionary(config.ZstdDictionaryPath)
+	if err != nil {
+		return nil, err
+	}
+	if dictionary != nil {
+		options = append(options, zstd.WithEncoderDict(dictionary))
+	}
+	if level := config.compressionLevel(); level > 0 {
+		options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	encoder, err := zstd.NewWriter(out, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd compressor: %w", err)
+	}
+	return encoder, nil
+}
+
+// zstdReader adapts zstd.Decoder, whose Close returns nothing, to
+// io.ReadCloser.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// decompressArchive returns a reader of the tar stream in r, which is read
+// from archivePath. .zst archives are decompressed with zstd and the
+// dictionary at dictionaryPath, if any, or one kept by retraining it; .br
+// archives with brotli, .tar archives are read as they are and everything
+// else with gzip.
+func decompressArchive(r io.Reader, archivePath, dictionaryPath string) (io.ReadCloser, error) {
+	if isEncryptedArchive(archivePath) {
+		return nil, fmt.Errorf("%s is encrypted, decrypt it first", archivePath)
+	}
+	if strings.HasSuffix(archivePath, ".tar") {
+		return io.NopCloser(r), nil
+	}
+	if strings.HasSuffix(archivePath, ".br") {
+		return newBrotliReader(r), nil
+	}
+	if !strings.HasSuffix(archivePath, ".zst") {
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return gzReader, nil
+	}
+
+	var options []zstd.DOption
+	dictionaries, err := loadDictionaries(dictionaryPath)
+	if err != nil {
+		return nil, err
+	}
+	if dictionaries != nil {
+		options = append(options, zstd.WithDecoderDicts(dictionaries...))
+	}
+	decoder, err := zstd.NewReader(r, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return zstdReader{decoder}, nil
+}
+
+// TrainZstdDictionary builds a zstd dictionary of at most maxSize bytes from
+// sample files, such as dumps of a few typical databases.
+func TrainZstdDictionary(samples []string, maxSize int) ([]byte, error) {
+	var input [][]byte
+	for _, sample := range samples {
+		data, err := os.ReadFile(sample)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sample: %w", err)
+		}
+		input = append(input, data)
+	}
+	return buildZstdDictionary(input, maxSize)
+}
+
+// dictionarySampleSize is how much of each dump in an archive is used to
+// train a dictionary. The start, with the table definitions and the first
+// rows, is what similar databases share.
+const dictionarySampleSize = 1 << 20
+
+// TrainZstdDictionaryFromArchives builds a dictionary like
+// TrainZstdDictionary from the dumps in the n newest archives in
+// BackupDirectory, so it can be retrained as the schemas change. Archives
+// that can't be read, such as encrypted ones, are skipped.
+func TrainZstdDictionaryFromArchives(config Config, n, maxSize int) ([]byte, error) {
+	archives, err := ListLocalArchives(config.BackupDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if len(archives) > n {
+		archives = archives[len(archives)-n:]
+	}
+	var input [][]byte
+	for _, archive := range archives {
+		samples, err := archiveSamples(filepath.Join(config.BackupDirectory, archive.Name), config.ZstdDictionaryPath)
+		if err != nil {
+			config.logger().Printf("skipping %s: %v", archive.Name, err)
+			continue
+		}
+		config.logger().Printf("sampled %d dumps from %s", len(samples), archive.Name)
+		input = append(input, samples...)
+	}
+	if len(input) == 0 {
+		return nil, fmt.Errorf("no dumps to sample in the archives of %s", config.BackupDirectory)
+	}
+	return buildZstdDictionary(input, maxSize)
+}
+
+// archiveSamples returns the first dictionarySampleSize bytes of every .sql
+// file in the archive at archivePath.
+func archiveSamples(archivePath, dictionaryPath string) ([][]byte, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+	tarStream, err := decompressArchive(file, archivePath, dictionaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer tarStream.Close()
+
+	var samples [][]byte
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !strings.HasSuffix(header.Name, ".sql") {
+			continue
+		}
+		sample, err := io.ReadAll(io.LimitReader(tarReader, dictionarySampleSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+}
+
+// buildZstdDictionary trains the dictionary. The builder panics on samples
+// with too little in common, which is reported as an error instead.
+func buildZstdDictionary(input [][]byte, maxSize int) (dictionary []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			dictionary, err = nil, fmt.Errorf("failed to build dictionary, the samples may be too small or too different: %v", r)
+		}
+	}()
+	dictionary, err = dict.BuildZstdDict(input, dict.Options{MaxDictSize: maxSize, HashBytes: 6})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dictionary: %w", err)
+	}
+	return dictionary, nil
+}